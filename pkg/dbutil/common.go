@@ -73,6 +73,16 @@ type DBConfig struct {
 	Schema string `toml:"schema" json:"schema"`
 
 	Snapshot string `toml:"snapshot" json:"snapshot"`
+
+	// TLSName is the name of the TLS config registered by mysql.RegisterTLSConfig,
+	// the connection isn't encrypted if it's empty.
+	TLSName string `toml:"-" json:"-"`
+
+	// Net is the network registered by RegisterDialer to connect to the host, it's tcp if it's empty.
+	Net string `toml:"-" json:"-"`
+
+	// ReadOnly makes the sessions read-only, and the statements modifying the data are refused by the driver.
+	ReadOnly bool `toml:"-" json:"-"`
 }
 
 // String returns native format of database configuration
@@ -111,12 +121,27 @@ func GetDBConfigFromEnv(schema string) DBConfig {
 
 // OpenDB opens a mysql connection FD
 func OpenDB(cfg DBConfig, vars map[string]string) (*sql.DB, error) {
+	network := cfg.Net
+	if len(network) == 0 {
+		network = "tcp"
+	}
 	var dbDSN string
 	if len(cfg.Snapshot) != 0 {
 		log.Info("create connection with snapshot", zap.String("snapshot", cfg.Snapshot))
-		dbDSN = fmt.Sprintf("%s:%s@tcp(%s:%d)/?charset=utf8mb4&tidb_snapshot=%s", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Snapshot)
+		dbDSN = fmt.Sprintf("%s:%s@%s(%s)/?charset=utf8mb4&tidb_snapshot=%s", cfg.User, cfg.Password, network, HostPort(cfg.Host, cfg.Port), cfg.Snapshot)
 	} else {
-		dbDSN = fmt.Sprintf("%s:%s@tcp(%s:%d)/?charset=utf8mb4", cfg.User, cfg.Password, cfg.Host, cfg.Port)
+		dbDSN = fmt.Sprintf("%s:%s@%s(%s)/?charset=utf8mb4", cfg.User, cfg.Password, network, HostPort(cfg.Host, cfg.Port))
+	}
+
+	if len(cfg.TLSName) != 0 {
+		dbDSN += "&tls=" + url.QueryEscape(cfg.TLSName)
+	}
+
+	driverName := "mysql"
+	if cfg.ReadOnly {
+		// the statements are checked by the driver instead of `transaction_read_only`, which is refused by TiDB
+		// unless tidb_enable_noop_functions is on, and doesn't exist before MySQL 5.7.20.
+		driverName = ReadOnlyDriverName
 	}
 
 	for key, val := range vars {
@@ -124,7 +149,7 @@ func OpenDB(cfg DBConfig, vars map[string]string) (*sql.DB, error) {
 		dbDSN += fmt.Sprintf("&%s=%%27%s%%27", key, url.QueryEscape(val))
 	}
 
-	dbConn, err := sql.Open("mysql", dbDSN)
+	dbConn, err := sql.Open(driverName, dbDSN)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -0,0 +1,155 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// the policies to select the address to connect to when the host resolves to several addresses.
+const (
+	// AddressSelectionOrdered tries the addresses in the order returned by the resolver.
+	AddressSelectionOrdered = "ordered"
+	// AddressSelectionRandom tries the addresses in a random order, which spreads the connections.
+	AddressSelectionRandom = "random"
+	// AddressSelectionPreferIPv4 tries the IPv4 addresses before the IPv6 ones.
+	AddressSelectionPreferIPv4 = "prefer-ipv4"
+	// AddressSelectionPreferIPv6 tries the IPv6 addresses before the IPv4 ones.
+	AddressSelectionPreferIPv6 = "prefer-ipv6"
+)
+
+// DefaultDialTimeout is the default timeout to connect to one address.
+const DefaultDialTimeout = 5 * time.Second
+
+// HostPort returns the address of the host and the port, the IPv6 host is enclosed in brackets, e.g. [::1]:4000.
+func HostPort(host string, port int) string {
+	return net.JoinHostPort(TrimIPv6Brackets(host), strconv.Itoa(port))
+}
+
+// TrimIPv6Brackets removes the brackets around the IPv6 literal, e.g. [::1] is returned as ::1.
+func TrimIPv6Brackets(host string) string {
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host[1 : len(host)-1]
+	}
+	return host
+}
+
+// CheckAddressSelection checks the policy to select the address, empty means AddressSelectionOrdered.
+func CheckAddressSelection(selection string) error {
+	switch selection {
+	case "", AddressSelectionOrdered, AddressSelectionRandom, AddressSelectionPreferIPv4, AddressSelectionPreferIPv6:
+		return nil
+	default:
+		return errors.Errorf("invalid address selection %s, it must be %s, %s, %s or %s", selection,
+			AddressSelectionOrdered, AddressSelectionRandom, AddressSelectionPreferIPv4, AddressSelectionPreferIPv6)
+	}
+}
+
+// DialPolicy is how to connect to a host resolving to several addresses.
+type DialPolicy struct {
+	// Selection is the order to try the addresses, empty means AddressSelectionOrdered.
+	Selection string
+	// Retry is how many more rounds all the addresses are tried after all of them failed.
+	Retry int
+	// Timeout is the timeout to connect to one address, 0 means DefaultDialTimeout.
+	Timeout time.Duration
+}
+
+// RegisterDialer registers the dialer of the policy as the network of the mysql driver,
+// the DSN with `name(host:port)` connects by it.
+func RegisterDialer(name string, policy DialPolicy) error {
+	if err := CheckAddressSelection(policy.Selection); err != nil {
+		return errors.Trace(err)
+	}
+	if policy.Retry < 0 {
+		return errors.Errorf("the retry of the dialer must not be less than 0")
+	}
+	mysql.RegisterDialContext(name, policy.DialContext)
+	return nil
+}
+
+// DialContext connects to the address, the addresses resolved from its host are tried in the order of
+// the selection, until one of them is connected.
+func (p DialPolicy) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDialTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var lastErr error
+	for i := 0; i <= p.Retry; i++ {
+		if i > 0 {
+			log.Warn("fail to connect to all the addresses, retry", zap.String("address", addr), zap.Int("retry", i), zap.Error(lastErr))
+		}
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		for _, ip := range p.sortAddresses(ips) {
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				return nil, errors.Trace(lastErr)
+			}
+		}
+	}
+	return nil, errors.Annotatef(lastErr, "fail to connect to %s", addr)
+}
+
+// sortAddresses returns the addresses in the order to try.
+func (p DialPolicy) sortAddresses(ips []net.IPAddr) []net.IPAddr {
+	sorted := make([]net.IPAddr, 0, len(ips))
+	switch p.Selection {
+	case AddressSelectionRandom:
+		for _, i := range rand.Perm(len(ips)) {
+			sorted = append(sorted, ips[i])
+		}
+	case AddressSelectionPreferIPv4, AddressSelectionPreferIPv6:
+		preferIPv4 := p.Selection == AddressSelectionPreferIPv4
+		others := make([]net.IPAddr, 0, len(ips))
+		for _, ip := range ips {
+			if (ip.IP.To4() != nil) == preferIPv4 {
+				sorted = append(sorted, ip)
+			} else {
+				others = append(others, ip)
+			}
+		}
+		sorted = append(sorted, others...)
+	default:
+		sorted = append(sorted, ips...)
+	}
+	return sorted
+}
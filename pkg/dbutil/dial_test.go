@@ -0,0 +1,65 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"net"
+
+	. "github.com/pingcap/check"
+)
+
+func (*testDBSuite) TestHostPort(c *C) {
+	c.Assert(HostPort("127.0.0.1", 4000), Equals, "127.0.0.1:4000")
+	c.Assert(HostPort("::1", 4000), Equals, "[::1]:4000")
+	c.Assert(HostPort("[::1]", 4000), Equals, "[::1]:4000")
+	c.Assert(HostPort("tidb.local", 4000), Equals, "tidb.local:4000")
+}
+
+func (*testDBSuite) TestSortAddresses(c *C) {
+	ips := []net.IPAddr{
+		{IP: net.ParseIP("::1")},
+		{IP: net.ParseIP("127.0.0.1")},
+		{IP: net.ParseIP("fe80::1")},
+		{IP: net.ParseIP("10.0.0.1")},
+	}
+	toStrings := func(ips []net.IPAddr) []string {
+		s := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			s = append(s, ip.String())
+		}
+		return s
+	}
+
+	c.Assert(toStrings(DialPolicy{}.sortAddresses(ips)), DeepEquals, []string{"::1", "127.0.0.1", "fe80::1", "10.0.0.1"})
+	c.Assert(toStrings(DialPolicy{Selection: AddressSelectionPreferIPv4}.sortAddresses(ips)), DeepEquals, []string{"127.0.0.1", "10.0.0.1", "::1", "fe80::1"})
+	c.Assert(toStrings(DialPolicy{Selection: AddressSelectionPreferIPv6}.sortAddresses(ips)), DeepEquals, []string{"::1", "fe80::1", "127.0.0.1", "10.0.0.1"})
+	c.Assert(DialPolicy{Selection: AddressSelectionRandom}.sortAddresses(ips), HasLen, len(ips))
+
+	c.Assert(CheckAddressSelection(""), IsNil)
+	c.Assert(CheckAddressSelection("nearest"), NotNil)
+	c.Assert(RegisterDialer("test_invalid", DialPolicy{Retry: -1}), NotNil)
+}
+
+func (*testDBSuite) TestDialContext(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	c.Assert(err, IsNil)
+
+	conn, err := DialPolicy{Retry: 1}.DialContext(context.Background(), net.JoinHostPort("localhost", port))
+	c.Assert(err, IsNil)
+	conn.Close()
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb/parser/model"
+	tmysql "github.com/pingcap/tidb/parser/mysql"
 )
 
 // IndexInfo contains information of table index.
@@ -193,3 +194,33 @@ func SelectUniqueOrderKey(tbInfo *model.TableInfo) ([]string, []*model.ColumnInf
 
 	return keys, keyCols
 }
+
+// SelectRowIdentityKey returns the columns identifying the rows of the table.
+// Unlike SelectUniqueOrderKey, the first unique key whose columns are all NOT NULL is preferred to a nullable one
+// if there is no primary key, because it identifies the rows as well as the primary key.
+func SelectRowIdentityKey(tbInfo *model.TableInfo) ([]string, []*model.ColumnInfo) {
+	for _, index := range tbInfo.Indices {
+		if index.Primary {
+			return SelectUniqueOrderKey(tbInfo)
+		}
+	}
+	for _, index := range tbInfo.Indices {
+		if !index.Unique {
+			continue
+		}
+		keys := make([]string, 0, len(index.Columns))
+		keyCols := make([]*model.ColumnInfo, 0, len(index.Columns))
+		for _, indexCol := range index.Columns {
+			col := tbInfo.Columns[indexCol.Offset]
+			if !tmysql.HasNotNullFlag(col.Flag) {
+				break
+			}
+			keys = append(keys, indexCol.Name.O)
+			keyCols = append(keyCols, col)
+		}
+		if len(keys) == len(index.Columns) {
+			return keys, keyCols
+		}
+	}
+	return SelectUniqueOrderKey(tbInfo)
+}
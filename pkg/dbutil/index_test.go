@@ -96,3 +96,45 @@ func (*testDBSuite) TestIndex(c *C) {
 		}
 	}
 }
+
+func (*testDBSuite) TestSelectUniqueOrderKey(c *C) {
+	testCases := []struct {
+		sql          string
+		orderKeys    []string
+		identityKeys []string
+	}{
+		{
+			"CREATE TABLE t (a int, b int NOT NULL, c int, PRIMARY KEY (c), UNIQUE KEY b(b))",
+			[]string{"c"},
+			[]string{"c"},
+		}, {
+			"CREATE TABLE t (a int, b int NOT NULL, c int NOT NULL, UNIQUE KEY a(a), UNIQUE KEY bc(b, c))",
+			[]string{"b", "c"},
+			[]string{"b", "c"},
+		}, {
+			// the last unique key is used to order the rows, and the NOT NULL one identifies the rows.
+			"CREATE TABLE t (a int, b int NOT NULL, c int, UNIQUE KEY b(b), UNIQUE KEY bc(b, c))",
+			[]string{"b", "c"},
+			[]string{"b"},
+		}, {
+			"CREATE TABLE t (a int, b int, c int NOT NULL, UNIQUE KEY a(a), UNIQUE KEY bc(b, c))",
+			[]string{"b", "c"},
+			[]string{"b", "c"},
+		}, {
+			"CREATE TABLE t (a int, b int, KEY a(a))",
+			[]string{"a", "b"},
+			[]string{"a", "b"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		tableInfo, err := GetTableInfoBySQL(testCase.sql, parser.New())
+		c.Assert(err, IsNil)
+		keys, keyCols := SelectUniqueOrderKey(tableInfo)
+		c.Assert(keys, DeepEquals, testCase.orderKeys)
+		c.Assert(keyCols, HasLen, len(testCase.orderKeys))
+		keys, keyCols = SelectRowIdentityKey(tableInfo)
+		c.Assert(keys, DeepEquals, testCase.identityKeys)
+		c.Assert(keyCols, HasLen, len(testCase.identityKeys))
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// KillableRows is the result of QueryContextWithKill.
+// It must be closed to release the dedicated connection the query runs on.
+type KillableRows struct {
+	*sql.Rows
+
+	closeOnce sync.Once
+	release   func()
+}
+
+// Close closes the rows, stops watching the context and releases the connection.
+func (r *KillableRows) Close() error {
+	err := r.Rows.Close()
+	r.closeOnce.Do(r.release)
+	return errors.Trace(err)
+}
+
+// QueryContextWithKill executes the query on a dedicated connection of db.
+// The connection id is recorded before the query starts, and once ctx is
+// cancelled or timed out before the rows are closed, `KILL QUERY` is issued
+// through another connection of db, so the statement is stopped on the server
+// instead of running to completion in the background.
+func QueryContextWithKill(ctx context.Context, db *sql.DB, query string, args ...interface{}) (*KillableRows, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	connID, isTiDB, err := getConnectionID(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Trace(err)
+	}
+
+	doneCh := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			if err := KillQuery(db, connID, isTiDB); err != nil {
+				log.Warn("kill query failed", zap.Int64("connection id", connID), zap.Error(err))
+			}
+		case <-doneCh:
+		}
+	}()
+	release := func() {
+		if ctx.Err() != nil {
+			// the statement may still be running on the server,
+			// so wait for the watcher to kill it.
+			wg.Wait()
+		}
+		close(doneCh)
+		wg.Wait()
+		conn.Close()
+	}
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		release()
+		return nil, errors.Trace(err)
+	}
+	return &KillableRows{
+		Rows:    rows,
+		release: release,
+	}, nil
+}
+
+// KillQuery kills the statement running on the connection `connID`.
+// TiDB only accepts `KILL TIDB QUERY` unless `compatible-kill-query` is enabled.
+func KillQuery(db *sql.DB, connID int64, isTiDB bool) error {
+	// the caller's context is already done, so use a fresh one.
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	query := fmt.Sprintf("KILL QUERY %d", connID)
+	if isTiDB {
+		query = fmt.Sprintf("KILL TIDB QUERY %d", connID)
+	}
+	log.Info("kill query", zap.String("sql", query))
+	_, err := db.ExecContext(ctx, query)
+	return errors.Trace(err)
+}
+
+// getConnectionID returns the connection id of conn and whether the server is TiDB.
+func getConnectionID(ctx context.Context, conn *sql.Conn) (int64, bool, error) {
+	var (
+		connID  int64
+		version string
+	)
+	err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID(), VERSION()").Scan(&connID, &version)
+	if err != nil {
+		return 0, false, errors.Trace(err)
+	}
+	return connID, strings.Contains(strings.ToLower(version), "tidb"), nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (*testDBSuite) TestQueryContextWithKill(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	// the query finishes normally, no KILL is issued.
+	mock.ExpectQuery("SELECT CONNECTION_ID\\(\\), VERSION\\(\\)").WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(7, "5.7.25-TiDB-v5.3.0"))
+	mock.ExpectQuery("SELECT a FROM t").WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+	rows, err := QueryContextWithKill(context.Background(), db, "SELECT a FROM t")
+	c.Assert(err, IsNil)
+	c.Assert(rows.Next(), IsTrue)
+	c.Assert(rows.Close(), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the context is canceled before the rows are closed.
+	ctx, cancel := context.WithCancel(context.Background())
+	mock.ExpectQuery("SELECT CONNECTION_ID\\(\\), VERSION\\(\\)").WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(8, "5.7.21"))
+	mock.ExpectQuery("SELECT a FROM t").WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+	mock.ExpectExec("KILL QUERY 8").WillReturnResult(sqlmock.NewResult(0, 0))
+	rows, err = QueryContextWithKill(ctx, db, "SELECT a FROM t")
+	c.Assert(err, IsNil)
+	cancel()
+	rows.Close()
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"unicode"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+)
+
+// ReadOnlyDriverName is the name of the mysql driver which refuses the statements modifying the data,
+// it's used by OpenDB if DBConfig.ReadOnly is set.
+const ReadOnlyDriverName = "mysql_readonly"
+
+func init() {
+	sql.Register(ReadOnlyDriverName, &readOnlyDriver{})
+}
+
+// IsReadOnlyStatement returns true if the statement doesn't modify the data or the global settings,
+// e.g. SELECT, SHOW, EXPLAIN and SET of the session variables.
+func IsReadOnlyStatement(query string) bool {
+	keyword, rest := nextKeyword(query)
+	switch keyword {
+	case "SELECT":
+		upper := strings.ToUpper(rest)
+		// the files are written on the server.
+		return !strings.Contains(upper, "INTO OUTFILE") && !strings.Contains(upper, "INTO DUMPFILE")
+	case "SHOW", "BEGIN", "COMMIT", "ROLLBACK":
+		return true
+	case "START":
+		// START SLAVE, START REPLICA and START GROUP_REPLICATION change the state of the server.
+		next, _ := nextKeyword(rest)
+		return next == "TRANSACTION"
+	case "EXPLAIN", "DESC", "DESCRIBE":
+		// EXPLAIN ANALYZE executes the statement.
+		if next, analyzed := nextKeyword(rest); next == "ANALYZE" {
+			return IsReadOnlyStatement(analyzed)
+		}
+		return true
+	case "SET":
+		upper := strings.ToUpper(rest)
+		next, _ := nextKeyword(rest)
+		return next != "GLOBAL" && next != "PERSIST" && next != "PERSIST_ONLY" && next != "PASSWORD" &&
+			!strings.Contains(upper, "@@GLOBAL.") && !strings.Contains(upper, "@@PERSIST")
+	default:
+		return false
+	}
+}
+
+// nextKeyword returns the first keyword of the statement in upper case and the rest of the statement,
+// the leading spaces, comments and parentheses are skipped.
+func nextKeyword(query string) (string, string) {
+	for {
+		query = strings.TrimLeftFunc(query, func(r rune) bool { return unicode.IsSpace(r) || r == '(' })
+		switch {
+		case strings.HasPrefix(query, "/*") && !strings.HasPrefix(query, "/*!"):
+			// the executable comments of MySQL are not skipped, so they are refused.
+			end := strings.Index(query, "*/")
+			if end < 0 {
+				return "", ""
+			}
+			query = query[end+2:]
+		case strings.HasPrefix(query, "#") || strings.HasPrefix(query, "-- "):
+			end := strings.IndexByte(query, '\n')
+			if end < 0 {
+				return "", ""
+			}
+			query = query[end+1:]
+		default:
+			end := strings.IndexFunc(query, func(r rune) bool { return !unicode.IsLetter(r) && r != '_' })
+			if end < 0 {
+				end = len(query)
+			}
+			return strings.ToUpper(query[:end]), query[end:]
+		}
+	}
+}
+
+func checkReadOnlyStatement(query string) error {
+	if IsReadOnlyStatement(query) {
+		return nil
+	}
+	keyword, _ := nextKeyword(query)
+	// the statement isn't in the error, since it may contain the data.
+	return errors.Errorf("the %s statement is refused on the read-only connection", keyword)
+}
+
+// readOnlyDriver wraps the mysql driver to refuse the statements modifying the data on its connections.
+// The mysql driver isn't embedded, otherwise its connector opens the connections without the wrapper.
+type readOnlyDriver struct {
+	base mysql.MySQLDriver
+}
+
+func (d *readOnlyDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.base.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyConn{Conn: conn}, nil
+}
+
+type readOnlyConn struct {
+	driver.Conn
+}
+
+func (c *readOnlyConn) Prepare(query string) (driver.Stmt, error) {
+	if err := checkReadOnlyStatement(query); err != nil {
+		return nil, err
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *readOnlyConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := checkReadOnlyStatement(query); err != nil {
+		return nil, err
+	}
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *readOnlyConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *readOnlyConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := checkReadOnlyStatement(query); err != nil {
+		return nil, err
+	}
+	if queryer, ok := c.Conn.(driver.QueryerContext); ok {
+		return queryer.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *readOnlyConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := checkReadOnlyStatement(query); err != nil {
+		return nil, err
+	}
+	if execer, ok := c.Conn.(driver.ExecerContext); ok {
+		return execer.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *readOnlyConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *readOnlyConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *readOnlyConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *readOnlyConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
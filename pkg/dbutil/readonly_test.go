@@ -0,0 +1,79 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+
+	. "github.com/pingcap/check"
+)
+
+func (*testDBSuite) TestIsReadOnlyStatement(c *C) {
+	testCases := []struct {
+		query    string
+		readOnly bool
+	}{
+		{"SELECT * FROM `test`.`t` WHERE a > ?", true},
+		{"  select 1", true},
+		{"/* comment */ SELECT 1", true},
+		{"-- comment\nSHOW GRANTS", true},
+		{"(SELECT 1) UNION (SELECT 2)", true},
+		{"SELECT * FROM t INTO OUTFILE '/tmp/t.csv'", false},
+		{"EXPLAIN SELECT * FROM t", true},
+		{"EXPLAIN ANALYZE SELECT * FROM t", true},
+		{"EXPLAIN ANALYZE DELETE FROM t", false},
+		{"DESC t", true},
+		{"SET @@session.tidb_snapshot = ?", true},
+		{"SET time_zone = '+00:00'", true},
+		{"SET GLOBAL tidb_gc_life_time = '10m'", false},
+		{"SET @@global.tidb_gc_life_time = '10m'", false},
+		{"BEGIN", true},
+		{"START TRANSACTION WITH CONSISTENT SNAPSHOT", true},
+		{"start  transaction", true},
+		{"START SLAVE", false},
+		{"START REPLICA", false},
+		{"START GROUP_REPLICATION", false},
+		{"COMMIT", true},
+		{"REPLACE INTO `test`.`t`(`a`) VALUES (1)", false},
+		{"DELETE FROM `test`.`t` WHERE `a` = 1", false},
+		{"/*!40101 DELETE FROM t */", false},
+		{"ANALYZE TABLE `test`.`t`", false},
+		{"", false},
+	}
+	for _, testCase := range testCases {
+		c.Assert(IsReadOnlyStatement(testCase.query), Equals, testCase.readOnly, Commentf("query: %s", testCase.query))
+	}
+	err := checkReadOnlyStatement("DELETE FROM t WHERE secret = 'x'")
+	c.Assert(err, ErrorMatches, "the DELETE statement is refused on the read-only connection")
+}
+
+func (*testDBSuite) TestOpenReadOnlyDB(c *C) {
+	cfg := GetDBConfigFromEnv("")
+	db, err := OpenDB(cfg, nil)
+	if err != nil {
+		c.Skip("no mysql to connect: " + err.Error())
+	}
+	CloseDB(db)
+
+	cfg.ReadOnly = true
+	db, err = OpenDB(cfg, nil)
+	c.Assert(err, IsNil)
+	defer CloseDB(db)
+	ctx := context.Background()
+	var n int
+	c.Assert(db.QueryRowContext(ctx, "SELECT 1").Scan(&n), IsNil)
+	c.Assert(n, Equals, 1)
+	_, err = db.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS `readonly_test`")
+	c.Assert(err, ErrorMatches, ".*the CREATE statement is refused on the read-only connection")
+}
@@ -132,6 +132,62 @@ func ToTLSConfigWithVerifyByRawbytes(caData, certData, keyData []byte, verifyCN
 	return tlsCfg, nil
 }
 
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion returns the TLS version of the name, e.g. "1.2".
+func ParseTLSVersion(name string) (uint16, error) {
+	version, ok := tlsVersions[strings.TrimPrefix(strings.TrimPrefix(name, "TLS"), "v")]
+	if !ok {
+		return 0, errors.Errorf("unknown TLS version %s, the supported versions are 1.0, 1.1, 1.2 and 1.3", name)
+	}
+	return version, nil
+}
+
+// ParseCipherSuites returns the ids of the cipher suites of the names, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	suites := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := suites[strings.TrimSpace(name)]
+		if !ok {
+			return nil, errors.Errorf("unknown cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// SetTLSVersionAndCipherSuites restricts the minimum TLS version and the cipher suites of the TLS config,
+// the defaults of Go are kept if they are empty. The cipher suites of TLS 1.3 are not configurable.
+func SetTLSVersionAndCipherSuites(tlsCfg *tls.Config, minVersion string, cipherSuites []string) error {
+	if minVersion != "" {
+		version, err := ParseTLSVersion(minVersion)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		tlsCfg.MinVersion = version
+	}
+	if len(cipherSuites) > 0 {
+		ids, err := ParseCipherSuites(cipherSuites)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		tlsCfg.CipherSuites = ids
+	}
+	return nil
+}
+
 // NewTLS constructs a new HTTP client with TLS configured with the CA,
 // certificate and key paths.
 //
@@ -158,6 +158,25 @@ func runServer(ctx context.Context, tlsCfg *tls.Config, port int, c *C) *http.Se
 	return server
 }
 
+func (s *securitySuite) TestTLSVersionAndCipherSuites(c *C) {
+	tlsCfg := &tls.Config{}
+	c.Assert(SetTLSVersionAndCipherSuites(tlsCfg, "", nil), IsNil)
+	c.Assert(tlsCfg.MinVersion, Equals, uint16(0))
+	c.Assert(tlsCfg.CipherSuites, IsNil)
+
+	c.Assert(SetTLSVersionAndCipherSuites(tlsCfg, "1.2", []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}), IsNil)
+	c.Assert(tlsCfg.MinVersion, Equals, uint16(tls.VersionTLS12))
+	c.Assert(tlsCfg.CipherSuites, DeepEquals, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384})
+
+	version, err := ParseTLSVersion("TLSv1.3")
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, uint16(tls.VersionTLS13))
+	_, err = ParseTLSVersion("1.4")
+	c.Assert(err, ErrorMatches, "unknown TLS version 1.4.*")
+	_, err = ParseCipherSuites([]string{"TLS_UNKNOWN"})
+	c.Assert(err, ErrorMatches, "unknown cipher suite TLS_UNKNOWN")
+}
+
 func getTestCertFile(dir, role string) (string, string, string) {
 	return path.Join(dir, "ca.pem"), path.Join(dir, fmt.Sprintf("%s.pem", role)), path.Join(dir, fmt.Sprintf("%s.key", role))
 }
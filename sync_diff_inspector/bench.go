@@ -0,0 +1,222 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/source"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/splitter"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	benchChecksumQuery = "checksum"
+	benchRowsQuery     = "rows"
+)
+
+// benchResult is the result of a round of the benchmark, which runs the queries of all the chunks
+// on an instance with the concurrency.
+type benchResult struct {
+	instance    string
+	query       string
+	concurrency int
+	rows        int64
+	cost        time.Duration
+	latencies   []time.Duration
+}
+
+func (r *benchResult) rowsPerSecond() float64 {
+	if r.cost <= 0 {
+		return 0
+	}
+	return float64(r.rows) / r.cost.Seconds()
+}
+
+// latency returns the latency at the percentile in [0, 1].
+func (r *benchResult) latency(percentile float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	return r.latencies[int(percentile*float64(len(r.latencies)-1))]
+}
+
+// runBench measures the read throughput of the checksum and row queries on upstream and downstream
+// with the concurrencies, helping users pick chunk-size and check-thread-count before a real run.
+func runBench(ctx context.Context, cfg *config.Config, w io.Writer) error {
+	maxConcurrency := 1
+	for _, concurrency := range cfg.BenchConcurrency {
+		if concurrency > maxConcurrency {
+			maxConcurrency = concurrency
+		}
+	}
+	// the connections are enough for the max concurrency.
+	cfg.CheckThreadCount = maxConcurrency
+	downstream, upstream, err := source.NewSources(ctx, cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer downstream.Close()
+	defer upstream.Close()
+
+	chunks, err := collectBenchChunks(ctx, downstream, cfg.BenchChunks)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(chunks) == 0 {
+		return errors.Errorf("no chunk to run the benchmark")
+	}
+	log.Info("start the benchmark", zap.Int("chunks", len(chunks)), zap.Ints("concurrency", cfg.BenchConcurrency))
+
+	results := make([]*benchResult, 0, 4*len(cfg.BenchConcurrency))
+	for _, instance := range []struct {
+		name   string
+		source source.Source
+	}{{"upstream", upstream}, {"downstream", downstream}} {
+		for _, query := range []string{benchChecksumQuery, benchRowsQuery} {
+			for _, concurrency := range cfg.BenchConcurrency {
+				result, err := benchQueries(ctx, instance.source, query, chunks, concurrency)
+				if err != nil {
+					return errors.Annotatef(err, "fail to run the %s queries on %s", query, instance.name)
+				}
+				result.instance = instance.name
+				log.Info("finish a round of the benchmark",
+					zap.String("instance", result.instance),
+					zap.String("query", result.query),
+					zap.Int("concurrency", result.concurrency),
+					zap.Int64("rows", result.rows),
+					zap.Duration("cost", result.cost))
+				results = append(results, result)
+			}
+		}
+	}
+	printBenchResults(w, results, len(chunks))
+	return nil
+}
+
+// collectBenchChunks collects at most n chunks in the order of the comparison.
+func collectBenchChunks(ctx context.Context, workSource source.Source, n int) ([]*splitter.RangeInfo, error) {
+	iter, err := workSource.GetRangeIterator(ctx, nil, workSource.GetTableAnalyzer())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer iter.Close()
+	chunks := make([]*splitter.RangeInfo, 0, n)
+	for len(chunks) < n {
+		c, err := iter.Next(ctx)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if c == nil {
+			break
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, nil
+}
+
+// benchQueries runs the query of each chunk on the source with the concurrency.
+func benchQueries(ctx context.Context, s source.Source, query string, chunks []*splitter.RangeInfo, concurrency int) (*benchResult, error) {
+	result := &benchResult{
+		query:       query,
+		concurrency: concurrency,
+		latencies:   make([]time.Duration, 0, len(chunks)),
+	}
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	pool := utils.NewWorkerPool(uint(concurrency), "bench")
+	beginTime := time.Now()
+	for _, c := range chunks {
+		c := c
+		pool.Apply(func() {
+			queryBeginTime := time.Now()
+			rows, err := runBenchQuery(ctx, s, query, c)
+			latency := time.Since(queryBeginTime)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			result.rows += rows
+			result.latencies = append(result.latencies, latency)
+		})
+	}
+	pool.WaitFinished()
+	result.cost = time.Since(beginTime)
+	return result, errors.Trace(firstErr)
+}
+
+// runBenchQuery runs the query of the chunk, and returns the number of rows read.
+func runBenchQuery(ctx context.Context, s source.Source, query string, c *splitter.RangeInfo) (int64, error) {
+	if query == benchChecksumQuery {
+		info := s.GetCountAndCrc32(ctx, c)
+		return info.Count, errors.Trace(info.Err)
+	}
+	iter, err := s.GetRowsIterator(ctx, c)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer iter.Close()
+	var rows int64
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if row == nil {
+			return rows, nil
+		}
+		rows++
+	}
+}
+
+func printBenchResults(w io.Writer, results []*benchResult, chunks int) {
+	var summary strings.Builder
+	table := tablewriter.NewWriter(&summary)
+	table.SetHeader([]string{"Instance", "Query", "Concurrency", "Rows", "Rows/s", "P50 latency", "P99 latency"})
+	for _, r := range results {
+		table.Append([]string{
+			r.instance,
+			r.query,
+			strconv.Itoa(r.concurrency),
+			strconv.FormatInt(r.rows, 10),
+			fmt.Sprintf("%.0f", r.rowsPerSecond()),
+			r.latency(0.5).String(),
+			r.latency(0.99).String(),
+		})
+	}
+	table.Render()
+	fmt.Fprintf(w, "The benchmark has queried %d chunks on each instance.\n", chunks)
+	fmt.Fprint(w, summary.String())
+	fmt.Fprintln(w, "Set check-thread-count to the concurrency after which the rows/s stops increasing,")
+	fmt.Fprintln(w, "and decrease chunk-size if the latency of a query is too high.")
+}
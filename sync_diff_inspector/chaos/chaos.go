@@ -0,0 +1,100 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package chaos injects failures at configurable rates by the failpoints, so that users can validate
+// their runbooks for resumption and alerting. It's enabled by `--chaos` and only for test.
+package chaos
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
+)
+
+const (
+	// SourceQueryError fails the checksum and row queries of the sources.
+	SourceQueryError = "source-query-error"
+	// CheckpointWriteError fails saving the checkpoint.
+	CheckpointWriteError = "checkpoint-write-error"
+
+	failpointPrefix = "github.com/pingcap/tidb-tools/sync_diff_inspector/chaos/"
+)
+
+var supportedPoints = map[string]struct{}{
+	SourceQueryError:     {},
+	CheckpointWriteError: {},
+}
+
+// Parse parses the chaos config in the format of `<point>=<rate>[,<point>=<rate>]`,
+// e.g. `source-query-error=0.01,checkpoint-write-error=0.1`. The rate is in (0, 1].
+func Parse(chaos string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	if chaos == "" {
+		return rates, nil
+	}
+	for _, item := range strings.Split(chaos, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("invalid chaos %s, the format should be <point>=<rate>", item)
+		}
+		point := strings.TrimSpace(kv[0])
+		if _, ok := supportedPoints[point]; !ok {
+			return nil, errors.Errorf("unsupported chaos point %s, the supported points are %s", point, strings.Join(points(), ", "))
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return nil, errors.Errorf("invalid rate %s of chaos point %s, it should be in (0, 1]", kv[1], point)
+		}
+		rates[point] = rate
+	}
+	return rates, nil
+}
+
+// Enable enables the chaos points with their rates.
+func Enable(rates map[string]float64) error {
+	for point, rate := range rates {
+		if err := failpoint.Enable(failpointPrefix+point, fmt.Sprintf("%g%%return(true)", rate*100)); err != nil {
+			return errors.Annotatef(err, "enable chaos point %s", point)
+		}
+	}
+	return nil
+}
+
+// Disable disables all the chaos points.
+func Disable() {
+	for point := range supportedPoints {
+		_ = failpoint.Disable(failpointPrefix + point)
+	}
+}
+
+// Inject returns an error if the chaos point is enabled and triggered this time.
+func Inject(point string) error {
+	if _, err := failpoint.Eval(failpointPrefix + point); err != nil {
+		// the point is not enabled or not triggered
+		return nil
+	}
+	return errors.Errorf("chaos: injected %s", point)
+}
+
+func points() []string {
+	names := make([]string, 0, len(supportedPoints))
+	for point := range supportedPoints {
+		names = append(names, point)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,47 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChaos(t *testing.T) {
+	rates, err := Parse("")
+	require.NoError(t, err)
+	require.Len(t, rates, 0)
+
+	rates, err = Parse("source-query-error=1, checkpoint-write-error=0.5")
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{SourceQueryError: 1, CheckpointWriteError: 0.5}, rates)
+
+	_, err = Parse("source-query-error")
+	require.Contains(t, err.Error(), "the format should be")
+	_, err = Parse("binlog-disconnect=0.1")
+	require.Contains(t, err.Error(), "unsupported chaos point")
+	_, err = Parse("source-query-error=0")
+	require.Contains(t, err.Error(), "it should be in (0, 1]")
+	_, err = Parse("source-query-error=abc")
+	require.Contains(t, err.Error(), "it should be in (0, 1]")
+
+	require.NoError(t, Inject(SourceQueryError))
+	require.NoError(t, Enable(map[string]float64{SourceQueryError: 1}))
+	defer Disable()
+	require.Contains(t, Inject(SourceQueryError).Error(), "chaos: injected source-query-error")
+	require.NoError(t, Inject(CheckpointWriteError))
+	Disable()
+	require.NoError(t, Inject(SourceQueryError))
+}
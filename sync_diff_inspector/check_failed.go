@@ -0,0 +1,52 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/checkpoints"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"go.uber.org/zap"
+)
+
+// initCheckFailedOnly restricts the run to the tables failed in the last run for `--check-failed-only`, as `--tables`
+// does, and returns false if no table failed. The failed chunks are loaded again when the chunks are split.
+func initCheckFailedOnly(cfg *config.Config) (bool, error) {
+	if len(cfg.Tables) > 0 {
+		return false, errors.New("--check-failed-only can't be used with --tables")
+	}
+	failed, err := checkpoints.LoadFailedChunks(filepath.Join(cfg.Task.OutputDir, checkpoints.FailedChunksFile))
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	tables := make([]filter.Table, 0, len(failed.Tables))
+	names := make([]string, 0, len(failed.Tables))
+	for _, table := range failed.Tables {
+		tables = append(tables, filter.Table{Schema: table.Schema, Name: table.Table})
+		names = append(names, dbutil.TableName(table.Schema, table.Table))
+	}
+	if len(tables) == 0 {
+		return false, nil
+	}
+	sort.Strings(names)
+	log.Info("only re-check the failed tables", zap.Strings("tables", names))
+	cfg.Task.FailedTables = tables
+	return true, nil
+}
@@ -17,14 +17,14 @@ import (
 	"container/heap"
 	"context"
 	"encoding/json"
-	"os"
+	"hash/crc32"
 	"sync"
 
-	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/chaos"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/report"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/utils"
 
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/chunk"
-	"github.com/siddontang/go/ioutil2"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
@@ -67,6 +67,11 @@ func (n *Node) GetBucketIndexRight() int { return n.ChunkRange.Index.BucketIndex
 
 func (n *Node) GetChunkIndex() int { return n.ChunkRange.Index.ChunkIndex }
 
+// IsTableFinished returns true if the node is the last chunk of the table, or the data-check of the table is skipped.
+func (n *Node) IsTableFinished() bool {
+	return n.ChunkRange.Type == chunk.Empty || n.ChunkRange.IsLastChunkForTable()
+}
+
 // IsAdjacent represents whether the next node is adjacent node.
 // it's the important logic for checkpoint update.
 // we need keep this node save to checkpoint in global order.
@@ -110,41 +115,108 @@ func (n *Node) IsLess(next *Node) bool {
 	return false
 }
 
-// heap maintain a Min Heap, which can be accessed by multiple threads and protected by mutex.
+// heap maintain a Min Heap of the checked chunks of a table.
 type nodeHeap struct {
 	Nodes            []*Node
-	CurrentSavedNode *Node       // CurrentSavedNode save the minimum checker chunk, updated by `GetChunkSnapshot` method
-	mu               *sync.Mutex // protect critical section
+	CurrentSavedNode *Node // CurrentSavedNode save the minimum continuous checked chunk of the table, nil if no chunk is checked
+}
+
+// isNext returns true if the node is the next chunk of CurrentSavedNode.
+func (hp *nodeHeap) isNext(n *Node) bool {
+	if hp.CurrentSavedNode == nil {
+		return n.ChunkRange.IsFirstChunkForTable()
+	}
+	return hp.CurrentSavedNode.IsAdjacent(n)
+}
+
+// isFinished returns true if all the chunks of the table are checked.
+func (hp *nodeHeap) isFinished() bool {
+	return hp.CurrentSavedNode != nil && hp.CurrentSavedNode.IsTableFinished()
 }
 
 // Checkpoint provide the ability to restart the sync-diff process from the
 // latest previous exit point (due to error or intention).
 type Checkpoint struct {
-	hp *nodeHeap
+	mu *sync.Mutex // protect critical section
+	// hps are the heaps of the checked chunks of each table index. The chunks of several tables are checked
+	// concurrently and finished out of order, so each table is saved up to its own minimum continuous checked chunk,
+	// and none of the checked chunks is checked again after resuming.
+	hps map[int]*nodeHeap
+	// finishedChunks counts the chunks of each table index up to its CurrentSavedNode.
+	finishedChunks map[int]int
+
+	// configHash is the hash of the effective config saved with the state, the state saved with
+	// another hash isn't loaded unless forceResume is set.
+	configHash  string
+	forceResume bool
+	// tables are the names of the tables in the order of the table index, which are saved with the state
+	// so that the state can be inspected without the config.
+	tables []string
 }
 
 // SaveState contains the information of the latest checked chunk and state of `report`
 // When sync-diff start from the checkpoint, it will load this information and continue running
 type SavedState struct {
+	// Chunk is the minimum continuous checked chunk across the tables, the tables before it are finished.
 	Chunk  *Node          `json:"chunk-info"`
 	Report *report.Report `json:"report-info"`
+	// TableChunks are the minimum continuous checked chunks of each table index, the tables not in it
+	// are checked from the beginning. It's empty in the state saved by the earlier versions.
+	TableChunks map[int]*Node `json:"table-chunks,omitempty"`
+	// FinishedChunks is the number of the finished chunks of each table index, so the progress is restored
+	// accurately after resuming.
+	FinishedChunks map[int]int `json:"finished-chunks,omitempty"`
+	// ConfigHash is the hash of the effective config when the state is saved.
+	ConfigHash string `json:"config-hash,omitempty"`
+	// Tables are the names of the tables in the order of the table index.
+	Tables []string `json:"tables,omitempty"`
+}
+
+// SetTables sets the names of the tables in the order of the table index, which are saved with the state.
+func (cp *Checkpoint) SetTables(tables []string) {
+	cp.tables = tables
 }
 
-// InitCurrentSavedID the method is only used in initialization without lock, be cautious
-func (cp *Checkpoint) InitCurrentSavedID(n *Node) {
-	cp.hp.CurrentSavedNode = n
+// SetConfigHash sets the hash of the effective config, which is saved with the state and checked when
+// the state is loaded. The state saved with another hash is still loaded if force is set.
+func (cp *Checkpoint) SetConfigHash(hash string, force bool) {
+	cp.configHash = hash
+	cp.forceResume = force
 }
 
-func (cp *Checkpoint) GetCurrentSavedID() *Node {
-	cp.hp.mu.Lock()
-	defer cp.hp.mu.Unlock()
-	return cp.hp.CurrentSavedNode
+// GetTableNodes returns the minimum continuous checked chunk of each table index, the tables not in it
+// have no checked chunk. The comparison of each table is resumed after its chunk.
+func (cp *Checkpoint) GetTableNodes() map[int]*Node {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.getTableNodes()
+}
+
+func (cp *Checkpoint) getTableNodes() map[int]*Node {
+	nodes := make(map[int]*Node, len(cp.hps))
+	for tableIndex, hp := range cp.hps {
+		if hp.CurrentSavedNode != nil {
+			nodes[tableIndex] = hp.CurrentSavedNode
+		}
+	}
+	return nodes
+}
+
+// getHeap returns the heap of the table index, it's created if not exists.
+func (cp *Checkpoint) getHeap(tableIndex int) *nodeHeap {
+	hp, ok := cp.hps[tableIndex]
+	if !ok {
+		hp = &nodeHeap{Nodes: make([]*Node, 0)}
+		heap.Init(hp)
+		cp.hps[tableIndex] = hp
+	}
+	return hp
 }
 
 func (cp *Checkpoint) Insert(node *Node) {
-	cp.hp.mu.Lock()
-	heap.Push(cp.hp, node)
-	cp.hp.mu.Unlock()
+	cp.mu.Lock()
+	heap.Push(cp.getHeap(node.GetTableIndex()), node)
+	cp.mu.Unlock()
 }
 
 // Len - get the length of the heap
@@ -176,68 +248,217 @@ func (hp *nodeHeap) Pop() (item interface{}) {
 }
 
 func (cp *Checkpoint) Init() {
-	hp := &nodeHeap{
-		mu:    &sync.Mutex{},
-		Nodes: make([]*Node, 0),
-		CurrentSavedNode: &Node{
-			ChunkRange: &chunk.Range{
-				Index:   chunk.GetInitChunkID(),
-				IsFirst: true,
-				IsLast:  true,
-			},
+	cp.mu = &sync.Mutex{}
+	cp.hps = make(map[int]*nodeHeap)
+	cp.finishedChunks = make(map[int]int)
+}
+
+// initNode is the chunk before all the tables, it's saved if no table has a continuous checked chunk from
+// the beginning.
+func initNode() *Node {
+	return &Node{
+		ChunkRange: &chunk.Range{
+			Index:   chunk.GetInitChunkID(),
+			IsFirst: true,
+			IsLast:  true,
 		},
 	}
-	heap.Init(hp)
-	cp.hp = hp
 }
 
-// GetChunkSnapshot get the snapshot of the minimum continuous checked chunk
+// GetChunkSnapshot advances the minimum continuous checked chunk of each table, and returns the one across
+// the tables if any table is advanced, otherwise nil is returned.
 func (cp *Checkpoint) GetChunkSnapshot() (cur *Node) {
-	cp.hp.mu.Lock()
-	defer cp.hp.mu.Unlock()
-	for cp.hp.Len() != 0 && cp.hp.CurrentSavedNode.IsAdjacent(cp.hp.Nodes[0]) {
-		cp.hp.CurrentSavedNode = heap.Pop(cp.hp).(*Node)
-		cur = cp.hp.CurrentSavedNode
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	advanced := false
+	for tableIndex, hp := range cp.hps {
+		for hp.Len() != 0 && hp.isNext(hp.Nodes[0]) {
+			hp.CurrentSavedNode = heap.Pop(hp).(*Node)
+			cp.finishedChunks[tableIndex]++
+			advanced = true
+		}
+	}
+	if !advanced {
+		// wait for the next flush to check
+		return nil
+	}
+	return cp.getGlobalNode()
+}
+
+// getGlobalNode returns the minimum continuous checked chunk across the tables, all the tables before it are finished.
+func (cp *Checkpoint) getGlobalNode() *Node {
+	cur := initNode()
+	for tableIndex := 0; ; tableIndex++ {
+		hp, ok := cp.hps[tableIndex]
+		if !ok || hp.CurrentSavedNode == nil {
+			return cur
+		}
+		cur = hp.CurrentSavedNode
+		if !hp.isFinished() {
+			return cur
+		}
 	}
-	// wait for next 10s to check
-	return cur
 }
 
 // SaveChunk saves the chunk to file.
 func (cp *Checkpoint) SaveChunk(ctx context.Context, fileName string, cur *Node, reportInfo *report.Report) (*chunk.ChunkID, error) {
+	return cp.SaveChunkTo(ctx, NewFileStorage(fileName), cur, reportInfo)
+}
+
+// SaveChunkTo saves the chunk to the storage, with the minimum continuous checked chunks of each table.
+func (cp *Checkpoint) SaveChunkTo(ctx context.Context, storage Storage, cur *Node, reportInfo *report.Report) (*chunk.ChunkID, error) {
 	if cur == nil {
 		return nil, nil
 	}
 
+	cp.mu.Lock()
 	savedState := &SavedState{
-		Chunk:  cur,
-		Report: reportInfo,
+		Chunk:          cur,
+		Report:         reportInfo,
+		TableChunks:    cp.getTableNodes(),
+		FinishedChunks: cp.getFinishedChunks(),
+		ConfigHash:     cp.configHash,
+		Tables:         cp.tables,
 	}
-	checkpointData, err := json.Marshal(savedState)
+	cp.mu.Unlock()
+	stateData, err := json.Marshal(savedState)
+	if err != nil {
+		log.Warn("fail to save the chunk", zap.Any("chunk index", cur.GetID()), zap.Error(err))
+		return nil, errors.Trace(err)
+	}
+	checkpointData, err := json.Marshal(&checksummedState{CRC32: crc32.ChecksumIEEE(stateData), State: stateData})
 	if err != nil {
-		log.Warn("fail to save the chunk to the file", zap.Any("chunk index", cur.GetID()), zap.Error(err))
 		return nil, errors.Trace(err)
 	}
 
-	if err = ioutil2.WriteFileAtomic(fileName, checkpointData, config.LocalFilePerm); err != nil {
+	if err = chaos.Inject(chaos.CheckpointWriteError); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = storage.Save(ctx, checkpointData); err != nil {
 		return nil, err
 	}
 	log.Info("save checkpoint",
-		zap.Any("chunk", cur),
+		utils.RedactAnyData("chunk", cur),
 		zap.String("state", cur.GetState()))
 	return cur.GetID(), nil
 }
 
 // LoadChunk loads chunk info from file `chunk`
 func (cp *Checkpoint) LoadChunk(fileName string) (*Node, *report.Report, error) {
-	bytes, err := os.ReadFile(fileName)
+	return cp.LoadChunkFrom(context.Background(), NewFileStorage(fileName))
+}
+
+// LoadChunkFrom loads chunk info from the storage. If the latest state is missing or corrupt,
+// the previous one is loaded if the storage keeps it.
+func (cp *Checkpoint) LoadChunkFrom(ctx context.Context, storage Storage) (*Node, *report.Report, error) {
+	n, err := ReadSavedState(ctx, storage)
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
-	n := &SavedState{}
-	err = json.Unmarshal(bytes, n)
-	if err != nil {
-		return nil, nil, errors.Trace(err)
+	// the state saved by the earlier versions has no hash.
+	if len(n.ConfigHash) > 0 && len(cp.configHash) > 0 && n.ConfigHash != cp.configHash {
+		if !cp.forceResume {
+			return nil, nil, errors.Errorf("the effective config is changed since the checkpoint %s is saved, please use another outputDir and start over again! or set --force-resume to resume anyway", storage.String())
+		}
+		log.Warn("the effective config is changed since the checkpoint is saved, resume from it because of --force-resume", zap.String("checkpoint", storage.String()))
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if len(n.TableChunks) > 0 {
+		for tableIndex, node := range n.TableChunks {
+			cp.getHeap(tableIndex).CurrentSavedNode = node
+		}
+	} else if n.Chunk.GetTableIndex() >= 0 {
+		// the state saved by the earlier versions has only the chunk across the tables,
+		// so the tables before it are finished.
+		for tableIndex := 0; tableIndex < n.Chunk.GetTableIndex(); tableIndex++ {
+			cp.getHeap(tableIndex).CurrentSavedNode = &Node{
+				State: IgnoreState,
+				ChunkRange: &chunk.Range{
+					Index:   &chunk.ChunkID{TableIndex: tableIndex},
+					Type:    chunk.Empty,
+					IsFirst: true,
+					IsLast:  true,
+				},
+			}
+		}
+		cp.getHeap(n.Chunk.GetTableIndex()).CurrentSavedNode = n.Chunk
+	}
+	if n.FinishedChunks != nil {
+		// the chunks are counted from the checkpoint, so the counts are still right after resuming several times.
+		cp.finishedChunks = n.FinishedChunks
 	}
 	return n.Chunk, n.Report, nil
 }
+
+// ReadSavedState reads the saved state from the storage. If the latest state is missing or corrupt,
+// the previous one is read if the storage keeps it.
+func ReadSavedState(ctx context.Context, storage Storage) (*SavedState, error) {
+	n, err := loadSavedState(ctx, storage.Load)
+	if err == nil {
+		return n, nil
+	}
+	prevLoader, ok := storage.(previousLoader)
+	if !ok {
+		return nil, errors.Trace(err)
+	}
+	log.Warn("fail to load the latest checkpoint, load the previous one", zap.String("checkpoint", storage.String()), zap.Error(err))
+	n, prevErr := loadSavedState(ctx, prevLoader.LoadPrevious)
+	if prevErr != nil {
+		return nil, errors.Annotatef(err, "the previous checkpoint can't be loaded either: %v", prevErr)
+	}
+	return n, nil
+}
+
+// checksummedState is the saved state with its CRC32, so that a corrupt state is detected.
+type checksummedState struct {
+	CRC32 uint32          `json:"crc32"`
+	State json.RawMessage `json:"state"`
+}
+
+// loadSavedState loads the saved state, the state saved without the checksum by the earlier versions is still loaded.
+func loadSavedState(ctx context.Context, load func(context.Context) ([]byte, error)) (*SavedState, error) {
+	data, err := load(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	checksummed := &checksummedState{}
+	if err = json.Unmarshal(data, checksummed); err != nil {
+		return nil, errors.Annotate(err, "the checkpoint is corrupt")
+	}
+	if len(checksummed.State) > 0 {
+		if crc32.ChecksumIEEE(checksummed.State) != checksummed.CRC32 {
+			return nil, errors.New("the checksum of the checkpoint mismatches")
+		}
+		data = checksummed.State
+	}
+	n := &SavedState{}
+	if err = json.Unmarshal(data, n); err != nil {
+		return nil, errors.Annotate(err, "the checkpoint is corrupt")
+	}
+	if n.Chunk == nil || n.Chunk.ChunkRange == nil || n.Chunk.ChunkRange.Index == nil {
+		return nil, errors.New("the checkpoint has no chunk")
+	}
+	for _, node := range n.TableChunks {
+		if node == nil || node.ChunkRange == nil || node.ChunkRange.Index == nil {
+			return nil, errors.New("the checkpoint has an invalid chunk of the table")
+		}
+	}
+	return n, nil
+}
+
+// GetFinishedChunks returns the number of the finished chunks of the table up to the saved chunk.
+func (cp *Checkpoint) GetFinishedChunks(tableIndex int) int {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.finishedChunks[tableIndex]
+}
+
+// getFinishedChunks returns a copy of the numbers of the finished chunks of the tables.
+func (cp *Checkpoint) getFinishedChunks() map[int]int {
+	counts := make(map[int]int, len(cp.finishedChunks))
+	for index, count := range cp.finishedChunks {
+		counts[index] = count
+	}
+	return counts
+}
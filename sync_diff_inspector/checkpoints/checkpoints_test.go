@@ -14,15 +14,23 @@
 package checkpoints
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/chunk"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/report"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/source/common"
+	"github.com/pingcap/tidb/br/pkg/storage"
 	"github.com/stretchr/testify/require"
 )
 
@@ -69,12 +77,22 @@ func TestSaveChunk(t *testing.T) {
 	}
 	wg.Wait()
 	defer os.Remove("TestSaveChunk")
+	defer os.Remove("TestSaveChunk.prev")
 
 	cur = checker.GetChunkSnapshot()
 	require.NotNil(t, cur)
 	id, err = checker.SaveChunk(ctx, "TestSaveChunk", cur, nil)
 	require.NoError(t, err)
 	require.Equal(t, id.Compare(&chunk.ChunkID{TableIndex: 0, BucketIndexLeft: 9, BucketIndexRight: 9, ChunkIndex: 9}), 0)
+	require.Equal(t, rounds, checker.GetFinishedChunks(0))
+
+	// the finished chunks are restored from the checkpoint
+	resumed := new(Checkpoint)
+	resumed.Init()
+	_, _, err = resumed.LoadChunk("TestSaveChunk")
+	require.NoError(t, err)
+	require.Equal(t, rounds, resumed.GetFinishedChunks(0))
+	require.Equal(t, 0, resumed.GetFinishedChunks(1))
 }
 
 func TestLoadChunk(t *testing.T) {
@@ -111,6 +129,7 @@ func TestLoadChunk(t *testing.T) {
 	}
 	wg.Wait()
 	defer os.Remove("TestLoadChunk")
+	defer os.Remove("TestLoadChunk.prev")
 	cur := checker.GetChunkSnapshot()
 	id, err := checker.SaveChunk(ctx, "TestLoadChunk", cur, nil)
 	require.NoError(t, err)
@@ -118,3 +137,340 @@ func TestLoadChunk(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, node.GetID().Compare(id), 0)
 }
+
+func TestIncrementalState(t *testing.T) {
+	fileName := "TestIncrementalState"
+	defer os.Remove(fileName)
+
+	// the state is empty before the first run
+	state, err := LoadIncrementalState(fileName)
+	require.NoError(t, err)
+	require.Empty(t, state.Tables)
+
+	state.PendingRunTime = "2022-01-02 03:04:05"
+	state.Tables["test:t1"] = &TableIncrementalState{LastRunTime: "2022-01-01 00:00:00", IncrementalRuns: 2}
+	require.NoError(t, SaveIncrementalState(fileName, state))
+
+	loaded, err := LoadIncrementalState(fileName)
+	require.NoError(t, err)
+	require.Equal(t, state, loaded)
+
+	require.NoError(t, os.WriteFile(fileName, []byte("{"), 0o644))
+	_, err = LoadIncrementalState(fileName)
+	require.Error(t, err)
+}
+
+func TestFailedChunks(t *testing.T) {
+	fileName := "TestFailedChunks"
+	defer os.Remove(fileName)
+
+	// no run has finished yet
+	_, err := LoadFailedChunks(fileName)
+	require.Error(t, err)
+
+	failed := NewFailedChunks()
+	chunkRange := chunk.NewChunkRange()
+	chunkRange.Update("a", "10", "20", true, true)
+	failed.AddChunk("test", "t1", chunkRange, 1)
+	failed.AddTable("test", "t2")
+	require.NoError(t, SaveFailedChunks(fileName, failed))
+
+	loaded, err := LoadFailedChunks(fileName)
+	require.NoError(t, err)
+	require.Len(t, loaded.Tables, 2)
+	t1 := loaded.GetTable("test", "t1")
+	require.False(t, t1.WholeTable)
+	require.Len(t, t1.Chunks, 1)
+	require.Equal(t, int64(1), t1.Chunks[0].IndexID)
+	require.Equal(t, "20", t1.Chunks[0].Range.Bounds[0].Upper)
+	require.True(t, loaded.GetTable("test", "t2").WholeTable)
+	require.Nil(t, loaded.GetTable("test", "t3"))
+
+	require.NoError(t, os.WriteFile(fileName, []byte("{"), 0o644))
+	_, err = LoadFailedChunks(fileName)
+	require.Error(t, err)
+}
+
+func TestMySQLStorage(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `sync_diff_inspector`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `sync_diff_inspector`.`sync_diff_checkpoints`").WillReturnResult(sqlmock.NewResult(0, 0))
+	storage, err := NewMySQLStorage(ctx, db, "/tmp/output")
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT COUNT").WithArgs("/tmp/output").WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	exists, err := storage.Exists(ctx)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	checker := new(Checkpoint)
+	checker.Init()
+	checker.SetConfigHash("hash1", false)
+	cur := &Node{
+		State: SuccessState,
+		ChunkRange: &chunk.Range{
+			Index: &chunk.ChunkID{TableIndex: 1, BucketIndexLeft: 0, BucketIndexRight: 0, ChunkIndex: 0, ChunkCnt: 1},
+		},
+	}
+	var saved []byte
+	mock.ExpectExec("REPLACE INTO `sync_diff_inspector`.`sync_diff_checkpoints`").
+		WithArgs("/tmp/output", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	id, err := checker.SaveChunkTo(ctx, storage, cur, nil)
+	require.NoError(t, err)
+	require.Equal(t, cur.GetID(), id)
+	saved, err = json.Marshal(&SavedState{Chunk: cur, FinishedChunks: map[int]int{}, ConfigHash: "hash1"})
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT `state`").WithArgs("/tmp/output").WillReturnRows(sqlmock.NewRows([]string{"state"}).AddRow(saved))
+	node, _, err := checker.LoadChunkFrom(ctx, storage)
+	require.NoError(t, err)
+	require.Equal(t, cur.GetID().ToString(), node.GetID().ToString())
+
+	// the checkpoint of another config can't be used, the hash is saved in the state.
+	checker.SetConfigHash("hash2", false)
+	mock.ExpectQuery("SELECT `state`").WithArgs("/tmp/output").WillReturnRows(sqlmock.NewRows([]string{"state"}).AddRow(saved))
+	_, _, err = checker.LoadChunkFrom(ctx, storage)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "the effective config is changed")
+
+	mock.ExpectExec("DELETE FROM `sync_diff_inspector`.`sync_diff_checkpoints`").WithArgs("/tmp/output").WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, storage.Remove(ctx))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExternalFileStorage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := storage.NewLocalStorage(dir)
+	require.NoError(t, err)
+	// the local storage doesn't create the dir of the file.
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "checkpoint"), 0o755))
+
+	cpStorage := NewExternalFileStorage(store, "checkpoint/sync_diff_checkpoints.pb")
+	exists, err := cpStorage.Exists(ctx)
+	require.NoError(t, err)
+	require.False(t, exists)
+	// it's ok to remove the checkpoint not saved.
+	require.NoError(t, cpStorage.Remove(ctx))
+
+	checker := new(Checkpoint)
+	checker.Init()
+	checker.SetConfigHash("hash1", false)
+	cur := &Node{
+		State: SuccessState,
+		ChunkRange: &chunk.Range{
+			Index: &chunk.ChunkID{TableIndex: 2, BucketIndexLeft: 0, BucketIndexRight: 0, ChunkIndex: 0, ChunkCnt: 1},
+		},
+	}
+	_, err = checker.SaveChunkTo(ctx, cpStorage, cur, nil)
+	require.NoError(t, err)
+	exists, err = cpStorage.Exists(ctx)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// the checkpoint is resumed with the same config.
+	cpStorage = NewExternalFileStorage(store, "checkpoint/sync_diff_checkpoints.pb")
+	node, _, err := checker.LoadChunkFrom(ctx, cpStorage)
+	require.NoError(t, err)
+	require.Equal(t, cur.GetID().ToString(), node.GetID().ToString())
+
+	// the checkpoint of another config can't be used, the hash is saved in the state.
+	checker = new(Checkpoint)
+	checker.Init()
+	checker.SetConfigHash("hash2", false)
+	_, _, err = checker.LoadChunkFrom(ctx, cpStorage)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "the effective config is changed")
+
+	require.NoError(t, cpStorage.Remove(ctx))
+	exists, err = cpStorage.Exists(ctx)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestCorruptCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	fileName := filepath.Join(t.TempDir(), "sync_diff_checkpoints.pb")
+	checker := new(Checkpoint)
+	checker.Init()
+	for i := 0; i < 2; i++ {
+		cur := &Node{
+			State: SuccessState,
+			ChunkRange: &chunk.Range{
+				Index: &chunk.ChunkID{TableIndex: 0, BucketIndexLeft: 0, BucketIndexRight: 0, ChunkIndex: i, ChunkCnt: 2},
+			},
+		}
+		_, err := checker.SaveChunk(ctx, fileName, cur, nil)
+		require.NoError(t, err)
+	}
+	node, _, err := checker.LoadChunk(fileName)
+	require.NoError(t, err)
+	require.Equal(t, 1, node.GetChunkIndex())
+
+	// the truncated checkpoint falls back to the previous one.
+	data, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fileName, data[:len(data)/2], 0o644))
+	node, _, err = checker.LoadChunk(fileName)
+	require.NoError(t, err)
+	require.Equal(t, 0, node.GetChunkIndex())
+
+	// the checksum detects the changed data.
+	require.NoError(t, os.WriteFile(fileName, bytes.Replace(data, []byte(`"chunk-index":1`), []byte(`"chunk-index":3`), 1), 0o644))
+	node, _, err = checker.LoadChunk(fileName)
+	require.NoError(t, err)
+	require.Equal(t, 0, node.GetChunkIndex())
+
+	// the checkpoint saved without the checksum is still loaded.
+	legacy, err := json.Marshal(&SavedState{Chunk: node})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fileName, legacy, 0o644))
+	node, _, err = checker.LoadChunk(fileName)
+	require.NoError(t, err)
+	require.Equal(t, 0, node.GetChunkIndex())
+
+	require.NoError(t, os.WriteFile(fileName+".prev", []byte("{"), 0o644))
+	require.NoError(t, os.WriteFile(fileName, []byte("{"), 0o644))
+	_, _, err = checker.LoadChunk(fileName)
+	require.Error(t, err)
+}
+
+func TestCheckpointConfigHash(t *testing.T) {
+	ctx := context.Background()
+	fileName := filepath.Join(t.TempDir(), "sync_diff_checkpoints.pb")
+	checker := new(Checkpoint)
+	checker.Init()
+	checker.SetConfigHash("hash1", false)
+	cur := &Node{
+		State: SuccessState,
+		ChunkRange: &chunk.Range{
+			Index: &chunk.ChunkID{TableIndex: 0, BucketIndexLeft: 0, BucketIndexRight: 0, ChunkIndex: 0, ChunkCnt: 1},
+		},
+	}
+	_, err := checker.SaveChunk(ctx, fileName, cur, nil)
+	require.NoError(t, err)
+	_, _, err = checker.LoadChunk(fileName)
+	require.NoError(t, err)
+
+	// the checkpoint of another config isn't resumed unless forced.
+	checker.SetConfigHash("hash2", false)
+	_, _, err = checker.LoadChunk(fileName)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--force-resume")
+	checker.SetConfigHash("hash2", true)
+	node, _, err := checker.LoadChunk(fileName)
+	require.NoError(t, err)
+	require.Equal(t, 0, node.GetChunkIndex())
+}
+
+func TestPrintSavedState(t *testing.T) {
+	reportInfo := report.NewReport(&config.TaskConfig{})
+	reportInfo.Init([]*common.TableDiff{{Schema: "test", Table: "t1"}, {Schema: "test", Table: "t2"}, {Schema: "test", Table: "t3"}}, nil, nil)
+	reportInfo.SetTableDataCheckResult("test", "t2", false, 2, 1, &chunk.ChunkID{TableIndex: 1, ChunkIndex: 3, ChunkCnt: 10})
+	state := &SavedState{
+		Chunk: &Node{
+			State: SuccessState,
+			ChunkRange: &chunk.Range{
+				Index:  &chunk.ChunkID{TableIndex: 1, ChunkIndex: 5, ChunkCnt: 10},
+				Bounds: []*chunk.Bound{{Column: "a", Upper: "10", HasUpper: true}},
+			},
+		},
+		Report:         reportInfo,
+		FinishedChunks: map[int]int{0: 4, 1: 6},
+		Tables:         []string{"`test`.`t1`", "`test`.`t2`", "`test`.`t3`"},
+	}
+	var b bytes.Buffer
+	require.NoError(t, state.Print(&b))
+	output := b.String()
+	require.Contains(t, output, "Saved chunk: 1:0-0:5:10 of `test`.`t2`")
+	require.Regexp(t, "0 +\\| +`test`.`t1` +\\| +finished", output)
+	require.Regexp(t, "1 +\\| +`test`.`t2` +\\| +in progress +\\| +6 +\\| +1:0-0:5:10 +\\| +data different", output)
+	require.Regexp(t, "2 +\\| +`test`.`t3` +\\| +pending", output)
+	require.Regexp(t, "`test`.`t2` +\\| +1:0-0:3:10 +\\| +2 +\\| +1", output)
+
+	// the table of the empty chunk is finished.
+	state.Chunk.ChunkRange.Type = chunk.Empty
+	b.Reset()
+	require.NoError(t, state.Print(&b))
+	require.Regexp(t, "1 +\\| +`test`.`t2` +\\| +finished", b.String())
+
+	// each table is resumed after its own chunk.
+	state.Chunk = initNode()
+	state.TableChunks = map[int]*Node{
+		1: {ChunkRange: &chunk.Range{Index: &chunk.ChunkID{TableIndex: 1, ChunkIndex: 5, ChunkCnt: 10},
+			Bounds: []*chunk.Bound{{Column: "a", Upper: "10", HasUpper: true}}}},
+		2: {ChunkRange: &chunk.Range{Index: &chunk.ChunkID{TableIndex: 2}, Type: chunk.Empty, IsFirst: true, IsLast: true}},
+	}
+	b.Reset()
+	require.NoError(t, state.Print(&b))
+	output = b.String()
+	require.NotContains(t, output, "Saved chunk")
+	require.Regexp(t, "0 +\\| +`test`.`t1` +\\| +pending", output)
+	require.Regexp(t, "1 +\\| +`test`.`t2` +\\| +in progress +\\| +6 +\\| +1:0-0:5:10", output)
+	require.Regexp(t, "2 +\\| +`test`.`t3` +\\| +finished", output)
+}
+
+func TestTableCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	fileName := filepath.Join(t.TempDir(), "sync_diff_checkpoints.pb")
+	newNode := func(tableIndex, chunkIndex int) *Node {
+		return &Node{
+			State: SuccessState,
+			ChunkRange: &chunk.Range{
+				Index:   &chunk.ChunkID{TableIndex: tableIndex, ChunkIndex: chunkIndex, ChunkCnt: 3},
+				IsFirst: chunkIndex == 0,
+				IsLast:  chunkIndex == 2,
+				Bounds:  []*chunk.Bound{{Column: "a", HasLower: chunkIndex != 0, HasUpper: chunkIndex != 2}},
+			},
+		}
+	}
+	checker := new(Checkpoint)
+	checker.Init()
+	// the tables are checked concurrently, the first chunk of table 0 is still being checked.
+	for _, node := range []*Node{newNode(0, 1), newNode(1, 0), newNode(1, 2), newNode(1, 1), newNode(2, 0)} {
+		checker.Insert(node)
+	}
+	cur := checker.GetChunkSnapshot()
+	require.NotNil(t, cur)
+	require.Equal(t, -1, cur.GetTableIndex())
+	_, err := checker.SaveChunk(ctx, fileName, cur, nil)
+	require.NoError(t, err)
+	require.Nil(t, checker.GetChunkSnapshot())
+
+	resumed := new(Checkpoint)
+	resumed.Init()
+	_, _, err = resumed.LoadChunk(fileName)
+	require.NoError(t, err)
+	nodes := resumed.GetTableNodes()
+	require.Len(t, nodes, 2)
+	require.True(t, nodes[1].IsTableFinished())
+	require.Equal(t, 0, nodes[2].GetChunkIndex())
+	require.Equal(t, 3, resumed.GetFinishedChunks(1))
+	require.Equal(t, 1, resumed.GetFinishedChunks(2))
+
+	// the chunk across the tables is advanced after table 0 is finished.
+	resumed.Insert(newNode(0, 0))
+	resumed.Insert(newNode(0, 1))
+	resumed.Insert(newNode(0, 2))
+	cur = resumed.GetChunkSnapshot()
+	require.Equal(t, 2, cur.GetTableIndex())
+	require.Equal(t, 0, cur.GetChunkIndex())
+
+	// the tables before the chunk saved by the earlier versions are finished.
+	legacy, err := json.Marshal(&SavedState{Chunk: newNode(2, 1)})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fileName, legacy, 0o644))
+	resumed = new(Checkpoint)
+	resumed.Init()
+	_, _, err = resumed.LoadChunk(fileName)
+	require.NoError(t, err)
+	nodes = resumed.GetTableNodes()
+	require.Len(t, nodes, 3)
+	require.True(t, nodes[0].IsTableFinished())
+	require.True(t, nodes[1].IsTableFinished())
+	require.Equal(t, 1, nodes[2].GetChunkIndex())
+}
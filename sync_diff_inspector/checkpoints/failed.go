@@ -0,0 +1,112 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoints
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/chunk"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/siddontang/go/ioutil2"
+)
+
+// FailedChunksFile is the file in the output dir recording the tables and the chunks failed in the last run,
+// which are re-checked by `--check-failed-only`. Like the incremental state, it's kept after the comparison finished.
+const FailedChunksFile = "failed_chunks.json"
+
+// FailedChunks records the failed tables of a run.
+type FailedChunks struct {
+	// Tables is keyed by dbutil.TableName of the target tables.
+	Tables map[string]*FailedTable `json:"tables"`
+}
+
+// FailedTable is a failed table, either the whole table or only some chunks of it are re-checked.
+type FailedTable struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// WholeTable is true if the table is re-checked from the beginning, e.g. its structure is different,
+	// it met an error or some of its chunks are skipped.
+	WholeTable bool `json:"whole-table"`
+	// Chunks are the failed chunks in the order they were checked.
+	Chunks []*FailedChunk `json:"chunks,omitempty"`
+}
+
+// FailedChunk is the range of a failed chunk.
+type FailedChunk struct {
+	Range   *chunk.Range `json:"range"`
+	IndexID int64        `json:"index-id"`
+}
+
+// NewFailedChunks returns the empty failed tables.
+func NewFailedChunks() *FailedChunks {
+	return &FailedChunks{Tables: make(map[string]*FailedTable)}
+}
+
+// AddTable records the whole table as failed.
+func (f *FailedChunks) AddTable(schema, table string) {
+	f.getTable(schema, table).WholeTable = true
+}
+
+// AddChunk records the chunk of the table as failed.
+func (f *FailedChunks) AddChunk(schema, table string, chunkRange *chunk.Range, indexID int64) {
+	t := f.getTable(schema, table)
+	t.Chunks = append(t.Chunks, &FailedChunk{Range: chunkRange, IndexID: indexID})
+}
+
+func (f *FailedChunks) getTable(schema, table string) *FailedTable {
+	name := dbutil.TableName(schema, table)
+	t, ok := f.Tables[name]
+	if !ok {
+		t = &FailedTable{Schema: schema, Table: table}
+		f.Tables[name] = t
+	}
+	return t
+}
+
+// GetTable returns the failed table, it's nil if the table passed.
+func (f *FailedChunks) GetTable(schema, table string) *FailedTable {
+	return f.Tables[dbutil.TableName(schema, table)]
+}
+
+// LoadFailedChunks loads the failed tables from the file, it's an error if the file doesn't exist,
+// since it means no run has finished in the output dir.
+func LoadFailedChunks(fileName string) (*FailedChunks, error) {
+	bytes, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, errors.Errorf("%s doesn't exist, please finish a comparison in the output dir first", fileName)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	failed := NewFailedChunks()
+	if err = json.Unmarshal(bytes, failed); err != nil {
+		return nil, errors.Annotatef(err, "the failed chunks %s is broken", fileName)
+	}
+	if failed.Tables == nil {
+		failed.Tables = make(map[string]*FailedTable)
+	}
+	return failed, nil
+}
+
+// SaveFailedChunks saves the failed tables to the file.
+func SaveFailedChunks(fileName string, failed *FailedChunks) error {
+	bytes, err := json.Marshal(failed)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(ioutil2.WriteFileAtomic(fileName, bytes, config.LocalFilePerm))
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoints
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/siddontang/go/ioutil2"
+)
+
+// IncrementalStateFile is the file in the output dir recording the last successful runs of the tables.
+// Different from the checkpoint, it's kept after the comparison finished.
+const IncrementalStateFile = "incremental_state.json"
+
+// IncrementalState records the last successful run of each table for the incremental mode.
+type IncrementalState struct {
+	// PendingRunTime is the start time of the run not finished yet, a run resumed from
+	// the checkpoint reuses it, so that the rows changed during the break are compared next time.
+	PendingRunTime string `json:"pending-run-time,omitempty"`
+	// Tables is keyed by utils.UniqueID of the tables.
+	Tables map[string]*TableIncrementalState `json:"tables"`
+}
+
+// TableIncrementalState is the state of a table for the incremental mode.
+type TableIncrementalState struct {
+	// LastRunTime is the start time of the last successful run, the rows whose change hint
+	// is not less than it are compared in the next run.
+	LastRunTime string `json:"last-run-time"`
+	// IncrementalRuns is the number of incremental runs since the last full run.
+	IncrementalRuns int `json:"incremental-runs"`
+}
+
+// LoadIncrementalState loads the state from the file, it's empty if the file doesn't exist.
+func LoadIncrementalState(fileName string) (*IncrementalState, error) {
+	state := &IncrementalState{Tables: make(map[string]*TableIncrementalState)}
+	bytes, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = json.Unmarshal(bytes, state); err != nil {
+		return nil, errors.Annotatef(err, "the incremental state %s is broken", fileName)
+	}
+	if state.Tables == nil {
+		state.Tables = make(map[string]*TableIncrementalState)
+	}
+	return state, nil
+}
+
+// SaveIncrementalState saves the state to the file.
+func SaveIncrementalState(fileName string, state *IncrementalState) error {
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(ioutil2.WriteFileAtomic(fileName, bytes, config.LocalFilePerm))
+}
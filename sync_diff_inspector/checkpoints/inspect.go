@@ -0,0 +1,180 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoints
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/chunk"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/report"
+)
+
+const (
+	tableFinished   = "finished"
+	tableInProgress = "in progress"
+	tablePending    = "pending"
+	tableUnknown    = "unknown"
+)
+
+// tableName returns the name of the table index, the state saved by the earlier versions has no names.
+func (s *SavedState) tableName(tableIndex int) string {
+	if tableIndex >= 0 && tableIndex < len(s.Tables) {
+		return s.Tables[tableIndex]
+	}
+	return fmt.Sprintf("table #%d", tableIndex)
+}
+
+// tableProgress returns whether the table of the index is finished, in progress or pending when resuming,
+// and the saved chunk of the table in progress.
+func (s *SavedState) tableProgress(tableIndex int) (string, *Node) {
+	var node *Node
+	switch {
+	case len(s.TableChunks) > 0:
+		node = s.TableChunks[tableIndex]
+	case tableIndex < s.Chunk.GetTableIndex():
+		// the state saved by the earlier versions has only the chunk across the tables.
+		return tableFinished, nil
+	case tableIndex == s.Chunk.GetTableIndex():
+		node = s.Chunk
+	}
+	switch {
+	case node == nil:
+		return tablePending, nil
+	case node.IsTableFinished():
+		return tableFinished, nil
+	default:
+		return tableInProgress, node
+	}
+}
+
+// Print prints which tables are finished, which chunks failed and where the comparison is resumed,
+// so that the state can be understood without reading the checkpoint file.
+func (s *SavedState) Print(w io.Writer) error {
+	var b strings.Builder
+	if id := s.Chunk.GetID(); id.TableIndex >= 0 {
+		fmt.Fprintf(&b, "Saved chunk: %s of %s, state: %s\n", id.ToString(), s.tableName(id.TableIndex), s.Chunk.GetState())
+	}
+	if len(s.ConfigHash) > 0 {
+		fmt.Fprintf(&b, "Config hash: %s\n", s.ConfigHash)
+	}
+	b.WriteString("Resume from: the finished tables are skipped, the tables in progress are checked after their saved chunks " +
+		"and the chunks after them are checked again even if they were finished, the pending tables are checked from the beginning\n")
+
+	results := make(map[string]*report.TableResult)
+	if s.Report != nil {
+		for schema, tableMap := range s.Report.TableResults {
+			for table, result := range tableMap {
+				results[dbutil.TableName(schema, table)] = result
+			}
+		}
+	}
+	// the tables are listed in the order of the table index if the names are saved.
+	names := s.Tables
+	if len(names) == 0 {
+		for name := range results {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	b.WriteString("\nTables\n")
+	tables := tablewriter.NewWriter(&b)
+	tables.SetHeader([]string{"Index", "Table", "Progress", "Finished chunks", "Resume after", "Result"})
+	failedChunks := make([][]string, 0)
+	for i, name := range names {
+		index, progress, finishedChunks, resumeAfter := strconv.Itoa(i), tableUnknown, "", ""
+		if len(s.Tables) > 0 {
+			var node *Node
+			progress, node = s.tableProgress(i)
+			if node != nil {
+				finishedChunks = strconv.Itoa(s.FinishedChunks[i])
+				resumeAfter = node.GetID().ToString()
+			}
+		} else {
+			index = "-"
+		}
+		result, ok := results[name]
+		if !ok {
+			tables.Append([]string{index, name, progress, finishedChunks, resumeAfter, "-"})
+			continue
+		}
+		tables.Append([]string{index, name, progress, finishedChunks, resumeAfter, tableResultString(result)})
+		failedChunks = append(failedChunks, chunkResultRows(name, result)...)
+	}
+	tables.Render()
+
+	if len(failedChunks) > 0 {
+		b.WriteString("\nFailed chunks\n")
+		chunks := tablewriter.NewWriter(&b)
+		chunks.SetHeader([]string{"Table", "Chunk", "Rows add", "Rows delete", "Note"})
+		for _, row := range failedChunks {
+			chunks.Append(row)
+		}
+		chunks.Render()
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// tableResultString returns the result of the table compared so far.
+func tableResultString(result *report.TableResult) string {
+	switch {
+	case !result.StructEqual:
+		return "structure different"
+	case result.DataSkip:
+		return "data skipped"
+	case !result.DataEqual:
+		return "data different"
+	default:
+		return "equal so far"
+	}
+}
+
+// chunkResultRows returns the rows of the failed chunks of the table in the order of the chunk id.
+func chunkResultRows(name string, result *report.TableResult) [][]string {
+	ids := make([]*chunk.ChunkID, 0, len(result.ChunkMap))
+	for key := range result.ChunkMap {
+		id := &chunk.ChunkID{}
+		if err := id.FromString(key); err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Compare(ids[j]) < 0
+	})
+	rows := make([][]string, 0, len(ids))
+	for _, id := range ids {
+		chunkResult := result.ChunkMap[id.ToString()]
+		notes := make([]string, 0, 3)
+		if chunkResult.Range != nil && chunkResult.Range.Partition != "" {
+			notes = append(notes, fmt.Sprintf("partition: %s", chunkResult.Range.Partition))
+		}
+		if chunkResult.CountMismatch {
+			notes = append(notes, fmt.Sprintf("count mismatch: %d vs %d", chunkResult.UpstreamCount, chunkResult.DownstreamCount))
+		}
+		if chunkResult.ExceedDiffLimit {
+			notes = append(notes, "exceed max-diff-rows-per-chunk")
+		}
+		rows = append(rows, []string{name, id.ToString(), strconv.Itoa(chunkResult.RowsAdd),
+			strconv.Itoa(chunkResult.RowsDelete), strings.Join(notes, ", ")})
+	}
+	return rows
+}
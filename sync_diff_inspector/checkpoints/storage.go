@@ -0,0 +1,269 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoints
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/pingcap/tidb/br/pkg/storage"
+	"github.com/siddontang/go/ioutil2"
+)
+
+const (
+	// CheckpointSchema is the schema of the checkpoint table in the target.
+	CheckpointSchema = "sync_diff_inspector"
+	// CheckpointTable is the table saving the checkpoints in the target, a row for each output dir.
+	CheckpointTable = "sync_diff_checkpoints"
+)
+
+// Storage saves the state of the checkpoint.
+type Storage interface {
+	// Exists returns true if a state is saved.
+	Exists(ctx context.Context) (bool, error)
+	// Load returns the saved state.
+	Load(ctx context.Context) ([]byte, error)
+	// Save replaces the saved state.
+	Save(ctx context.Context, data []byte) error
+	// Remove removes the saved state, it's ok if no state is saved.
+	Remove(ctx context.Context) error
+	// String returns where the state is saved, it's used in the logs.
+	String() string
+}
+
+// previousLoader is implemented by the storages keeping the previous state, which is loaded
+// if the latest one is corrupt.
+type previousLoader interface {
+	LoadPrevious(ctx context.Context) ([]byte, error)
+}
+
+// FileStorage saves the state into a local file, the previous state is kept in the file with the suffix `.prev`.
+type FileStorage struct {
+	path string
+}
+
+// NewFileStorage returns the storage of the file.
+func NewFileStorage(path string) *FileStorage {
+	return &FileStorage{path: path}
+}
+
+func (s *FileStorage) prevPath() string {
+	return s.path + ".prev"
+}
+
+// Exists implements Storage.Exists. The previous state counts, since the latest one is missing
+// for a moment when it's replaced.
+func (s *FileStorage) Exists(_ context.Context) (bool, error) {
+	return ioutil2.FileExists(s.path) || ioutil2.FileExists(s.prevPath()), nil
+}
+
+// Load implements Storage.Load.
+func (s *FileStorage) Load(_ context.Context) ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	return data, errors.Trace(err)
+}
+
+// LoadPrevious returns the state saved before the latest one.
+func (s *FileStorage) LoadPrevious(_ context.Context) ([]byte, error) {
+	data, err := os.ReadFile(s.prevPath())
+	return data, errors.Trace(err)
+}
+
+// Save implements Storage.Save. The data is written into a temporary file and synced before it replaces
+// the latest state, so the file is never truncated if the process is killed, and the latest state is kept
+// as the previous one.
+func (s *FileStorage) Save(_ context.Context, data []byte) error {
+	dir, name := filepath.Split(s.path)
+	if dir == "" {
+		dir = "."
+	}
+	tmpFile, err := os.CreateTemp(dir, name+".tmp")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tmpPath := tmpFile.Name()
+	if _, err = tmpFile.Write(data); err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, config.LocalFilePerm)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Trace(err)
+	}
+	if ioutil2.FileExists(s.path) {
+		if err := os.Rename(s.path, s.prevPath()); err != nil {
+			os.Remove(tmpPath)
+			return errors.Trace(err)
+		}
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(syncDir(dir))
+}
+
+// syncDir syncs the dir, so that the renamed files are persisted.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Remove implements Storage.Remove.
+func (s *FileStorage) Remove(_ context.Context) error {
+	for _, path := range []string{s.path, s.prevPath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (s *FileStorage) String() string {
+	return s.path
+}
+
+// MySQLStorage saves the state into the checkpoint table of the target, so that the comparison can be resumed
+// on another host. The row is identified by the output dir, and the config hash is checked by the hash saved in the state.
+type MySQLStorage struct {
+	db        *sql.DB
+	outputDir string
+}
+
+// NewMySQLStorage creates the checkpoint table if not exists.
+func NewMySQLStorage(ctx context.Context, db *sql.DB, outputDir string) (*MySQLStorage, error) {
+	s := &MySQLStorage{db: db, outputDir: outputDir}
+	if err := s.createTable(ctx); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return s, nil
+}
+
+func (s *MySQLStorage) tableName() string {
+	return dbutil.TableName(CheckpointSchema, CheckpointTable)
+}
+
+func (s *MySQLStorage) createTable(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", dbutil.ColumnName(CheckpointSchema))); err != nil {
+		return errors.Annotatef(err, "create the schema of the checkpoint table %s", s.tableName())
+	}
+	createTableSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"`output_dir` VARCHAR(255) NOT NULL, "+
+		"`state` LONGBLOB NOT NULL, "+
+		"`update_time` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, "+
+		"PRIMARY KEY (`output_dir`))", s.tableName())
+	if _, err := s.db.ExecContext(ctx, createTableSQL); err != nil {
+		return errors.Annotatef(err, "create the checkpoint table %s", s.tableName())
+	}
+	return nil
+}
+
+// Exists implements Storage.Exists.
+func (s *MySQLStorage) Exists(ctx context.Context) (bool, error) {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE `output_dir` = ?", s.tableName())
+	if err := s.db.QueryRowContext(ctx, query, s.outputDir).Scan(&count); err != nil {
+		return false, errors.Trace(err)
+	}
+	return count > 0, nil
+}
+
+// Load implements Storage.Load.
+func (s *MySQLStorage) Load(ctx context.Context) ([]byte, error) {
+	var data []byte
+	query := fmt.Sprintf("SELECT `state` FROM %s WHERE `output_dir` = ?", s.tableName())
+	if err := s.db.QueryRowContext(ctx, query, s.outputDir).Scan(&data); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return data, nil
+}
+
+// Save implements Storage.Save.
+func (s *MySQLStorage) Save(ctx context.Context, data []byte) error {
+	query := fmt.Sprintf("REPLACE INTO %s (`output_dir`, `state`) VALUES (?, ?)", s.tableName())
+	_, err := s.db.ExecContext(ctx, query, s.outputDir, data)
+	return errors.Trace(err)
+}
+
+// Remove implements Storage.Remove.
+func (s *MySQLStorage) Remove(ctx context.Context) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE `output_dir` = ?", s.tableName())
+	_, err := s.db.ExecContext(ctx, query, s.outputDir)
+	return errors.Trace(err)
+}
+
+func (s *MySQLStorage) String() string {
+	return fmt.Sprintf("%s of %s", s.tableName(), s.outputDir)
+}
+
+// ExternalFileStorage saves the state into a file of the external storage, e.g. S3 or GCS, so that the comparison
+// can be resumed on another host. The config hash is checked by the hash saved in the state.
+type ExternalFileStorage struct {
+	store storage.ExternalStorage
+	name  string
+}
+
+// NewExternalFileStorage returns the storage of the file `name` in the external storage.
+func NewExternalFileStorage(store storage.ExternalStorage, name string) *ExternalFileStorage {
+	return &ExternalFileStorage{store: store, name: name}
+}
+
+// Exists implements Storage.Exists.
+func (s *ExternalFileStorage) Exists(ctx context.Context) (bool, error) {
+	ok, err := s.store.FileExists(ctx, s.name)
+	return ok, errors.Trace(err)
+}
+
+// Load implements Storage.Load.
+func (s *ExternalFileStorage) Load(ctx context.Context) ([]byte, error) {
+	data, err := s.store.ReadFile(ctx, s.name)
+	return data, errors.Trace(err)
+}
+
+// Save implements Storage.Save, the object is replaced as a whole, so it's never read partially.
+func (s *ExternalFileStorage) Save(ctx context.Context, data []byte) error {
+	return errors.Trace(s.store.WriteFile(ctx, s.name, data))
+}
+
+// Remove implements Storage.Remove.
+func (s *ExternalFileStorage) Remove(ctx context.Context) error {
+	ok, err := s.store.FileExists(ctx, s.name)
+	if err != nil || !ok {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.store.DeleteFile(ctx, s.name))
+}
+
+// Name returns the name of the file in the external storage.
+func (s *ExternalFileStorage) Name() string {
+	return s.name
+}
+
+func (s *ExternalFileStorage) String() string {
+	return fmt.Sprintf("%s in %s", s.name, s.store.URI())
+}
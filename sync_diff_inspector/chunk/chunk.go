@@ -150,6 +150,10 @@ type Range struct {
 	Where string        `json:"where"`
 	Args  []interface{} `json:"args"`
 
+	// Partition is the partition of the table containing the chunk if the table is split by partitions,
+	// then the first and the last chunks of the table are only decided by `IsFirst` and `IsLast`.
+	Partition string `json:"partition,omitempty"`
+
 	columnOffset map[string]int
 }
 
@@ -187,8 +191,8 @@ func NewChunkRangeOffset(columnOffset map[string]int) *Range {
 }
 
 func (c *Range) IsLastChunkForTable() bool {
-	if c.IsLast {
-		return true
+	if c.IsLast || c.Partition != "" {
+		return c.IsLast
 	}
 	// calculate from bounds
 	for _, b := range c.Bounds {
@@ -200,8 +204,8 @@ func (c *Range) IsLastChunkForTable() bool {
 }
 
 func (c *Range) IsFirstChunkForTable() bool {
-	if c.IsFirst {
-		return true
+	if c.IsFirst || c.Partition != "" {
+		return c.IsFirst
 	}
 	// calculate from bounds
 	for _, b := range c.Bounds {
@@ -245,6 +249,13 @@ func (c *Range) ToString(collation string) (string, []interface{}) {
 	preConditionArgsForLower := make([]interface{}, 0, 1)
 	preConditionArgsForUpper := make([]interface{}, 0, 1)
 
+	// the bounds after `lastUpper` have no upper, which means the upper of them is infinite,
+	// so the upper bound of `lastUpper` is inclusive.
+	lastUpper := len(c.Bounds) - 1
+	for lastUpper > 0 && !c.Bounds[lastUpper].HasUpper {
+		lastUpper--
+	}
+
 	i := 0
 	for ; i < len(c.Bounds); i++ {
 		bound := c.Bounds[i]
@@ -264,7 +275,7 @@ func (c *Range) ToString(collation string) (string, []interface{}) {
 		bound := c.Bounds[i]
 		lowerSymbol := gt
 		upperSymbol := lt
-		if i == len(c.Bounds)-1 {
+		if i == lastUpper {
 			upperSymbol = lte
 		}
 
@@ -414,6 +425,7 @@ func (c *Range) Clone() *Range {
 	newChunk.Index = c.Index.Copy()
 	newChunk.IsFirst = c.IsFirst
 	newChunk.IsLast = c.IsLast
+	newChunk.Partition = c.Partition
 	return newChunk
 }
 
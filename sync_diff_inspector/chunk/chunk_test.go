@@ -388,6 +388,30 @@ func TestChunkToString(t *testing.T) {
 	require.Equal(t, chunk.ToMeta(), "range in sequence: Full")
 }
 
+func TestChunkToStringWithoutTrailingUpper(t *testing.T) {
+	// the upper of `b` is infinite, so the upper of `a` is inclusive.
+	chunk := &Range{
+		Bounds: []*Bound{
+			{
+				Column:   "a",
+				Lower:    "1",
+				Upper:    "2",
+				HasLower: true,
+				HasUpper: true,
+			}, {
+				Column:   "b",
+				Lower:    "3",
+				HasLower: true,
+				HasUpper: false,
+			},
+		},
+	}
+
+	conditions, args := chunk.ToString("")
+	require.Equal(t, "((`a` > ?) OR (`a` = ? AND `b` > ?)) AND ((`a` <= ?))", conditions)
+	require.Equal(t, []interface{}{"1", "1", "3", "2"}, args)
+}
+
 func TestChunkInit(t *testing.T) {
 	chunks := []*Range{
 		{
@@ -611,4 +635,14 @@ func TestChunkIndex(t *testing.T) {
 	}
 	require.False(t, chunkRange.IsLastChunkForTable())
 	require.False(t, chunkRange.IsFirstChunkForTable())
+
+	// the chunks split by partitions are only decided by the flags, since a partition has its own bounds.
+	chunkRange.Bounds = []*Bound{}
+	chunkRange.Partition = "p1"
+	require.False(t, chunkRange.IsLastChunkForTable())
+	require.False(t, chunkRange.IsFirstChunkForTable())
+	chunkRange.IsFirst, chunkRange.IsLast = true, true
+	require.True(t, chunkRange.IsLastChunkForTable())
+	require.True(t, chunkRange.IsFirstChunkForTable())
+	require.Equal(t, "p1", chunkRange.Clone().Partition)
 }
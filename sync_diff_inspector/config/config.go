@@ -15,20 +15,28 @@ package config
 
 import (
 	"crypto/sha256"
+	"crypto/tls"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/go-sql-driver/mysql"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
 	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
 	router "github.com/pingcap/tidb-tools/pkg/table-router"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/chaos"
+	"github.com/pingcap/tidb/br/pkg/storage"
 	"github.com/pingcap/tidb/parser/model"
 	flag "github.com/spf13/pflag"
 	"go.uber.org/zap"
@@ -39,8 +47,149 @@ const (
 	LocalFilePerm os.FileMode = 0o644
 
 	LogFileName = "sync_diff.log"
+
+	// the passwords are replaced by it when the config is logged.
+	redactedPassword = "******"
+
+	// the network of the mysql driver registered with the dialer selecting the addresses of the hosts.
+	dialerNetwork = "sync_diff_tcp"
+
+	// DefaultTableThreadCount is the default number of tables split into chunks concurrently.
+	DefaultTableThreadCount = 3
+	// DefaultGCSafePointTTL is the default ttl in seconds of the service safepoint.
+	DefaultGCSafePointTTL = 5 * 60
+	// DefaultBinSearchFanOut is the default number of parts a mismatched chunk is split into in each round of binary search.
+	DefaultBinSearchFanOut = 2
+	// DefaultMaxChecksumTimeouts is the default number of checksum timeouts of a table before comparing its rows directly.
+	DefaultMaxChecksumTimeouts = 3
+	// DefaultMinFreeDiskSpace is the default min free space in bytes of the output directories.
+	DefaultMinFreeDiskSpace = 64 << 20
+	// DefaultFullRunInterval is the default number of incremental runs before a forced full run.
+	DefaultFullRunInterval = 10
+	// DefaultCheckpointFlushInterval is the default interval in seconds to save the checkpoint.
+	DefaultCheckpointFlushInterval = 10
+	// DefaultFloatTolerance is the default max difference of the FLOAT/DOUBLE values regarded as equal.
+	DefaultFloatTolerance = 1e-6
+)
+
+const (
+	// SummaryFilterAll lists all the tables in the summary.
+	SummaryFilterAll = "all"
+	// SummaryFilterFailed only lists the failed or errored tables in the summary.
+	SummaryFilterFailed = "failed"
+
+	// SummarySortByName sorts the tables in the summary by their names.
+	SummarySortByName = "name"
+	// SummarySortByDiffRows sorts the tables in the summary by their different rows, the most first.
+	SummarySortByDiffRows = "diff-rows"
+	// SummarySortByDuration sorts the tables in the summary by the time spent to compare them, the longest first.
+	SummarySortByDuration = "duration"
 )
 
+const (
+	// CheckpointStorageFile saves the checkpoint into the checkpoint dir of the output dir.
+	CheckpointStorageFile = "file"
+	// CheckpointStorageMySQL saves the checkpoint into a table of the target, so that the comparison can be
+	// resumed on another host.
+	CheckpointStorageMySQL = "mysql"
+)
+
+// SourceTypeMock is the type of the data source generating synthetic tables, for offline testing and demos.
+const SourceTypeMock = "mock"
+
+const (
+	// SnapshotModeAuto uses `tidb_snapshot` if it's allowed, otherwise `AS OF TIMESTAMP`.
+	SnapshotModeAuto = "auto"
+	// SnapshotModeTiDBSnapshot reads the snapshot by the session variable `tidb_snapshot`.
+	SnapshotModeTiDBSnapshot = "tidb-snapshot"
+	// SnapshotModeAsOfTimestamp reads the snapshot by the stale read `AS OF TIMESTAMP`.
+	SnapshotModeAsOfTimestamp = "as-of-timestamp"
+	// SnapshotModeNone ignores the snapshot and reads the latest data.
+	SnapshotModeNone = "none"
+)
+
+const (
+	// OnErrorSkipTable skips the rest chunks of the table when the table meets error.
+	OnErrorSkipTable = "skip-table"
+	// OnErrorFailRun stops the whole comparison when any table meets error.
+	OnErrorFailRun = "fail-run"
+	// OnErrorRetryPrefix is the prefix of the policy `retry-N`, which retries
+	// the failed chunk N times and then skips the table.
+	OnErrorRetryPrefix = "retry-"
+)
+
+const (
+	// LargeTableSkip skips the data-check of the tables larger than `large-table-threshold`.
+	LargeTableSkip = "skip"
+	// LargeTableDefer checks the tables larger than `large-table-threshold` after all the other tables.
+	LargeTableDefer = "defer"
+)
+
+const (
+	// TableOrderName compares the tables in the descending order of their names.
+	TableOrderName = "name"
+	// TableOrderLargestFirst compares the tables in the descending order of their estimated sizes.
+	TableOrderLargestFirst = "largest-first"
+	// TableOrderSmallestFirst compares the tables in the ascending order of their estimated sizes.
+	TableOrderSmallestFirst = "smallest-first"
+	// TableOrderPriority compares the tables matching the earlier patterns of `priority-tables` first.
+	TableOrderPriority = "priority"
+)
+
+const (
+	// ChecksumCRC32 XORs the CRC32 of the rows, it's fast but collides more likely on the chunks of billions of rows.
+	ChecksumCRC32 = "crc32"
+	// ChecksumSHA1 XORs the first 60 bits of the SHA1 of the rows.
+	ChecksumSHA1 = "sha1"
+	// ChecksumNone only counts the rows, it's used by `check-count-only` instead of `checksum-algorithm`.
+	ChecksumNone = "none"
+)
+
+// ErrorPolicy decides what to do when the checksum of a table keeps erroring.
+type ErrorPolicy struct {
+	// Action is `skip-table` or `fail-run`.
+	Action string
+	// RetryCount is the number of retries before taking the action.
+	RetryCount int
+}
+
+// ParseErrorPolicy parses the `on-error` config, the empty string means `skip-table`.
+func ParseErrorPolicy(policy string) (*ErrorPolicy, error) {
+	switch {
+	case policy == "" || policy == OnErrorSkipTable:
+		return &ErrorPolicy{Action: OnErrorSkipTable}, nil
+	case policy == OnErrorFailRun:
+		return &ErrorPolicy{Action: OnErrorFailRun}, nil
+	case strings.HasPrefix(policy, OnErrorRetryPrefix):
+		n, err := strconv.Atoi(strings.TrimPrefix(policy, OnErrorRetryPrefix))
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid on-error policy %s, the retry count should be a non-negative integer", policy)
+		}
+		return &ErrorPolicy{Action: OnErrorSkipTable, RetryCount: n}, nil
+	default:
+		return nil, errors.Errorf("invalid on-error policy %s, should be one of `skip-table`, `fail-run` and `retry-N`", policy)
+	}
+}
+
+// ParseCheckWindow parses the `check-window` config, which is a duration like "12h" or a number of days like "7d".
+func ParseCheckWindow(window string) (time.Duration, error) {
+	var (
+		d   time.Duration
+		err error
+	)
+	if days := strings.TrimSuffix(window, "d"); days != window {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(window)
+	}
+	if err != nil || d <= 0 {
+		return 0, errors.Errorf("invalid check-window %s, should be a positive duration like `12h` or days like `7d`", window)
+	}
+	return d, nil
+}
+
 // TableConfig is the config of table.
 type TableConfig struct {
 	// table's filter to tell us which table should adapt to this config.
@@ -55,10 +204,21 @@ type TableConfig struct {
 
 	// columns be ignored, will not check this column's data
 	IgnoreColumns []string `toml:"ignore-columns"`
+	// only check these columns and the unique key if it's not empty
+	Columns []string `toml:"columns" json:"columns,omitempty"`
 	// field should be the primary key, unique key or field with index
 	Fields []string `toml:"index-fields"`
 	// select range, for example: "age > 10 AND age < 20"
 	Range string `toml:"range"`
+	// the rows matching it are ignored on both sides, for example: "deleted_at IS NOT NULL"
+	IgnoreWhere string `toml:"ignore-where" json:"ignore-where,omitempty"`
+	// the column recording the last modified time of the rows, for example: "updated_at".
+	// only the rows changed since the last successful run are compared in the incremental mode.
+	ChangeHintColumn string `toml:"change-hint-column" json:"change-hint-column,omitempty"`
+	// the time column of the append-only table and the window before now, for example: "created_at" and "7d".
+	// only the rows in the window are split into chunks and compared, the history before it isn't scanned again.
+	TimeColumn  string `toml:"time-column" json:"time-column,omitempty"`
+	CheckWindow string `toml:"check-window" json:"check-window,omitempty"`
 
 	TargetTableInfo *model.TableInfo
 
@@ -67,6 +227,77 @@ type TableConfig struct {
 
 	// specify the chunksize for the table
 	ChunkSize int64 `toml:"chunk-size" json:"chunk-size"`
+	// the max number of the chunks of the table compared concurrently, which limits how many of the
+	// `check-thread-count` workers the table may occupy. 0 means no limit.
+	CheckThreadCount int `toml:"check-thread-count" json:"check-thread-count,omitempty"`
+
+	// policy when the table meets error, overrides the global `on-error`.
+	OnError string `toml:"on-error" json:"on-error,omitempty"`
+
+	// the FLOAT/DOUBLE values differing by no more than it are regarded as equal when comparing the rows,
+	// 0 means `DefaultFloatTolerance`.
+	FloatTolerance float64 `toml:"float-tolerance" json:"float-tolerance,omitempty"`
+	// the tolerances of the numeric columns by name, which override `float-tolerance` and apply to
+	// the DECIMAL columns as well, for example: {price = 0.01}.
+	ColumnTolerances map[string]float64 `toml:"column-tolerances" json:"column-tolerances,omitempty"`
+	// the columns of the target renamed in the source, which maps the target columns to the source columns,
+	// for example: {user_id = "uid"}.
+	ColumnMap map[string]string `toml:"column-map" json:"column-map,omitempty"`
+	// the SQL expressions selected instead of the columns of the source or the target, which map the target columns
+	// to the expressions, for example: {email = "LOWER(email)", amount = "ROUND(amount, 2)"}.
+	SourceExpressions map[string]string `toml:"source-expressions" json:"source-expressions,omitempty"`
+	TargetExpressions map[string]string `toml:"target-expressions" json:"target-expressions,omitempty"`
+	// the values of these columns never leave the databases, they are compared by their SHA2 hashes computed
+	// by the databases, and they are redacted in the fix sql.
+	SensitiveColumns []string `toml:"sensitive-columns" json:"sensitive-columns,omitempty"`
+	// only these partitions of the range or hash partitioned target table are compared one by one,
+	// e.g. the recent partitions of a huge fact table.
+	Partitions []string `toml:"partitions" json:"partitions,omitempty"`
+
+	// Internally used to indicate the table is the result set of a query check.
+	QueryCheck *QueryCheck `toml:"-" json:"-"`
+}
+
+// QueryCheck compares the result sets of the equivalent queries on the source and the target,
+// so the derived or aggregated tables can be validated.
+type QueryCheck struct {
+	// the name of the check in the format of `schema.table`, which is used in the report and the checkpoint.
+	// the fix sql is generated for this table.
+	TargetTable string `toml:"target-table" json:"target-table"`
+	// the SELECT statements of the source and the target, they must return the same columns.
+	SourceQuery string `toml:"source-query" json:"source-query"`
+	TargetQuery string `toml:"target-query" json:"target-query"`
+	// the columns which identify a row of the result set, the chunks are split and the rows are ordered by them.
+	KeyColumns []string `toml:"key-columns" json:"key-columns"`
+	// specify the chunksize for the result set
+	ChunkSize int64 `toml:"chunk-size" json:"chunk-size"`
+	// policy when the check meets error, overrides the global `on-error`.
+	OnError string `toml:"on-error" json:"on-error,omitempty"`
+
+	// Internally used to indicate the target table.
+	Schema string `toml:"-" json:"-"`
+	Table  string `toml:"-" json:"-"`
+}
+
+// Valid returns true if the query check is valid.
+func (q *QueryCheck) Valid() bool {
+	if len(q.SourceQuery) == 0 || len(q.TargetQuery) == 0 {
+		log.Error("source-query and target-query can't be empty in QueryCheck")
+		return false
+	}
+	if len(q.KeyColumns) == 0 {
+		log.Error("key-columns can't be empty in QueryCheck")
+		return false
+	}
+	if q.ChunkSize < 0 {
+		log.Error("chunk-size must not be less than 0 in QueryCheck")
+		return false
+	}
+	if _, err := ParseErrorPolicy(q.OnError); err != nil {
+		log.Error("invalid on-error in QueryCheck", zap.Error(err))
+		return false
+	}
+	return true
 }
 
 // Valid returns true if table's config is valide.
@@ -75,6 +306,24 @@ func (t *TableConfig) Valid() bool {
 		log.Error("target tables can't be empty in TableConfig")
 		return false
 	}
+	if _, err := ParseErrorPolicy(t.OnError); err != nil {
+		log.Error("invalid on-error in TableConfig", zap.Error(err))
+		return false
+	}
+	if t.ChunkSize < 0 || t.CheckThreadCount < 0 {
+		log.Error("chunk-size and check-thread-count must not be less than 0 in TableConfig")
+		return false
+	}
+	if (t.TimeColumn == "") != (t.CheckWindow == "") {
+		log.Error("time-column and check-window must be set together in TableConfig")
+		return false
+	}
+	if t.CheckWindow != "" {
+		if _, err := ParseCheckWindow(t.CheckWindow); err != nil {
+			log.Error("invalid check-window in TableConfig", zap.Error(err))
+			return false
+		}
+	}
 
 	return true
 }
@@ -87,21 +336,131 @@ type DataSource struct {
 	Password string `toml:"password" json:"password"`
 	SqlMode  string `toml:"sql-mode" json:"sql-mode"`
 	Snapshot string `toml:"snapshot" json:"snapshot"`
+	// SnapshotMode is how the snapshot is read, `auto` by default.
+	SnapshotMode string `toml:"snapshot-mode" json:"snapshot-mode,omitempty"`
+	// ResolvedSnapshotMode is the mode detected from the capability of the instance when SnapshotMode is `auto`.
+	ResolvedSnapshotMode string `toml:"-" json:"-"`
 
 	RouteRules []string `toml:"route-rules" json:"route-rules"`
 	Router     *router.Table
 
+	// the pd addresses to keep GC stopped when the instance is TiDB, e.g. the proxies of pd.
+	// the pd addresses are fetched from TiDB if it's empty.
+	PDAddrs []string `toml:"pd-addrs" json:"pd-addrs,omitempty"`
+	// the TLS config to connect to pd.
+	PDSecurity *Security `toml:"pd-security" json:"pd-security,omitempty"`
+	// the keyspace of the TiDB in a multi-tenant cluster.
+	KeyspaceName string `toml:"keyspace-name" json:"keyspace-name,omitempty"`
+	// the TLS config to connect to the instance, the connection isn't encrypted if it's nil.
+	Security *Security `toml:"security" json:"security,omitempty"`
+	// TLSName is the name of the registered TLS config of Security.
+	TLSName string `toml:"-" json:"-"`
+	// Net is the network of the registered dialer selecting the address of the host.
+	Net string `toml:"-" json:"-"`
+	// ReadOnly is true for the target if the fix sql isn't applied, then the sessions are read-only and
+	// the statements other than SELECT and SHOW are refused.
+	ReadOnly bool `toml:"-" json:"-"`
+	// SessionTimeZone is the `@@session.time_zone` of the connections, and Location is the location it represents,
+	// they are set after connecting, and Location is nil if the time zone is unknown.
+	SessionTimeZone string         `toml:"-" json:"-"`
+	Location        *time.Location `toml:"-" json:"-"`
+
 	Conn *sql.DB
-	// SourceType string `toml:"source-type" json:"source-type"`
+	// SourceType is empty for the MySQL or TiDB instance, or `mock` to generate synthetic tables.
+	SourceType string `toml:"source-type" json:"source-type,omitempty"`
+	// Mock is the config of the synthetic tables when SourceType is `mock`.
+	Mock *MockConfig `toml:"mock" json:"mock,omitempty"`
+}
+
+// SyncPointConfig is the config to pick the snapshots of both sides from the syncpoint table of a TiCDC changefeed.
+type SyncPointConfig struct {
+	// the changefeed replicating the source to the target with syncpoint enabled.
+	Changefeed string `toml:"changefeed" json:"changefeed"`
+	// the id of the TiCDC cluster, it's only needed if several TiCDC clusters replicate to the target.
+	ClusterID string `toml:"cluster-id" json:"cluster-id,omitempty"`
+}
+
+const (
+	// DiffEventsProtocolCanalJSON encodes the different rows as the canal-json messages of TiCDC.
+	DiffEventsProtocolCanalJSON = "canal-json"
+	// DiffEventsProtocolOpen encodes the different rows as the open protocol messages of TiCDC.
+	DiffEventsProtocolOpen = "open-protocol"
+	// DiffEventsFileName is the default file of the row change events in the output dir.
+	DiffEventsFileName = "diff_events.json"
+)
+
+// DiffEventsConfig is the config to emit the different rows as row change events,
+// so that the existing pipelines consuming the changefeeds can apply them.
+type DiffEventsConfig struct {
+	// the protocol of the events: canal-json or open-protocol.
+	Protocol string `toml:"protocol" json:"protocol"`
+	// the events are appended to the file, one message per line. empty means diff_events.json in the output dir.
+	File string `toml:"file" json:"file,omitempty"`
+	// the events are sent to the kafka topic instead of the file if the addresses are set.
+	KafkaAddrs []string `toml:"kafka-addrs" json:"kafka-addrs,omitempty"`
+	KafkaTopic string   `toml:"kafka-topic" json:"kafka-topic,omitempty"`
+}
+
+// MockConfig is the config of the synthetic tables generated by the mock source.
+type MockConfig struct {
+	// the number of tables `mock`.`t0`, `mock`.`t1`, ...
+	Tables int `toml:"tables" json:"tables"`
+	// the number of rows in each table.
+	Rows int64 `toml:"rows" json:"rows"`
+	// the seed to generate the rows, the rows are the same on both sides with the same seed.
+	Seed int64 `toml:"seed" json:"seed"`
+	// the rate of the rows which are missing or changed, in [0, 1].
+	CorruptionRate float64 `toml:"corruption-rate" json:"corruption-rate"`
+}
+
+// IsMock returns true if the data source generates synthetic tables instead of connecting to an instance.
+func (d *DataSource) IsMock() bool {
+	return d.SourceType == SourceTypeMock
+}
+
+// Security is the TLS config.
+type Security struct {
+	CAPath   string `toml:"ca-path" json:"ca-path"`
+	CertPath string `toml:"cert-path" json:"cert-path"`
+	KeyPath  string `toml:"key-path" json:"key-path"`
+}
+
+// GetSnapshotMode returns the mode to read the snapshot, which is resolved by the capability of the instance
+// if it's `auto`. It returns `auto` before the mode is resolved.
+func (d *DataSource) GetSnapshotMode() string {
+	if d.ResolvedSnapshotMode != "" {
+		return d.ResolvedSnapshotMode
+	}
+	if d.SnapshotMode == "" {
+		return SnapshotModeAuto
+	}
+	return d.SnapshotMode
+}
+
+// GetStaleReadSnapshot returns the snapshot to read by `AS OF TIMESTAMP`, it's empty if the snapshot is read in other ways.
+func (d *DataSource) GetStaleReadSnapshot() string {
+	if d.GetSnapshotMode() != SnapshotModeAsOfTimestamp {
+		return ""
+	}
+	return d.Snapshot
 }
 
 func (d *DataSource) ToDBConfig() *dbutil.DBConfig {
+	snapshot := d.Snapshot
+	switch d.GetSnapshotMode() {
+	case SnapshotModeAsOfTimestamp, SnapshotModeNone:
+		// the snapshot isn't read by the session variable
+		snapshot = ""
+	}
 	return &dbutil.DBConfig{
 		Host:     d.Host,
 		Port:     d.Port,
 		User:     d.User,
 		Password: d.Password,
-		Snapshot: d.Snapshot,
+		Snapshot: snapshot,
+		TLSName:  d.TLSName,
+		Net:      d.Net,
+		ReadOnly: d.ReadOnly,
 	}
 }
 
@@ -111,6 +470,9 @@ type TaskConfig struct {
 	Target       string   `toml:"target-instance" json:"target-instance"`
 	CheckTables  []string `toml:"target-check-tables" json:"target-check-tables"`
 	TableConfigs []string `toml:"target-configs" json:"target-configs"`
+	QueryChecks  []string `toml:"query-checks" json:"query-checks,omitempty"`
+	// the data values of these tables, e.g. the chunk bounds and the rows, are redacted in the logs and the report.
+	SensitiveTables []string `toml:"sensitive-tables" json:"sensitive-tables,omitempty"`
 	// OutputDir include these
 	// 1. checkpoint Dir
 	// 2. fix-target-sql Dir
@@ -118,20 +480,69 @@ type TaskConfig struct {
 	// 4. sync diff log file
 	// 5. fix
 	OutputDir string `toml:"output-dir" json:"output-dir"`
+	// CheckpointStorage is where the checkpoint is saved, `file` or `mysql`, empty means `file`.
+	CheckpointStorage string `toml:"checkpoint-storage" json:"checkpoint-storage,omitempty"`
+	// ExternalStorage is the URI of the external storage, e.g. `s3://bucket/prefix`, the checkpoint and the fix sql
+	// files are saved into it besides the output dir.
+	ExternalStorage string `toml:"external-storage" json:"external-storage,omitempty"`
 
 	SourceInstances    []*DataSource
 	TargetInstance     *DataSource
 	TargetTableConfigs []*TableConfig
 	TargetCheckTables  filter.Filter
+	TargetQueryChecks  []*QueryCheck `json:"-"`
 
 	FixDir        string
 	CheckpointDir string
 	HashFile      string
+	// ConfigHash is the hash of the task, the checkpoint can be used only if its hash is the same.
+	ConfigHash string `toml:"-" json:"-"`
+	// ForceResume resumes from the checkpoint even if the config hash is different, it's set by `--force-resume`.
+	ForceResume bool `toml:"-" json:"-"`
+
+	// RecheckTables restricts the run to some tables of the task, it's set by `--tables`.
+	RecheckTables       []string      `toml:"-" json:"-"`
+	TargetRecheckTables filter.Filter `toml:"-" json:"-"`
+	// FailedTables restricts the run to the tables failed in the last run, it's set by `--check-failed-only`.
+	FailedTables []filter.Table `toml:"-" json:"-"`
+
+	// TargetSensitiveTables is nil if no table is sensitive.
+	TargetSensitiveTables filter.Filter `toml:"-" json:"-"`
+
+	// ImportedTables restricts the run to the tables imported by TiDB Lightning, keyed by dbutil.TableName.
+	ImportedTables map[string]*LightningTable `toml:"-" json:"-"`
+}
+
+// UseMySQLCheckpoint returns true if the checkpoint is saved in the target. A re-check always starts over,
+// so its checkpoint is still saved in the local file.
+func (t *TaskConfig) UseMySQLCheckpoint() bool {
+	return t.CheckpointStorage == CheckpointStorageMySQL && !t.IsRecheck()
+}
+
+// UseExternalStorage returns true if the checkpoint and the fix sql files are saved into the external storage.
+// A re-check always starts over, so its files are only kept in the output dir.
+func (t *TaskConfig) UseExternalStorage() bool {
+	return len(t.ExternalStorage) > 0 && !t.IsRecheck()
+}
+
+// IsRecheck returns true if only some tables of the task are re-checked.
+func (t *TaskConfig) IsRecheck() bool {
+	return len(t.RecheckTables) > 0 || len(t.FailedTables) > 0
+}
+
+// IsImported returns true if the table has been imported by TiDB Lightning, or the run isn't restricted by Lightning.
+func (t *TaskConfig) IsImported(schema, table string) bool {
+	if t.ImportedTables == nil {
+		return true
+	}
+	_, ok := t.ImportedTables[dbutil.TableName(schema, table)]
+	return ok
 }
 
 func (t *TaskConfig) Init(
 	dataSources map[string]*DataSource,
 	tableConfigs map[string]*TableConfig,
+	queryChecks map[string]*QueryCheck,
 ) (err error) {
 	// Parse Source/Target
 	dataSourceList := make([]*DataSource, 0, len(t.Source))
@@ -158,6 +569,25 @@ func (t *TaskConfig) Init(
 		return errors.Annotate(err, "parse check tables failed")
 	}
 
+	if len(t.FailedTables) > 0 {
+		// the names of the failed tables are matched as they are, instead of being parsed as the filter rules.
+		t.TargetRecheckTables = filter.NewTablesFilter(t.FailedTables...)
+	} else if t.IsRecheck() {
+		t.TargetRecheckTables, err = filter.Parse(t.RecheckTables)
+		if err != nil {
+			log.Error("parse recheck tables failed", zap.Error(err))
+			return errors.Annotate(err, "parse recheck tables failed")
+		}
+	}
+
+	if len(t.SensitiveTables) > 0 {
+		t.TargetSensitiveTables, err = filter.Parse(t.SensitiveTables)
+		if err != nil {
+			log.Error("parse sensitive tables failed", zap.Error(err))
+			return errors.Annotate(err, "parse sensitive tables failed")
+		}
+	}
+
 	targetConfigs := t.TableConfigs
 	if targetConfigs != nil {
 		// table config can be nil
@@ -174,10 +604,45 @@ func (t *TaskConfig) Init(
 		t.TargetTableConfigs = tableConfigsList
 	}
 
+	queryCheckList := make([]*QueryCheck, 0, len(t.QueryChecks))
+	for _, c := range t.QueryChecks {
+		qc, ok := queryChecks[c]
+		if !ok {
+			log.Error("not found query check", zap.String("query check", c))
+			return errors.Errorf("not found query check. query check is `%s`", c)
+		}
+		schemaTable := strings.Split(qc.TargetTable, ".")
+		if len(schemaTable) != 2 || schemaTable[0] == "" || schemaTable[1] == "" {
+			return errors.Errorf("target-table of query check `%s` should be in the format of `schema.table`", c)
+		}
+		qc.Schema, qc.Table = schemaTable[0], schemaTable[1]
+		queryCheckList = append(queryCheckList, qc)
+	}
+	t.TargetQueryChecks = queryCheckList
+
+	switch t.CheckpointStorage {
+	case "", CheckpointStorageFile:
+	case CheckpointStorageMySQL:
+		if t.TargetInstance.IsMock() {
+			return errors.Errorf("checkpoint-storage can't be %s for the mock target", CheckpointStorageMySQL)
+		}
+	default:
+		return errors.Errorf("checkpoint-storage must be %s or %s", CheckpointStorageFile, CheckpointStorageMySQL)
+	}
+	if len(t.ExternalStorage) > 0 {
+		if t.CheckpointStorage == CheckpointStorageMySQL {
+			return errors.Errorf("checkpoint-storage can't be %s if external-storage is set", CheckpointStorageMySQL)
+		}
+		if _, err := storage.ParseBackend(t.ExternalStorage, nil); err != nil {
+			return errors.Annotate(err, "invalid external-storage")
+		}
+	}
+
 	hash, err := t.ComputeConfigHash()
 	if err != nil {
 		return errors.Trace(err)
 	}
+	t.ConfigHash = hash
 
 	// Create output Dir if not exists
 	ok, err = pathExists(t.OutputDir)
@@ -189,6 +654,10 @@ func (t *TaskConfig) Init(
 			return errors.Trace(err)
 		}
 	}
+	if t.IsRecheck() {
+		return t.initRecheckDirs()
+	}
+
 	// outputDir exists, we need to check the config hash for checkpoint.
 	t.CheckpointDir = filepath.Join(t.OutputDir, "checkpoint")
 	ok, err = pathExists(t.CheckpointDir)
@@ -212,8 +681,15 @@ func (t *TaskConfig) Init(
 			return errors.Trace(err)
 		}
 		if !ok {
-			// not match, raise error
-			return errors.Errorf("config changes breaking the checkpoint, please use another outputDir and start over again!")
+			if !t.ForceResume {
+				// not match, raise error
+				return errors.Errorf("config changes breaking the checkpoint, please use another outputDir and start over again! or set --force-resume to resume anyway")
+			}
+			log.Warn("config changes breaking the checkpoint, resume from it because of --force-resume")
+			err = os.WriteFile(filepath.Join(t.CheckpointDir, hash), []byte{}, LocalFilePerm)
+			if err != nil {
+				return errors.Trace(err)
+			}
 		}
 	}
 
@@ -225,6 +701,25 @@ func (t *TaskConfig) Init(
 	return nil
 }
 
+// initRecheckDirs uses separated checkpoint and fix sql dirs for re-checking some tables,
+// so that the checkpoint and fix sql files of the whole task are kept.
+// A re-check is expected to be small, so it always starts over instead of resuming from checkpoint.
+func (t *TaskConfig) initRecheckDirs() error {
+	t.CheckpointDir = filepath.Join(t.OutputDir, "checkpoint-recheck")
+	if err := os.RemoveAll(t.CheckpointDir); err != nil {
+		return errors.Trace(err)
+	}
+	if err := mkdirAll(t.CheckpointDir); err != nil {
+		return errors.Trace(err)
+	}
+
+	t.FixDir = filepath.Join(t.OutputDir, fmt.Sprintf("fix-on-%s-recheck", t.Target))
+	if err := mkdirAll(t.FixDir); err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
 // ComputeConfigHash compute the hash according to the task
 // if ConfigHash is as same as checkpoint.hash
 // we think the second sync diff can use the checkpoint.
@@ -256,10 +751,56 @@ func (t *TaskConfig) ComputeConfigHash() (string, error) {
 	for _, c := range targetCheckTables {
 		hash = append(hash, []byte(c)...)
 	}
+	// compute query checks
+	for _, c := range t.TargetQueryChecks {
+		configBytes, err = json.Marshal(c)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		hash = append(hash, configBytes...)
+	}
 
 	return fmt.Sprintf("%x", sha256.Sum256(hash)), nil
 }
 
+// ComputeResumeHash computes the hash of the effective config deciding the chunks and the compared rows, e.g. the
+// snapshots, the table filters and the chunk sizes. Unlike ComputeConfigHash, it's computed after the sources are
+// initialized, so the snapshots resolved from the sync point are included, and it's saved in the checkpoint.
+func (t *TaskConfig) ComputeResumeHash() (string, error) {
+	type resumeConfig struct {
+		SourceSnapshots []string       `json:"source-snapshots"`
+		TargetSnapshot  string         `json:"target-snapshot"`
+		CheckTables     []string       `json:"check-tables"`
+		RecheckTables   []string       `json:"recheck-tables"`
+		FailedTables    []filter.Table `json:"failed-tables"`
+		TableConfigs    []*TableConfig `json:"table-configs"`
+		QueryChecks     []*QueryCheck  `json:"query-checks"`
+	}
+	rc := &resumeConfig{
+		TargetSnapshot: t.TargetInstance.Snapshot,
+		CheckTables:    t.CheckTables,
+		RecheckTables:  t.RecheckTables,
+		FailedTables:   t.FailedTables,
+		QueryChecks:    t.TargetQueryChecks,
+	}
+	for _, ds := range t.SourceInstances {
+		rc.SourceSnapshots = append(rc.SourceSnapshots, ds.Snapshot)
+	}
+	for _, c := range t.TargetTableConfigs {
+		// the fields filled when matching the tables are left out, and so is the concurrency, which doesn't
+		// decide the chunks.
+		tc := *c
+		tc.Schema, tc.Table, tc.HasMatched, tc.TargetTableInfo = "", "", false, nil
+		tc.CheckThreadCount = 0
+		rc.TableConfigs = append(rc.TableConfigs, &tc)
+	}
+	data, err := json.Marshal(rc)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
 // Config is the configuration.
 type Config struct {
 	*flag.FlagSet `json:"-"`
@@ -268,15 +809,135 @@ type Config struct {
 	LogLevel string `toml:"-" json:"-"`
 	// how many goroutines are created to check data
 	CheckThreadCount int `toml:"check-thread-count" json:"check-thread-count"`
+	// how many tables are split into chunks concurrently, so that the chunks of small tables
+	// are not blocked by a huge one. 0 means `DefaultTableThreadCount`.
+	TableThreadCount int `toml:"table-thread-count" json:"table-thread-count,omitempty"`
 	// set true if want to compare rows
-	// set false won't compare rows.
+	// set false won't compare rows, only the chunks with different checksums are reported.
 	ExportFixSQL bool `toml:"export-fix-sql" json:"export-fix-sql"`
+	// set true if want to apply the fix sql to the target and verify the fixed chunks.
+	ApplyFixSQL bool `toml:"apply-fix" json:"apply-fix,omitempty"`
+	// how many parts a mismatched chunk is split into in each round of binary search.
+	// 0 means `DefaultBinSearchFanOut`.
+	BinSearchFanOut int `toml:"bin-search-fan-out" json:"bin-search-fan-out,omitempty"`
+	// the max number of different rows recorded for a chunk, the row-by-row comparison of the chunk
+	// stops once exceeded. 0 means no limit.
+	MaxDiffRowsPerChunk int `toml:"max-diff-rows-per-chunk" json:"max-diff-rows-per-chunk,omitempty"`
+	// set true if want to export a range-level reload suggestion for the chunks exceeding `max-diff-rows-per-chunk`.
+	ExportRangeReloadSQL bool `toml:"export-range-reload-sql" json:"export-range-reload-sql,omitempty"`
+	// the rest chunks of a table are skipped once the different rows or the failed chunks of the table
+	// exceed these thresholds. 0 means no limit.
+	MaxDiffRowsPerTable     int `toml:"max-diff-rows-per-table" json:"max-diff-rows-per-table,omitempty"`
+	MaxFailedChunksPerTable int `toml:"max-failed-chunks-per-table" json:"max-failed-chunks-per-table,omitempty"`
+	// the rest chunks of all the tables are skipped once the different rows of all the tables exceed it.
+	// 0 means no limit.
+	MaxDiffRowsTotal int64 `toml:"max-diff-rows-total" json:"max-diff-rows-total,omitempty"`
+	// the tables whose estimated size in bytes exceeds it are skipped or deferred according to
+	// `large-table-action`. 0 means no limit.
+	LargeTableThreshold int64 `toml:"large-table-threshold" json:"large-table-threshold,omitempty"`
+	// what to do with the large tables: skip or defer, default is skip.
+	LargeTableAction string `toml:"large-table-action" json:"large-table-action,omitempty"`
+	// the order to compare the tables: name, largest-first, smallest-first or priority, default is name.
+	// the tables are ordered by the patterns of `priority-tables` if it's priority.
+	TableOrder     string   `toml:"table-order" json:"table-order,omitempty"`
+	PriorityTables []string `toml:"priority-tables" json:"priority-tables,omitempty"`
+	// the algorithm of the checksum of the chunks: crc32 or sha1, default is crc32.
+	ChecksumAlgorithm string `toml:"checksum-algorithm" json:"checksum-algorithm,omitempty"`
 	// only check table struct without table data.
 	CheckStructOnly bool `toml:"check-struct-only" json:"check-struct-only"`
+	// only compare the row counts of the chunks, neither the checksums nor the rows, as a cheap smoke test.
+	CheckCountOnly bool `toml:"check-count-only" json:"check-count-only,omitempty"`
+	// stop the comparison at the first different chunk, the summary of the chunks compared so far is committed.
+	FailFast bool `toml:"fail-fast" json:"fail-fast,omitempty"`
+	// only compare the percentage of the chunks, which are chosen by the hashes of the seed and the chunks, so the same
+	// chunks are chosen with the same seed. The different chunks of all the chunks are estimated in the report.
+	// 0 or 100 means all the chunks are compared.
+	SamplePercent int   `toml:"sample-percent" json:"sample-percent,omitempty"`
+	SampleSeed    int64 `toml:"sample-seed" json:"sample-seed,omitempty"`
 	// DMAddr is dm-master's address, the format should like "http://127.0.0.1:8261"
 	DMAddr string `toml:"dm-addr" json:"dm-addr"`
 	// DMTask string `toml:"dm-task" json:"dm-task"`
 	DMTask string `toml:"dm-task" json:"dm-task"`
+	// the address of the status server, which serves the progress as the validation status of the DM task at `/status`.
+	StatusAddr string `toml:"status-addr" json:"status-addr,omitempty"`
+	// the TLS config of the status server, it's served by HTTPS if it's set.
+	StatusSecurity *Security `toml:"status-security" json:"status-security,omitempty"`
+	// the minimum TLS version, e.g. "1.2", and the allowed cipher suites of all the TLS connections
+	// to the instances and the status server. The defaults of Go are used if they are empty.
+	MinTLSVersion   string   `toml:"min-tls-version" json:"min-tls-version,omitempty"`
+	TLSCipherSuites []string `toml:"tls-cipher-suites" json:"tls-cipher-suites,omitempty"`
+	// how to connect to the host of an instance resolving to several addresses: ordered, random, prefer-ipv4 or
+	// prefer-ipv6, default is ordered. All the addresses are tried `dial-retry` more rounds after all of them failed,
+	// and the timeout in seconds to connect to one address is `dial-timeout`, 0 means 5.
+	AddressSelection string `toml:"address-selection" json:"address-selection,omitempty"`
+	DialRetry        int    `toml:"dial-retry" json:"dial-retry,omitempty"`
+	DialTimeout      int64  `toml:"dial-timeout" json:"dial-timeout,omitempty"`
+	// set true if don't want to keep GC stopped by the service safepoint,
+	// then user should guarantee the GC stopped during the comparison.
+	DisableGCSafePoint bool `toml:"disable-gc-safepoint" json:"disable-gc-safepoint,omitempty"`
+	// the ttl in seconds of the service safepoint which keeps GC stopped during the comparison, 0 means 300.
+	GCSafePointTTL int64 `toml:"gc-safepoint-ttl" json:"gc-safepoint-ttl,omitempty"`
+	// the interval in seconds to update the service safepoint, 0 means half of the ttl.
+	GCSafePointUpdateInterval int64 `toml:"gc-safepoint-update-interval" json:"gc-safepoint-update-interval,omitempty"`
+	// the id of the service safepoint, empty means `Sync_diff_<timestamp>`.
+	GCServiceID string `toml:"gc-service-id" json:"gc-service-id,omitempty"`
+	// policy when a table meets error: skip-table, fail-run or retry-N
+	OnError string `toml:"on-error" json:"on-error,omitempty"`
+	// the timeout in seconds of the checksum of a chunk, the chunk is compared row by row after the checksum timed out.
+	// 0 means no timeout.
+	ChecksumTimeout int64 `toml:"checksum-timeout" json:"checksum-timeout,omitempty"`
+	// the rest chunks of a table are compared row by row without checksum once the checksum of the table
+	// timed out so many times. 0 means `DefaultMaxChecksumTimeouts`.
+	MaxChecksumTimeouts int `toml:"max-checksum-timeouts" json:"max-checksum-timeouts,omitempty"`
+	// the chunks with different checksums are compared again after the delay in seconds at most so many times
+	// before they are reported, since the differences may be caused by the replication lag. 0 means no re-check.
+	RecheckDelay int64 `toml:"recheck-delay" json:"recheck-delay,omitempty"`
+	RecheckTimes int   `toml:"recheck-times" json:"recheck-times,omitempty"`
+	// the TEXT/BLOB columns are compared by their MD5 hashes first, and the full values are only fetched for
+	// the different rows, which reduces the network transfer of the tables with large payloads.
+	LazyLargeColumns bool `toml:"lazy-large-columns" json:"lazy-large-columns,omitempty"`
+	// only the columns in both the upstream and the downstream are compared, and the extra columns of the downstream,
+	// e.g. the soft-delete flags or the audit columns, are listed in the report instead of failing the structure check.
+	IgnoreExtraColumns bool `toml:"ignore-extra-columns" json:"ignore-extra-columns,omitempty"`
+	// the JSON values are parsed and compared semantically when comparing the rows, so the values serialized with
+	// the different key orders or whitespaces by MySQL and TiDB are equal.
+	SemanticJSON bool `toml:"semantic-json" json:"semantic-json,omitempty"`
+	// the tables without primary key or unique key are compared by the hashes of the full rows and their counts,
+	// so the duplicate rows are compared as a multiset instead of being canceled out by the checksum.
+	FullRowHash bool `toml:"full-row-hash" json:"full-row-hash,omitempty"`
+	// the chunks of the range or hash partitioned tables are split in each partition, and the differences
+	// are reported by the partitions.
+	SplitByPartition bool `toml:"split-by-partition" json:"split-by-partition,omitempty"`
+	// the chunk queries of the target costing more seconds than it are explained to suggest the missing indexes.
+	// 0 means no check.
+	SlowQueryThreshold int64 `toml:"slow-query-threshold" json:"slow-query-threshold,omitempty"`
+	// the comparison doesn't start if the free space in bytes of the output directories is less than it.
+	// 0 means `DefaultMinFreeDiskSpace`.
+	MinFreeDiskSpace int64 `toml:"min-free-disk-space" json:"min-free-disk-space,omitempty"`
+	// the interval in seconds to save the checkpoint. 0 means `DefaultCheckpointFlushInterval`.
+	CheckpointFlushInterval int `toml:"checkpoint-flush-interval" json:"checkpoint-flush-interval,omitempty"`
+	// the checkpoint is also saved after so many chunks are checked, besides after a table is checked.
+	// 0 means the chunks aren't counted.
+	CheckpointFlushChunks int `toml:"checkpoint-flush-chunks" json:"checkpoint-flush-chunks,omitempty"`
+	// the checkpoint, the summary and the fix sql of the last so many finished runs are kept in the history dir
+	// of the output dir, the older ones and the trash dirs of the fix sql are removed. 0 means no history is kept.
+	KeepRuns int `toml:"keep-runs" json:"keep-runs,omitempty"`
+	// the snapshots of the source and the target are set to the latest consistent pair in the syncpoint table of TiCDC.
+	SyncPoint *SyncPointConfig `toml:"sync-point" json:"sync-point,omitempty"`
+	// the different rows are emitted as row change events besides the fix sql.
+	DiffEvents *DiffEventsConfig `toml:"diff-events" json:"diff-events,omitempty"`
+	// only the tables imported by TiDB Lightning are checked.
+	Lightning *LightningConfig `toml:"lightning" json:"lightning,omitempty"`
+	// how the tables are listed in the summary: `summary-filter` is all or failed, default is all, and
+	// `summary-sort-by` is name, diff-rows or duration, default is name. The equal tables are listed as a count
+	// if `summary-collapse-passed` is set.
+	SummaryFilter         string `toml:"summary-filter" json:"summary-filter,omitempty"`
+	SummarySortBy         string `toml:"summary-sort-by" json:"summary-sort-by,omitempty"`
+	SummaryCollapsePassed bool   `toml:"summary-collapse-passed" json:"summary-collapse-passed,omitempty"`
+	// only the rows changed since the last successful run are compared for the tables with `change-hint-column`.
+	Incremental bool `toml:"incremental" json:"incremental,omitempty"`
+	// a full run is forced after so many incremental runs of a table. 0 means `DefaultFullRunInterval`.
+	FullRunInterval int `toml:"full-run-interval" json:"full-run-interval,omitempty"`
 
 	DataSources map[string]*DataSource `toml:"data-sources" json:"data-sources"`
 
@@ -284,12 +945,33 @@ type Config struct {
 
 	TableConfigs map[string]*TableConfig `toml:"table-configs" json:"table-configs"`
 
+	QueryChecks map[string]*QueryCheck `toml:"query-checks" json:"query-checks,omitempty"`
+
 	Task TaskConfig `toml:"task" json:"task"`
 	// config file
 	ConfigFile string
 
 	// print version if set true
 	PrintVersion bool
+
+	// only re-check these tables of the task, e.g. `db.tbl1,db.tbl2`
+	Tables string `toml:"-" json:"-"`
+
+	// resume from the checkpoint even if the config is changed since the checkpoint is saved.
+	ForceResume bool `toml:"-" json:"-"`
+
+	// only re-check the tables and the chunks failed in the last run in the output dir.
+	CheckFailedOnly bool `toml:"-" json:"-"`
+
+	// inject failures at the rates for test, e.g. `source-query-error=0.01,checkpoint-write-error=0.1`
+	Chaos string `toml:"-" json:"-"`
+
+	// Bench is true for the `bench` subcommand, which measures the read throughput of the instances instead of comparing.
+	Bench bool `toml:"-" json:"-"`
+	// the number of chunks queried in each round of the benchmark.
+	BenchChunks int `toml:"-" json:"-"`
+	// the concurrencies of the rounds of the benchmark.
+	BenchConcurrency []int `toml:"-" json:"-"`
 }
 
 // NewConfig creates a new config.
@@ -303,9 +985,60 @@ func NewConfig() *Config {
 	fs.StringVarP(&cfg.ConfigFile, "config", "C", "", "Config file")
 	fs.StringVar(&cfg.DMAddr, "dm-addr", "", "the address of DM")
 	fs.StringVar(&cfg.DMTask, "dm-task", "", "identifier of dm task")
+	fs.StringVar(&cfg.StatusAddr, "status-addr", "", "the address of the status server serving the progress in the shape of DM validation status, e.g. 127.0.0.1:8277")
+	fs.StringVar(&cfg.AddressSelection, "address-selection", "", "how to connect to the host resolving to several addresses: ordered, random, prefer-ipv4 or prefer-ipv6, default is ordered")
+	fs.IntVar(&cfg.DialRetry, "dial-retry", 0, "how many more rounds all the addresses of the host are tried after all of them failed")
+	fs.Int64Var(&cfg.DialTimeout, "dial-timeout", 0, "the timeout in seconds to connect to one address of the host, 0 means 5")
 	fs.IntVar(&cfg.CheckThreadCount, "check-thread-count", 1, "how many goroutines are created to check data")
-	fs.BoolVar(&cfg.ExportFixSQL, "export-fix-sql", true, "set true if want to compare rows or set to false will only compare checksum")
+	fs.IntVar(&cfg.TableThreadCount, "table-thread-count", 0, "how many tables are split into chunks concurrently, 0 means 3")
+	fs.BoolVar(&cfg.ExportFixSQL, "export-fix-sql", true, "set true if want to compare rows or set to false will only compare checksum and report the different chunks")
 	fs.BoolVar(&cfg.CheckStructOnly, "check-struct-only", false, "ignore check table's data")
+	fs.BoolVar(&cfg.CheckCountOnly, "check-count-only", false, "only compare the row counts of the chunks without the checksums or the rows")
+	fs.BoolVar(&cfg.FailFast, "fail-fast", false, "stop the comparison at the first different chunk and exit with a non-zero code")
+	fs.IntVar(&cfg.SamplePercent, "sample-percent", 0, "only compare the percentage of the chunks chosen by sample-seed, and estimate the different chunks of all the chunks, 0 or 100 means all the chunks are compared")
+	fs.Int64Var(&cfg.SampleSeed, "sample-seed", 0, "the seed to choose the sampled chunks, the same chunks are chosen with the same seed")
+	fs.IntVar(&cfg.BinSearchFanOut, "bin-search-fan-out", 0, "how many parts a mismatched chunk is split into in each round of binary search, 0 means 2")
+	fs.IntVar(&cfg.MaxDiffRowsPerChunk, "max-diff-rows-per-chunk", 0, "the max number of different rows recorded for a chunk, 0 means no limit")
+	fs.BoolVar(&cfg.ExportRangeReloadSQL, "export-range-reload-sql", false, "set true if want to export a range-level reload suggestion for the chunks exceeding max-diff-rows-per-chunk")
+	fs.IntVar(&cfg.MaxDiffRowsPerTable, "max-diff-rows-per-table", 0, "skip the rest chunks of a table once its different rows exceed it, 0 means no limit")
+	fs.IntVar(&cfg.MaxFailedChunksPerTable, "max-failed-chunks-per-table", 0, "skip the rest chunks of a table once its failed chunks exceed it, 0 means no limit")
+	fs.Int64Var(&cfg.MaxDiffRowsTotal, "max-diff-rows-total", 0, "skip the rest chunks of all the tables once the different rows of all the tables exceed it, 0 means no limit")
+	fs.Int64Var(&cfg.LargeTableThreshold, "large-table-threshold", 0, "the tables whose estimated size in bytes exceeds it are skipped or deferred, 0 means no limit")
+	fs.StringVar(&cfg.LargeTableAction, "large-table-action", "", "what to do with the tables larger than large-table-threshold: skip or defer, default is skip")
+	fs.StringVar(&cfg.TableOrder, "table-order", "", "the order to compare the tables: name, largest-first, smallest-first or priority, default is name")
+	fs.StringSliceVar(&cfg.PriorityTables, "priority-tables", nil, "the patterns of the tables compared first in order if table-order is priority, e.g. db.orders,db.*")
+	fs.StringVar(&cfg.ChecksumAlgorithm, "checksum-algorithm", "", "the algorithm of the checksum of the chunks: crc32 or sha1, default is crc32")
+	fs.BoolVar(&cfg.ApplyFixSQL, "apply-fix", false, "set true if want to apply the fix sql to the target and verify the fixed chunks")
+	fs.StringVar(&cfg.Tables, "tables", "", "only re-check these tables of the task, e.g. db.tbl1,db.tbl2")
+	fs.BoolVar(&cfg.ForceResume, "force-resume", false, "resume from the checkpoint even if the config is changed since the checkpoint is saved")
+	fs.BoolVar(&cfg.CheckFailedOnly, "check-failed-only", false, "only re-check the tables and the chunks failed in the last run in the output dir")
+	fs.IntVar(&cfg.BenchChunks, "bench-chunks", 16, "only for bench: the number of chunks queried in each round of the benchmark")
+	fs.IntSliceVar(&cfg.BenchConcurrency, "bench-concurrency", []int{1, 4, 8}, "only for bench: the concurrencies of the rounds of the benchmark")
+	fs.StringVar(&cfg.Chaos, "chaos", "", "inject failures at the rates for test, e.g. source-query-error=0.01,checkpoint-write-error=0.1")
+	fs.BoolVar(&cfg.DisableGCSafePoint, "disable-gc-safepoint", false, "set true if don't want to keep GC stopped by the service safepoint")
+	fs.Int64Var(&cfg.GCSafePointTTL, "gc-safepoint-ttl", 0, "the ttl in seconds of the service safepoint which keeps GC stopped, 0 means 300")
+	fs.Int64Var(&cfg.GCSafePointUpdateInterval, "gc-safepoint-update-interval", 0, "the interval in seconds to update the service safepoint, 0 means half of the ttl")
+	fs.StringVar(&cfg.GCServiceID, "gc-service-id", "", "the id of the service safepoint, default is Sync_diff_<timestamp>")
+	fs.StringVar(&cfg.OnError, "on-error", "", "policy when a table meets error: skip-table, fail-run or retry-N, default is skip-table")
+	fs.Int64Var(&cfg.ChecksumTimeout, "checksum-timeout", 0, "the timeout in seconds of the checksum of a chunk, the chunk is compared row by row after the checksum timed out, 0 means no timeout")
+	fs.IntVar(&cfg.MaxChecksumTimeouts, "max-checksum-timeouts", 0, "the rest chunks of a table are compared row by row once the checksum of the table timed out so many times, 0 means 3")
+	fs.Int64Var(&cfg.RecheckDelay, "recheck-delay", 0, "the delay in seconds before the chunks with different checksums are compared again")
+	fs.IntVar(&cfg.RecheckTimes, "recheck-times", 0, "how many times the chunks with different checksums are compared again before they are reported, 0 means no re-check")
+	fs.BoolVar(&cfg.Incremental, "incremental", false, "only compare the rows changed since the last successful run for the tables with change-hint-column")
+	fs.StringVar(&cfg.SummaryFilter, "summary-filter", "", "which tables are listed in the summary: all or failed, default is all")
+	fs.StringVar(&cfg.SummarySortBy, "summary-sort-by", "", "how the tables in the summary are sorted: name, diff-rows or duration, default is name")
+	fs.BoolVar(&cfg.SummaryCollapsePassed, "summary-collapse-passed", false, "list the equal tables in the summary as a count")
+	fs.IntVar(&cfg.FullRunInterval, "full-run-interval", 0, "a full run is forced after so many incremental runs of a table, 0 means 10")
+	fs.IntVar(&cfg.CheckpointFlushInterval, "checkpoint-flush-interval", 0, "the interval in seconds to save the checkpoint, 0 means 10")
+	fs.IntVar(&cfg.CheckpointFlushChunks, "checkpoint-flush-chunks", 0, "the checkpoint is also saved after so many chunks are checked, 0 means the chunks aren't counted")
+	fs.IntVar(&cfg.KeepRuns, "keep-runs", 0, "keep the checkpoint, the summary and the fix sql of the last so many finished runs in the history dir, 0 means no history is kept")
+	fs.Int64Var(&cfg.MinFreeDiskSpace, "min-free-disk-space", 0, "the comparison doesn't start if the free space in bytes of the output directories is less than it, 0 means 64MiB")
+	fs.BoolVar(&cfg.LazyLargeColumns, "lazy-large-columns", false, "compare the TEXT/BLOB columns by their MD5 hashes first, and only fetch the full values of the different rows")
+	fs.BoolVar(&cfg.IgnoreExtraColumns, "ignore-extra-columns", false, "only compare the columns in both the upstream and the downstream, and list the extra columns of the downstream in the report")
+	fs.BoolVar(&cfg.SemanticJSON, "semantic-json", false, "compare the JSON values semantically, ignoring the different key orders and whitespaces")
+	fs.BoolVar(&cfg.FullRowHash, "full-row-hash", false, "compare the tables without primary key or unique key by the hashes of the full rows and their counts")
+	fs.BoolVar(&cfg.SplitByPartition, "split-by-partition", false, "split the chunks of the partitioned tables in each partition, and report the differences by the partitions")
+	fs.Int64Var(&cfg.SlowQueryThreshold, "slow-query-threshold", 0, "the chunk queries of the target costing more seconds than it are explained to suggest the missing indexes, 0 means no check")
 
 	fs.SortFlags = false
 	return cfg
@@ -346,13 +1079,138 @@ func (c *Config) Parse(arguments []string) error {
 }
 
 func (c *Config) String() string {
-	cfg, err := json.Marshal(c)
+	cfg, err := json.Marshal(c.redactPasswords())
 	if err != nil {
 		return "<nil>"
 	}
 	return string(cfg)
 }
 
+// redactPasswords returns a copy of the config whose passwords are redacted, which is safe to be logged.
+func (c *Config) redactPasswords() *Config {
+	redact := func(ds *DataSource) *DataSource {
+		if ds == nil {
+			return nil
+		}
+		redacted := *ds
+		if redacted.Password != "" {
+			redacted.Password = redactedPassword
+		}
+		return &redacted
+	}
+	cfg := *c
+	if c.DataSources != nil {
+		cfg.DataSources = make(map[string]*DataSource, len(c.DataSources))
+		for name, ds := range c.DataSources {
+			cfg.DataSources[name] = redact(ds)
+		}
+	}
+	if c.Task.SourceInstances != nil {
+		cfg.Task.SourceInstances = make([]*DataSource, 0, len(c.Task.SourceInstances))
+		for _, ds := range c.Task.SourceInstances {
+			cfg.Task.SourceInstances = append(cfg.Task.SourceInstances, redact(ds))
+		}
+	}
+	cfg.Task.TargetInstance = redact(c.Task.TargetInstance)
+	return &cfg
+}
+
+// initDialer registers the dialer selecting the addresses of the hosts, which is used by all the data sources.
+// The brackets around the IPv6 hosts are removed, e.g. [::1] is the same as ::1.
+func (c *Config) initDialer() error {
+	if c.DialTimeout < 0 {
+		return errors.New("dial-timeout must not be less than 0")
+	}
+	policy := dbutil.DialPolicy{
+		Selection: c.AddressSelection,
+		Retry:     c.DialRetry,
+		Timeout:   time.Duration(c.DialTimeout) * time.Second,
+	}
+	if err := dbutil.RegisterDialer(dialerNetwork, policy); err != nil {
+		return errors.Trace(err)
+	}
+	for _, ds := range c.DataSources {
+		ds.Host = dbutil.TrimIPv6Brackets(ds.Host)
+		ds.Net = dialerNetwork
+	}
+	return nil
+}
+
+// initTLS registers the TLS configs of the data sources, and checks the TLS config of the status server.
+func (c *Config) initTLS() error {
+	// the minimum version and the cipher suites are checked even if no TLS connection is used.
+	if err := utils.SetTLSVersionAndCipherSuites(&tls.Config{}, c.MinTLSVersion, c.TLSCipherSuites); err != nil {
+		return errors.Trace(err)
+	}
+	for name, ds := range c.DataSources {
+		if ds.Security == nil {
+			continue
+		}
+		tlsCfg, err := c.ToTLSConfig(ds.Security)
+		if err != nil {
+			return errors.Annotatef(err, "invalid security of data source %s", name)
+		}
+		if tlsCfg == nil {
+			return errors.Errorf("ca-path of the security of data source %s is required", name)
+		}
+		ds.TLSName = "sync_diff_" + name
+		if err := mysql.RegisterTLSConfig(ds.TLSName, tlsCfg); err != nil {
+			return errors.Annotatef(err, "register the TLS config of data source %s", name)
+		}
+	}
+	if c.StatusSecurity != nil {
+		tlsCfg, err := c.GetStatusTLSConfig()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if tlsCfg == nil || len(tlsCfg.Certificates) == 0 {
+			return errors.New("ca-path, cert-path and key-path of status-security are required")
+		}
+	}
+	return nil
+}
+
+// ToTLSConfig returns the TLS config restricted by `min-tls-version` and `tls-cipher-suites`, it's nil if the CA is empty.
+func (c *Config) ToTLSConfig(s *Security) (*tls.Config, error) {
+	tlsCfg, err := utils.ToTLSConfig(s.CAPath, s.CertPath, s.KeyPath)
+	if err != nil || tlsCfg == nil {
+		return nil, errors.Trace(err)
+	}
+	if err := utils.SetTLSVersionAndCipherSuites(tlsCfg, c.MinTLSVersion, c.TLSCipherSuites); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return tlsCfg, nil
+}
+
+// GetStatusTLSConfig returns the TLS config of the status server, it's nil if the status server is served by HTTP.
+func (c *Config) GetStatusTLSConfig() (*tls.Config, error) {
+	if c.StatusSecurity == nil {
+		return nil, nil
+	}
+	tlsCfg, err := c.ToTLSConfig(c.StatusSecurity)
+	return tlsCfg, errors.Annotate(err, "invalid status-security")
+}
+
+// GetSecrets returns the passwords of the data sources, which should never appear in the logs.
+func (c *Config) GetSecrets() []string {
+	secrets := make([]string, 0, len(c.DataSources))
+	for _, ds := range c.DataSources {
+		if ds.Password != "" {
+			secrets = append(secrets, ds.Password)
+		}
+	}
+	// the credentials may be set in the query of the external storage URI.
+	if u, err := url.Parse(c.Task.ExternalStorage); err == nil && len(c.Task.ExternalStorage) > 0 {
+		query := u.Query()
+		for _, key := range []string{"access-key", "secret-access-key", "session-token"} {
+			if value := query.Get(key); value != "" {
+				secrets = append(secrets, value, url.QueryEscape(value))
+			}
+		}
+	}
+	return secrets
+}
+
 // configFromFile loads config from file.
 func (c *Config) configFromFile(path string) error {
 	meta, err := toml.DecodeFile(path, c)
@@ -416,15 +1274,29 @@ func (c *Config) adjustConfigByDMSubTasks() (err error) {
 }
 
 func (c *Config) Init() (err error) {
+	for _, table := range strings.Split(c.Tables, ",") {
+		// skip the spaces and the empty entries, e.g. `--tables "a.t1, a.t2,"`
+		if table = strings.TrimSpace(table); table != "" {
+			c.Task.RecheckTables = append(c.Task.RecheckTables, table)
+		}
+	}
+	c.Task.ForceResume = c.ForceResume
 	if len(c.DMAddr) > 0 {
 		err := c.adjustConfigByDMSubTasks()
 		if err != nil {
 			return errors.Annotate(err, "failed to init Task")
 		}
-		err = c.Task.Init(c.DataSources, c.TableConfigs)
+		if err := c.initDialer(); err != nil {
+			return errors.Annotate(err, "failed to init dialer")
+		}
+		if err := c.initTLS(); err != nil {
+			return errors.Annotate(err, "failed to init TLS")
+		}
+		err = c.Task.Init(c.DataSources, c.TableConfigs, c.QueryChecks)
 		if err != nil {
 			return errors.Annotate(err, "failed to init Task")
 		}
+		c.Task.TargetInstance.ReadOnly = !c.ApplyFixSQL
 		return nil
 	}
 	for _, d := range c.DataSources {
@@ -444,10 +1316,53 @@ func (c *Config) Init() (err error) {
 		}
 	}
 
-	err = c.Task.Init(c.DataSources, c.TableConfigs)
+	if err := c.initDialer(); err != nil {
+		return errors.Annotate(err, "failed to init dialer")
+	}
+	if err := c.initTLS(); err != nil {
+		return errors.Annotate(err, "failed to init TLS")
+	}
+
+	if c.Lightning != nil {
+		if err := c.initLightningTables(); err != nil {
+			return errors.Annotate(err, "failed to init Task")
+		}
+	}
+
+	err = c.Task.Init(c.DataSources, c.TableConfigs, c.QueryChecks)
 	if err != nil {
 		return errors.Annotate(err, "failed to init Task")
 	}
+	// the target is only written by the fix sql.
+	c.Task.TargetInstance.ReadOnly = !c.ApplyFixSQL
+	return nil
+}
+
+// initLightningTables restricts the run to the tables whose data and indexes have been imported by TiDB Lightning.
+// All the imported tables are checked if `target-check-tables` is empty.
+func (c *Config) initLightningTables() error {
+	tables, err := LoadLightningCheckpoints(c.Lightning.CheckpointDir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	c.Task.ImportedTables = make(map[string]*LightningTable, len(tables))
+	for name, table := range tables {
+		if !table.IsImported() {
+			log.Warn("skip the table not imported by TiDB Lightning completely",
+				zap.String("table", name),
+				zap.Int("status", table.Status),
+				zap.Int("imported engines", table.ImportedEngines),
+				zap.Int("data engines", table.DataEngines))
+			continue
+		}
+		c.Task.ImportedTables[name] = table
+	}
+	if len(c.Task.ImportedTables) == 0 {
+		return errors.Errorf("no table is imported by TiDB Lightning according to the checkpoints in %s", c.Lightning.CheckpointDir)
+	}
+	if len(c.Task.CheckTables) == 0 {
+		c.Task.CheckTables = []string{"*.*"}
+	}
 	return nil
 }
 
@@ -456,6 +1371,209 @@ func (c *Config) CheckConfig() bool {
 		log.Error("check-thread-count must greater than 0!")
 		return false
 	}
+	if c.ApplyFixSQL && !c.ExportFixSQL {
+		log.Error("must set the `export-fix-sql` if set `apply-fix`")
+		return false
+	}
+	if c.ApplyFixSQL && c.Task.TargetInstance != nil && ((c.Task.TargetInstance.Snapshot != "" && c.Task.TargetInstance.GetSnapshotMode() != SnapshotModeNone) || c.SyncPoint != nil) {
+		// the fix sql can't be executed on the snapshot, and the fixed chunks would be verified on the old snapshot.
+		log.Error("`apply-fix` can't be set if the target reads a snapshot by `snapshot` or `sync-point`")
+		return false
+	}
+	if c.ApplyFixSQL && c.CheckCountOnly {
+		log.Error("`apply-fix` can't be set with `check-count-only`, no fix sql is generated by counting the rows")
+		return false
+	}
+	if c.BinSearchFanOut < 0 || c.BinSearchFanOut == 1 {
+		log.Error("bin-search-fan-out must be 0 or greater than 1!")
+		return false
+	}
+	if c.MaxDiffRowsPerChunk < 0 {
+		log.Error("max-diff-rows-per-chunk must not be less than 0!")
+		return false
+	}
+	if c.MaxDiffRowsPerTable < 0 || c.MaxFailedChunksPerTable < 0 || c.MaxDiffRowsTotal < 0 {
+		log.Error("max-diff-rows-per-table, max-failed-chunks-per-table and max-diff-rows-total must not be less than 0!")
+		return false
+	}
+	if c.LargeTableThreshold < 0 {
+		log.Error("large-table-threshold must not be less than 0!")
+		return false
+	}
+	if c.LargeTableAction != "" && c.LargeTableAction != LargeTableSkip && c.LargeTableAction != LargeTableDefer {
+		log.Error("large-table-action must be skip or defer!")
+		return false
+	}
+	switch c.TableOrder {
+	case "", TableOrderName, TableOrderLargestFirst, TableOrderSmallestFirst:
+	case TableOrderPriority:
+		if len(c.PriorityTables) == 0 {
+			log.Error("priority-tables must be set if table-order is priority!")
+			return false
+		}
+	default:
+		log.Error("table-order must be name, largest-first, smallest-first or priority!")
+		return false
+	}
+	if _, err := c.GetPriorityTables(); err != nil {
+		log.Error("invalid priority-tables", zap.Error(err))
+		return false
+	}
+	if c.ChecksumAlgorithm != "" && c.ChecksumAlgorithm != ChecksumCRC32 && c.ChecksumAlgorithm != ChecksumSHA1 {
+		log.Error("checksum-algorithm must be crc32 or sha1!")
+		return false
+	}
+	if c.GCSafePointTTL < 0 || c.GCSafePointUpdateInterval < 0 {
+		log.Error("gc-safepoint-ttl and gc-safepoint-update-interval must not be less than 0!")
+		return false
+	}
+	if c.GCSafePointUpdateInterval > 0 && c.GCSafePointUpdateInterval >= c.GetGCSafePointTTL() {
+		log.Error("gc-safepoint-update-interval must be less than gc-safepoint-ttl!")
+		return false
+	}
+	if c.TableThreadCount < 0 {
+		log.Error("table-thread-count must not be less than 0!")
+		return false
+	}
+	if c.Bench {
+		if c.BenchChunks <= 0 {
+			log.Error("bench-chunks must be greater than 0!")
+			return false
+		}
+		for _, concurrency := range c.BenchConcurrency {
+			if concurrency <= 0 {
+				log.Error("bench-concurrency must be greater than 0!")
+				return false
+			}
+		}
+	}
+	if !c.checkMockConfig() {
+		return false
+	}
+	for _, instance := range c.DataSources {
+		switch instance.SnapshotMode {
+		case "", SnapshotModeAuto, SnapshotModeTiDBSnapshot, SnapshotModeAsOfTimestamp, SnapshotModeNone:
+		default:
+			log.Error("snapshot-mode must be auto, tidb-snapshot, as-of-timestamp or none!", zap.String("snapshot-mode", instance.SnapshotMode))
+			return false
+		}
+	}
+	if _, err := chaos.Parse(c.Chaos); err != nil {
+		log.Error("invalid chaos", zap.Error(err))
+		return false
+	}
+	if c.ChecksumTimeout < 0 || c.MaxChecksumTimeouts < 0 {
+		log.Error("checksum-timeout and max-checksum-timeouts must not be less than 0!")
+		return false
+	}
+	if c.SamplePercent < 0 || c.SamplePercent > 100 {
+		log.Error("sample-percent must be between 0 and 100!")
+		return false
+	}
+	if c.RecheckDelay < 0 || c.RecheckTimes < 0 {
+		log.Error("recheck-delay and recheck-times must not be less than 0!")
+		return false
+	}
+	if c.FullRunInterval < 0 {
+		log.Error("full-run-interval must not be less than 0!")
+		return false
+	}
+	if !c.checkSyncPointConfig() {
+		return false
+	}
+	if !c.checkDiffEventsConfig() {
+		return false
+	}
+	if c.MinFreeDiskSpace < 0 {
+		log.Error("min-free-disk-space must not be less than 0!")
+		return false
+	}
+	if c.CheckpointFlushInterval < 0 || c.CheckpointFlushChunks < 0 {
+		log.Error("checkpoint-flush-interval and checkpoint-flush-chunks must not be less than 0!")
+		return false
+	}
+	if c.KeepRuns < 0 {
+		log.Error("keep-runs must not be less than 0!")
+		return false
+	}
+	if c.SummaryFilter != "" && c.SummaryFilter != SummaryFilterAll && c.SummaryFilter != SummaryFilterFailed {
+		log.Error("summary-filter must be all or failed!")
+		return false
+	}
+	switch c.SummarySortBy {
+	case "", SummarySortByName, SummarySortByDiffRows, SummarySortByDuration:
+	default:
+		log.Error("summary-sort-by must be name, diff-rows or duration!")
+		return false
+	}
+	if c.SlowQueryThreshold < 0 {
+		log.Error("slow-query-threshold must not be less than 0!")
+		return false
+	}
+	if _, err := ParseErrorPolicy(c.OnError); err != nil {
+		log.Error("invalid on-error", zap.Error(err))
+		return false
+	}
+	for name, tableConfig := range c.TableConfigs {
+		if _, err := ParseErrorPolicy(tableConfig.OnError); err != nil {
+			log.Error("invalid on-error in table config", zap.String("config", name), zap.Error(err))
+			return false
+		}
+		if (tableConfig.TimeColumn == "") != (tableConfig.CheckWindow == "") {
+			log.Error("time-column and check-window must be set together in table config", zap.String("config", name))
+			return false
+		}
+		if tableConfig.CheckWindow != "" {
+			if _, err := ParseCheckWindow(tableConfig.CheckWindow); err != nil {
+				log.Error("invalid check-window in table config", zap.String("config", name), zap.Error(err))
+				return false
+			}
+		}
+		if tableConfig.FloatTolerance < 0 {
+			log.Error("float-tolerance must not be less than 0 in table config", zap.String("config", name))
+			return false
+		}
+		if tableConfig.ChunkSize < 0 || tableConfig.CheckThreadCount < 0 {
+			log.Error("chunk-size and check-thread-count must not be less than 0 in table config", zap.String("config", name))
+			return false
+		}
+		for column, tolerance := range tableConfig.ColumnTolerances {
+			if tolerance < 0 {
+				log.Error("column-tolerances must not be less than 0 in table config", zap.String("config", name), zap.String("column", column))
+				return false
+			}
+		}
+		for column, sourceColumn := range tableConfig.ColumnMap {
+			if column == "" || sourceColumn == "" {
+				log.Error("column-map must not have empty column names in table config", zap.String("config", name), zap.String("column", column))
+				return false
+			}
+		}
+		for _, partition := range tableConfig.Partitions {
+			if partition == "" {
+				log.Error("partitions must not have empty names in table config", zap.String("config", name))
+				return false
+			}
+		}
+		if c.ApplyFixSQL && len(tableConfig.SensitiveColumns) > 0 {
+			log.Error("`apply-fix` can't be set with `sensitive-columns` in table config, their values are redacted in the fix sql", zap.String("config", name))
+			return false
+		}
+		for _, expressions := range []map[string]string{tableConfig.SourceExpressions, tableConfig.TargetExpressions} {
+			for column, expression := range expressions {
+				if column == "" || strings.TrimSpace(expression) == "" {
+					log.Error("source-expressions and target-expressions must not have empty columns or expressions in table config", zap.String("config", name), zap.String("column", column))
+					return false
+				}
+			}
+		}
+	}
+	for name, queryCheck := range c.QueryChecks {
+		if !queryCheck.Valid() {
+			log.Error("invalid query check", zap.String("query check", name))
+			return false
+		}
+	}
 	if len(c.DMAddr) != 0 {
 		u, err := url.Parse(c.DMAddr)
 		if err != nil || u.Scheme == "" || u.Host == "" {
@@ -471,6 +1589,184 @@ func (c *Config) CheckConfig() bool {
 	return true
 }
 
+// checkMockConfig checks the mock data sources are compared with each other only.
+func (c *Config) checkMockConfig() bool {
+	if c.Task.TargetInstance == nil {
+		return true
+	}
+	instances := append([]*DataSource{c.Task.TargetInstance}, c.Task.SourceInstances...)
+	mockCount := 0
+	for _, instance := range instances {
+		if instance.SourceType != "" && !instance.IsMock() {
+			log.Error("source-type must be empty or mock!", zap.String("source-type", instance.SourceType))
+			return false
+		}
+		if !instance.IsMock() {
+			continue
+		}
+		mockCount++
+		if instance.Mock == nil || instance.Mock.Tables <= 0 || instance.Mock.Rows <= 0 {
+			log.Error("mock.tables and mock.rows must be greater than 0!")
+			return false
+		}
+		if instance.Mock.CorruptionRate < 0 || instance.Mock.CorruptionRate > 1 {
+			log.Error("mock.corruption-rate must be in [0, 1]!")
+			return false
+		}
+	}
+	if mockCount == 0 {
+		return true
+	}
+	if mockCount != 2 || len(instances) != 2 {
+		log.Error("the mock data source can only be compared with another mock data source!")
+		return false
+	}
+	if c.ApplyFixSQL {
+		log.Error("apply-fix is not supported by the mock data source!")
+		return false
+	}
+	return true
+}
+
+func (c *Config) checkSyncPointConfig() bool {
+	if c.SyncPoint == nil || c.Task.TargetInstance == nil {
+		return true
+	}
+	if c.SyncPoint.Changefeed == "" {
+		log.Error("sync-point.changefeed can't be empty!")
+		return false
+	}
+	if len(c.Task.SourceInstances) != 1 {
+		log.Error("sync-point only supports one source instance!")
+		return false
+	}
+	for _, instance := range []*DataSource{c.Task.SourceInstances[0], c.Task.TargetInstance} {
+		if instance.Snapshot != "" || instance.IsMock() {
+			log.Error("the snapshot of the instances must be empty when sync-point is set, it's picked from the syncpoint table!")
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Config) checkDiffEventsConfig() bool {
+	if c.DiffEvents == nil {
+		return true
+	}
+	switch c.DiffEvents.Protocol {
+	case DiffEventsProtocolCanalJSON, DiffEventsProtocolOpen:
+	default:
+		log.Error("diff-events.protocol must be canal-json or open-protocol!", zap.String("protocol", c.DiffEvents.Protocol))
+		return false
+	}
+	if len(c.DiffEvents.KafkaAddrs) > 0 && c.DiffEvents.KafkaTopic == "" {
+		log.Error("diff-events.kafka-topic can't be empty when diff-events.kafka-addrs is set!")
+		return false
+	}
+	if !c.ExportFixSQL {
+		log.Error("diff-events needs export-fix-sql to compare the different rows!")
+		return false
+	}
+	return true
+}
+
+// GetTableThreadCount returns the number of tables split into chunks concurrently.
+func (c *Config) GetTableThreadCount() int {
+	if c.TableThreadCount <= 0 {
+		return DefaultTableThreadCount
+	}
+	return c.TableThreadCount
+}
+
+// GetGCSafePointTTL returns the ttl in seconds of the service safepoint.
+func (c *Config) GetGCSafePointTTL() int64 {
+	if c.GCSafePointTTL <= 0 {
+		return DefaultGCSafePointTTL
+	}
+	return c.GCSafePointTTL
+}
+
+// GetChecksumAlgorithm returns the algorithm of the checksum of the chunks.
+func (c *Config) GetChecksumAlgorithm() string {
+	if c.CheckCountOnly {
+		return ChecksumNone
+	}
+	if c.ChecksumAlgorithm == "" {
+		return ChecksumCRC32
+	}
+	return c.ChecksumAlgorithm
+}
+
+// GetTableOrder returns the order to compare the tables.
+func (c *Config) GetTableOrder() string {
+	if c.TableOrder == "" {
+		return TableOrderName
+	}
+	return c.TableOrder
+}
+
+// GetPriorityTables returns the filters of the patterns of `priority-tables` in order, a table matching
+// the earlier filter is compared first.
+func (c *Config) GetPriorityTables() ([]filter.Filter, error) {
+	filters := make([]filter.Filter, 0, len(c.PriorityTables))
+	for _, pattern := range c.PriorityTables {
+		f, err := filter.Parse([]string{pattern})
+		if err != nil {
+			return nil, errors.Annotatef(err, "parse priority table %s", pattern)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// GetLargeTableAction returns what to do with the tables larger than `large-table-threshold`.
+func (c *Config) GetLargeTableAction() string {
+	if c.LargeTableAction == "" {
+		return LargeTableSkip
+	}
+	return c.LargeTableAction
+}
+
+// GetBinSearchFanOut returns the number of parts a mismatched chunk is split into in each round of binary search.
+func (c *Config) GetBinSearchFanOut() int {
+	if c.BinSearchFanOut <= 0 {
+		return DefaultBinSearchFanOut
+	}
+	return c.BinSearchFanOut
+}
+
+// GetMaxChecksumTimeouts returns the number of checksum timeouts of a table before comparing its rows directly.
+func (c *Config) GetMaxChecksumTimeouts() int {
+	if c.MaxChecksumTimeouts <= 0 {
+		return DefaultMaxChecksumTimeouts
+	}
+	return c.MaxChecksumTimeouts
+}
+
+// GetFullRunInterval returns the number of incremental runs of a table before a forced full run.
+func (c *Config) GetFullRunInterval() int {
+	if c.FullRunInterval <= 0 {
+		return DefaultFullRunInterval
+	}
+	return c.FullRunInterval
+}
+
+// GetCheckpointFlushInterval returns the interval to save the checkpoint.
+func (c *Config) GetCheckpointFlushInterval() time.Duration {
+	if c.CheckpointFlushInterval <= 0 {
+		return DefaultCheckpointFlushInterval * time.Second
+	}
+	return time.Duration(c.CheckpointFlushInterval) * time.Second
+}
+
+// GetMinFreeDiskSpace returns the min free space in bytes of the output directories.
+func (c *Config) GetMinFreeDiskSpace() int64 {
+	if c.MinFreeDiskSpace <= 0 {
+		return DefaultMinFreeDiskSpace
+	}
+	return c.MinFreeDiskSpace
+}
+
 func pathExists(_path string) (bool, error) {
 	_, err := os.Stat(_path)
 	if err != nil {
@@ -14,9 +14,13 @@
 package config
 
 import (
+	"crypto/tls"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -32,18 +36,22 @@ func TestParseConfig(t *testing.T) {
 
 	require.Nil(t, cfg.Parse([]string{"--config", "config.toml"}))
 	require.Nil(t, cfg.Init())
-	require.Nil(t, cfg.Task.Init(cfg.DataSources, cfg.TableConfigs))
+	require.Nil(t, cfg.Task.Init(cfg.DataSources, cfg.TableConfigs, cfg.QueryChecks))
 
 	require.Nil(t, cfg.Parse([]string{"--config", "config_sharding.toml"}))
 	// we change the config from config.toml to config_sharding.toml
 	// this action will raise error.
 	require.Contains(t, cfg.Init().Error(), "failed to init Task: config changes breaking the checkpoint, please use another outputDir and start over again!")
+	// the checkpoint is resumed anyway with --force-resume.
+	require.Nil(t, cfg.Parse([]string{"--config", "config_sharding.toml", "--force-resume"}))
+	require.Nil(t, cfg.Init())
+	require.True(t, cfg.Task.ForceResume)
 
 	require.NoError(t, os.RemoveAll(cfg.Task.OutputDir))
 	require.Nil(t, cfg.Parse([]string{"--config", "config_sharding.toml"}))
 	// this time will be ok, because we remove the last outputDir.
 	require.Nil(t, cfg.Init())
-	require.Nil(t, cfg.Task.Init(cfg.DataSources, cfg.TableConfigs))
+	require.Nil(t, cfg.Task.Init(cfg.DataSources, cfg.TableConfigs, cfg.QueryChecks))
 
 	require.True(t, cfg.CheckConfig())
 
@@ -74,6 +82,128 @@ func TestError(t *testing.T) {
 	require.False(t, cfg.CheckConfig())
 	cfg.CheckThreadCount = 1
 	require.True(t, cfg.CheckConfig())
+	require.Equal(t, DefaultTableThreadCount, cfg.GetTableThreadCount())
+	cfg.TableThreadCount = -1
+	require.False(t, cfg.CheckConfig())
+	cfg.TableThreadCount = 8
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, 8, cfg.GetTableThreadCount())
+	require.Equal(t, DefaultBinSearchFanOut, cfg.GetBinSearchFanOut())
+	cfg.BinSearchFanOut = 1
+	require.False(t, cfg.CheckConfig())
+	cfg.BinSearchFanOut = 4
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, 4, cfg.GetBinSearchFanOut())
+	cfg.MaxDiffRowsPerChunk = -1
+	require.False(t, cfg.CheckConfig())
+	cfg.MaxDiffRowsPerChunk = 100
+	require.True(t, cfg.CheckConfig())
+	cfg.SlowQueryThreshold = -1
+	require.False(t, cfg.CheckConfig())
+	cfg.SlowQueryThreshold = 10
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, int64(DefaultMinFreeDiskSpace), cfg.GetMinFreeDiskSpace())
+	cfg.Chaos = "source-query-error=2"
+	require.False(t, cfg.CheckConfig())
+	cfg.Chaos = "source-query-error=0.1"
+	require.True(t, cfg.CheckConfig())
+	cfg.Chaos = ""
+	require.Equal(t, DefaultMaxChecksumTimeouts, cfg.GetMaxChecksumTimeouts())
+	cfg.ChecksumTimeout = -1
+	require.False(t, cfg.CheckConfig())
+	cfg.ChecksumTimeout = 60
+	cfg.MaxChecksumTimeouts = 5
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, 5, cfg.GetMaxChecksumTimeouts())
+	cfg.RecheckTimes = -1
+	require.False(t, cfg.CheckConfig())
+	cfg.RecheckDelay, cfg.RecheckTimes = 30, 3
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, DefaultFullRunInterval, cfg.GetFullRunInterval())
+	cfg.FullRunInterval = -1
+	require.False(t, cfg.CheckConfig())
+	cfg.FullRunInterval = 3
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, 3, cfg.GetFullRunInterval())
+	cfg.DiffEvents = &DiffEventsConfig{Protocol: "avro"}
+	require.False(t, cfg.CheckConfig())
+	cfg.DiffEvents.Protocol = DiffEventsProtocolCanalJSON
+	cfg.DiffEvents.KafkaAddrs = []string{"127.0.0.1:9092"}
+	require.False(t, cfg.CheckConfig())
+	cfg.DiffEvents.KafkaTopic = "diff"
+	cfg.ExportFixSQL = false
+	require.False(t, cfg.CheckConfig())
+	cfg.ExportFixSQL = true
+	require.True(t, cfg.CheckConfig())
+	cfg.DiffEvents = nil
+	cfg.Bench = true
+	cfg.BenchConcurrency = []int{1, 0}
+	require.False(t, cfg.CheckConfig())
+	cfg.BenchConcurrency = []int{1, 2}
+	cfg.BenchChunks = 0
+	require.False(t, cfg.CheckConfig())
+	cfg.BenchChunks = 8
+	require.True(t, cfg.CheckConfig())
+	cfg.Bench = false
+	cfg.MinFreeDiskSpace = -1
+	require.False(t, cfg.CheckConfig())
+	cfg.MinFreeDiskSpace = 1 << 30
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, int64(1<<30), cfg.GetMinFreeDiskSpace())
+	require.Equal(t, DefaultCheckpointFlushInterval*time.Second, cfg.GetCheckpointFlushInterval())
+	cfg.CheckpointFlushChunks = -1
+	require.False(t, cfg.CheckConfig())
+	cfg.CheckpointFlushChunks = 100
+	cfg.CheckpointFlushInterval = 30
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, 30*time.Second, cfg.GetCheckpointFlushInterval())
+	cfg.KeepRuns = -1
+	require.False(t, cfg.CheckConfig())
+	cfg.KeepRuns = 3
+	require.True(t, cfg.CheckConfig())
+	cfg.MaxFailedChunksPerTable = -1
+	require.False(t, cfg.CheckConfig())
+	cfg.MaxFailedChunksPerTable = 10
+	cfg.MaxDiffRowsPerTable = 1000
+	require.True(t, cfg.CheckConfig())
+	cfg.MaxDiffRowsTotal = -1
+	require.False(t, cfg.CheckConfig())
+	cfg.MaxDiffRowsTotal = 10000
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, LargeTableSkip, cfg.GetLargeTableAction())
+	cfg.LargeTableAction = "abc"
+	require.False(t, cfg.CheckConfig())
+	cfg.LargeTableThreshold = 1 << 30
+	cfg.LargeTableAction = LargeTableDefer
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, LargeTableDefer, cfg.GetLargeTableAction())
+	require.Equal(t, ChecksumCRC32, cfg.GetChecksumAlgorithm())
+	cfg.ChecksumAlgorithm = "xxhash"
+	require.False(t, cfg.CheckConfig())
+	cfg.ChecksumAlgorithm = ChecksumSHA1
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, ChecksumSHA1, cfg.GetChecksumAlgorithm())
+	cfg.CheckCountOnly = true
+	require.Equal(t, ChecksumNone, cfg.GetChecksumAlgorithm())
+	cfg.ApplyFixSQL = true
+	require.False(t, cfg.CheckConfig())
+	cfg.ApplyFixSQL, cfg.CheckCountOnly = false, false
+	require.Equal(t, int64(DefaultGCSafePointTTL), cfg.GetGCSafePointTTL())
+	cfg.GCSafePointUpdateInterval = DefaultGCSafePointTTL
+	require.False(t, cfg.CheckConfig())
+	cfg.GCSafePointTTL = 600
+	require.True(t, cfg.CheckConfig())
+	require.Equal(t, int64(600), cfg.GetGCSafePointTTL())
+	cfg.QueryChecks = map[string]*QueryCheck{
+		"check1": {
+			TargetTable: "test.stats",
+			SourceQuery: "SELECT a, COUNT(*) AS cnt FROM test.t GROUP BY a",
+			TargetQuery: "SELECT a, cnt FROM test.stats",
+		},
+	}
+	require.False(t, cfg.CheckConfig())
+	cfg.QueryChecks["check1"].KeyColumns = []string{"a"}
+	require.True(t, cfg.CheckConfig())
 
 	// Init
 	cfg.DataSources = make(map[string]*DataSource)
@@ -83,3 +213,356 @@ func TestError(t *testing.T) {
 	err := cfg.Init()
 	require.Contains(t, err.Error(), "not found source routes for rule 111, please correct the config")
 }
+
+func TestSnapshotMode(t *testing.T) {
+	ds := &DataSource{Snapshot: "386902609362944000"}
+	require.Equal(t, SnapshotModeAuto, ds.GetSnapshotMode())
+	require.Equal(t, "386902609362944000", ds.ToDBConfig().Snapshot)
+	require.Equal(t, "", ds.GetStaleReadSnapshot())
+
+	ds.ResolvedSnapshotMode = SnapshotModeAsOfTimestamp
+	require.Equal(t, "", ds.ToDBConfig().Snapshot)
+	require.Equal(t, "386902609362944000", ds.GetStaleReadSnapshot())
+
+	ds = &DataSource{Snapshot: "386902609362944000", SnapshotMode: SnapshotModeNone}
+	require.Equal(t, "", ds.ToDBConfig().Snapshot)
+	require.Equal(t, "", ds.GetStaleReadSnapshot())
+
+	source, target := &DataSource{}, &DataSource{}
+	cfg := NewConfig()
+	cfg.DataSources = map[string]*DataSource{"source": source, "target": target}
+	cfg.Task.SourceInstances = []*DataSource{source}
+	cfg.Task.TargetInstance = target
+	require.True(t, cfg.CheckConfig())
+	target.SnapshotMode = "abc"
+	require.False(t, cfg.CheckConfig())
+	target.SnapshotMode = SnapshotModeAsOfTimestamp
+	require.True(t, cfg.CheckConfig())
+
+	// the snapshots are picked from the syncpoint table
+	cfg.SyncPoint = &SyncPointConfig{}
+	require.False(t, cfg.CheckConfig())
+	cfg.SyncPoint.Changefeed = "cf"
+	require.True(t, cfg.CheckConfig())
+	target.Snapshot = "123"
+	require.False(t, cfg.CheckConfig())
+	target.Snapshot = ""
+	cfg.Task.SourceInstances = []*DataSource{source, source}
+	require.False(t, cfg.CheckConfig())
+
+	// the fix sql can't be applied on the snapshot of the target
+	cfg.Task.SourceInstances = []*DataSource{source}
+	cfg.ApplyFixSQL, cfg.ExportFixSQL = true, true
+	require.False(t, cfg.CheckConfig())
+	cfg.SyncPoint = nil
+	require.True(t, cfg.CheckConfig())
+	target.Snapshot = "123"
+	require.False(t, cfg.CheckConfig())
+	target.SnapshotMode = SnapshotModeNone
+	require.True(t, cfg.CheckConfig())
+}
+
+func TestComputeResumeHash(t *testing.T) {
+	source, target := &DataSource{Snapshot: "1"}, &DataSource{Snapshot: "2"}
+	task := &TaskConfig{
+		SourceInstances:    []*DataSource{source},
+		TargetInstance:     target,
+		TargetTableConfigs: []*TableConfig{{Range: "a > 1"}},
+	}
+	hash, err := task.ComputeResumeHash()
+	require.NoError(t, err)
+
+	// the fields filled when matching the tables don't change the hash.
+	task.TargetTableConfigs[0].Schema, task.TargetTableConfigs[0].HasMatched = "test", true
+	newHash, err := task.ComputeResumeHash()
+	require.NoError(t, err)
+	require.Equal(t, hash, newHash)
+
+	target.Snapshot = "3"
+	newHash, err = task.ComputeResumeHash()
+	require.NoError(t, err)
+	require.NotEqual(t, hash, newHash)
+	target.Snapshot = "2"
+
+	task.TargetTableConfigs[0].Range = "a > 2"
+	newHash, err = task.ComputeResumeHash()
+	require.NoError(t, err)
+	require.NotEqual(t, hash, newHash)
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	policy, err := ParseErrorPolicy("")
+	require.NoError(t, err)
+	require.Equal(t, &ErrorPolicy{Action: OnErrorSkipTable}, policy)
+
+	policy, err = ParseErrorPolicy("fail-run")
+	require.NoError(t, err)
+	require.Equal(t, &ErrorPolicy{Action: OnErrorFailRun}, policy)
+
+	policy, err = ParseErrorPolicy("retry-3")
+	require.NoError(t, err)
+	require.Equal(t, &ErrorPolicy{Action: OnErrorSkipTable, RetryCount: 3}, policy)
+
+	_, err = ParseErrorPolicy("retry--1")
+	require.Error(t, err)
+	_, err = ParseErrorPolicy("ignore")
+	require.Error(t, err)
+
+	tableConfig := &TableConfig{TargetTables: []string{"test.t"}, OnError: "retry-x"}
+	require.False(t, tableConfig.Valid())
+
+	cfg := NewConfig()
+	cfg.CheckThreadCount = 1
+	cfg.OnError = "fail"
+	require.False(t, cfg.CheckConfig())
+	cfg.OnError = "retry-2"
+	require.True(t, cfg.CheckConfig())
+}
+
+func TestParseCheckWindow(t *testing.T) {
+	window, err := ParseCheckWindow("7d")
+	require.NoError(t, err)
+	require.Equal(t, 7*24*time.Hour, window)
+	window, err = ParseCheckWindow("12h")
+	require.NoError(t, err)
+	require.Equal(t, 12*time.Hour, window)
+	for _, invalid := range []string{"", "0d", "-1h", "xd", "week"} {
+		_, err = ParseCheckWindow(invalid)
+		require.Error(t, err)
+	}
+
+	tableConfig := &TableConfig{TargetTables: []string{"test.t"}, TimeColumn: "created_at"}
+	require.False(t, tableConfig.Valid())
+	tableConfig.CheckWindow = "1w"
+	require.False(t, tableConfig.Valid())
+	tableConfig.CheckWindow = "7d"
+	require.True(t, tableConfig.Valid())
+}
+
+func TestRecheckTables(t *testing.T) {
+	cfg := NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config.toml", "--tables", "test2.t2,schema1.table1"}))
+	require.Nil(t, cfg.Init())
+	require.Equal(t, []string{"test2.t2", "schema1.table1"}, cfg.Task.RecheckTables)
+
+	require.True(t, cfg.Task.IsRecheck())
+	require.True(t, cfg.Task.TargetRecheckTables.MatchTable("test2", "t2"))
+	require.True(t, cfg.Task.TargetRecheckTables.MatchTable("schema1", "table1"))
+	require.False(t, cfg.Task.TargetRecheckTables.MatchTable("schema1", "table2"))
+	require.Equal(t, "/tmp/output/config/checkpoint-recheck", cfg.Task.CheckpointDir)
+	require.Equal(t, "/tmp/output/config/fix-on-tidb0-recheck", cfg.Task.FixDir)
+	require.NoError(t, os.RemoveAll(cfg.Task.OutputDir))
+
+	// the spaces and the empty entries are skipped
+	cfg = NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config.toml", "--tables", " test2.t2, ,schema1.table1,"}))
+	require.Nil(t, cfg.Init())
+	require.Equal(t, []string{"test2.t2", "schema1.table1"}, cfg.Task.RecheckTables)
+	require.NoError(t, os.RemoveAll(cfg.Task.OutputDir))
+
+	cfg = NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config.toml", "--tables", " , "}))
+	require.Nil(t, cfg.Init())
+	require.False(t, cfg.Task.IsRecheck())
+	require.NoError(t, os.RemoveAll(cfg.Task.OutputDir))
+}
+
+func TestRedactPasswords(t *testing.T) {
+	cfg := NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config.toml"}))
+	cfg.DataSources["mysql1"].Password = "mysql-secret"
+	cfg.DataSources["tidb0"].Password = "tidb-secret"
+	cfg.Task.SensitiveTables = []string{"schema1.*"}
+	require.Nil(t, cfg.Init())
+	require.ElementsMatch(t, []string{"mysql-secret", "tidb-secret"}, cfg.GetSecrets())
+	require.True(t, cfg.Task.TargetSensitiveTables.MatchTable("schema1", "table1"))
+	require.False(t, cfg.Task.TargetSensitiveTables.MatchTable("test2", "t2"))
+
+	output := cfg.String()
+	require.NotContains(t, output, "mysql-secret")
+	require.NotContains(t, output, "tidb-secret")
+	require.Contains(t, output, redactedPassword)
+	// the config itself is not changed
+	require.Equal(t, "mysql-secret", cfg.DataSources["mysql1"].Password)
+	require.Equal(t, "tidb-secret", cfg.Task.TargetInstance.Password)
+
+	require.NoError(t, os.RemoveAll(cfg.Task.OutputDir))
+}
+
+func TestTLS(t *testing.T) {
+	certDir := filepath.Join("..", "..", "pkg", "utils", "tls_test")
+	cfg := NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config.toml"}))
+	cfg.MinTLSVersion = "1.4"
+	require.Error(t, cfg.Init())
+
+	cfg = NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config.toml"}))
+	cfg.MinTLSVersion = "1.2"
+	cfg.TLSCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+	cfg.DataSources["tidb0"].Security = &Security{
+		CAPath:   filepath.Join(certDir, "ca.pem"),
+		CertPath: filepath.Join(certDir, "client1.pem"),
+		KeyPath:  filepath.Join(certDir, "client1.key"),
+	}
+	cfg.StatusSecurity = &Security{
+		CAPath:   filepath.Join(certDir, "ca.pem"),
+		CertPath: filepath.Join(certDir, "server.pem"),
+		KeyPath:  filepath.Join(certDir, "server.key"),
+	}
+	require.Nil(t, cfg.Init())
+	require.Equal(t, "sync_diff_tidb0", cfg.Task.TargetInstance.ToDBConfig().TLSName)
+	require.Empty(t, cfg.DataSources["mysql1"].ToDBConfig().TLSName)
+	tlsCfg, err := cfg.GetStatusTLSConfig()
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS12), tlsCfg.MinVersion)
+	require.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, tlsCfg.CipherSuites)
+
+	// the status server needs the certificate
+	cfg.StatusSecurity.CertPath, cfg.StatusSecurity.KeyPath = "", ""
+	require.Error(t, cfg.initTLS())
+	// the CA is required to connect the instance with TLS
+	cfg.StatusSecurity = nil
+	cfg.DataSources["tidb0"].Security = &Security{}
+	require.Error(t, cfg.initTLS())
+
+	require.NoError(t, os.RemoveAll(cfg.Task.OutputDir))
+}
+
+func TestReadOnlyTarget(t *testing.T) {
+	cfg := NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config.toml"}))
+	require.Nil(t, cfg.Init())
+	require.True(t, cfg.Task.TargetInstance.ToDBConfig().ReadOnly)
+	for _, source := range cfg.Task.SourceInstances {
+		require.False(t, source.ToDBConfig().ReadOnly)
+	}
+	require.NoError(t, os.RemoveAll(cfg.Task.OutputDir))
+
+	cfg = NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config.toml", "--apply-fix"}))
+	require.Nil(t, cfg.Init())
+	require.False(t, cfg.Task.TargetInstance.ToDBConfig().ReadOnly)
+	require.NoError(t, os.RemoveAll(cfg.Task.OutputDir))
+}
+
+func TestDialer(t *testing.T) {
+	cfg := NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config.toml"}))
+	cfg.AddressSelection = "nearest"
+	require.Error(t, cfg.Init())
+
+	cfg = NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config.toml"}))
+	cfg.AddressSelection = dbutil.AddressSelectionPreferIPv6
+	cfg.DialRetry = 2
+	cfg.DataSources["mysql1"].Host = "[::1]"
+	require.Nil(t, cfg.Init())
+	dbCfg := cfg.DataSources["mysql1"].ToDBConfig()
+	require.Equal(t, "::1", dbCfg.Host)
+	require.Equal(t, dialerNetwork, dbCfg.Net)
+	require.Equal(t, dialerNetwork, cfg.Task.TargetInstance.ToDBConfig().Net)
+
+	cfg.DialTimeout = -1
+	require.Error(t, cfg.initDialer())
+
+	require.NoError(t, os.RemoveAll(cfg.Task.OutputDir))
+}
+
+func TestQueryChecks(t *testing.T) {
+	cfg := NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config.toml", "--tables", "test.stats"}))
+	require.Nil(t, cfg.Init())
+	require.Empty(t, cfg.Task.TargetQueryChecks)
+
+	queryChecks := map[string]*QueryCheck{
+		"check1": {
+			TargetTable: "test.stats",
+			SourceQuery: "SELECT a, COUNT(*) AS cnt FROM test.t GROUP BY a",
+			TargetQuery: "SELECT a, cnt FROM test.stats",
+			KeyColumns:  []string{"a"},
+		},
+	}
+	cfg.Task.QueryChecks = []string{"check2"}
+	require.Contains(t, cfg.Task.Init(cfg.DataSources, cfg.TableConfigs, queryChecks).Error(), "not found query check")
+
+	cfg.Task.QueryChecks = []string{"check1"}
+	require.Nil(t, cfg.Task.Init(cfg.DataSources, cfg.TableConfigs, queryChecks))
+	require.Len(t, cfg.Task.TargetQueryChecks, 1)
+	require.Equal(t, "test", cfg.Task.TargetQueryChecks[0].Schema)
+	require.Equal(t, "stats", cfg.Task.TargetQueryChecks[0].Table)
+
+	queryChecks["check1"].TargetTable = "stats"
+	require.Contains(t, cfg.Task.Init(cfg.DataSources, cfg.TableConfigs, queryChecks).Error(), "should be in the format of `schema.table`")
+
+	require.NoError(t, os.RemoveAll(cfg.Task.OutputDir))
+}
+
+func TestMockConfig(t *testing.T) {
+	cfg := NewConfig()
+	require.Nil(t, cfg.Parse([]string{"--config", "config_mock.toml"}))
+	require.Nil(t, cfg.Init())
+	defer os.RemoveAll(cfg.Task.OutputDir)
+	require.True(t, cfg.Task.TargetInstance.IsMock())
+	require.Equal(t, &MockConfig{Tables: 4, Rows: 100000, Seed: 1, CorruptionRate: 0.001}, cfg.Task.TargetInstance.Mock)
+	require.True(t, cfg.CheckConfig())
+
+	cfg.ApplyFixSQL = true
+	require.False(t, cfg.CheckConfig())
+	cfg.ApplyFixSQL = false
+
+	cfg.Task.TargetInstance.Mock.CorruptionRate = 2
+	require.False(t, cfg.CheckConfig())
+	cfg.Task.TargetInstance.Mock.CorruptionRate = 0.1
+
+	// the mock data source can't be compared with a real instance.
+	cfg.Task.SourceInstances[0].SourceType = ""
+	require.False(t, cfg.CheckConfig())
+	cfg.Task.SourceInstances[0].SourceType = "abc"
+	require.False(t, cfg.CheckConfig())
+	cfg.Task.SourceInstances[0].SourceType = SourceTypeMock
+	require.True(t, cfg.CheckConfig())
+}
+
+func TestLightningCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	_, err := LoadLightningCheckpoints(dir)
+	require.Contains(t, err.Error(), "tidb-lightning-ctl --checkpoint-dump")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, lightningTablesFile), []byte(
+		"task_id,table_name,hash,status,alloc_base,create_time,update_time\n"+
+			"1,`test`.`t1`,00,180,0,2021-01-01 00:00:00,2021-01-01 00:00:00\n"+
+			"1,`test`.`t``2`,00,120,0,2021-01-01 00:00:00,2021-01-01 00:00:00\n"+
+			"1,`test`.`t3`,00,13,0,2021-01-01 00:00:00,2021-01-01 00:00:00\n"), LocalFilePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, lightningEnginesFile), []byte(
+		"table_name,engine_id,status,create_time,update_time\n"+
+			"`test`.`t1`,-1,120,2021-01-01 00:00:00,2021-01-01 00:00:00\n"+
+			"`test`.`t1`,0,120,2021-01-01 00:00:00,2021-01-01 00:00:00\n"+
+			"`test`.`t1`,1,120,2021-01-01 00:00:00,2021-01-01 00:00:00\n"+
+			"`test`.`t``2`,0,120,2021-01-01 00:00:00,2021-01-01 00:00:00\n"+
+			"`test`.`t``2`,1,90,2021-01-01 00:00:00,2021-01-01 00:00:00\n"), LocalFilePerm))
+	tables, err := LoadLightningCheckpoints(dir)
+	require.NoError(t, err)
+	require.Len(t, tables, 3)
+	require.Equal(t, &LightningTable{Schema: "test", Table: "t1", Status: 180, DataEngines: 2, ImportedEngines: 2}, tables["`test`.`t1`"])
+	require.Equal(t, &LightningTable{Schema: "test", Table: "t`2", Status: 120, DataEngines: 2, ImportedEngines: 1}, tables["`test`.`t``2`"])
+	require.True(t, tables["`test`.`t1`"].IsImported())
+	require.False(t, tables["`test`.`t``2`"].IsImported())
+	// the failed import
+	require.False(t, tables["`test`.`t3`"].IsImported())
+
+	cfg := NewConfig()
+	cfg.Lightning = &LightningConfig{CheckpointDir: dir}
+	require.NoError(t, cfg.initLightningTables())
+	require.Equal(t, []string{"*.*"}, cfg.Task.CheckTables)
+	require.True(t, cfg.Task.IsImported("test", "t1"))
+	require.False(t, cfg.Task.IsImported("test", "t`2"))
+	require.False(t, cfg.Task.IsImported("test", "t4"))
+	cfg.Task.ImportedTables = nil
+	require.True(t, cfg.Task.IsImported("test", "t4"))
+
+	for _, name := range []string{"test.t1", "`test`", "`test`.`t1", "`test`.`t1`.`c`", "`test`x`t1`"} {
+		_, _, err := parseLightningTableName(name)
+		require.Error(t, err, name)
+	}
+}
@@ -14,16 +14,22 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"path/filepath"
+	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/pingcap/dm/dm/config"
 	"github.com/pingcap/dm/dm/pb"
 	"github.com/pingcap/dm/pkg/utils"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
+	router "github.com/pingcap/tidb-tools/pkg/table-router"
 	"go.uber.org/zap"
 )
 
@@ -79,6 +85,199 @@ func getDMTaskCfg(dmAddr, task string) ([]*config.SubTaskConfig, error) {
 		subTaskCfgs = append(subTaskCfgs, subtaskCfg)
 	}
 
-	log.Info("dm sub task configs", zap.Reflect("cfgs", subTaskCfgs))
+	// the decrypted passwords are in the configs, so only the sources are logged.
+	sources := make([]string, 0, len(subTaskCfgs))
+	for _, subTaskCfg := range subTaskCfgs {
+		sources = append(sources, subTaskCfg.SourceID)
+	}
+	log.Info("dm sub task configs", zap.String("task", task), zap.Strings("sources", sources))
 	return subTaskCfgs, nil
 }
+
+// dmGeneratedConfig is the sync_diff config generated from a DM task, only the fields decided by the task are written.
+type dmGeneratedConfig struct {
+	CheckThreadCount int                               `toml:"check-thread-count"`
+	ExportFixSQL     bool                              `toml:"export-fix-sql"`
+	DataSources      map[string]*dmGeneratedDataSource `toml:"data-sources"`
+	Routes           map[string]*router.TableRule      `toml:"routes,omitempty"`
+	Task             dmGeneratedTask                   `toml:"task"`
+}
+
+type dmGeneratedDataSource struct {
+	Host       string   `toml:"host"`
+	Port       int      `toml:"port"`
+	User       string   `toml:"user"`
+	Password   string   `toml:"password"`
+	SqlMode    string   `toml:"sql-mode,omitempty"`
+	RouteRules []string `toml:"route-rules,omitempty"`
+}
+
+type dmGeneratedTask struct {
+	OutputDir   string   `toml:"output-dir"`
+	Source      []string `toml:"source-instances"`
+	Target      string   `toml:"target-instance"`
+	CheckTables []string `toml:"target-check-tables"`
+}
+
+// GenerateConfigFromDMTask returns a sync_diff config in toml checking the tables replicated by the DM task,
+// the source instances, routes and block-allow lists are pulled from dm-master.
+func GenerateConfigFromDMTask(dmAddr, task string) ([]byte, error) {
+	subTaskCfgs, err := getDMTaskCfg(dmAddr, task)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to get the config of DM task %s", task)
+	}
+	return generateConfigFromDMSubTasks(task, subTaskCfgs)
+}
+
+func generateConfigFromDMSubTasks(task string, subTaskCfgs []*config.SubTaskConfig) ([]byte, error) {
+	if len(subTaskCfgs) == 0 {
+		return nil, errors.Errorf("DM task %s has no sub task", task)
+	}
+	sqlMode := ""
+	if subTaskCfgs[0].EnableANSIQuotes {
+		sqlMode = "ANSI_QUOTES"
+	}
+	generated := &dmGeneratedConfig{
+		CheckThreadCount: 4,
+		ExportFixSQL:     true,
+		DataSources:      make(map[string]*dmGeneratedDataSource),
+		Routes:           make(map[string]*router.TableRule),
+		Task: dmGeneratedTask{
+			OutputDir: filepath.Join("output", task),
+			Target:    "target",
+		},
+	}
+	to := subTaskCfgs[0].To
+	generated.DataSources["target"] = &dmGeneratedDataSource{
+		Host:     to.Host,
+		Port:     to.Port,
+		User:     to.User,
+		Password: to.Password,
+		SqlMode:  sqlMode,
+	}
+
+	// the same route rules of the sub tasks share a name.
+	routeNames := make(map[router.TableRule]string)
+	var allowRules, blockRules []string
+	notes := make([]string, 0)
+	for _, subTaskCfg := range subTaskCfgs {
+		source := &dmGeneratedDataSource{
+			Host:     subTaskCfg.From.Host,
+			Port:     subTaskCfg.From.Port,
+			User:     subTaskCfg.From.User,
+			Password: subTaskCfg.From.Password,
+			SqlMode:  sqlMode,
+		}
+		for _, rule := range subTaskCfg.RouteRules {
+			key := router.TableRule{SchemaPattern: rule.SchemaPattern, TablePattern: rule.TablePattern, TargetSchema: rule.TargetSchema, TargetTable: rule.TargetTable}
+			name, ok := routeNames[key]
+			if !ok {
+				name = fmt.Sprintf("route%d", len(routeNames)+1)
+				routeNames[key] = name
+				generated.Routes[name] = rule
+			}
+			source.RouteRules = append(source.RouteRules, name)
+			targetTable := rule.TargetTable
+			if targetTable == "" {
+				targetTable = "*"
+			}
+			allowRules = append(allowRules, fmt.Sprintf("%s.%s", escapeFilterName(rule.TargetSchema), escapeFilterName(targetTable)))
+		}
+		generated.DataSources[subTaskCfg.SourceID] = source
+		generated.Task.Source = append(generated.Task.Source, subTaskCfg.SourceID)
+
+		allow, block := blockAllowListToFilterRules(subTaskCfg.BAList)
+		allowRules = append(allowRules, allow...)
+		blockRules = append(blockRules, block...)
+		if subTaskCfg.MetaSchema != "" {
+			blockRules = append(blockRules, fmt.Sprintf("!%s.*", escapeFilterName(subTaskCfg.MetaSchema)))
+		}
+		for _, rule := range subTaskCfg.FilterRules {
+			notes = append(notes, fmt.Sprintf("%s: %s.%s %v %v", subTaskCfg.SourceID, rule.SchemaPattern, rule.TablePattern, rule.Events, rule.SQLPattern))
+		}
+	}
+	// the tables not routed keep their names in the target, so the allow lists of the sources are kept.
+	// the block lists are at the end, because the later rules of the table filter take precedence.
+	generated.Task.CheckTables = uniqueStrings(append(allowRules, blockRules...))
+
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("# Diff Configuration generated from DM task %s.\n", task))
+	buf.WriteString("# the passwords are in plaintext, please keep the file safe.\n")
+	if len(notes) > 0 {
+		buf.WriteString("# the binlog event filter rules of the task are not applied, the rows of the filtered events may be reported as different:\n")
+		for _, note := range notes {
+			buf.WriteString(fmt.Sprintf("#   %s\n", note))
+		}
+	}
+	buf.WriteString("\n")
+	if err := toml.NewEncoder(&buf).Encode(generated); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// blockAllowListToFilterRules returns the rules of the table filter matching the block-allow list of DM.
+// All the tables are allowed if the list has no do-dbs or do-tables.
+func blockAllowListToFilterRules(rules *filter.MySQLReplicationRules) (allow []string, block []string) {
+	if rules == nil || (len(rules.DoDBs) == 0 && len(rules.DoTables) == 0) {
+		allow = append(allow, "*.*")
+	}
+	if rules == nil {
+		return allow, nil
+	}
+	for _, db := range rules.DoDBs {
+		allow = append(allow, fmt.Sprintf("%s.*", legacyPatternToFilterRule(db)))
+	}
+	for _, table := range rules.DoTables {
+		allow = append(allow, fmt.Sprintf("%s.%s", legacyPatternToFilterRule(table.Schema), legacyPatternToFilterRule(table.Name)))
+	}
+	for _, db := range rules.IgnoreDBs {
+		block = append(block, fmt.Sprintf("!%s.*", legacyPatternToFilterRule(db)))
+	}
+	for _, table := range rules.IgnoreTables {
+		block = append(block, fmt.Sprintf("!%s.%s", legacyPatternToFilterRule(table.Schema), legacyPatternToFilterRule(table.Name)))
+	}
+	return allow, block
+}
+
+// legacyPatternToFilterRule converts a pattern of the block-allow list to the syntax of the table filter,
+// the regular expression starting with `~` is wrapped by `/`, and the wildcard is kept.
+func legacyPatternToFilterRule(pattern string) string {
+	if strings.HasPrefix(pattern, "~") {
+		return "/" + strings.Replace(pattern[1:], "/", "\\/", -1) + "/"
+	}
+	return escapeFilterName(pattern)
+}
+
+// escapeFilterName escapes the punctuations reserved by the table filter, except the wildcards.
+func escapeFilterName(name string) string {
+	var builder strings.Builder
+	inBracket := false
+	for _, r := range name {
+		switch {
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case inBracket, r == '*', r == '?', r == '_', r == '$', r >= 0x80,
+			r >= '0' && r <= '9', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		default:
+			builder.WriteRune('\\')
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+func uniqueStrings(strs []string) []string {
+	seen := make(map[string]struct{}, len(strs))
+	result := make([]string, 0, len(strs))
+	for _, s := range strs {
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		result = append(result, s)
+	}
+	return result
+}
@@ -19,6 +19,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/BurntSushi/toml"
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
 	"github.com/stretchr/testify/require"
 )
 
@@ -69,3 +71,52 @@ func TestGetDMTaskCfg(t *testing.T) {
 		User:     dmTaskCfg[1].From.User,
 	}))
 }
+
+func TestGenerateConfigFromDMTask(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(testHandler))
+	defer mockServer.Close()
+
+	data, err := GenerateConfigFromDMTask(mockServer.URL, "test")
+	require.NoError(t, err)
+	dmTaskCfg, err := getDMTaskCfg(mockServer.URL, "test")
+	require.NoError(t, err)
+
+	cfg := NewConfig()
+	_, err = toml.Decode(string(data), cfg)
+	require.NoError(t, err)
+	require.Equal(t, "target", cfg.Task.Target)
+	require.Equal(t, []string{"mysql-replica-01", "mysql-replica-02"}, cfg.Task.Source)
+	require.True(t, equal(cfg.DataSources["target"], &DataSource{
+		Host:     dmTaskCfg[0].To.Host,
+		Port:     dmTaskCfg[0].To.Port,
+		Password: dmTaskCfg[0].To.Password,
+		User:     dmTaskCfg[0].To.User,
+	}))
+	require.True(t, equal(cfg.DataSources["mysql-replica-02"], &DataSource{
+		Host:     dmTaskCfg[1].From.Host,
+		Port:     dmTaskCfg[1].From.Port,
+		Password: dmTaskCfg[1].From.Password,
+		User:     dmTaskCfg[1].From.User,
+	}))
+
+	// the same route rules of the sub tasks are shared
+	require.Len(t, cfg.Routes, 2)
+	require.Equal(t, []string{"route1", "route2"}, cfg.DataSources["mysql-replica-01"].RouteRules)
+	require.Equal(t, []string{"route1", "route2"}, cfg.DataSources["mysql-replica-02"].RouteRules)
+	require.Equal(t, "t_target", cfg.Routes["route1"].TargetTable)
+
+	require.Equal(t, []string{
+		"db_target.t_target",
+		"db_target.*",
+		`/^sharding[\d]+/.*`,
+		`/^sharding[\d]+/./^t[\d]+/`,
+		"!dm_meta.*",
+	}, cfg.Task.CheckTables)
+	f, err := filter.Parse(cfg.Task.CheckTables)
+	require.NoError(t, err)
+	require.True(t, f.MatchTable("db_target", "t_target"))
+	require.False(t, f.MatchTable("dm_meta", "test_syncer_checkpoint"))
+
+	require.Equal(t, `a\-b*.t[a-z]?`, legacyPatternToFilterRule("a-b*")+"."+legacyPatternToFilterRule("t[a-z]?"))
+	require.Equal(t, `/^a\/b$/`, legacyPatternToFilterRule("~^a/b$"))
+}
@@ -0,0 +1,205 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+const (
+	// the files dumped by `tidb-lightning-ctl --checkpoint-dump=<dir>`.
+	lightningTablesFile  = "tables.csv"
+	lightningEnginesFile = "engines.csv"
+
+	// the statuses of the checkpoints of TiDB Lightning, the statuses not greater than
+	// lightningStatusMaxInvalid mean the import failed.
+	lightningStatusMaxInvalid    = 25
+	lightningStatusImported      = 120
+	lightningStatusIndexImported = 140
+
+	// the engine of the indexes, the other engines contain the rows.
+	lightningIndexEngineID = -1
+)
+
+// LightningConfig is the config to verify the tables imported by TiDB Lightning.
+type LightningConfig struct {
+	// the directory dumped by `tidb-lightning-ctl --checkpoint-dump=<dir>` after the import,
+	// only the tables whose data and indexes have been imported are checked.
+	CheckpointDir string `toml:"checkpoint-dir" json:"checkpoint-dir"`
+}
+
+// LightningTable is the import progress of a table by TiDB Lightning.
+type LightningTable struct {
+	Schema string
+	Table  string
+	Status int
+	// DataEngines and ImportedEngines are the numbers of the engines containing the rows of the table,
+	// and the ones imported.
+	DataEngines     int
+	ImportedEngines int
+}
+
+// IsImported returns true if the data and the indexes of the table have been imported.
+func (t *LightningTable) IsImported() bool {
+	return t.Status >= lightningStatusIndexImported
+}
+
+// LoadLightningCheckpoints loads the import progress of the tables from the dumped checkpoints of TiDB Lightning,
+// the tables are keyed by dbutil.TableName.
+func LoadLightningCheckpoints(dir string) (map[string]*LightningTable, error) {
+	tables := make(map[string]*LightningTable)
+	// the engines refer to the tables by the names in the checkpoints.
+	tablesByName := make(map[string]*LightningTable)
+	tableRows, err := readLightningCSV(filepath.Join(dir, lightningTablesFile), "table_name", "status")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, row := range tableRows {
+		schema, table, err := parseLightningTableName(row[0])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		status, err := strconv.Atoi(row[1])
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid status of table %s", row[0])
+		}
+		if status <= lightningStatusMaxInvalid {
+			// the import failed, so the table may be incomplete.
+			status = 0
+		}
+		lightningTable := &LightningTable{Schema: schema, Table: table, Status: status}
+		tables[dbutil.TableName(schema, table)] = lightningTable
+		tablesByName[row[0]] = lightningTable
+	}
+
+	engineRows, err := readLightningCSV(filepath.Join(dir, lightningEnginesFile), "table_name", "engine_id", "status")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, row := range engineRows {
+		table, ok := tablesByName[row[0]]
+		if !ok {
+			continue
+		}
+		engineID, err := strconv.Atoi(row[1])
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid engine id of table %s", row[0])
+		}
+		status, err := strconv.Atoi(row[2])
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid status of engine %d of table %s", engineID, row[0])
+		}
+		if engineID == lightningIndexEngineID {
+			continue
+		}
+		table.DataEngines++
+		if status >= lightningStatusImported {
+			table.ImportedEngines++
+		}
+	}
+	return tables, nil
+}
+
+// readLightningCSV returns the values of the columns of the rows in the csv file with a header.
+func readLightningCSV(fileName string, columns ...string) ([][]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Annotate(err, "please dump the checkpoints by `tidb-lightning-ctl --checkpoint-dump`")
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Annotatef(err, "read the header of %s", fileName)
+	}
+	offsets := make([]int, 0, len(columns))
+	for _, column := range columns {
+		offset := -1
+		for i, name := range header {
+			if name == column {
+				offset = i
+				break
+			}
+		}
+		if offset < 0 {
+			return nil, errors.Errorf("column %s is not found in %s", column, fileName)
+		}
+		offsets = append(offsets, offset)
+	}
+
+	rows := make([][]string, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, errors.Annotatef(err, "read %s", fileName)
+		}
+		row := make([]string, 0, len(offsets))
+		for _, offset := range offsets {
+			row = append(row, record[offset])
+		}
+		rows = append(rows, row)
+	}
+}
+
+// parseLightningTableName splits the quoted name of TiDB Lightning, e.g. `schema`.`table`.
+func parseLightningTableName(name string) (string, string, error) {
+	parts := make([]string, 0, 2)
+	rest := name
+	for len(rest) > 0 {
+		if rest[0] != '`' {
+			return "", "", errors.Errorf("invalid table name %s", name)
+		}
+		var part strings.Builder
+		i := 1
+		for ; i < len(rest); i++ {
+			if rest[i] != '`' {
+				part.WriteByte(rest[i])
+				continue
+			}
+			if i+1 < len(rest) && rest[i+1] == '`' {
+				// the escaped backquote
+				part.WriteByte('`')
+				i++
+				continue
+			}
+			break
+		}
+		if i >= len(rest) {
+			return "", "", errors.Errorf("invalid table name %s", name)
+		}
+		parts = append(parts, part.String())
+		rest = rest[i+1:]
+		if len(rest) > 0 {
+			if rest[0] != '.' {
+				return "", "", errors.Errorf("invalid table name %s", name)
+			}
+			rest = rest[1:]
+		}
+	}
+	if len(parts) != 2 {
+		return "", "", errors.Errorf("invalid table name %s", name)
+	}
+	return parts[0], parts[1], nil
+}
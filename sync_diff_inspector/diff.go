@@ -20,9 +20,11 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -33,15 +35,18 @@ import (
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/checkpoints"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/chunk"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/events"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/progress"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/report"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/source"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/source/common"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/splitter"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/utils"
+	"github.com/pingcap/tidb/br/pkg/storage"
 	tidbconfig "github.com/pingcap/tidb/config"
 	"github.com/pingcap/tidb/parser/model"
 	"github.com/siddontang/go/ioutil2"
+	pd "github.com/tikv/pd/client"
 	"go.uber.org/zap"
 )
 
@@ -56,6 +61,13 @@ type ChunkDML struct {
 	sqls      []string
 	rowAdd    int
 	rowDelete int
+	// exceedDiffLimit is true if the different rows of the chunk exceed `max-diff-rows-per-chunk`,
+	// then sqls only contains the range-level reload suggestion.
+	exceedDiffLimit bool
+	// events are the different rows encoded as row change events if `diff-events` is set.
+	events []*events.Message
+	// rowHashes are the hashes of the full rows whose counts are different, see `full-row-hash`.
+	rowHashes []string
 }
 
 // Diff contains two sql DB, used for comparing.
@@ -67,33 +79,199 @@ type Diff struct {
 	// workSource is one of upstream/downstream by some policy in #pickSource.
 	workSource source.Source
 
+	// only sample percent of the chunks chosen by sampleSeed are compared, 0 or 100 means all the chunks are compared.
 	sample           int
+	sampleSeed       int64
 	checkThreadCount int
 	exportFixSQL     bool
+	applyFix         bool
+	binSearchFanOut  int
 	useCheckpoint    bool
 	ignoreDataCheck  bool
-	sqlWg            sync.WaitGroup
-	checkpointWg     sync.WaitGroup
+	// checkCountOnly only compares the row counts of the chunks, the rows are never fetched.
+	checkCountOnly bool
+	// failFast stops the data comparison at the first different chunk.
+	failFast     bool
+	sqlWg        sync.WaitGroup
+	checkpointWg sync.WaitGroup
+	// ignoreExtraColumns only compares the columns in both the upstream and the downstream.
+	ignoreExtraColumns bool
+
+	// the checkpoint is saved every checkpointFlushInterval, after a table is checked and after
+	// checkpointFlushChunks chunks are checked if it's greater than 0. flushCh triggers the saving.
+	checkpointFlushInterval time.Duration
+	checkpointFlushChunks   int
+	flushCh                 chan struct{}
+	// the artifacts of the last keepRuns finished runs are kept in the history dir of outputDir, 0 means no history is kept.
+	keepRuns  int
+	outputDir string
+
+	// maxDiffRowsPerChunk is the max number of different rows recorded for a chunk, 0 means no limit.
+	maxDiffRowsPerChunk  int
+	exportRangeReloadSQL bool
+	// the rest chunks of a table are skipped once its diffs exceed these thresholds, 0 means no limit.
+	maxDiffRowsPerTable     int64
+	maxFailedChunksPerTable int64
+	// tableDiffCounts stores the *tableDiffCount of each table index.
+	tableDiffCounts sync.Map
+	// the rest chunks of all the tables are skipped once totalDiffRows exceeds maxDiffRowsTotal, 0 means no limit.
+	maxDiffRowsTotal  int64
+	totalDiffRows     int64
+	totalDiffExceeded int32
+	// largeTableAction is what to do with the tables larger than `large-table-threshold`.
+	largeTableAction string
+	// the chunk queries of downstream costing more than slowQueryThreshold are explained, 0 means no check.
+	slowQueryThreshold time.Duration
+	// explainedTables stores the index of tables whose slow query has been explained.
+	explainedTables sync.Map
+	// the checksum of a chunk costing more than checksumTimeout is given up, 0 means no timeout.
+	checksumTimeout     time.Duration
+	maxChecksumTimeouts int64
+	// checksumTimeouts stores the *int64 count of checksum timeouts of each table index.
+	checksumTimeouts sync.Map
+	// rowCompareTables stores the index of tables whose rest chunks are compared row by row without checksum.
+	rowCompareTables sync.Map
+	// the timestamp values of the upstream are converted into downstreamLocation if upstreamLocation is different,
+	// they are nil if the time zones are unknown. fixTimeZone is the session time zone set by the fix sql files.
+	upstreamLocation   *time.Location
+	downstreamLocation *time.Location
+	fixTimeZone        string
+	// tableLimiters are the limiters of the table indexes with `check-thread-count`, which are guarded by limiterMu.
+	limiterMu     sync.Mutex
+	limiterCond   *sync.Cond
+	tableLimiters map[int]*tableLimiter
+
+	// incremental only compares the rows changed since the last successful run for the tables with change hint,
+	// a full run is forced after fullRunInterval incremental runs.
+	incremental          bool
+	fullRunInterval      int
+	incrementalStatePath string
+	incrementalState     *checkpoints.IncrementalState
+	// runTime is the start time of this run, which is the last run time of the tables in the next run.
+	runTime string
+
+	// failedChunksPath is where the failed tables and chunks of this run are saved, it's empty if they aren't saved.
+	failedChunksPath string
+	// failedChunks are the tables and chunks failed in the last run, only they are checked if it isn't nil.
+	failedChunks *checkpoints.FailedChunks
+
+	disableGCSafePoint bool
+	gcSafePointConfig  utils.GCSafePointConfig
+	// stopGCKeepers stop updating and remove the service safepoints when exits.
+	stopGCKeepers []func()
 
 	FixSQLDir     string
 	CheckpointDir string
+	// cpStorage is where the checkpoint is saved, the checkpoint file by default.
+	cpStorage checkpoints.Storage
+	// cpDB is the connection to save the checkpoint into the target, it's nil if the checkpoint is saved in the file.
+	cpDB *sql.DB
+	// extStorage is the external storage to save the checkpoint and the fix sql files, it's nil if not set.
+	// The fix sql files are saved into extFixDir of it besides FixSQLDir.
+	extStorage storage.ExternalStorage
+	extFixDir  string
+	// extLocalDir is the dir of the external storage if it's a local path, whose sub dirs must be created
+	// before writing the files into them.
+	extLocalDir string
+	// resumeHash is the hash of the effective config saved in the checkpoint, the checkpoint saved with
+	// another hash is resumed only if forceResume is set.
+	resumeHash  string
+	forceResume bool
+
+	// diffEvents emits the different rows as row change events, it's nil if `diff-events` isn't set.
+	diffEvents *events.Emitter
+
+	sqlCh chan *ChunkDML
+	cp    *checkpoints.Checkpoint
+	// startRanges are the chunks of each table index saved in the checkpoint, the chunks of each table
+	// are checked after its start range.
+	startRanges map[int]*splitter.RangeInfo
+	report      *report.Report
+
+	// skippedTables stores the index of tables skipped by the on-error policy or the thresholds.
+	skippedTables sync.Map
+	// cancel stops the data comparison when a table meets error with the `fail-run` policy.
+	cancel    context.CancelFunc
+	abortOnce sync.Once
+	abortErr  error
+	// failFastStopped is set to 1 once the data comparison is stopped by `fail-fast`.
+	failFastStopped int32
+
+	// fixedChunks are the chunks whose fix sqls have been applied to downstream.
+	// It's only accessed by the writeSQLs goroutine until the data comparison finished.
+	fixedChunks []*splitter.RangeInfo
+
+	// retryChunks are the chunks failed by transient errors, which are retried once at the end of the data comparison.
+	retryMu     sync.Mutex
+	retryChunks []*retryChunk
+	// recheckChunks are the chunks with different checksums, which are compared again after recheckDelay
+	// at most recheckTimes times. recheckCounts stores how many times each *splitter.RangeInfo is queued.
+	recheckDelay  time.Duration
+	recheckTimes  int
+	recheckChunks []*recheckChunk
+	recheckCounts sync.Map
+}
+
+// recheckChunk is a chunk with different checksums waiting for the re-check.
+type recheckChunk struct {
+	rangeInfo *splitter.RangeInfo
+	queuedAt  time.Time
+}
 
-	sqlCh      chan *ChunkDML
-	cp         *checkpoints.Checkpoint
-	startRange *splitter.RangeInfo
-	report     *report.Report
+// retryChunk is a chunk failed by a transient error.
+type retryChunk struct {
+	rangeInfo *splitter.RangeInfo
+	err       error
 }
 
 // NewDiff returns a Diff instance.
 func NewDiff(ctx context.Context, cfg *config.Config) (diff *Diff, err error) {
 	diff = &Diff{
+		sample:           cfg.SamplePercent,
+		sampleSeed:       cfg.SampleSeed,
 		checkThreadCount: cfg.CheckThreadCount,
 		exportFixSQL:     cfg.ExportFixSQL,
+		applyFix:         cfg.ApplyFixSQL,
+		binSearchFanOut:  cfg.GetBinSearchFanOut(),
 		ignoreDataCheck:  cfg.CheckStructOnly,
+		checkCountOnly:   cfg.CheckCountOnly,
+		failFast:         cfg.FailFast,
 		sqlCh:            make(chan *ChunkDML, splitter.DefaultChannelBuffer),
 		cp:               new(checkpoints.Checkpoint),
 		report:           report.NewReport(&cfg.Task),
+
+		maxDiffRowsPerChunk:  cfg.MaxDiffRowsPerChunk,
+		exportRangeReloadSQL: cfg.ExportRangeReloadSQL,
+
+		maxDiffRowsPerTable:     int64(cfg.MaxDiffRowsPerTable),
+		maxFailedChunksPerTable: int64(cfg.MaxFailedChunksPerTable),
+		maxDiffRowsTotal:        cfg.MaxDiffRowsTotal,
+		largeTableAction:        cfg.GetLargeTableAction(),
+		ignoreExtraColumns:      cfg.IgnoreExtraColumns,
+		slowQueryThreshold:      time.Duration(cfg.SlowQueryThreshold) * time.Second,
+		checksumTimeout:         time.Duration(cfg.ChecksumTimeout) * time.Second,
+		maxChecksumTimeouts:     int64(cfg.GetMaxChecksumTimeouts()),
+		recheckDelay:            time.Duration(cfg.RecheckDelay) * time.Second,
+		recheckTimes:            cfg.RecheckTimes,
+		incremental:             cfg.Incremental,
+		fullRunInterval:         cfg.GetFullRunInterval(),
+
+		checkpointFlushInterval: cfg.GetCheckpointFlushInterval(),
+		checkpointFlushChunks:   cfg.CheckpointFlushChunks,
+		flushCh:                 make(chan struct{}, 1),
+		keepRuns:                cfg.KeepRuns,
+		outputDir:               cfg.Task.OutputDir,
+
+		disableGCSafePoint: cfg.DisableGCSafePoint,
+		gcSafePointConfig: utils.GCSafePointConfig{
+			TTL:            cfg.GetGCSafePointTTL(),
+			UpdateInterval: time.Duration(cfg.GCSafePointUpdateInterval) * time.Second,
+			ServiceID:      cfg.GCServiceID,
+		},
 	}
+	diff.report.SetSummaryOptions(cfg.SummaryFilter, cfg.SummarySortBy, cfg.SummaryCollapsePassed)
+	diff.report.SetChecksumAlgorithm(cfg.GetChecksumAlgorithm())
+	diff.report.SetChecksumOnly(!diff.rowsComparable() && !diff.checkCountOnly)
 	if err = diff.init(ctx, cfg); err != nil {
 		diff.Close()
 		return nil, errors.Trace(err)
@@ -105,7 +283,9 @@ func NewDiff(ctx context.Context, cfg *config.Config) (diff *Diff, err error) {
 func (df *Diff) PrintSummary(ctx context.Context) bool {
 	// Stop updating progress bar so that summary won't be flushed.
 	progress.Close()
-	df.report.CalculateTotalSize(ctx, df.downstream.GetDB())
+	if db := df.downstream.GetDB(); db != nil {
+		df.report.CalculateTotalSize(ctx, db)
+	}
 	err := df.report.CommitSummary()
 	if err != nil {
 		log.Fatal("failed to commit report", zap.Error(err))
@@ -115,20 +295,39 @@ func (df *Diff) PrintSummary(ctx context.Context) bool {
 }
 
 func (df *Diff) Close() {
+	for _, stop := range df.stopGCKeepers {
+		stop()
+	}
 	if df.upstream != nil {
 		df.upstream.Close()
 	}
 	if df.downstream != nil {
 		df.downstream.Close()
 	}
+	if df.diffEvents != nil {
+		if err := df.diffEvents.Close(); err != nil {
+			log.Warn("fail to close the diff events", zap.Error(err))
+		}
+	}
 
 	failpoint.Inject("wait-for-checkpoint", func() {
 		log.Info("failpoint wait-for-checkpoint injected, skip delete checkpoint file.")
 		failpoint.Return()
 	})
 
-	if err := os.Remove(filepath.Join(df.CheckpointDir, checkpointFile)); err != nil && !os.IsNotExist(err) {
-		log.Fatal("fail to remove the checkpoint file", zap.String("error", err.Error()))
+	if df.keepRuns > 0 {
+		// the checkpoint is still removed if the artifacts can't be kept, since the run is finished.
+		if err := df.archiveRun(context.Background()); err != nil {
+			log.Warn("fail to keep the artifacts of the run", zap.Error(err))
+		}
+	}
+	if df.cpStorage != nil {
+		if err := df.cpStorage.Remove(context.Background()); err != nil {
+			log.Fatal("fail to remove the checkpoint", zap.String("checkpoint", df.cpStorage.String()), zap.String("error", err.Error()))
+		}
+	}
+	if df.cpDB != nil {
+		dbutil.CloseDB(df.cpDB)
 	}
 }
 
@@ -141,66 +340,409 @@ func (df *Diff) init(ctx context.Context, cfg *config.Config) (err error) {
 		return errors.Trace(err)
 	}
 
-	df.workSource = df.pickSource(ctx)
+	// the hash is computed after the sources are initialized, so that the snapshots are resolved.
+	if df.resumeHash, err = cfg.Task.ComputeResumeHash(); err != nil {
+		return errors.Trace(err)
+	}
+	df.forceResume = cfg.Task.ForceResume
+	df.initTimeZone(cfg)
+
+	df.workSource = df.pickSource(ctx, cfg)
 	df.FixSQLDir = cfg.Task.FixDir
 	df.CheckpointDir = cfg.Task.CheckpointDir
+	if err := df.initCheckpointStorage(ctx, cfg); err != nil {
+		return errors.Trace(err)
+	}
+	// the tables are reordered before they are accessed by the table indexes.
+	if err := df.restoreTableOrder(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	for tableIndex, tableDiff := range df.downstream.GetTables() {
+		// only the hashes of the sensitive columns are read, so their values are redacted in the fix sql.
+		utils.SetSensitiveColumns(tableDiff.Schema, tableDiff.Table, tableDiff.SensitiveColumns)
+		if tableDiff.FullRowHash && df.rowsComparable() {
+			// the duplicate rows cancel out each other in the checksum, so the hashes of the rows are always compared.
+			df.rowCompareTables.Store(tableIndex, struct{}{})
+		}
+	}
+	df.initTableLimiters()
+
+	if df.incremental {
+		if err := df.initIncremental(ctx, cfg); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := df.initFailedChunks(cfg); err != nil {
+		return errors.Trace(err)
+	}
+	if df.sampling() {
+		df.report.SetSamplePercent(df.sample)
+	}
 
 	sourceConfigs, targetConfig, err := getConfigsForReport(cfg)
 	if err != nil {
 		return errors.Trace(err)
 	}
 	df.report.Init(df.downstream.GetTables(), sourceConfigs, targetConfig)
-	if err := df.initCheckpoint(); err != nil {
+	if err := df.initCheckpoint(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	if err := df.checkDiskSpace(ctx, cfg.GetMinFreeDiskSpace()); err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.DiffEvents != nil && !df.ignoreDataCheck {
+		if df.diffEvents, err = events.NewEmitter(cfg.DiffEvents, cfg.Task.OutputDir); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, tableDiff := range df.downstream.GetTables() {
+		if tableDiff.LargeTable {
+			df.report.SetTableLargeTableAction(tableDiff.Schema, tableDiff.Table, df.largeTableAction)
+		}
+	}
+	return nil
+}
+
+// initIncremental restricts the ranges of the tables with change hint to the rows changed since their last
+// successful runs. The notes are added to the tables before the report is initialized, so that they are
+// kept in the checkpoint.
+func (df *Diff) initIncremental(ctx context.Context, cfg *config.Config) error {
+	if cfg.Task.TargetInstance.IsMock() {
+		log.Warn("the incremental mode is ignored for the mock sources")
+		df.incremental = false
+		return nil
+	}
+	df.incrementalStatePath = filepath.Join(cfg.Task.OutputDir, checkpoints.IncrementalStateFile)
+	state, err := checkpoints.LoadIncrementalState(df.incrementalStatePath)
+	if err != nil {
 		return errors.Trace(err)
 	}
+	df.incrementalState = state
+
+	resumed, err := df.cpStorage.Exists(ctx)
+	if err != nil {
+		return errors.Annotate(err, "check the checkpoint for the incremental mode")
+	}
+	if resumed && state.PendingRunTime != "" {
+		df.runTime = state.PendingRunTime
+	} else {
+		// the rows changed after the snapshots of the sources are compared in the next run,
+		// so the run time is the earliest one of the sources.
+		for _, instance := range cfg.Task.SourceInstances {
+			snapshot := instance.Snapshot
+			if instance.GetSnapshotMode() == config.SnapshotModeNone {
+				snapshot = ""
+			}
+			runTime, err := utils.GetSnapshotTime(ctx, instance.Conn, snapshot)
+			if err != nil {
+				return errors.Annotate(err, "get the run time for the incremental mode")
+			}
+			if df.runTime == "" || runTime < df.runTime {
+				df.runTime = runTime
+			}
+		}
+		state.PendingRunTime = df.runTime
+		if err := checkpoints.SaveIncrementalState(df.incrementalStatePath, state); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	for _, tableDiff := range df.downstream.GetTables() {
+		if tableDiff.ChangeHintColumn == "" {
+			continue
+		}
+		tableState, ok := state.Tables[utils.UniqueID(tableDiff.Schema, tableDiff.Table)]
+		switch {
+		case !ok:
+			tableDiff.Notes = append(tableDiff.Notes, "full run because the table has no successful run yet")
+		case tableState.IncrementalRuns >= df.fullRunInterval:
+			tableDiff.Notes = append(tableDiff.Notes, fmt.Sprintf("forced full run after %d incremental runs", tableState.IncrementalRuns))
+		default:
+			tableDiff.Range = utils.ChangedSinceRange(tableDiff.Range, tableDiff.ChangeHintColumn, tableState.LastRunTime)
+			tableDiff.Notes = append(tableDiff.Notes, fmt.Sprintf("only the rows whose %s is not less than '%s' are compared", tableDiff.ChangeHintColumn, tableState.LastRunTime))
+		}
+	}
+	log.Info("incremental mode", zap.String("run time", df.runTime), zap.Int("full run interval", df.fullRunInterval))
 	return nil
 }
 
-func (df *Diff) initCheckpoint() error {
+// initFailedChunks loads the tables and chunks failed in the last run for `--check-failed-only`. The failed ones of
+// this run replace them at the end, except for a re-check of some tables by `--tables`, which doesn't check the others.
+func (df *Diff) initFailedChunks(cfg *config.Config) error {
+	path := filepath.Join(cfg.Task.OutputDir, checkpoints.FailedChunksFile)
+	if cfg.CheckFailedOnly {
+		failed, err := checkpoints.LoadFailedChunks(path)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		df.failedChunks = failed
+	} else if cfg.Task.IsRecheck() {
+		return nil
+	}
+	if df.checkCountOnly {
+		// the equal counts don't mean the equal data, the recorded ones are kept.
+		return nil
+	}
+	df.failedChunksPath = path
+	return nil
+}
+
+// SaveFailedChunks records the tables and chunks failed in this run, which are re-checked by `--check-failed-only`.
+func (df *Diff) SaveFailedChunks() error {
+	// the chunks not compared because of `fail-fast` are unknown, the recorded ones are kept.
+	if len(df.failedChunksPath) == 0 || atomic.LoadInt32(&df.failFastStopped) == 1 {
+		return nil
+	}
+	failed := checkpoints.NewFailedChunks()
+	for _, tableDiff := range df.downstream.GetTables() {
+		isFailed, chunks := df.report.GetFailedChunks(tableDiff.Schema, tableDiff.Table)
+		switch {
+		case !isFailed:
+		case chunks == nil:
+			failed.AddTable(tableDiff.Schema, tableDiff.Table)
+		default:
+			for _, chunkResult := range chunks {
+				failed.AddChunk(tableDiff.Schema, tableDiff.Table, chunkResult.Range, chunkResult.IndexID)
+			}
+		}
+	}
+	return errors.Trace(checkpoints.SaveFailedChunks(df.failedChunksPath, failed))
+}
+
+// SaveIncrementalState records this run as the last successful run of the tables with change hint whose data is equal,
+// the other tables are compared from their previous last run times again in the next run.
+func (df *Diff) SaveIncrementalState() error {
+	// the equal counts don't mean the equal data, so the run isn't a successful run of the tables,
+	// and the tables not compared because of `fail-fast` may be counted as equal.
+	if !df.incremental || df.checkCountOnly || atomic.LoadInt32(&df.failFastStopped) == 1 {
+		return nil
+	}
+	state := df.incrementalState
+	for _, tableDiff := range df.downstream.GetTables() {
+		if tableDiff.ChangeHintColumn == "" || tableDiff.IgnoreDataCheck || !df.report.IsTableEqual(tableDiff.Schema, tableDiff.Table) {
+			continue
+		}
+		id := utils.UniqueID(tableDiff.Schema, tableDiff.Table)
+		tableState, ok := state.Tables[id]
+		if !ok || tableState.IncrementalRuns >= df.fullRunInterval {
+			// this run is a full run.
+			state.Tables[id] = &checkpoints.TableIncrementalState{LastRunTime: df.runTime}
+			continue
+		}
+		tableState.LastRunTime = df.runTime
+		tableState.IncrementalRuns++
+	}
+	state.PendingRunTime = ""
+	return errors.Trace(checkpoints.SaveIncrementalState(df.incrementalStatePath, state))
+}
+
+// initCheckpointStorage decides where the checkpoint is saved. The checkpoint is saved into the target by
+// a separated connection, because the sessions of the target are read-only unless applying the fix sql.
+func (df *Diff) initCheckpointStorage(ctx context.Context, cfg *config.Config) error {
+	if cfg.Task.UseExternalStorage() {
+		return df.initExternalStorage(ctx, cfg)
+	}
+	if !cfg.Task.UseMySQLCheckpoint() {
+		df.cpStorage = checkpoints.NewFileStorage(filepath.Join(df.CheckpointDir, checkpointFile))
+		return nil
+	}
+	target := cfg.Task.TargetInstance
+	dbCfg := target.ToDBConfig()
+	dbCfg.Snapshot = ""
+	dbCfg.ReadOnly = false
+	db, err := dbutil.OpenDB(*dbCfg, nil)
+	if err != nil {
+		return errors.Annotatef(err, "connect to target %s to save the checkpoint", dbutil.HostPort(target.Host, target.Port))
+	}
+	storage, err := checkpoints.NewMySQLStorage(ctx, db, cfg.Task.OutputDir)
+	if err != nil {
+		dbutil.CloseDB(db)
+		return errors.Trace(err)
+	}
+	df.cpDB = db
+	df.cpStorage = storage
+	log.Info("save the checkpoint into the target", zap.String("checkpoint", storage.String()))
+	return nil
+}
+
+// initExternalStorage saves the checkpoint and the fix sql files into the external storage, in the same layout
+// as the output dir.
+func (df *Diff) initExternalStorage(ctx context.Context, cfg *config.Config) error {
+	backend, err := storage.ParseBackend(cfg.Task.ExternalStorage, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	extStorage, err := storage.New(ctx, backend, &storage.ExternalStorageOptions{})
+	if err != nil {
+		return errors.Annotatef(err, "open the external storage %s", utils.RedactSecrets(cfg.Task.ExternalStorage))
+	}
+	cpStorage := checkpoints.NewExternalFileStorage(extStorage, path.Join("checkpoint", checkpointFile))
+	df.extStorage = extStorage
+	df.extFixDir = filepath.Base(df.FixSQLDir)
+	if local := backend.GetLocal(); local != nil {
+		df.extLocalDir = local.Path
+		if err := df.mkdirExternal(path.Dir(cpStorage.Name()), df.extFixDir); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	df.cpStorage = cpStorage
+	log.Info("save the checkpoint and the fix sql files into the external storage", zap.String("checkpoint", cpStorage.String()))
+	return nil
+}
+
+// restoreTableOrder compares the tables in the order saved in the checkpoint, because the order by the estimated
+// sizes of `table-order` may change after resuming, while the chunks of the checkpoint are keyed by the table indexes.
+func (df *Diff) restoreTableOrder(ctx context.Context) error {
+	exists, err := df.cpStorage.Exists(ctx)
+	if err != nil || !exists {
+		return errors.Trace(err)
+	}
+	state, err := checkpoints.ReadSavedState(ctx, df.cpStorage)
+	if err != nil {
+		// the checkpoint is loaded again by initCheckpoint, which reports the error.
+		log.Warn("fail to read the order of the tables in the checkpoint", zap.Error(err))
+		return nil
+	}
+	if len(state.Tables) > 0 && source.RestoreTableOrder(df.downstream.GetTables(), state.Tables) {
+		log.Info("compare the tables in the order saved in the checkpoint", zap.Strings("tables", state.Tables))
+	}
+	return nil
+}
+
+func (df *Diff) initCheckpoint(ctx context.Context) error {
 	df.cp.Init()
+	df.cp.SetConfigHash(df.resumeHash, df.forceResume)
+	tables := make([]string, 0, len(df.workSource.GetTables()))
+	for _, tableDiff := range df.workSource.GetTables() {
+		tables = append(tables, dbutil.TableName(tableDiff.Schema, tableDiff.Table))
+	}
+	df.cp.SetTables(tables)
 
 	finishTableNums := 0
-	path := filepath.Join(df.CheckpointDir, checkpointFile)
-	if ioutil2.FileExists(path) {
-		node, reportInfo, err := df.cp.LoadChunk(path)
+	exists, err := df.cpStorage.Exists(ctx)
+	if err != nil {
+		return errors.Annotate(err, "the checkpoint load process failed")
+	}
+	checkpointIDs := make(map[int]*chunk.ChunkID)
+	if exists {
+		node, reportInfo, err := df.cp.LoadChunkFrom(ctx, df.cpStorage)
 		if err != nil {
 			return errors.Annotate(err, "the checkpoint load process failed")
-		} else {
-			// this need not be synchronized, because at the moment, the is only one thread access the section
-			log.Info("load checkpoint",
-				zap.Any("chunk index", node.GetID()),
-				zap.Reflect("chunk", node),
-				zap.String("state", node.GetState()))
-			df.cp.InitCurrentSavedID(node)
-		}
-
-		if node != nil {
-			// remove the sql file that ID bigger than node.
-			// cause we will generate these sql again.
-			err = df.removeSQLFiles(node.GetID())
-			if err != nil {
-				return errors.Trace(err)
+		}
+		// this need not be synchronized, because at the moment, the is only one thread access the section
+		log.Info("load checkpoint",
+			zap.Any("chunk index", node.GetID()),
+			utils.RedactAnyData("chunk", node),
+			zap.String("state", node.GetState()))
+		df.report.LoadReport(reportInfo)
+		df.startRanges = make(map[int]*splitter.RangeInfo)
+		for tableIndex, tableNode := range df.cp.GetTableNodes() {
+			if tableIndex >= len(df.workSource.GetTables()) {
+				return errors.Errorf("the table index %d of the checkpoint is out of the %d tables", tableIndex, len(df.workSource.GetTables()))
 			}
-			df.startRange = splitter.FromNode(node)
-			df.report.LoadReport(reportInfo)
-			finishTableNums = df.startRange.GetTableIndex()
-			if df.startRange.ChunkRange.Type == chunk.Empty {
+			df.startRanges[tableIndex] = splitter.FromNode(tableNode)
+			checkpointIDs[tableIndex] = tableNode.GetID()
+			if tableNode.IsTableFinished() {
 				// chunk_iter will skip this table directly
 				finishTableNums++
 			}
 		}
 	} else {
-		log.Info("not found checkpoint file, start from beginning")
-		id := &chunk.ChunkID{TableIndex: -1, BucketIndexLeft: -1, BucketIndexRight: -1, ChunkIndex: -1, ChunkCnt: 0}
-		err := df.removeSQLFiles(id)
+		log.Info("not found checkpoint, start from beginning")
+	}
+	// remove the sql files after the checkpoint of each table, cause we will generate these sql again.
+	if err := df.removeSQLFiles(ctx, checkpointIDs); err != nil {
+		return errors.Trace(err)
+	}
+	progress.Init(len(df.workSource.GetTables()), finishTableNums)
+	for tableIndex, tableNode := range df.cp.GetTableNodes() {
+		if tableNode.IsTableFinished() {
+			continue
+		}
+		// the chunks of the resumed table up to the checkpoint are counted as finished.
+		tableDiff := df.workSource.GetTables()[tableIndex]
+		finishedChunks := df.cp.GetFinishedChunks(tableIndex)
+		log.Info("restore the progress of the table",
+			zap.String("table", dbutil.TableName(tableDiff.Schema, tableDiff.Table)),
+			zap.Int("finished chunks", finishedChunks))
+		progress.RestoreTable(dbutil.TableName(tableDiff.Schema, tableDiff.Table), finishedChunks)
+	}
+	return nil
+}
+
+// checkDiskSpace checks the free space of the output directories before the comparison,
+// and warns if the fix sql may fill the disk, which can be as large as the data of the tables in the worst case.
+func (df *Diff) checkDiskSpace(ctx context.Context, minFreeSpace int64) error {
+	var fixSQLFreeSpace uint64
+	for _, dir := range []string{df.CheckpointDir, df.FixSQLDir} {
+		freeSpace, err := utils.GetDiskFreeSpace(dir)
 		if err != nil {
 			return errors.Trace(err)
 		}
+		if freeSpace < uint64(minFreeSpace) {
+			return errors.Errorf("the free space of %s is %d bytes, less than min-free-disk-space %d bytes, please free some space or change the output-dir", dir, freeSpace, minFreeSpace)
+		}
+		fixSQLFreeSpace = freeSpace
+	}
+	if df.ignoreDataCheck || !df.exportFixSQL || df.downstream.GetDB() == nil {
+		return nil
+	}
+
+	var estimatedSize int64
+	for _, tableDiff := range df.downstream.GetTables() {
+		if tableDiff.Query != "" {
+			// the result set of a query has no table size
+			continue
+		}
+		size, err := utils.GetTableSize(ctx, df.downstream.GetDB(), tableDiff.Schema, tableDiff.Table)
+		if err != nil {
+			log.Warn("fail to get the size of table", zap.String("table", dbutil.TableName(tableDiff.Schema, tableDiff.Table)), zap.Error(err))
+			continue
+		}
+		estimatedSize += size
+	}
+	if uint64(estimatedSize) > fixSQLFreeSpace {
+		log.Warn("the fix sql may fill the disk if most of the data is different, the comparison stops with the checkpoint kept when the disk is full",
+			zap.String("fix sql dir", df.FixSQLDir),
+			zap.Uint64("free space", fixSQLFreeSpace),
+			zap.Int64("estimated size", estimatedSize))
 	}
-	progress.Init(len(df.workSource.GetTables()), finishTableNums)
 	return nil
 }
 
+// abortByNoSpace stops the comparison because the disk is full. The checkpoint is kept,
+// so the comparison continues from it after the space is freed.
+func (df *Diff) abortByNoSpace(path string, err error) {
+	df.abortOnce.Do(func() {
+		log.Error("stop the comparison because the disk is full", zap.String("path", path), zap.Error(err))
+		df.abortErr = errors.Annotatef(err, "the disk of %s is full, please free some space and run again to continue from the checkpoint", path)
+		if df.cancel != nil {
+			df.cancel()
+		}
+	})
+}
+
+// abortByApplyError stops the comparison because the fix sql of a chunk failed to be applied.
+func (df *Diff) abortByApplyError(err error) {
+	df.abortOnce.Do(func() {
+		log.Error("stop the comparison because the fix sql can't be applied", zap.Error(err))
+		df.abortErr = errors.Annotate(err, "please run again to continue from the checkpoint")
+		if df.cancel != nil {
+			df.cancel()
+		}
+	})
+}
+
+func (df *Diff) abortByEventsError(err error) {
+	df.abortOnce.Do(func() {
+		log.Error("stop the comparison because the diff events can't be written", zap.Error(err))
+		df.abortErr = errors.Annotate(err, "fail to write the diff events, please run again to continue from the checkpoint")
+		if df.cancel != nil {
+			df.cancel()
+		}
+	})
+}
+
 func encodeReportConfig(config *report.ReportConfig) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	if err := toml.NewEncoder(buf).Encode(config); err != nil {
@@ -246,8 +788,13 @@ func getConfigsForReport(cfg *config.Config) ([][]byte, []byte, error) {
 }
 
 // Equal tests whether two database have same data and schema.
-func (df *Diff) Equal(ctx context.Context) error {
-	chunksIter, err := df.generateChunksIterator(ctx)
+func (df *Diff) Equal(ctx context.Context) (err error) {
+	// checkCtx is cancelled when a table meets error with the `fail-run` policy,
+	// the checkpoint and sql writer still use ctx to flush what have been checked.
+	checkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	df.cancel = cancel
+	chunksIter, err := df.generateChunksIterator(checkCtx)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -268,10 +815,16 @@ func (df *Diff) Equal(ctx context.Context) error {
 		df.sqlWg.Wait()
 		stopCh <- struct{}{}
 		df.checkpointWg.Wait()
+		if df.abortErr != nil {
+			err = df.abortErr
+		}
 	}()
 
 	for {
-		c, err := chunksIter.Next(ctx)
+		if checkCtx.Err() != nil {
+			break
+		}
+		c, err := chunksIter.Next(checkCtx)
 		if err != nil {
 			return errors.Trace(err)
 		}
@@ -279,26 +832,138 @@ func (df *Diff) Equal(ctx context.Context) error {
 			// finish read the tables
 			break
 		}
-		log.Info("global consume chunk info", zap.Any("chunk index", c.ChunkRange.Index), zap.Any("chunk bound", c.ChunkRange.Bounds))
+		if !df.sampleChunk(c) {
+			df.skipUnsampledChunk(c)
+			continue
+		}
+		tableDiff := df.workSource.GetTables()[c.GetTableIndex()]
+		log.Info("global consume chunk info", zap.Any("chunk index", c.ChunkRange.Index), utils.RedactData(tableDiff.Schema, tableDiff.Table, "chunk bound", c.ChunkRange.Bounds))
+		if !df.acquireTable(c) {
+			// the chunk is pending, it's compared by the worker of the table after the running chunk.
+			continue
+		}
 		pool.Apply(func() {
-			isEqual := df.consume(ctx, c)
-			if !isEqual {
-				progress.FailTable(c.ProgressID)
-			}
-			progress.Inc(c.ProgressID)
+			df.consumeTableChunks(checkCtx, c)
 		})
 	}
 
+	pool.WaitFinished()
+	df.recheckFailedChunks(checkCtx, pool)
+	df.retryFailedChunks(checkCtx, pool)
 	return nil
 }
 
+// consumeChunk compares the chunk and updates the progress, the progress of the chunk queued for the retry
+// is updated after the retry.
+func (df *Diff) consumeChunk(ctx context.Context, rangeInfo *splitter.RangeInfo, isRetry bool) {
+	isEqual, queued := df.consume(ctx, rangeInfo, isRetry)
+	if queued {
+		return
+	}
+	if !isEqual {
+		progress.FailTable(rangeInfo.ProgressID)
+	}
+	progress.Inc(rangeInfo.ProgressID)
+}
+
+// queueRetry queues the chunk failed by a transient error to retry it at the end of the data comparison,
+// and returns false if the error isn't transient or the comparison is stopped.
+func (df *Diff) queueRetry(ctx context.Context, rangeInfo *splitter.RangeInfo, err error) bool {
+	if ctx.Err() != nil || !utils.IsTransientError(err) {
+		return false
+	}
+	tableDiff := df.downstream.GetTables()[rangeInfo.GetTableIndex()]
+	log.Warn("the chunk meets a transient error, retry it at the end",
+		zap.String("table", dbutil.TableName(tableDiff.Schema, tableDiff.Table)),
+		zap.Any("chunk id", rangeInfo.ChunkRange.Index),
+		zap.Error(err))
+	df.retryMu.Lock()
+	df.retryChunks = append(df.retryChunks, &retryChunk{rangeInfo: rangeInfo, err: err})
+	df.retryMu.Unlock()
+	return true
+}
+
+// queueRecheck queues the chunk with different checksums to compare it again after `recheck-delay`, since the
+// differences may be caused by the replication lag. It returns false if the chunk has been re-checked
+// `recheck-times` times or the comparison is stopped.
+func (df *Diff) queueRecheck(ctx context.Context, rangeInfo *splitter.RangeInfo) bool {
+	if df.recheckTimes <= 0 || ctx.Err() != nil {
+		return false
+	}
+	// a chunk is re-checked after the previous check finished, so its count isn't accessed concurrently.
+	v, _ := df.recheckCounts.LoadOrStore(rangeInfo, new(int))
+	times := v.(*int)
+	if *times >= df.recheckTimes {
+		return false
+	}
+	*times++
+	df.retryMu.Lock()
+	df.recheckChunks = append(df.recheckChunks, &recheckChunk{rangeInfo: rangeInfo, queuedAt: time.Now()})
+	df.retryMu.Unlock()
+	return true
+}
+
+// recheckFailedChunks compares the queued chunks with different checksums again once `recheck-delay` passed since
+// they are queued, the chunks still different are queued again until they are re-checked `recheck-times` times,
+// then they are compared row by row and reported. The chunks retried because of transient errors afterwards
+// aren't re-checked.
+func (df *Diff) recheckFailedChunks(ctx context.Context, pool *utils.WorkerPool) {
+	for {
+		df.retryMu.Lock()
+		chunks := df.recheckChunks
+		df.recheckChunks = nil
+		df.retryMu.Unlock()
+		if len(chunks) == 0 || ctx.Err() != nil {
+			return
+		}
+		// the chunks are queued in order, so the delay of the last one covers all of them.
+		delay := time.Until(chunks[len(chunks)-1].queuedAt.Add(df.recheckDelay))
+		log.Info("re-check the chunks with different checksums", zap.Int("chunk count", len(chunks)), zap.Duration("wait", delay))
+		if delay > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+		for _, c := range chunks {
+			rangeInfo := c.rangeInfo
+			pool.Apply(func() {
+				df.consumeChunk(ctx, rangeInfo, false)
+			})
+		}
+		pool.WaitFinished()
+	}
+}
+
+// retryFailedChunks compares the chunks failed by transient errors once more, the chunks failed again are
+// reported as errors. The checkpoint doesn't move past the queued chunks until they are retried,
+// so they are compared again if the run is interrupted before.
+func (df *Diff) retryFailedChunks(ctx context.Context, pool *utils.WorkerPool) {
+	df.retryMu.Lock()
+	chunks := df.retryChunks
+	df.retryChunks = nil
+	df.retryMu.Unlock()
+	if len(chunks) == 0 || ctx.Err() != nil {
+		return
+	}
+	log.Info("retry the chunks failed by transient errors", zap.Int("chunk count", len(chunks)))
+	for _, c := range chunks {
+		rangeInfo := c.rangeInfo
+		pool.Apply(func() {
+			df.consumeChunk(ctx, rangeInfo, true)
+		})
+	}
+	pool.WaitFinished()
+}
+
 func (df *Diff) StructEqual(ctx context.Context) error {
 	tables := df.downstream.GetTables()
-	tableIndex := 0
-	if df.startRange != nil {
-		tableIndex = df.startRange.ChunkRange.Index.TableIndex
-	}
-	for ; tableIndex < len(tables); tableIndex++ {
+	for tableIndex := 0; tableIndex < len(tables); tableIndex++ {
+		if startRange, ok := df.startRanges[tableIndex]; ok && startRange.ChunkRange.IsLastChunkForTable() {
+			// the result of the finished table is loaded from the checkpoint.
+			continue
+		}
 		isEqual, isSkip, err := df.compareStruct(ctx, tableIndex)
 		if err != nil {
 			return errors.Trace(err)
@@ -315,18 +980,67 @@ func (df *Diff) compareStruct(ctx context.Context, tableIndex int) (isEqual bool
 		return false, true, errors.Trace(err)
 	}
 	table := df.downstream.GetTables()[tableIndex]
+	if df.ignoreExtraColumns {
+		df.removeExtraColumns(table, sourceTableInfos)
+	}
 	isEqual, isSkip = utils.CompareStruct(sourceTableInfos, table.Info)
-	table.IgnoreDataCheck = isSkip
+	// the data-check of the large tables is skipped by `large-table-action`, but the structure is still compared.
+	table.IgnoreDataCheck = isSkip || (table.LargeTable && df.largeTableAction == config.LargeTableSkip)
 	return isEqual, isSkip, nil
 }
 
-func (df *Diff) startGCKeeperForTiDB(ctx context.Context, db *sql.DB, snap string) {
-	pdCli, _ := utils.GetPDClientForGC(ctx, db)
+// removeExtraColumns removes the columns only in the upstream or the downstream from the table infos, so only
+// the columns in both of them are compared. The fix sql updates the different columns only, so the extra columns
+// of the downstream are kept.
+func (df *Diff) removeExtraColumns(table *common.TableDiff, sourceTableInfos []*model.TableInfo) {
+	for _, sourceTableInfo := range sourceTableInfos {
+		utils.ResetColumns(sourceTableInfo, utils.ExtraColumns(sourceTableInfo, []*model.TableInfo{table.Info}))
+	}
+	extraColumns := utils.ExtraColumns(table.Info, sourceTableInfos)
+	if len(extraColumns) == 0 {
+		return
+	}
+	log.Warn("the extra columns of the downstream are not compared",
+		zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Strings("columns", extraColumns))
+	table.Info, _ = utils.ResetColumns(table.Info, extraColumns)
+	table.PartialColumns = true
+	largeColumns := make([]string, 0, len(table.LargeColumns))
+	for _, column := range table.LargeColumns {
+		if dbutil.FindColumnByName(table.Info.Columns, column) != nil {
+			largeColumns = append(largeColumns, column)
+		}
+	}
+	table.LargeColumns = largeColumns
+	df.report.SetTableExtraColumns(table.Schema, table.Table, extraColumns)
+}
+
+func (df *Diff) startGCKeeperForTiDB(ctx context.Context, db *sql.DB, snap string, ds *config.DataSource) {
+	if df.disableGCSafePoint {
+		log.Warn("the GC safepoint is disabled, user should guarantee the GC stopped during diff progress.")
+		return
+	}
+	if ds.KeyspaceName != "" {
+		// the service safepoint of pd only works for the whole cluster, which doesn't keep the GC of a keyspace stopped.
+		log.Warn("the GC safepoint of keyspace is not supported, user should guarantee the GC stopped during diff progress.",
+			zap.String("keyspace", ds.KeyspaceName))
+		return
+	}
+	security := pd.SecurityOption{}
+	if ds.PDSecurity != nil {
+		security.CAPath = ds.PDSecurity.CAPath
+		security.CertPath = ds.PDSecurity.CertPath
+		security.KeyPath = ds.PDSecurity.KeyPath
+	}
+	pdCli, err := utils.GetPDClientForGC(ctx, db, ds.PDAddrs, security)
+	if err != nil {
+		log.Warn("failed to create pd client, user should guarantee the GC stopped during diff progress.", zap.Error(err))
+		return
+	}
 	if pdCli != nil {
 		// Get latest snapshot
 		latestSnap, err := utils.GetSnapshot(ctx, db)
 		if err != nil {
-			log.Info("failed to get snapshot, user should guarantee the GC stopped during diff progress.")
+			log.Warn("failed to get snapshot, user should guarantee the GC stopped during diff progress.", zap.Error(err))
 			return
 		}
 
@@ -340,33 +1054,43 @@ func (df *Diff) startGCKeeperForTiDB(ctx context.Context, db *sql.DB, snap strin
 			}
 		}
 
-		err = utils.StartGCSavepointUpdateService(ctx, pdCli, db, snap)
+		stop, err := utils.StartGCSavepointUpdateService(ctx, pdCli, db, snap, df.gcSafePointConfig)
 		if err != nil {
-			log.Info("failed to keep snapshot, user should guarantee the GC stopped during diff progress.")
-		} else {
+			log.Warn("failed to keep snapshot, user should guarantee the GC stopped during diff progress.", zap.Error(err))
+		} else if stop != nil {
+			df.stopGCKeepers = append(df.stopGCKeepers, stop)
 			log.Info("start update service to keep GC stopped automatically")
 		}
 	}
 }
 
 // pickSource pick one proper source to do some work. e.g. generate chunks
-func (df *Diff) pickSource(ctx context.Context) source.Source {
+func (df *Diff) pickSource(ctx context.Context, cfg *config.Config) source.Source {
 	workSource := df.downstream
+	if df.downstream.GetDB() == nil {
+		// the mock sources have no database.
+		return workSource
+	}
 	if ok, _ := dbutil.IsTiDB(ctx, df.upstream.GetDB()); ok {
 		log.Info("The upstream is TiDB. pick it as work source candidate")
-		df.startGCKeeperForTiDB(ctx, df.upstream.GetDB(), df.upstream.GetSnapshot())
+		// the upstream TiDB source has only one instance.
+		df.startGCKeeperForTiDB(ctx, df.upstream.GetDB(), df.upstream.GetSnapshot(), cfg.Task.SourceInstances[0])
 		workSource = df.upstream
 	}
 	if ok, _ := dbutil.IsTiDB(ctx, df.downstream.GetDB()); ok {
 		log.Info("The downstream is TiDB. pick it as work source first")
-		df.startGCKeeperForTiDB(ctx, df.downstream.GetDB(), df.downstream.GetSnapshot())
+		df.startGCKeeperForTiDB(ctx, df.downstream.GetDB(), df.downstream.GetSnapshot(), cfg.Task.TargetInstance)
 		workSource = df.downstream
 	}
 	return workSource
 }
 
 func (df *Diff) generateChunksIterator(ctx context.Context) (source.RangeIterator, error) {
-	return df.workSource.GetRangeIterator(ctx, df.startRange, df.workSource.GetTableAnalyzer())
+	analyzer := df.workSource.GetTableAnalyzer()
+	if df.failedChunks != nil {
+		analyzer = source.NewFailedChunksAnalyzer(analyzer, df.failedChunks)
+	}
+	return df.workSource.GetRangeIterator(ctx, df.startRanges, analyzer)
 }
 
 func (df *Diff) handleCheckpoints(ctx context.Context, stopCh chan struct{}) {
@@ -378,16 +1102,30 @@ func (df *Diff) handleCheckpoints(ctx context.Context, stopCh chan struct{}) {
 		df.checkpointWg.Done()
 	}()
 	flush := func() {
-		chunk := df.cp.GetChunkSnapshot()
-		if chunk != nil {
-			tableDiff := df.downstream.GetTables()[chunk.GetTableIndex()]
-			schema, table := tableDiff.Schema, tableDiff.Table
-			r, err := df.report.GetSnapshot(chunk.GetID(), schema, table)
+		cur := df.cp.GetChunkSnapshot()
+		if cur != nil {
+			// the results of each table are saved up to its own checked chunk.
+			chunkIDs := make(map[string]map[string]*chunk.ChunkID)
+			for tableIndex, node := range df.cp.GetTableNodes() {
+				tableDiff := df.downstream.GetTables()[tableIndex]
+				if _, ok := chunkIDs[tableDiff.Schema]; !ok {
+					chunkIDs[tableDiff.Schema] = make(map[string]*chunk.ChunkID)
+				}
+				chunkIDs[tableDiff.Schema][tableDiff.Table] = node.GetID()
+			}
+			r, err := df.report.GetTablesSnapshot(chunkIDs)
 			if err != nil {
 				log.Warn("fail to save the report", zap.Error(err))
 			}
-			_, err = df.cp.SaveChunk(ctx, filepath.Join(df.CheckpointDir, checkpointFile), chunk, r)
+			// the checkpoint is still saved after ctx is done, so it's saved with its own timeout.
+			saveCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			_, err = df.cp.SaveChunkTo(saveCtx, df.cpStorage, cur, r)
+			cancel()
 			if err != nil {
+				if utils.IsNoSpaceError(err) {
+					df.abortByNoSpace(df.CheckpointDir, err)
+					return
+				}
 				log.Warn("fail to save the chunk", zap.Error(err))
 				// maybe we should panic, because SaveChunk method should not failed.
 			}
@@ -402,64 +1140,343 @@ func (df *Diff) handleCheckpoints(ctx context.Context, stopCh chan struct{}) {
 		case <-stopCh:
 			log.Info("Stop do checkpoint")
 			return
-		case <-time.After(10 * time.Second):
+		case <-df.flushCh:
+			flush()
+		case <-time.After(df.checkpointFlushInterval):
 			flush()
 		}
 	}
 }
 
-func (df *Diff) consume(ctx context.Context, rangeInfo *splitter.RangeInfo) bool {
+// rowsComparable returns false if only the checksums or the counts of the chunks are compared,
+// i.e. `export-fix-sql` is false or `check-count-only` is set, then the rows are never fetched.
+func (df *Diff) rowsComparable() bool {
+	return df.exportFixSQL && !df.checkCountOnly
+}
+
+// triggerFlush saves the checkpoint soon, it doesn't block if a saving is already triggered.
+func (df *Diff) triggerFlush() {
+	select {
+	case df.flushCh <- struct{}{}:
+	default:
+	}
+}
+
+// consume compares the chunk and returns whether it's equal. If the chunk meets a transient error and
+// it isn't a retry, it's queued to retry at the end and queued is true, then nothing is sent to the checkpoint.
+func (df *Diff) consume(ctx context.Context, rangeInfo *splitter.RangeInfo, isRetry bool) (bool, bool) {
 	dml := &ChunkDML{
 		node: rangeInfo.ToNode(),
 	}
-	defer func() { df.sqlCh <- dml }()
+	queued := false
+	defer func() {
+		if !queued {
+			df.sqlCh <- dml
+		}
+	}()
 	if rangeInfo.ChunkRange.Type == chunk.Empty {
 		dml.node.State = checkpoints.IgnoreState
-		return true
+		return true, false
 	}
 	tableDiff := df.downstream.GetTables()[rangeInfo.GetTableIndex()]
 	schema, table := tableDiff.Schema, tableDiff.Table
+	startTime := time.Now()
+	defer func() {
+		df.report.AddTableDuration(schema, table, time.Since(startTime))
+	}()
+	// chunkErr is the error of the chunk, which decides the outcome of the retry.
+	var chunkErr error
+	if isRetry {
+		defer func() {
+			df.report.SetChunkRetried(schema, table, chunkErr == nil)
+		}()
+	}
+	if atomic.LoadInt32(&df.totalDiffExceeded) == 1 {
+		df.skipTableByThreshold(rangeInfo.GetTableIndex(), schema, table)
+	}
+	if _, ok := df.skippedTables.Load(rangeInfo.GetTableIndex()); ok {
+		// the table is skipped by the on-error policy or the thresholds
+		dml.node.State = checkpoints.FailedState
+		chunkErr = errors.New("the table is skipped")
+		return false, false
+	}
 	var state string = checkpoints.SuccessState
+	errorPolicy := getErrorPolicy(tableDiff)
 
-	isEqual, count, err := df.compareChecksumAndGetCount(ctx, rangeInfo)
+	var (
+		isEqual         bool
+		count           int64
+		downstreamCount int64
+		checksum        *rangeChecksum
+		err             error
+	)
+	// directCompare is true if the rows of the chunk are compared directly without checksum.
+	_, directCompare := df.rowCompareTables.Load(rangeInfo.GetTableIndex())
+	if directCompare {
+		isEqual = true
+	} else {
+		checksum, err = df.compareChecksumWithRetry(ctx, rangeInfo, errorPolicy)
+		// the rows can't be compared instead if only the checksums or the counts are compared,
+		// so the timeout is an error of the chunk.
+		if errors.Cause(err) == errChecksumTimeout && df.rowsComparable() {
+			df.onChecksumTimeout(rangeInfo.GetTableIndex(), schema, table, err)
+			err = nil
+			isEqual, directCompare = true, true
+		}
+	}
+	if err == nil && !directCompare {
+		isEqual, count, downstreamCount = checksum.isEqual(), checksum.upstream.Count, checksum.downstream.Count
+		if !isEqual && !isRetry && df.queueRecheck(ctx, rangeInfo) {
+			queued = true
+			return true, true
+		}
+		if _, rechecked := df.recheckCounts.Load(rangeInfo); rechecked {
+			df.report.SetChunkRechecked(schema, table, isEqual)
+		}
+		df.report.AddTableProcessedRows(schema, table, count)
+		if df.checkCountOnly {
+			df.report.AddTableDownstreamRows(schema, table, downstreamCount)
+		}
+		df.checkSlowQuery(ctx, rangeInfo, slowChecksumQuery, checksum.downstream.Cost)
+	}
+	if err == nil && !directCompare && count != downstreamCount {
+		// the checksum may be equal even if the row counts are different,
+		// so the count mismatch is reported as a distinct kind of failure.
+		log.Warn("the row count of the chunk is not equal",
+			zap.String("table", dbutil.TableName(schema, table)),
+			zap.Any("chunk id", rangeInfo.ChunkRange.Index),
+			zap.Int64("upstream count", count),
+			zap.Int64("downstream count", downstreamCount))
+		df.report.SetTableCountMismatch(schema, table, count, downstreamCount, rangeInfo.ChunkRange.Index)
+	}
+	if df.interruptedByFailFast(ctx, err) {
+		dml.node.State = checkpoints.FailedState
+		return true, false
+	}
+	if err != nil && !isRetry && df.queueRetry(ctx, rangeInfo, err) {
+		queued = true
+		return true, true
+	}
 	if err != nil {
 		// If an error occurs during the checksum phase, skip the data compare phase.
+		chunkErr = err
 		state = checkpoints.FailedState
 		df.report.SetTableMeetError(schema, table, err)
-	} else if !isEqual && df.exportFixSQL {
-		log.Debug("checksum failed", zap.Any("chunk id", rangeInfo.ChunkRange.Index), zap.Int64("chunk size", count), zap.String("table", df.workSource.GetTables()[rangeInfo.GetTableIndex()].Table))
-		state = checkpoints.FailedState
+		df.handleTableError(rangeInfo.GetTableIndex(), schema, table, errorPolicy, err)
+	} else if !df.rowsComparable() {
+		// only the checksums or the counts are compared, the different chunk is recorded in the report,
+		// but neither the binary search nor the row comparison is run.
+		if !isEqual {
+			state = checkpoints.FailedState
+		}
+	} else if directCompare || !isEqual {
+		if !directCompare {
+			log.Debug("checksum failed", zap.Any("chunk id", rangeInfo.ChunkRange.Index), zap.Int64("chunk size", count), zap.String("table", df.workSource.GetTables()[rangeInfo.GetTableIndex()].Table))
+			state = checkpoints.FailedState
+		}
 		// if the chunk's checksum differ, try to do binary check
 		info := rangeInfo
-		if count > splitter.SplitThreshold {
+		if !directCompare && count > splitter.SplitThreshold {
 			log.Debug("count greater than threshold, start do bingenerate", zap.Any("chunk id", rangeInfo.ChunkRange.Index), zap.Int64("chunk size", count))
-			info, err = df.BinGenerate(ctx, df.workSource, rangeInfo, count)
+			info, err = df.BinGenerate(ctx, df.workSource, rangeInfo, checksum)
 			if err != nil {
 				log.Error("fail to do binary search.", zap.Error(err))
 				df.report.SetTableMeetError(schema, table, err)
 				// reuse rangeInfo to compare data
 				info = rangeInfo
 			} else {
-				log.Debug("bin generate finished", zap.Reflect("chunk", info.ChunkRange), zap.Any("chunk id", info.ChunkRange.Index))
+				log.Debug("bin generate finished", utils.RedactData(schema, table, "chunk", info.ChunkRange), zap.Any("chunk id", info.ChunkRange.Index))
 			}
 		}
 		isDataEqual, err := df.compareRows(ctx, info, dml)
+		if df.interruptedByFailFast(ctx, err) {
+			if directCompare {
+				dml.node.State = checkpoints.FailedState
+				return true, false
+			}
+			// the checksum is different, so the chunk is still different even if its rows aren't compared.
+			dml.sqls, dml.events, dml.rowAdd, dml.rowDelete = nil, nil, 0, 0
+			isDataEqual, err = false, nil
+		}
+		if err != nil && !isRetry && df.queueRetry(ctx, rangeInfo, err) {
+			if !directCompare {
+				// the rows are counted again by the retry.
+				df.report.AddTableProcessedRows(schema, table, -count)
+			}
+			queued = true
+			return true, true
+		}
 		if err != nil {
+			chunkErr = err
 			df.report.SetTableMeetError(schema, table, err)
+			df.handleTableError(rangeInfo.GetTableIndex(), schema, table, errorPolicy, err)
+		} else if dml.exceedDiffLimit {
+			log.Warn("chunk exceeds diff limit, stop comparing the rows of the chunk",
+				zap.String("table", dbutil.TableName(schema, table)),
+				zap.Any("chunk id", rangeInfo.ChunkRange.Index),
+				zap.Int("max diff rows", df.maxDiffRowsPerChunk))
+			df.report.SetChunkExceedDiffLimit(schema, table, rangeInfo.ChunkRange.Index)
+			if df.exportRangeReloadSQL {
+				dml.sqls = generateRangeReloadSQLs(tableDiff, info)
+			}
+		}
+		if err == nil && len(dml.rowHashes) > 0 {
+			df.report.SetChunkRowHashes(schema, table, rangeInfo.ChunkRange.Index, dml.rowHashes)
+		}
+		if err == nil && !directCompare && isDataEqual && tableDiff.Tolerance != nil && count == downstreamCount {
+			// the checksums are different because of the numeric values within the tolerance of the table.
+			log.Info("the rows of the chunk are equal within the tolerance",
+				zap.String("table", dbutil.TableName(schema, table)),
+				zap.Any("chunk id", rangeInfo.ChunkRange.Index))
+			isEqual, state = true, checkpoints.SuccessState
 		}
 		isEqual = isEqual && isDataEqual
+		if directCompare && (err != nil || !isEqual) {
+			state = checkpoints.FailedState
+		}
 	}
 	dml.node.State = state
 	id := rangeInfo.ChunkRange.Index
 	df.report.SetTableDataCheckResult(schema, table, isEqual, dml.rowAdd, dml.rowDelete, id)
-	return isEqual
+	if !isEqual {
+		df.report.SetChunkRange(schema, table, rangeInfo.ChunkRange, rangeInfo.IndexID)
+		df.checkTableThreshold(rangeInfo.GetTableIndex(), schema, table, dml.rowAdd+dml.rowDelete)
+		if chunkErr == nil {
+			df.stopByFailFast(schema, table, id)
+		}
+	}
+	return isEqual, false
 }
 
-func (df *Diff) BinGenerate(ctx context.Context, targetSource source.Source, tableRange *splitter.RangeInfo, count int64) (*splitter.RangeInfo, error) {
-	if count <= splitter.SplitThreshold {
+// stopByFailFast stops the data comparison after the chunk is found different if `fail-fast` is set,
+// the chunks in progress are cancelled, and the summary of the chunks compared so far is committed.
+func (df *Diff) stopByFailFast(schema, table string, id *chunk.ChunkID) {
+	if !df.failFast || !atomic.CompareAndSwapInt32(&df.failFastStopped, 0, 1) {
+		return
+	}
+	log.Warn("stop the comparison at the first different chunk because of fail-fast",
+		zap.String("table", dbutil.TableName(schema, table)),
+		zap.Any("chunk id", id))
+	df.report.SetFailFastStopped()
+	if df.cancel != nil {
+		df.cancel()
+	}
+}
+
+// interruptedByFailFast returns true if the chunk failed because it was cancelled by `fail-fast`,
+// then it's neither reported as an error nor retried.
+func (df *Diff) interruptedByFailFast(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() != nil && atomic.LoadInt32(&df.failFastStopped) == 1
+}
+
+// tableDiffCount counts the diffs of a table found so far.
+type tableDiffCount struct {
+	diffRows     int64
+	failedChunks int64
+}
+
+// checkTableThreshold adds the diffs of a failed chunk to its table and all the tables,
+// and skips the rest chunks of the table once the diffs exceed the threshold, or the rest chunks
+// of all the tables once the different rows of all the tables exceed `max-diff-rows-total`.
+func (df *Diff) checkTableThreshold(tableIndex int, schema, table string, diffRows int) {
+	if df.maxDiffRowsTotal > 0 {
+		totalDiffRows := atomic.AddInt64(&df.totalDiffRows, int64(diffRows))
+		if totalDiffRows > df.maxDiffRowsTotal {
+			if atomic.CompareAndSwapInt32(&df.totalDiffExceeded, 0, 1) {
+				log.Warn("skip the rest chunks of all the tables because the different rows exceed max-diff-rows-total",
+					zap.Int64("diff rows", totalDiffRows),
+					zap.Int64("max diff rows total", df.maxDiffRowsTotal))
+			}
+			df.skipTableByThreshold(tableIndex, schema, table)
+			return
+		}
+	}
+	if df.maxDiffRowsPerTable <= 0 && df.maxFailedChunksPerTable <= 0 {
+		return
+	}
+	v, _ := df.tableDiffCounts.LoadOrStore(tableIndex, &tableDiffCount{})
+	count := v.(*tableDiffCount)
+	totalDiffRows := atomic.AddInt64(&count.diffRows, int64(diffRows))
+	failedChunks := atomic.AddInt64(&count.failedChunks, 1)
+	if (df.maxDiffRowsPerTable > 0 && totalDiffRows > df.maxDiffRowsPerTable) ||
+		(df.maxFailedChunksPerTable > 0 && failedChunks > df.maxFailedChunksPerTable) {
+		if df.skipTableByThreshold(tableIndex, schema, table) {
+			log.Warn("skip the rest chunks of the table because the diffs exceed the threshold",
+				zap.String("table", dbutil.TableName(schema, table)),
+				zap.Int64("diff rows", totalDiffRows),
+				zap.Int64("failed chunks", failedChunks))
+		}
+	}
+}
+
+// skipTableByThreshold skips the rest chunks of the table and marks it in the report because of the thresholds,
+// it returns false if the table is already skipped.
+func (df *Diff) skipTableByThreshold(tableIndex int, schema, table string) bool {
+	if _, loaded := df.skippedTables.LoadOrStore(tableIndex, struct{}{}); loaded {
+		return false
+	}
+	df.report.SetTableExceedThreshold(schema, table)
+	return true
+}
+
+// onChecksumTimeout counts the checksum timeouts of the table, and compares the rows of its rest chunks
+// directly once the timeouts reach `max-checksum-timeouts`.
+func (df *Diff) onChecksumTimeout(tableIndex int, schema, table string, err error) {
+	v, _ := df.checksumTimeouts.LoadOrStore(tableIndex, new(int64))
+	timeouts := atomic.AddInt64(v.(*int64), 1)
+	log.Warn("checksum timed out, compare the rows of the chunk directly",
+		zap.String("table", dbutil.TableName(schema, table)),
+		zap.Int64("timeouts", timeouts),
+		zap.Error(err))
+	if timeouts < df.maxChecksumTimeouts {
+		return
+	}
+	if _, loaded := df.rowCompareTables.LoadOrStore(tableIndex, struct{}{}); !loaded {
+		log.Warn("checksum of the table timed out too many times, compare the rows of the rest chunks directly",
+			zap.String("table", dbutil.TableName(schema, table)),
+			zap.Int64("timeouts", timeouts))
+		df.report.AddTableNote(schema, table, fmt.Sprintf("checksum timed out %d times, the rest chunks are compared row by row", timeouts))
+	}
+}
+
+// getErrorPolicy returns the on-error policy of the table, `skip-table` by default.
+func getErrorPolicy(tableDiff *common.TableDiff) *config.ErrorPolicy {
+	if tableDiff.ErrorPolicy == nil {
+		return &config.ErrorPolicy{Action: config.OnErrorSkipTable}
+	}
+	return tableDiff.ErrorPolicy
+}
+
+// handleTableError takes the action of the on-error policy after the table meets error.
+func (df *Diff) handleTableError(tableIndex int, schema, table string, policy *config.ErrorPolicy, err error) {
+	switch policy.Action {
+	case config.OnErrorFailRun:
+		df.abortOnce.Do(func() {
+			log.Error("stop the comparison because of the error", zap.String("table", dbutil.TableName(schema, table)), zap.Error(err))
+			df.report.SetTableErrorAction(schema, table, config.OnErrorFailRun)
+			df.abortErr = errors.Annotatef(err, "failed to check table %s", dbutil.TableName(schema, table))
+			if df.cancel != nil {
+				df.cancel()
+			}
+		})
+	default:
+		if _, loaded := df.skippedTables.LoadOrStore(tableIndex, struct{}{}); !loaded {
+			log.Warn("skip the rest chunks of the table because of the error", zap.String("table", dbutil.TableName(schema, table)), zap.Error(err))
+			df.report.SetTableErrorAction(schema, table, config.OnErrorSkipTable)
+		}
+	}
+}
+
+// BinGenerate narrows the mismatched chunk down by binary search, checksum is the checksum of tableRange.
+func (df *Diff) BinGenerate(ctx context.Context, targetSource source.Source, tableRange *splitter.RangeInfo, checksum *rangeChecksum) (*splitter.RangeInfo, error) {
+	if checksum.upstream.Count <= splitter.SplitThreshold {
 		return tableRange, nil
 	}
 	tableDiff := targetSource.GetTables()[tableRange.GetTableIndex()]
+	if tableDiff.Query != "" || targetSource.GetDB() == nil {
+		// the split points can't be estimated for the result set of a query or the mock source.
+		return tableRange, nil
+	}
 	indices := dbutil.FindAllIndex(tableDiff.Info)
 	// if no index, do not split
 	if len(indices) == 0 {
@@ -481,88 +1498,209 @@ func (df *Diff) BinGenerate(ctx context.Context, targetSource source.Source, tab
 		return tableRange, nil
 	}
 	// TODO use selectivity from utils.GetBetterIndex
-	// only support PK/UK
-	if !(index.Primary || index.Unique) {
-		log.Warn("BinGenerate only support PK/UK")
-		return tableRange, nil
-	}
-
 	log.Debug("index for BinGenerate", zap.String("index", index.Name.O))
 	indexColumns := utils.GetColumnsFromIndex(index, tableDiff.Info)
 	if len(indexColumns) == 0 {
 		log.Warn("fail to get columns of the selected index, directly return the origin chunk")
 		return tableRange, nil
 	}
+	if !(index.Primary || index.Unique) {
+		// The split points of a non-unique index may be duplicate, so append the
+		// columns of the unique order key as tiebreaker. If there is no PK/UK,
+		// all the columns are used, and the duplicate rows are always in the same
+		// sub range because the lower bound is exclusive and the upper bound is inclusive.
+		indexColumns = appendTiebreakerColumns(indexColumns, tableDiff.Info)
+	}
 
-	return df.binSearch(ctx, targetSource, tableRange, count, tableDiff, indexColumns)
+	return df.binSearch(ctx, targetSource, tableRange, checksum, tableDiff, indexColumns)
 }
 
-func (df *Diff) binSearch(ctx context.Context, targetSource source.Source, tableRange *splitter.RangeInfo, count int64, tableDiff *common.TableDiff, indexColumns []*model.ColumnInfo) (*splitter.RangeInfo, error) {
+// binSearch splits tableRange into sub ranges and searches the mismatched one recursively.
+// The checksums are XOR of the rows, so the checksum of the last sub range is computed
+// from tableRange and the other sub ranges instead of querying again.
+func (df *Diff) binSearch(ctx context.Context, targetSource source.Source, tableRange *splitter.RangeInfo, checksum *rangeChecksum, tableDiff *common.TableDiff, indexColumns []*model.ColumnInfo) (*splitter.RangeInfo, error) {
+	count := checksum.upstream.Count
 	if count <= splitter.SplitThreshold {
 		return tableRange, nil
 	}
-	var (
-		isEqual1, isEqual2 bool
-		count1, count2     int64
-	)
-	tableRange1 := tableRange.Copy()
-	tableRange2 := tableRange.Copy()
 
 	chunkLimits, args := tableRange.ChunkRange.ToString(tableDiff.Collation)
-	limitRange := fmt.Sprintf("(%s) AND (%s)", chunkLimits, tableDiff.Range)
-	midValues, err := utils.GetApproximateMidBySize(ctx, targetSource.GetDB(), tableDiff.Schema, tableDiff.Table, indexColumns, limitRange, args, count)
-	log.Debug("mid values", zap.Reflect("mid values", midValues), zap.Reflect("indices", indexColumns), zap.Reflect("bounds", tableRange.ChunkRange.Bounds))
+	limitRange := fmt.Sprintf("(%s) AND (%s)", chunkLimits, tableDiff.GetRange(tableRange.ChunkRange.Partition))
+	splitValues, err := utils.GetApproximateSplitPointsBySize(ctx, targetSource.GetDB(), tableDiff.Schema, tableDiff.Table, indexColumns, limitRange, args, count, df.binSearchFanOut)
+	log.Debug("split values",
+		utils.RedactData(tableDiff.Schema, tableDiff.Table, "split values", splitValues),
+		zap.Reflect("indices", indexColumns),
+		utils.RedactData(tableDiff.Schema, tableDiff.Table, "bounds", tableRange.ChunkRange.Bounds))
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	log.Debug("table ranges", zap.Reflect("original range", tableRange))
-	for i := range indexColumns {
-		log.Debug("update tableRange", zap.String("field", indexColumns[i].Name.O), zap.String("value", midValues[indexColumns[i].Name.O]))
-		tableRange1.Update(indexColumns[i].Name.O, "", midValues[indexColumns[i].Name.O], false, true, tableDiff.Collation, tableDiff.Range)
-		tableRange2.Update(indexColumns[i].Name.O, midValues[indexColumns[i].Name.O], "", true, false, tableDiff.Collation, tableDiff.Range)
+	if len(splitValues) == 0 {
+		return tableRange, nil
 	}
-	log.Debug("table ranges", zap.Reflect("tableRange 1", tableRange1), zap.Reflect("tableRange 2", tableRange2))
-	isEqual1, count1, err = df.compareChecksumAndGetCount(ctx, tableRange1)
-	if err != nil {
-		return nil, errors.Trace(err)
+	log.Debug("table ranges", utils.RedactData(tableDiff.Schema, tableDiff.Table, "original range", tableRange))
+
+	// the i-th range is (splitValues[i-1], splitValues[i]]
+	subRanges := make([]*splitter.RangeInfo, 0, len(splitValues)+1)
+	for i := 0; i <= len(splitValues); i++ {
+		subRanges = append(subRanges, newSubRange(tableRange, tableDiff, indexColumns, splitValues, i, i))
 	}
-	isEqual2, count2, err = df.compareChecksumAndGetCount(ctx, tableRange2)
-	if err != nil {
-		return nil, errors.Trace(err)
+	log.Debug("table ranges", utils.RedactData(tableDiff.Schema, tableDiff.Table, "sub ranges", subRanges))
+
+	var (
+		checksums = make([]*rangeChecksum, len(subRanges))
+		counts    = make([]int64, len(subRanges))
+		// the first and the last index of the unequal sub ranges
+		first, last = -1, -1
+	)
+	for i := range subRanges[:len(subRanges)-1] {
+		checksums[i], err = df.getRangeChecksum(ctx, subRanges[i])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
 	}
-	if count1+count2 != count {
+	lastChecksum := checksum.subtract(checksums[:len(subRanges)-1]...)
+	if lastChecksum.upstream.Count < 0 || lastChecksum.downstream.Count < 0 {
 		log.Fatal("the count is not correct",
-			zap.Int64("count1", count1),
-			zap.Int64("count2", count2),
+			zap.Int64("upstream count of the last sub range", lastChecksum.upstream.Count),
+			zap.Int64("downstream count of the last sub range", lastChecksum.downstream.Count),
 			zap.Int64("count", count))
 	}
+	checksums[len(subRanges)-1] = lastChecksum
+	for i, c := range checksums {
+		counts[i] = c.upstream.Count
+		if !c.isEqual() {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
 	log.Info("chunk split successfully",
 		zap.Any("chunk id", tableRange.ChunkRange.Index),
-		zap.Int64("count1", count1),
-		zap.Int64("count2", count2))
+		zap.Int64s("counts", counts))
 
-	if !isEqual1 && !isEqual2 {
+	switch {
+	case first == -1:
+		// TODO: handle the error to foreground
+		log.Fatal("the sub ranges cannot be all equal")
+		return nil, nil
+	case first == 0 && last == len(subRanges)-1:
+		// the differences spread over the whole chunk
 		return tableRange, nil
-	} else if !isEqual1 {
-		c, err := df.binSearch(ctx, targetSource, tableRange1, count1, tableDiff, indexColumns)
+	case first == last:
+		c, err := df.binSearch(ctx, targetSource, subRanges[first], checksums[first], tableDiff, indexColumns)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
 		return c, nil
-	} else if !isEqual2 {
-		c, err := df.binSearch(ctx, targetSource, tableRange2, count2, tableDiff, indexColumns)
+	default:
+		// narrow the chunk to the sub ranges from `first` to `last`
+		spanChecksum := checksum.subtract(checksums[:first]...).subtract(checksums[last+1:]...)
+		c, err := df.binSearch(ctx, targetSource, newSubRange(tableRange, tableDiff, indexColumns, splitValues, first, last), spanChecksum, tableDiff, indexColumns)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
 		return c, nil
-	} else {
-		// TODO: handle the error to foreground
-		log.Fatal("the isEqual1 and isEqual2 cannot be both true")
-		return nil, nil
 	}
 }
 
-func (df *Diff) compareChecksumAndGetCount(ctx context.Context, tableRange *splitter.RangeInfo) (bool, int64, error) {
+// appendTiebreakerColumns appends the columns of the unique order key which are not in indexColumns.
+func appendTiebreakerColumns(indexColumns []*model.ColumnInfo, tableInfo *model.TableInfo) []*model.ColumnInfo {
+	_, orderKeyCols := dbutil.SelectUniqueOrderKey(tableInfo)
+	columns := make([]*model.ColumnInfo, 0, len(indexColumns)+len(orderKeyCols))
+	columns = append(columns, indexColumns...)
+	for _, col := range orderKeyCols {
+		if dbutil.FindColumnByName(indexColumns, col.Name.O) == nil {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+// newSubRange returns the range from the `first` to the `last` sub ranges of tableRange split by splitValues,
+// the i-th sub range is (splitValues[i-1], splitValues[i]].
+func newSubRange(tableRange *splitter.RangeInfo, tableDiff *common.TableDiff, indexColumns []*model.ColumnInfo, splitValues []map[string]string, first, last int) *splitter.RangeInfo {
+	subRange := tableRange.Copy()
+	for _, column := range indexColumns {
+		var lower, upper string
+		hasLower, hasUpper := first > 0, last < len(splitValues)
+		if hasLower {
+			lower = splitValues[first-1][column.Name.O]
+		}
+		if hasUpper {
+			upper = splitValues[last][column.Name.O]
+		}
+		subRange.Update(column.Name.O, lower, upper, hasLower, hasUpper, tableDiff.Collation, tableDiff.GetRange(tableRange.ChunkRange.Partition))
+	}
+	return subRange
+}
+
+// rangeChecksum is the checksums and counts of a range in upstream and downstream.
+type rangeChecksum struct {
+	upstream   *source.ChecksumInfo
+	downstream *source.ChecksumInfo
+}
+
+func (c *rangeChecksum) isEqual() bool {
+	// two counts are not necessary equal, the caller reports the count mismatch
+	return c.upstream.Algorithm == c.downstream.Algorithm &&
+		c.upstream.Count == c.downstream.Count && c.upstream.Checksum == c.downstream.Checksum
+}
+
+// subtract returns the checksum of the range excluding the given sub ranges.
+func (c *rangeChecksum) subtract(subRanges ...*rangeChecksum) *rangeChecksum {
+	result := &rangeChecksum{
+		upstream:   &source.ChecksumInfo{Algorithm: c.upstream.Algorithm, Count: c.upstream.Count, Checksum: c.upstream.Checksum},
+		downstream: &source.ChecksumInfo{Algorithm: c.downstream.Algorithm, Count: c.downstream.Count, Checksum: c.downstream.Checksum},
+	}
+	for _, sub := range subRanges {
+		result.upstream.Count -= sub.upstream.Count
+		result.upstream.Checksum ^= sub.upstream.Checksum
+		result.downstream.Count -= sub.downstream.Count
+		result.downstream.Checksum ^= sub.downstream.Checksum
+	}
+	return result
+}
+
+// errChecksumTimeout means the checksum of a chunk costs more than `checksum-timeout`.
+var errChecksumTimeout = errors.New("checksum timed out")
+
+// compareChecksumWithRetry retries getRangeChecksum according to the on-error policy.
+func (df *Diff) compareChecksumWithRetry(ctx context.Context, tableRange *splitter.RangeInfo, policy *config.ErrorPolicy) (*rangeChecksum, error) {
+	for i := 0; ; i++ {
+		checksumCtx, cancel := ctx, context.CancelFunc(func() {})
+		if df.checksumTimeout > 0 {
+			checksumCtx, cancel = context.WithTimeout(ctx, df.checksumTimeout)
+		}
+		checksum, err := df.getRangeChecksum(checksumCtx, tableRange)
+		timeout := err != nil && ctx.Err() == nil && checksumCtx.Err() == context.DeadlineExceeded
+		cancel()
+		if timeout {
+			// retrying a slow checksum doesn't help, the caller falls back to compare the rows.
+			return nil, errors.Annotatef(errChecksumTimeout, "chunk %s, %v", tableRange.ChunkRange.Index.ToString(), err)
+		}
+		if err == nil || i >= policy.RetryCount || ctx.Err() != nil {
+			return checksum, err
+		}
+		log.Warn("fail to compare checksum, retry",
+			zap.Any("chunk id", tableRange.ChunkRange.Index),
+			zap.Int("retry", i+1),
+			zap.Error(err))
+	}
+}
+
+// compareChecksumAndGetCount returns whether the chunk is equal between upstream and downstream,
+// along with the upstream and downstream row counts of the chunk.
+func (df *Diff) compareChecksumAndGetCount(ctx context.Context, tableRange *splitter.RangeInfo) (bool, int64, int64, error) {
+	checksum, err := df.getRangeChecksum(ctx, tableRange)
+	if err != nil {
+		return false, -1, -1, errors.Trace(err)
+	}
+	return checksum.isEqual(), checksum.upstream.Count, checksum.downstream.Count, nil
+}
+
+// getRangeChecksum gets the checksums and counts of the range in upstream and downstream concurrently.
+func (df *Diff) getRangeChecksum(ctx context.Context, tableRange *splitter.RangeInfo) (*rangeChecksum, error) {
 	var wg sync.WaitGroup
 	var upstreamInfo, downstreamInfo *source.ChecksumInfo
 	wg.Add(1)
@@ -575,38 +1713,125 @@ func (df *Diff) compareChecksumAndGetCount(ctx context.Context, tableRange *spli
 
 	if upstreamInfo.Err != nil {
 		log.Warn("failed to compare upstream checksum")
-		return false, -1, errors.Trace(upstreamInfo.Err)
+		return nil, errors.Trace(upstreamInfo.Err)
 	}
 	if downstreamInfo.Err != nil {
 		log.Warn("failed to compare downstream checksum")
-		return false, -1, errors.Trace(downstreamInfo.Err)
+		return nil, errors.Trace(downstreamInfo.Err)
+	}
+	return &rangeChecksum{
+		upstream:   upstreamInfo,
+		downstream: downstreamInfo,
+	}, nil
+}
 
+// initTimeZone decides how the timestamp values are converted by the session time zones of the instances.
+func (df *Diff) initTimeZone(cfg *config.Config) {
+	df.fixTimeZone = utils.UnifiedTimeZone
+	if len(cfg.Task.TargetInstance.SessionTimeZone) > 0 {
+		df.fixTimeZone = cfg.Task.TargetInstance.SessionTimeZone
 	}
-	// TODO two counts are not necessary equal
-	if upstreamInfo.Count == downstreamInfo.Count && upstreamInfo.Checksum == downstreamInfo.Checksum {
-		return true, upstreamInfo.Count, nil
+	df.downstreamLocation = cfg.Task.TargetInstance.Location
+	for i, ds := range cfg.Task.SourceInstances {
+		if ds.Location == nil || (i > 0 && !utils.SameLocation(ds.Location, df.upstreamLocation)) {
+			// the rows of the sources are merged, so they can't be converted from different time zones.
+			log.Warn("the time zones of the sources are unknown or different, the timestamp values are not converted")
+			df.upstreamLocation = nil
+			return
+		}
+		df.upstreamLocation = ds.Location
+	}
+	if df.needConvertTimeZone() {
+		log.Warn("the session time zones of the upstream and the downstream are different, the timestamp values of the upstream are converted",
+			zap.String("upstream", df.upstreamLocation.String()), zap.String("downstream", df.downstreamLocation.String()))
+	}
+}
+
+// needConvertTimeZone returns true if the timestamp values of the upstream should be converted into the downstream location.
+func (df *Diff) needConvertTimeZone() bool {
+	return df.upstreamLocation != nil && df.downstreamLocation != nil && !utils.SameLocation(df.upstreamLocation, df.downstreamLocation)
+}
+
+// timeZoneRowsIterator converts the timestamp values of the upstream rows into the downstream location,
+// so that they are compared with the downstream rows and written into the fix sql as the downstream values.
+type timeZoneRowsIterator struct {
+	source.RowDataIterator
+	tableInfo *model.TableInfo
+	from, to  *time.Location
+}
+
+func (it *timeZoneRowsIterator) Next() (map[string]*dbutil.ColumnData, error) {
+	row, err := it.RowDataIterator.Next()
+	if err != nil || row == nil {
+		return row, err
 	}
-	return false, upstreamInfo.Count, nil
+	row, err = utils.ConvertRowTimeZone(row, it.tableInfo, it.from, it.to)
+	return row, errors.Trace(err)
 }
 
 func (df *Diff) compareRows(ctx context.Context, rangeInfo *splitter.RangeInfo, dml *ChunkDML) (bool, error) {
+	if df.workSource.GetTables()[rangeInfo.GetTableIndex()].FullRowHash {
+		return df.compareRowHashes(ctx, rangeInfo, dml)
+	}
 	rowsAdd, rowsDelete := 0, 0
 	upstreamRowsIterator, err := df.upstream.GetRowsIterator(ctx, rangeInfo)
 	if err != nil {
 		return false, errors.Trace(err)
 	}
 	defer upstreamRowsIterator.Close()
+	beginTime := time.Now()
 	downstreamRowsIterator, err := df.downstream.GetRowsIterator(ctx, rangeInfo)
 	if err != nil {
 		return false, errors.Trace(err)
 	}
 	defer downstreamRowsIterator.Close()
+	df.checkSlowQuery(ctx, rangeInfo, slowRowsQuery, time.Since(beginTime))
 
 	var lastUpstreamData, lastDownstreamData map[string]*dbutil.ColumnData
 	equal := true
 
-	tableInfo := df.workSource.GetTables()[rangeInfo.GetTableIndex()].Info
+	tableDiff := df.workSource.GetTables()[rangeInfo.GetTableIndex()]
+	tableInfo := tableDiff.Info
 	_, orderKeyCols := dbutil.SelectUniqueOrderKey(tableInfo)
+	convertTimeZone := tableDiff.NeedUnifiedTimeZone && df.needConvertTimeZone()
+	if convertTimeZone {
+		upstreamRowsIterator = &timeZoneRowsIterator{upstreamRowsIterator, tableInfo, df.upstreamLocation, df.downstreamLocation}
+	}
+	// generateFixSQL fetches the full values of the large columns before generating the fix sql,
+	// because only their hashes are read when comparing the rows.
+	generateFixSQL := func(t source.DMLType, upstreamData, downstreamData map[string]*dbutil.ColumnData) (string, error) {
+		if len(tableDiff.LargeColumns) > 0 {
+			var err error
+			if upstreamData != nil {
+				if convertTimeZone {
+					// the row is fetched by the upstream values of the order keys.
+					if upstreamData, err = utils.ConvertRowTimeZone(upstreamData, tableInfo, df.downstreamLocation, df.upstreamLocation); err != nil {
+						return "", errors.Trace(err)
+					}
+				}
+				if upstreamData, err = df.fetchFullRow(ctx, df.upstream, rangeInfo, orderKeyCols, upstreamData); err != nil {
+					return "", errors.Trace(err)
+				}
+				if convertTimeZone {
+					if upstreamData, err = utils.ConvertRowTimeZone(upstreamData, tableInfo, df.upstreamLocation, df.downstreamLocation); err != nil {
+						return "", errors.Trace(err)
+					}
+				}
+			}
+			if downstreamData != nil {
+				if downstreamData, err = df.fetchFullRow(ctx, df.downstream, rangeInfo, orderKeyCols, downstreamData); err != nil {
+					return "", errors.Trace(err)
+				}
+			}
+		}
+		if df.diffEvents != nil {
+			if err := df.encodeDiffEvent(tableDiff, dml, t, upstreamData, downstreamData); err != nil {
+				return "", errors.Trace(err)
+			}
+		}
+		return df.downstream.GenerateFixSQL(t, upstreamData, downstreamData, rangeInfo.GetTableIndex()), nil
+	}
+rowLoop:
 	for {
 		if lastUpstreamData == nil {
 			lastUpstreamData, err = upstreamRowsIterator.Next()
@@ -625,12 +1850,18 @@ func (df *Diff) compareRows(ctx context.Context, rangeInfo *splitter.RangeInfo,
 		if lastUpstreamData == nil {
 			// don't have source data, so all the targetRows's data is redundant, should be deleted
 			for lastDownstreamData != nil {
-				sql := df.downstream.GenerateFixSQL(source.Delete, lastUpstreamData, lastDownstreamData, rangeInfo.GetTableIndex())
+				sql, err := generateFixSQL(source.Delete, lastUpstreamData, lastDownstreamData)
+				if err != nil {
+					return false, errors.Trace(err)
+				}
 				rowsDelete++
-				log.Debug("[delete]", zap.String("sql", sql))
+				log.Debug("[delete]", utils.RedactData(tableDiff.Schema, tableDiff.Table, "sql", sql))
 
 				dml.sqls = append(dml.sqls, sql)
 				equal = false
+				if df.exceedDiffLimit(dml) {
+					break rowLoop
+				}
 				lastDownstreamData, err = downstreamRowsIterator.Next()
 				if err != nil {
 					return false, err
@@ -642,12 +1873,18 @@ func (df *Diff) compareRows(ctx context.Context, rangeInfo *splitter.RangeInfo,
 		if lastDownstreamData == nil {
 			// target lack some data, should insert the last source datas
 			for lastUpstreamData != nil {
-				sql := df.downstream.GenerateFixSQL(source.Insert, lastUpstreamData, lastDownstreamData, rangeInfo.GetTableIndex())
+				sql, err := generateFixSQL(source.Insert, lastUpstreamData, lastDownstreamData)
+				if err != nil {
+					return false, errors.Trace(err)
+				}
 				rowsAdd++
-				log.Debug("[insert]", zap.String("sql", sql))
+				log.Debug("[insert]", utils.RedactData(tableDiff.Schema, tableDiff.Table, "sql", sql))
 
 				dml.sqls = append(dml.sqls, sql)
 				equal = false
+				if df.exceedDiffLimit(dml) {
+					break rowLoop
+				}
 
 				lastUpstreamData, err = upstreamRowsIterator.Next()
 				if err != nil {
@@ -657,7 +1894,7 @@ func (df *Diff) compareRows(ctx context.Context, rangeInfo *splitter.RangeInfo,
 			break
 		}
 
-		eq, cmp, err := utils.CompareData(lastUpstreamData, lastDownstreamData, orderKeyCols, tableInfo.Columns)
+		eq, cmp, err := utils.CompareData(lastUpstreamData, lastDownstreamData, orderKeyCols, tableInfo.Columns, tableDiff.Tolerance)
 		if err != nil {
 			return false, errors.Trace(err)
 		}
@@ -673,33 +1910,180 @@ func (df *Diff) compareRows(ctx context.Context, rangeInfo *splitter.RangeInfo,
 		switch cmp {
 		case 1:
 			// delete
-			sql = df.downstream.GenerateFixSQL(source.Delete, lastUpstreamData, lastDownstreamData, rangeInfo.GetTableIndex())
+			sql, err = generateFixSQL(source.Delete, nil, lastDownstreamData)
 			rowsDelete++
-			log.Debug("[delete]", zap.String("sql", sql))
+			log.Debug("[delete]", utils.RedactData(tableDiff.Schema, tableDiff.Table, "sql", sql))
 			lastDownstreamData = nil
 		case -1:
 			// insert
-			sql = df.downstream.GenerateFixSQL(source.Insert, lastUpstreamData, lastDownstreamData, rangeInfo.GetTableIndex())
+			sql, err = generateFixSQL(source.Insert, lastUpstreamData, nil)
 			rowsAdd++
-			log.Debug("[insert]", zap.String("sql", sql))
+			log.Debug("[insert]", utils.RedactData(tableDiff.Schema, tableDiff.Table, "sql", sql))
 			lastUpstreamData = nil
 		case 0:
 			// update
-			sql = df.downstream.GenerateFixSQL(source.Replace, lastUpstreamData, lastDownstreamData, rangeInfo.GetTableIndex())
+			sql, err = generateFixSQL(source.Replace, lastUpstreamData, lastDownstreamData)
 			rowsAdd++
 			rowsDelete++
-			log.Debug("[update]", zap.String("sql", sql))
+			log.Debug("[update]", utils.RedactData(tableDiff.Schema, tableDiff.Table, "sql", sql))
 			lastUpstreamData = nil
 			lastDownstreamData = nil
 		}
+		if err != nil {
+			return false, errors.Trace(err)
+		}
 
 		dml.sqls = append(dml.sqls, sql)
+		if df.exceedDiffLimit(dml) {
+			break
+		}
 	}
 	dml.rowAdd = rowsAdd
 	dml.rowDelete = rowsDelete
+	if df.exceedDiffLimit(dml) {
+		// the fix sqls of the chunk are incomplete, so drop them instead of fixing the chunk partially.
+		dml.exceedDiffLimit = true
+		dml.sqls = nil
+		dml.events = nil
+	}
 	return equal, nil
 }
 
+// encodeDiffEvent encodes the different row as a row change event of the chunk.
+func (df *Diff) encodeDiffEvent(tableDiff *common.TableDiff, dml *ChunkDML, t source.DMLType, upstreamData, downstreamData map[string]*dbutil.ColumnData) error {
+	var eventType events.EventType
+	switch t {
+	case source.Insert:
+		eventType = events.Insert
+	case source.Delete:
+		eventType = events.Delete
+	default:
+		eventType = events.Update
+	}
+	msg, err := df.diffEvents.Encode(tableDiff.Schema, tableDiff.Table, tableDiff.Info, eventType, downstreamData, upstreamData)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	dml.events = append(dml.events, msg)
+	return nil
+}
+
+// fetchFullRow reads the row again by its unique order key with the full values of the large columns.
+func (df *Diff) fetchFullRow(ctx context.Context, s source.Source, rangeInfo *splitter.RangeInfo, orderKeyCols []*model.ColumnInfo, row map[string]*dbutil.ColumnData) (map[string]*dbutil.ColumnData, error) {
+	conditions := make([]string, 0, len(orderKeyCols))
+	args := make([]interface{}, 0, len(orderKeyCols))
+	for _, col := range orderKeyCols {
+		data := row[col.Name.O]
+		if data.IsNull {
+			conditions = append(conditions, fmt.Sprintf("%s IS NULL", dbutil.ColumnName(col.Name.O)))
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = ?", dbutil.ColumnName(col.Name.O)))
+		args = append(args, string(data.Data))
+	}
+	rowRange := rangeInfo.Copy()
+	rowRange.ChunkRange.Where = strings.Join(conditions, " AND ")
+	rowRange.ChunkRange.Args = args
+	rowRange.FullColumns = true
+
+	iter, err := s.GetRowsIterator(ctx, rowRange)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer iter.Close()
+	fullRow, err := iter.Next()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if fullRow == nil {
+		return nil, errors.Errorf("the row of %s %v is not found when fetching its full values, it may be changed during the comparison", rowRange.ChunkRange.Where, args)
+	}
+	return fullRow, nil
+}
+
+const (
+	slowChecksumQuery = "checksum"
+	slowRowsQuery     = "rows"
+)
+
+// checkSlowQuery explains the chunk query of downstream if it costs more than `slow-query-threshold`,
+// and records the plan with an index suggestion in the report. Only the first slow query of a table is explained.
+func (df *Diff) checkSlowQuery(ctx context.Context, rangeInfo *splitter.RangeInfo, kind string, cost time.Duration) {
+	if df.slowQueryThreshold <= 0 || cost < df.slowQueryThreshold {
+		return
+	}
+	if df.downstream.GetDB() == nil {
+		return
+	}
+	tableIndex := rangeInfo.GetTableIndex()
+	if _, loaded := df.explainedTables.LoadOrStore(tableIndex, struct{}{}); loaded {
+		return
+	}
+	tableDiff := df.downstream.GetTables()[tableIndex]
+	chunkRange := rangeInfo.GetChunk()
+	var query string
+	switch kind {
+	case slowChecksumQuery:
+		tableName := dbutil.TableName(tableDiff.Schema, tableDiff.Table)
+		if tableDiff.Query != "" {
+			tableName = utils.QueryTableName(tableDiff.Query, tableDiff.Table)
+		}
+		query = utils.CountAndChecksumQuery(tableName, tableDiff.Info, tableDiff.ChecksumAlgorithm, chunkRange.Where)
+	default:
+		var rowsQuery string
+		if tableDiff.Query != "" {
+			rowsQuery, _ = utils.GetQueryRowsQueryFormat(tableDiff.Query, tableDiff.Table, tableDiff.Info, tableDiff.Collation, tableDiff.LargeColumns)
+		} else {
+			rowsQuery, _ = utils.GetTableRowsQueryFormat(tableDiff.Schema, tableDiff.Table, tableDiff.Info, tableDiff.Collation, tableDiff.LargeColumns)
+		}
+		query = fmt.Sprintf(rowsQuery, chunkRange.Where)
+	}
+	plan, err := utils.ExplainQuery(ctx, df.downstream.GetDB(), query, chunkRange.Args)
+	if err != nil {
+		log.Warn("fail to explain the slow query", zap.String("table", dbutil.TableName(tableDiff.Schema, tableDiff.Table)), zap.Error(err))
+		return
+	}
+
+	columns := make([]string, 0, len(chunkRange.Bounds))
+	for _, bound := range chunkRange.Bounds {
+		columns = append(columns, bound.Column)
+	}
+	suggestion := utils.SuggestIndex(plan, tableDiff.Schema, tableDiff.Table, columns)
+	planText := plan.String()
+	if utils.IsSensitiveTable(tableDiff.Schema, tableDiff.Table) {
+		// the ranges of the plan contain the chunk bounds.
+		planText = utils.RedactedValue
+	}
+	log.Warn("the chunk query is slow",
+		zap.String("table", dbutil.TableName(tableDiff.Schema, tableDiff.Table)),
+		zap.Any("chunk id", rangeInfo.ChunkRange.Index),
+		zap.String("kind", kind),
+		zap.Duration("cost", cost),
+		zap.String("plan", planText),
+		zap.String("suggestion", suggestion))
+	df.report.SetTableSlowQuery(tableDiff.Schema, tableDiff.Table, &report.SlowQueryResult{
+		Kind:       kind,
+		Cost:       cost,
+		Plan:       planText,
+		Suggestion: suggestion,
+	})
+}
+
+// exceedDiffLimit returns true if the different rows of the chunk exceed `max-diff-rows-per-chunk`.
+func (df *Diff) exceedDiffLimit(dml *ChunkDML) bool {
+	return df.maxDiffRowsPerChunk > 0 && len(dml.sqls) > df.maxDiffRowsPerChunk
+}
+
+// generateRangeReloadSQLs returns the suggestion to reload the whole range instead of fixing the rows one by one.
+// The DELETE is commented out, because the rows of the range must be reloaded from the source after it.
+func generateRangeReloadSQLs(tableDiff *common.TableDiff, rangeInfo *splitter.RangeInfo) []string {
+	deleteSQL := utils.GenerateRangeDeleteDML(tableDiff.Schema, tableDiff.Table, rangeInfo.ChunkRange.Where, rangeInfo.ChunkRange.Args)
+	return []string{
+		"-- chunk exceeds diff limit, delete the range and reload it from the source instead of fixing the rows one by one",
+		fmt.Sprintf("-- %s", deleteSQL),
+	}
+}
+
 // WriteSQLs write sqls to file
 func (df *Diff) writeSQLs(ctx context.Context) {
 	log.Info("start writeSQLs goroutine")
@@ -707,6 +2091,10 @@ func (df *Diff) writeSQLs(ctx context.Context) {
 		log.Info("close writeSQLs goroutine")
 		df.sqlWg.Done()
 	}()
+	// stopped is true after the disk is full or the diff events fail, then the rest chunks are not inserted into the checkpoint,
+	// so that they are compared again in the next run.
+	stopped := false
+	insertedChunks := 0
 	for {
 		select {
 		case <-ctx.Done():
@@ -716,42 +2104,145 @@ func (df *Diff) writeSQLs(ctx context.Context) {
 				log.Info("write sql channel closed")
 				return
 			}
+			if stopped {
+				continue
+			}
 			if len(dml.sqls) > 0 {
 				tableDiff := df.downstream.GetTables()[dml.node.GetTableIndex()]
-				fileName := fmt.Sprintf("%s:%s:%s.sql", tableDiff.Schema, tableDiff.Table, utils.GetSQLFileName(dml.node.GetID()))
+				fileName := utils.GetFixSQLFileName(tableDiff.Schema, tableDiff.Table, dml.node.GetID())
 				fixSQLPath := filepath.Join(df.FixSQLDir, fileName)
 				if ok := ioutil2.FileExists(fixSQLPath); ok {
 					// unreachable
 					log.Fatal("write sql failed: repeat sql happen", zap.Strings("sql", dml.sqls))
 				}
-				fixSQLFile, err := os.Create(fixSQLPath)
-				if err != nil {
-					log.Fatal("write sql failed: cannot create file", zap.Strings("sql", dml.sqls), zap.Error(err))
-					continue
+				if err := writeFixSQLFile(fixSQLPath, tableDiff, dml, df.fixTimeZone); err != nil {
+					if utils.IsNoSpaceError(err) {
+						// the partial file is removed, otherwise the chunk meets a repeat sql file in the next run.
+						os.Remove(fixSQLPath)
+						stopped = true
+						df.abortByNoSpace(df.FixSQLDir, err)
+						continue
+					}
+					log.Fatal("write sql failed", zap.Strings("sql", dml.sqls), zap.Error(err))
+				}
+				if df.extStorage != nil {
+					if err := df.uploadFixSQLFile(ctx, fixSQLPath, fileName); err != nil {
+						log.Fatal("upload sql failed", zap.String("file", fileName), zap.Error(err))
+					}
 				}
-				// write chunk meta
-				chunkRange := dml.node.ChunkRange
-				fixSQLFile.WriteString(fmt.Sprintf("-- table: %s.%s\n-- %s\n", tableDiff.Schema, tableDiff.Table, chunkRange.ToMeta()))
-				if tableDiff.NeedUnifiedTimeZone {
-					fixSQLFile.WriteString(fmt.Sprintf("set @@session.time_zone = \"%s\";\n", source.UnifiedTimeZone))
+				if df.diffEvents != nil && len(dml.events) > 0 {
+					if err := df.diffEvents.Write(dml.events); err != nil {
+						// the chunk isn't inserted into the checkpoint, so its events are emitted again in the next run.
+						stopped = true
+						df.abortByEventsError(err)
+						continue
+					}
 				}
-				for _, sql := range dml.sqls {
-					_, err = fixSQLFile.WriteString(fmt.Sprintf("%s\n", sql))
-					if err != nil {
-						log.Fatal("write sql failed", zap.String("sql", sql), zap.Error(err))
+				if df.applyFix && !dml.exceedDiffLimit {
+					if err := df.applyFixSQLs(ctx, tableDiff, dml); err != nil {
+						// the chunk isn't inserted into the checkpoint, so it's compared and fixed again in the next run.
+						stopped = true
+						df.abortByApplyError(err)
+						continue
 					}
 				}
-				fixSQLFile.Close()
 			}
 			log.Debug("insert node", zap.Any("chunk index", dml.node.GetID()))
 			df.cp.Insert(dml.node)
+			insertedChunks++
+			if dml.node.ChunkRange.IsLastChunkForTable() ||
+				(df.checkpointFlushChunks > 0 && insertedChunks%df.checkpointFlushChunks == 0) {
+				df.triggerFlush()
+			}
+		}
+	}
+}
+
+// writeFixSQLFile writes the fix sqls of the chunk into the file, the session time zone is set to `timeZone` in which
+// the timestamp values are.
+func writeFixSQLFile(fixSQLPath string, tableDiff *common.TableDiff, dml *ChunkDML, timeZone string) error {
+	fixSQLFile, err := os.Create(fixSQLPath)
+	if err != nil {
+		return errors.Annotate(err, "cannot create file")
+	}
+	defer fixSQLFile.Close()
+	// write chunk meta
+	chunkRange := dml.node.ChunkRange
+	if _, err = fixSQLFile.WriteString(fmt.Sprintf("-- table: %s.%s\n-- %s\n", tableDiff.Schema, tableDiff.Table, chunkRange.ToMeta())); err != nil {
+		return errors.Trace(err)
+	}
+	if tableDiff.NeedUnifiedTimeZone {
+		if _, err = fixSQLFile.WriteString(utils.SetTimeZoneSQL(timeZone) + "\n"); err != nil {
+			return errors.Trace(err)
 		}
 	}
+	for _, sql := range dml.sqls {
+		if _, err = fixSQLFile.WriteString(fmt.Sprintf("%s\n", sql)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	// the data may be written back when closing the file
+	return errors.Trace(fixSQLFile.Close())
+}
+
+// applyFixSQLs executes the fix sqls of the chunk on downstream in one transaction,
+// and records the chunk to verify it after the data comparison. The chunk failed to be fixed is reported as broken.
+func (df *Diff) applyFixSQLs(ctx context.Context, tableDiff *common.TableDiff, dml *ChunkDML) error {
+	err := dbutil.ExecuteSQLs(ctx, df.downstream.GetDB(), dml.sqls, make([][]interface{}, len(dml.sqls)))
+	if err != nil {
+		// the chunk is reported as broken without the verification, since none of its fix sqls is applied.
+		df.report.SetChunkFixVerified(tableDiff.Schema, tableDiff.Table, false)
+		return errors.Annotatef(err, "fail to apply the fix sql of chunk %s of table %s", dml.node.GetID().ToString(),
+			dbutil.TableName(tableDiff.Schema, tableDiff.Table))
+	}
+	df.fixedChunks = append(df.fixedChunks, splitter.FromNode(dml.node))
+	return nil
+}
+
+// VerifyFix re-runs the checksum comparison only on the chunks whose fix sqls have been applied.
+func (df *Diff) VerifyFix(ctx context.Context) error {
+	log.Info("start to verify the fixed chunks", zap.Int("chunk count", len(df.fixedChunks)))
+	for _, rangeInfo := range df.fixedChunks {
+		tableDiff := df.downstream.GetTables()[rangeInfo.GetTableIndex()]
+		isEqual, _, _, err := df.compareChecksumAndGetCount(ctx, rangeInfo)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !isEqual {
+			log.Warn("the chunk is still not equal after applying fix sql",
+				zap.String("table", dbutil.TableName(tableDiff.Schema, tableDiff.Table)),
+				zap.Any("chunk id", rangeInfo.ChunkRange.Index))
+		}
+		df.report.SetChunkFixVerified(tableDiff.Schema, tableDiff.Table, isEqual)
+	}
+	return nil
 }
 
-func (df *Diff) removeSQLFiles(checkPointId *chunk.ChunkID) error {
+// uploadFixSQLFile copies the fix sql file into the external storage.
+func (df *Diff) uploadFixSQLFile(ctx context.Context, fixSQLPath string, fileName string) error {
+	data, err := os.ReadFile(fixSQLPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(df.extStorage.WriteFile(ctx, path.Join(df.extFixDir, fileName), data))
+}
+
+// afterCheckpoint returns true if the chunk is after the checkpoint of its table, the chunks of the tables
+// without the checkpoint are all after it.
+func afterCheckpoint(id *chunk.ChunkID, checkpointIDs map[int]*chunk.ChunkID) bool {
+	checkpointID, ok := checkpointIDs[id.TableIndex]
+	return !ok || id.Compare(checkpointID) > 0
+}
+
+// removeSQLFiles moves the fix sql files after the checkpoint of their tables into the trash dir.
+func (df *Diff) removeSQLFiles(ctx context.Context, checkpointIDs map[int]*chunk.ChunkID) error {
 	ts := time.Now().Format("2006-01-02T15:04:05Z07:00")
 	dirName := fmt.Sprintf(".trash-%s", ts)
+	if df.extStorage != nil {
+		if err := df.removeExternalSQLFiles(ctx, checkpointIDs, dirName); err != nil {
+			return errors.Trace(err)
+		}
+	}
 	folderPath := filepath.Join(df.FixSQLDir, dirName)
 
 	if _, err := os.Stat(folderPath); os.IsNotExist(err) {
@@ -785,22 +2276,13 @@ func (df *Diff) removeSQLFiles(checkPointId *chunk.ChunkID) error {
 		}
 
 		if strings.HasSuffix(name, ".sql") {
-			fileIDStr := strings.TrimRight(name, ".sql")
-			fileIDSubstrs := strings.SplitN(fileIDStr, ":", 3)
-			if len(fileIDSubstrs) != 3 {
-				return nil
-			}
-			tableIndex, bucketIndexLeft, bucketIndexRight, chunkIndex, err := utils.GetChunkIDFromSQLFileName(fileIDSubstrs[2])
+			fileID, err := utils.GetChunkIDFromFixSQLFileName(name)
 			if err != nil {
-				return errors.Trace(err)
-			}
-			fileID := &chunk.ChunkID{
-				TableIndex: tableIndex, BucketIndexLeft: bucketIndexLeft, BucketIndexRight: bucketIndexRight, ChunkIndex: chunkIndex, ChunkCnt: 0,
-			}
-			if err != nil {
-				return errors.Trace(err)
+				// not generated by sync-diff, leave it there.
+				log.Warn("skip unrecognized sql file in fix sql dir", zap.String("file", path), zap.Error(err))
+				return nil
 			}
-			if fileID.Compare(checkPointId) > 0 {
+			if afterCheckpoint(fileID, checkpointIDs) {
 				// move to trash
 				err = os.Rename(oldPath, newPath)
 				if err != nil {
@@ -816,6 +2298,60 @@ func (df *Diff) removeSQLFiles(checkPointId *chunk.ChunkID) error {
 	return nil
 }
 
+// removeExternalSQLFiles moves the fix sql files in the external storage after the checkpoint of their tables
+// into the trash dir, as removeSQLFiles does for the local files. The objects can't be renamed, so they are copied
+// and deleted.
+func (df *Diff) removeExternalSQLFiles(ctx context.Context, checkpointIDs map[int]*chunk.ChunkID, trashDir string) error {
+	toRemove := make([]string, 0)
+	err := df.extStorage.WalkDir(ctx, &storage.WalkOption{SubDir: df.extFixDir}, func(filePath string, _ int64) error {
+		name := path.Base(filePath)
+		if strings.Contains(filePath, ".trash") || !strings.HasSuffix(name, ".sql") {
+			return nil
+		}
+		fileID, err := utils.GetChunkIDFromFixSQLFileName(name)
+		if err != nil {
+			log.Warn("skip unrecognized sql file in the external storage", zap.String("file", filePath), zap.Error(err))
+			return nil
+		}
+		if afterCheckpoint(fileID, checkpointIDs) {
+			toRemove = append(toRemove, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := df.mkdirExternal(path.Join(df.extFixDir, trashDir)); err != nil {
+		return errors.Trace(err)
+	}
+	for _, filePath := range toRemove {
+		data, err := df.extStorage.ReadFile(ctx, filePath)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := df.extStorage.WriteFile(ctx, path.Join(df.extFixDir, trashDir, path.Base(filePath)), data); err != nil {
+			return errors.Trace(err)
+		}
+		if err := df.extStorage.DeleteFile(ctx, filePath); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// mkdirExternal creates the dirs in the external storage if it's a local path, the object storages have no dirs.
+func (df *Diff) mkdirExternal(dirs ...string) error {
+	if df.extLocalDir == "" {
+		return nil
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(df.extLocalDir, dir), os.ModePerm); err != nil {
+			return errors.Annotatef(err, "create the dir %s in the external storage", dir)
+		}
+	}
+	return nil
+}
+
 func setTiDBCfg() {
 	// to support long index key in TiDB
 	tidbCfg := tidbconfig.GetGlobalConfig()
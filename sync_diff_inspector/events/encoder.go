@@ -0,0 +1,353 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/pingcap/tidb/parser/types"
+)
+
+// EventType is the type of a row change event.
+type EventType string
+
+const (
+	// Insert means the row is missing in the target.
+	Insert EventType = "INSERT"
+	// Update means the row of the target is different from the source.
+	Update EventType = "UPDATE"
+	// Delete means the row is redundant in the target.
+	Delete EventType = "DELETE"
+)
+
+// Message is an encoded row change event, Key is nil if the protocol has no key.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// Encoder encodes a different row as a row change event.
+// before is the row of the target, and after is the row of the source, one of them is nil for insert and delete.
+type Encoder interface {
+	Encode(schema, table string, tableInfo *model.TableInfo, eventType EventType, before, after map[string]*dbutil.ColumnData) (*Message, error)
+}
+
+// NewEncoder returns the encoder of the protocol.
+func NewEncoder(protocol string) (Encoder, error) {
+	switch protocol {
+	case config.DiffEventsProtocolCanalJSON:
+		return canalJSONEncoder{}, nil
+	case config.DiffEventsProtocolOpen:
+		return openProtocolEncoder{}, nil
+	default:
+		return nil, errors.Errorf("unknown protocol %s of the diff events", protocol)
+	}
+}
+
+// the events are not committed by any transaction, so the time of the encoding is used as the commit time.
+func commitTime() time.Time {
+	return time.Now()
+}
+
+// composeTS returns the tso of the physical time, which is the commit ts of the open protocol.
+func composeTS(t time.Time) uint64 {
+	return uint64(t.UnixNano()/int64(time.Millisecond)) << 18
+}
+
+// isBinary returns whether the column is a string column of the binary charset, e.g. BINARY, VARBINARY or BLOB.
+func isBinary(col *model.ColumnInfo) bool {
+	if col.Charset != "binary" {
+		return false
+	}
+	switch col.Tp {
+	case mysql.TypeString, mysql.TypeVarString, mysql.TypeVarchar,
+		mysql.TypeTinyBlob, mysql.TypeMediumBlob, mysql.TypeBlob, mysql.TypeLongBlob:
+		return true
+	default:
+		return false
+	}
+}
+
+// bitValue returns the value of the BIT column, which is read as big-endian bytes.
+func bitValue(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+// canalJSONMessage is the canal-json message of TiCDC.
+type canalJSONMessage struct {
+	ID            int64                `json:"id"`
+	Schema        string               `json:"database"`
+	Table         string               `json:"table"`
+	PKNames       []string             `json:"pkNames"`
+	IsDDL         bool                 `json:"isDdl"`
+	EventType     string               `json:"type"`
+	ExecutionTime int64                `json:"es"`
+	BuildTime     int64                `json:"ts"`
+	Query         string               `json:"sql"`
+	SQLType       map[string]int32     `json:"sqlType"`
+	MySQLType     map[string]string    `json:"mysqlType"`
+	Data          []map[string]*string `json:"data"`
+	Old           []map[string]*string `json:"old"`
+}
+
+type canalJSONEncoder struct{}
+
+func (canalJSONEncoder) Encode(schema, table string, tableInfo *model.TableInfo, eventType EventType, before, after map[string]*dbutil.ColumnData) (*Message, error) {
+	now := commitTime().UnixNano() / int64(time.Millisecond)
+	msg := &canalJSONMessage{
+		Schema:        schema,
+		Table:         table,
+		PKNames:       make([]string, 0),
+		EventType:     string(eventType),
+		ExecutionTime: now,
+		BuildTime:     now,
+		SQLType:       make(map[string]int32, len(tableInfo.Columns)),
+		MySQLType:     make(map[string]string, len(tableInfo.Columns)),
+	}
+	for _, col := range tableInfo.Columns {
+		if mysql.HasPriKeyFlag(col.Flag) {
+			msg.PKNames = append(msg.PKNames, col.Name.O)
+		}
+		msg.SQLType[col.Name.O] = javaSQLType(col)
+		mysqlType := types.TypeToStr(col.Tp, col.Charset)
+		if mysql.HasUnsignedFlag(col.Flag) {
+			mysqlType += " unsigned"
+		}
+		msg.MySQLType[col.Name.O] = mysqlType
+	}
+	switch eventType {
+	case Delete:
+		msg.Data = []map[string]*string{canalJSONRow(tableInfo, before)}
+	case Update:
+		msg.Data = []map[string]*string{canalJSONRow(tableInfo, after)}
+		msg.Old = []map[string]*string{canalJSONRow(tableInfo, before)}
+	default:
+		msg.Data = []map[string]*string{canalJSONRow(tableInfo, after)}
+	}
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Message{Value: value}, nil
+}
+
+// canalJSONRow returns the values of the row as strings, the binary values are encoded in ISO-8859-1 as TiCDC does.
+func canalJSONRow(tableInfo *model.TableInfo, row map[string]*dbutil.ColumnData) map[string]*string {
+	values := make(map[string]*string, len(tableInfo.Columns))
+	for _, col := range tableInfo.Columns {
+		data, ok := row[col.Name.O]
+		if !ok || data.IsNull {
+			values[col.Name.O] = nil
+			continue
+		}
+		var value string
+		switch {
+		case col.Tp == mysql.TypeBit:
+			value = strconv.FormatUint(bitValue(data.Data), 10)
+		case isBinary(col):
+			var builder strings.Builder
+			for _, b := range data.Data {
+				builder.WriteRune(rune(b))
+			}
+			value = builder.String()
+		default:
+			value = string(data.Data)
+		}
+		values[col.Name.O] = &value
+	}
+	return values
+}
+
+// javaSQLType returns the type in java.sql.Types of the column, which is the `sqlType` of canal-json.
+func javaSQLType(col *model.ColumnInfo) int32 {
+	switch col.Tp {
+	case mysql.TypeTiny:
+		return -6 // TINYINT
+	case mysql.TypeShort:
+		return 5 // SMALLINT
+	case mysql.TypeInt24, mysql.TypeLong, mysql.TypeEnum:
+		return 4 // INTEGER
+	case mysql.TypeLonglong:
+		return -5 // BIGINT
+	case mysql.TypeFloat:
+		return 7 // REAL
+	case mysql.TypeDouble:
+		return 8 // DOUBLE
+	case mysql.TypeNewDecimal:
+		return 3 // DECIMAL
+	case mysql.TypeDate, mysql.TypeNewDate:
+		return 91 // DATE
+	case mysql.TypeDuration:
+		return 92 // TIME
+	case mysql.TypeDatetime, mysql.TypeTimestamp:
+		return 93 // TIMESTAMP
+	case mysql.TypeBit, mysql.TypeSet:
+		return -7 // BIT
+	case mysql.TypeString:
+		if isBinary(col) {
+			return -2 // BINARY
+		}
+		return 1 // CHAR
+	case mysql.TypeVarchar, mysql.TypeVarString:
+		if isBinary(col) {
+			return -3 // VARBINARY
+		}
+		return 12 // VARCHAR
+	case mysql.TypeTinyBlob, mysql.TypeBlob, mysql.TypeMediumBlob, mysql.TypeLongBlob:
+		if isBinary(col) {
+			return 2004 // BLOB
+		}
+		return 2005 // CLOB
+	default:
+		return 12 // VARCHAR, e.g. YEAR and JSON
+	}
+}
+
+// the flags of the columns in the open protocol.
+const (
+	openBinaryFlag     = 1 << 0
+	openHandleKeyFlag  = 1 << 1
+	openPrimaryKeyFlag = 1 << 3
+	openNullableFlag   = 1 << 6
+	openUnsignedFlag   = 1 << 7
+)
+
+// the type of the row changed event in the open protocol.
+const openRowChangedType = 1
+
+type openProtocolKey struct {
+	TS     uint64 `json:"ts"`
+	Schema string `json:"scm"`
+	Table  string `json:"tbl"`
+	Type   int    `json:"t"`
+}
+
+type openProtocolColumn struct {
+	Type   byte        `json:"t"`
+	Handle bool        `json:"h,omitempty"`
+	Flag   uint64      `json:"f"`
+	Value  interface{} `json:"v"`
+}
+
+type openProtocolValue struct {
+	Update     map[string]*openProtocolColumn `json:"u,omitempty"`
+	PreColumns map[string]*openProtocolColumn `json:"p,omitempty"`
+	Delete     map[string]*openProtocolColumn `json:"d,omitempty"`
+}
+
+type openProtocolEncoder struct{}
+
+func (openProtocolEncoder) Encode(schema, table string, tableInfo *model.TableInfo, eventType EventType, before, after map[string]*dbutil.ColumnData) (*Message, error) {
+	key, err := json.Marshal(&openProtocolKey{
+		TS:     composeTS(commitTime()),
+		Schema: schema,
+		Table:  table,
+		Type:   openRowChangedType,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	handleKeys := handleKeyColumns(tableInfo)
+	value := &openProtocolValue{}
+	switch eventType {
+	case Delete:
+		value.Delete = openProtocolRow(tableInfo, handleKeys, before)
+	case Update:
+		value.Update = openProtocolRow(tableInfo, handleKeys, after)
+		value.PreColumns = openProtocolRow(tableInfo, handleKeys, before)
+	default:
+		value.Update = openProtocolRow(tableInfo, handleKeys, after)
+	}
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Message{Key: key, Value: valueBytes}, nil
+}
+
+// handleKeyColumns returns the columns of the primary key or the unique key identifying the rows.
+func handleKeyColumns(tableInfo *model.TableInfo) map[string]struct{} {
+	columns := make(map[string]struct{})
+	hasKey := false
+	for _, index := range tableInfo.Indices {
+		if index.Primary || index.Unique {
+			hasKey = true
+			break
+		}
+	}
+	if !hasKey && !tableInfo.PKIsHandle {
+		return columns
+	}
+	keys, _ := dbutil.SelectRowIdentityKey(tableInfo)
+	for _, key := range keys {
+		columns[key] = struct{}{}
+	}
+	return columns
+}
+
+// openProtocolRow returns the columns of the row, the numbers are encoded as JSON numbers, and the binary
+// values are escaped as TiCDC does.
+func openProtocolRow(tableInfo *model.TableInfo, handleKeys map[string]struct{}, row map[string]*dbutil.ColumnData) map[string]*openProtocolColumn {
+	columns := make(map[string]*openProtocolColumn, len(tableInfo.Columns))
+	for _, col := range tableInfo.Columns {
+		column := &openProtocolColumn{Type: col.Tp}
+		if _, ok := handleKeys[col.Name.O]; ok {
+			column.Handle = true
+			column.Flag |= openHandleKeyFlag
+		}
+		if mysql.HasPriKeyFlag(col.Flag) {
+			column.Flag |= openPrimaryKeyFlag
+		}
+		if !mysql.HasNotNullFlag(col.Flag) {
+			column.Flag |= openNullableFlag
+		}
+		if mysql.HasUnsignedFlag(col.Flag) {
+			column.Flag |= openUnsignedFlag
+		}
+		if isBinary(col) {
+			column.Flag |= openBinaryFlag
+		}
+		columns[col.Name.O] = column
+
+		data, ok := row[col.Name.O]
+		if !ok || data.IsNull {
+			continue
+		}
+		switch {
+		case col.Tp == mysql.TypeBit:
+			column.Value = bitValue(data.Data)
+		case col.Tp == mysql.TypeTiny, col.Tp == mysql.TypeShort, col.Tp == mysql.TypeInt24, col.Tp == mysql.TypeLong,
+			col.Tp == mysql.TypeLonglong, col.Tp == mysql.TypeFloat, col.Tp == mysql.TypeDouble, col.Tp == mysql.TypeYear:
+			column.Value = json.Number(data.Data)
+		case isBinary(col):
+			quoted := strconv.Quote(string(data.Data))
+			column.Value = quoted[1 : len(quoted)-1]
+		default:
+			column.Value = string(data.Data)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,132 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/pingcap/tidb/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoder(t *testing.T) {
+	createTableSQL := "create table `test`.`t`(`a` int unsigned not null, `b` varchar(10), `c` varbinary(10), primary key(`a`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	before := map[string]*dbutil.ColumnData{
+		"a": {Data: []byte("1")},
+		"b": {Data: []byte("x")},
+		"c": {IsNull: true},
+	}
+	after := map[string]*dbutil.ColumnData{
+		"a": {Data: []byte("1")},
+		"b": {Data: []byte("y")},
+		"c": {Data: []byte{0, 0xff}},
+	}
+
+	_, err = NewEncoder("avro")
+	require.Error(t, err)
+
+	encoder, err := NewEncoder(config.DiffEventsProtocolCanalJSON)
+	require.NoError(t, err)
+	msg, err := encoder.Encode("test", "t", tableInfo, Update, before, after)
+	require.NoError(t, err)
+	require.Nil(t, msg.Key)
+	canal := &canalJSONMessage{}
+	require.NoError(t, json.Unmarshal(msg.Value, canal))
+	require.Equal(t, "UPDATE", canal.EventType)
+	require.Equal(t, []string{"a"}, canal.PKNames)
+	require.Equal(t, "int unsigned", canal.MySQLType["a"])
+	require.Equal(t, int32(-3), canal.SQLType["c"])
+	require.Equal(t, "y", *canal.Data[0]["b"])
+	require.Equal(t, "\u0000ÿ", *canal.Data[0]["c"])
+	require.Equal(t, "x", *canal.Old[0]["b"])
+	require.Nil(t, canal.Old[0]["c"])
+
+	msg, err = encoder.Encode("test", "t", tableInfo, Delete, before, nil)
+	require.NoError(t, err)
+	canal = &canalJSONMessage{}
+	require.NoError(t, json.Unmarshal(msg.Value, canal))
+	require.Equal(t, "DELETE", canal.EventType)
+	require.Equal(t, "x", *canal.Data[0]["b"])
+	require.Nil(t, canal.Old)
+
+	encoder, err = NewEncoder(config.DiffEventsProtocolOpen)
+	require.NoError(t, err)
+	msg, err = encoder.Encode("test", "t", tableInfo, Insert, nil, after)
+	require.NoError(t, err)
+	key := &openProtocolKey{}
+	require.NoError(t, json.Unmarshal(msg.Key, key))
+	require.Equal(t, "test", key.Schema)
+	require.Equal(t, "t", key.Table)
+	require.Equal(t, openRowChangedType, key.Type)
+	require.NotZero(t, key.TS)
+	require.JSONEq(t, `{"u":{`+
+		`"a":{"t":3,"h":true,"f":138,"v":1},`+
+		`"b":{"t":15,"f":64,"v":"y"},`+
+		`"c":{"t":15,"f":65,"v":"\\x00\\xff"}}}`, string(msg.Value))
+
+	msg, err = encoder.Encode("test", "t", tableInfo, Delete, before, nil)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"d":{`+
+		`"a":{"t":3,"h":true,"f":138,"v":1},`+
+		`"b":{"t":15,"f":64,"v":"x"},`+
+		`"c":{"t":15,"f":65,"v":null}}}`, string(msg.Value))
+
+	batchKey, batchValue := encodeOpenProtocolBatch(msg)
+	require.Equal(t, uint64(openProtocolBatchVersion), binary.BigEndian.Uint64(batchKey))
+	require.Equal(t, uint64(len(msg.Key)), binary.BigEndian.Uint64(batchKey[8:]))
+	require.Equal(t, msg.Key, batchKey[16:])
+	require.Equal(t, uint64(len(msg.Value)), binary.BigEndian.Uint64(batchValue))
+	require.Equal(t, msg.Value, batchValue[8:])
+}
+
+func TestFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	emitter, err := NewEmitter(&config.DiffEventsConfig{Protocol: config.DiffEventsProtocolOpen}, dir)
+	require.NoError(t, err)
+	require.NoError(t, emitter.Write([]*Message{
+		{Key: []byte(`{"k":1}`), Value: []byte(`{"v":1}`)},
+		{Key: []byte(`{"k":2}`), Value: []byte(`{"v":2}`)},
+	}))
+	require.NoError(t, emitter.Close())
+
+	// the events are appended to the file
+	emitter, err = NewEmitter(&config.DiffEventsConfig{Protocol: config.DiffEventsProtocolCanalJSON}, dir)
+	require.NoError(t, err)
+	require.NoError(t, emitter.Write([]*Message{{Value: []byte(`{"v":3}`)}}))
+	require.NoError(t, emitter.Close())
+
+	file, err := os.Open(filepath.Join(dir, config.DiffEventsFileName))
+	require.NoError(t, err)
+	defer file.Close()
+	lines := make([]string, 0, 3)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, []string{
+		`{"key":{"k":1},"value":{"v":1}}`,
+		`{"key":{"k":2},"value":{"v":2}}`,
+		`{"v":3}`,
+	}, lines)
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	"github.com/Shopify/sarama"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+)
+
+// the version of the batched messages of the open protocol.
+const openProtocolBatchVersion = 1
+
+// Writer writes the encoded events of a chunk.
+type Writer interface {
+	Write(messages []*Message) error
+	Close() error
+}
+
+// Emitter encodes the different rows as row change events and writes them.
+// The events of a chunk may be written again if the comparison is resumed from the checkpoint,
+// so the consumers should apply them idempotently.
+type Emitter struct {
+	Encoder
+	Writer
+}
+
+// NewEmitter returns the emitter of the config, the events are written to the file in the output dir by default.
+func NewEmitter(cfg *config.DiffEventsConfig, outputDir string) (*Emitter, error) {
+	encoder, err := NewEncoder(cfg.Protocol)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var writer Writer
+	if len(cfg.KafkaAddrs) > 0 {
+		writer, err = newKafkaWriter(cfg.KafkaAddrs, cfg.KafkaTopic, cfg.Protocol)
+	} else {
+		fileName := cfg.File
+		if fileName == "" {
+			fileName = filepath.Join(outputDir, config.DiffEventsFileName)
+		}
+		writer, err = newFileWriter(fileName)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Emitter{Encoder: encoder, Writer: writer}, nil
+}
+
+// fileWriter appends the events to the file, one message per line.
+// The message of the open protocol is written as {"key":...,"value":...}.
+type fileWriter struct {
+	file *os.File
+}
+
+func newFileWriter(fileName string) (*fileWriter, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, config.LocalFilePerm)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot open the file of the diff events")
+	}
+	return &fileWriter{file: file}, nil
+}
+
+func (w *fileWriter) Write(messages []*Message) error {
+	var buf bytes.Buffer
+	for _, msg := range messages {
+		if msg.Key == nil {
+			buf.Write(msg.Value)
+		} else {
+			buf.WriteString(`{"key":`)
+			buf.Write(msg.Key)
+			buf.WriteString(`,"value":`)
+			buf.Write(msg.Value)
+			buf.WriteString("}")
+		}
+		buf.WriteString("\n")
+	}
+	// the events of a chunk are written at once, so that the file isn't broken in the middle of a message.
+	_, err := w.file.Write(buf.Bytes())
+	return errors.Trace(err)
+}
+
+func (w *fileWriter) Close() error {
+	return errors.Trace(w.file.Close())
+}
+
+// kafkaWriter sends the events to the kafka topic.
+type kafkaWriter struct {
+	producer sarama.SyncProducer
+	topic    string
+	protocol string
+}
+
+func newKafkaWriter(addrs []string, topic, protocol string) (*kafkaWriter, error) {
+	cfg := sarama.NewConfig()
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+	cfg.Producer.Return.Successes = true
+	producer, err := sarama.NewSyncProducer(addrs, cfg)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot connect to kafka")
+	}
+	return &kafkaWriter{producer: producer, topic: topic, protocol: protocol}, nil
+}
+
+func (w *kafkaWriter) Write(messages []*Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	msgs := make([]*sarama.ProducerMessage, 0, len(messages))
+	for _, msg := range messages {
+		key, value := msg.Key, msg.Value
+		if w.protocol == config.DiffEventsProtocolOpen {
+			key, value = encodeOpenProtocolBatch(msg)
+		}
+		producerMsg := &sarama.ProducerMessage{Topic: w.topic, Value: sarama.ByteEncoder(value)}
+		if key != nil {
+			producerMsg.Key = sarama.ByteEncoder(key)
+		}
+		msgs = append(msgs, producerMsg)
+	}
+	return errors.Trace(w.producer.SendMessages(msgs))
+}
+
+func (w *kafkaWriter) Close() error {
+	return errors.Trace(w.producer.Close())
+}
+
+// encodeOpenProtocolBatch returns the kafka key and value of a batch containing only the message,
+// the key is the version followed by the length and the key of the message,
+// and the value is the length and the value of the message.
+func encodeOpenProtocolBatch(msg *Message) ([]byte, []byte) {
+	key := make([]byte, 16, 16+len(msg.Key))
+	binary.BigEndian.PutUint64(key, openProtocolBatchVersion)
+	binary.BigEndian.PutUint64(key[8:], uint64(len(msg.Key)))
+	key = append(key, msg.Key...)
+
+	value := make([]byte, 8, 8+len(msg.Value))
+	binary.BigEndian.PutUint64(value, uint64(len(msg.Value)))
+	value = append(value, msg.Value...)
+	return key, value
+}
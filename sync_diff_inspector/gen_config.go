@@ -0,0 +1,69 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	flag "github.com/spf13/pflag"
+)
+
+// runGenConfig handles `sync_diff_inspector gen-config --from-dm <master-addr> <task>`, which writes a config
+// checking the tables replicated by the DM task, and returns the exit code.
+func runGenConfig(args []string) int {
+	fs := flag.NewFlagSet("gen-config", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sync_diff_inspector gen-config --from-dm <master-addr> <task> [--output=<file>]")
+		fs.PrintDefaults()
+	}
+	dmAddr := fs.String("from-dm", "", "the address of dm-master, e.g. http://127.0.0.1:8261")
+	output := fs.String("output", "", "the file to write the config, the config is printed if it's empty")
+	err := fs.Parse(args)
+	if errors.Cause(err) == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 2
+	}
+	if *dmAddr == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	addr := *dmAddr
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	data, err := config.GenerateConfigFromDMTask(addr, fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Fail to generate config.\n%s\n", err.Error())
+		return 1
+	}
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	// the config contains the passwords, so it's only readable by the owner.
+	if err := os.WriteFile(*output, data, 0o600); err != nil {
+		fmt.Printf("Fail to write config.\n%s\n", err.Error())
+		return 1
+	}
+	fmt.Printf("The config of DM task %s is written to %s\n", fs.Arg(0), *output)
+	return 0
+}
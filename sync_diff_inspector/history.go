@@ -0,0 +1,146 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"go.uber.org/zap"
+)
+
+const (
+	// historyDir is the dir in the output dir keeping the artifacts of the finished runs.
+	historyDir = "history"
+	// runDirPrefix is the prefix of the dir of a finished run, which is followed by the finish time.
+	runDirPrefix = "run-"
+	// trashDirPrefix is the prefix of the dirs in the fix sql dir keeping the fix sql files removed when resuming.
+	trashDirPrefix = ".trash-"
+	summaryFile    = "summary.txt"
+)
+
+// archiveRun keeps the checkpoint, the summary and the fix sql of the finished run in a new dir of the history dir,
+// then removes the dirs of the runs and the trash dirs of the fix sql except the last keepRuns ones.
+func (df *Diff) archiveRun(ctx context.Context) error {
+	runDir := filepath.Join(df.outputDir, historyDir, runDirPrefix+time.Now().Format("20060102T150405"))
+	if err := os.MkdirAll(runDir, config.LocalDirPerm); err != nil {
+		return errors.Trace(err)
+	}
+
+	if df.cpStorage != nil {
+		exists, err := df.cpStorage.Exists(ctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if exists {
+			data, err := df.cpStorage.Load(ctx)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if err := os.WriteFile(filepath.Join(runDir, checkpointFile), data, config.LocalFilePerm); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(df.outputDir, summaryFile))
+	if err == nil {
+		err = os.WriteFile(filepath.Join(runDir, summaryFile), data, config.LocalFilePerm)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Trace(err)
+	}
+	// the fix sql files are moved, they would be moved into the trash dir by the next run anyway.
+	if err := moveFixSQLFiles(df.FixSQLDir, filepath.Join(runDir, filepath.Base(df.FixSQLDir))); err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("keep the artifacts of the run", zap.String("dir", runDir))
+
+	if err := removeOldDirs(filepath.Join(df.outputDir, historyDir), runDirPrefix, df.keepRuns); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(removeOldDirs(df.FixSQLDir, trashDirPrefix, df.keepRuns))
+}
+
+// moveFixSQLFiles moves the fix sql files out of the fix sql dir, the trash dirs are left there.
+func moveFixSQLFiles(fixSQLDir, dstDir string) error {
+	entries, err := os.ReadDir(fixSQLDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Trace(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), trashDirPrefix) {
+			continue
+		}
+		if err := os.MkdirAll(dstDir, config.LocalDirPerm); err != nil {
+			return errors.Trace(err)
+		}
+		if err := os.Rename(filepath.Join(fixSQLDir, entry.Name()), filepath.Join(dstDir, entry.Name())); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// removeOldDirs removes the dirs with the prefix in the parent dir except the last keep ones by the modification time.
+func removeOldDirs(parent, prefix string, keep int) error {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Trace(err)
+	}
+	type dirInfo struct {
+		name    string
+		modTime time.Time
+	}
+	dirs := make([]dirInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		dirs = append(dirs, dirInfo{name: entry.Name(), modTime: info.ModTime()})
+	}
+	if len(dirs) <= keep {
+		return nil
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].modTime.Equal(dirs[j].modTime) {
+			return dirs[i].name < dirs[j].name
+		}
+		return dirs[i].modTime.Before(dirs[j].modTime)
+	})
+	for _, dir := range dirs[:len(dirs)-keep] {
+		path := filepath.Join(parent, dir.name)
+		if err := os.RemoveAll(path); err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("remove the old dir", zap.String("dir", path))
+	}
+	return nil
+}
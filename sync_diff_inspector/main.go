@@ -24,14 +24,30 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-tools/pkg/utils"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/chaos"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	diffutils "github.com/pingcap/tidb-tools/sync_diff_inspector/utils"
 	flag "github.com/spf13/pflag"
 	"go.uber.org/zap"
 )
 
 func main() {
 	cfg := config.NewConfig()
-	err := cfg.Parse(os.Args[1:])
+	args := os.Args[1:]
+	// `sync_diff_inspector gen-config --from-dm <master-addr> <task>` writes a config from the DM task.
+	if len(args) > 0 && args[0] == "gen-config" {
+		os.Exit(runGenConfig(args[1:]))
+	}
+	// `sync_diff_inspector show-checkpoint <output-dir>` prints the state saved in the checkpoint.
+	if len(args) > 0 && args[0] == "show-checkpoint" {
+		os.Exit(runShowCheckpoint(args[1:]))
+	}
+	// `sync_diff_inspector bench --config=...` measures the read throughput of the instances instead of comparing.
+	if len(args) > 0 && args[0] == "bench" {
+		cfg.Bench = true
+		args = args[1:]
+	}
+	err := cfg.Parse(args)
 	switch errors.Cause(err) {
 	case nil:
 	case flag.ErrHelp:
@@ -56,16 +72,34 @@ func main() {
 		log.Error("Log init failed!", zap.String("error", e.Error()))
 		os.Exit(2)
 	}
+	// the passwords of the instances are scrubbed from the logs once they are registered.
+	lg = lg.WithOptions(zap.WrapCore(diffutils.NewRedactCore))
 	log.ReplaceGlobals(lg, p)
 
 	utils.PrintInfo("sync_diff_inspector")
 
+	// the passwords in the config file may appear in the errors of the initialization.
+	diffutils.AddSecrets(cfg.GetSecrets()...)
+	if cfg.CheckFailedOnly {
+		hasFailed, err := initCheckFailedOnly(cfg)
+		if err != nil {
+			fmt.Printf("Fail to load the failed chunks of the last run.\n%s\n", err.Error())
+			os.Exit(2)
+		}
+		if !hasFailed {
+			fmt.Printf("No table failed in the last run, nothing to re-check.\n")
+			return
+		}
+	}
 	// Initial config
 	err = cfg.Init()
 	if err != nil {
-		fmt.Printf("Fail to initialize config.\n%s\n", err.Error())
+		fmt.Printf("Fail to initialize config.\n%s\n", diffutils.RedactSecrets(err.Error()))
 		os.Exit(2)
 	}
+	// the passwords of the DM task are known after the config is initialized.
+	diffutils.AddSecrets(cfg.GetSecrets()...)
+	diffutils.SetSensitiveTables(cfg.Task.TargetSensitiveTables)
 
 	ok := cfg.CheckConfig()
 	if !ok {
@@ -75,7 +109,23 @@ func main() {
 
 	log.Info("", zap.Stringer("config", cfg))
 
+	if cfg.Chaos != "" {
+		rates, _ := chaos.Parse(cfg.Chaos)
+		if err := chaos.Enable(rates); err != nil {
+			fmt.Printf("Fail to enable chaos.\n%s\n", err.Error())
+			os.Exit(2)
+		}
+		log.Warn("chaos test mode is enabled, the failures are injected", zap.Any("rates", rates))
+	}
+
 	ctx := context.Background()
+	if cfg.Bench {
+		if err := runBench(ctx, cfg, os.Stdout); err != nil {
+			fmt.Printf("There is something error when run the benchmark, please check log info in %s\n", conf.File.Filename)
+			log.Fatal("failed to run the benchmark", zap.Error(err))
+		}
+		return
+	}
 	if !checkSyncState(ctx, cfg) {
 		log.Warn("check failed!!!")
 		os.Exit(1)
@@ -97,6 +147,16 @@ func checkSyncState(ctx context.Context, cfg *config.Config) bool {
 	}
 	defer d.Close()
 
+	if cfg.StatusAddr != "" {
+		stopStatusServer, err := d.startStatusServer(cfg)
+		if err != nil {
+			fmt.Printf("There is something error when start the status server, please check log info in %s\n", filepath.Join(cfg.Task.OutputDir, config.LogFileName))
+			log.Fatal("failed to start the status server", zap.Error(err))
+			return false
+		}
+		defer stopStatusServer()
+	}
+
 	err = d.StructEqual(ctx)
 	if err != nil {
 		fmt.Printf("There is something error when compare structure of table, please check log info in %s\n", filepath.Join(cfg.Task.OutputDir, config.LogFileName))
@@ -110,6 +170,20 @@ func checkSyncState(ctx context.Context, cfg *config.Config) bool {
 			log.Fatal("failed to check data difference", zap.Error(err))
 			return false
 		}
+		if cfg.ApplyFixSQL {
+			err = d.VerifyFix(ctx)
+			if err != nil {
+				fmt.Printf("There is something error when verify the applied fix sql, please check log info in %s\n", filepath.Join(cfg.Task.OutputDir, config.LogFileName))
+				log.Fatal("failed to verify the applied fix sql", zap.Error(err))
+				return false
+			}
+		}
+		if err = d.SaveIncrementalState(); err != nil {
+			log.Warn("failed to save the incremental state, the next run compares the rows changed since the previous successful run", zap.Error(err))
+		}
+		if err = d.SaveFailedChunks(); err != nil {
+			log.Warn("failed to save the failed chunks, --check-failed-only can't be used for this run", zap.Error(err))
+		}
 	} else {
 		fmt.Printf("Check table struct only, skip data check\n")
 	}
@@ -36,6 +36,13 @@ type TableProgressPrinter struct {
 	progress int
 	total    int
 
+	// restoredChunks are the chunks of the tables finished before the run is resumed from the checkpoint,
+	// they are added to the progress of the tables once they are started.
+	restoredChunks map[string]int
+	// the ETA is estimated by the progress made since etaStartTime, so the restored progress isn't counted.
+	etaStartTime     time.Time
+	etaStartProgress float32
+
 	optCh    chan Operator
 	finishCh chan struct{}
 }
@@ -74,6 +81,7 @@ const (
 	PROGRESS_OPT_FAIL
 	PROGRESS_OPT_CLOSE
 	PROGRESS_OPT_ERROR
+	PROGRESS_OPT_RESTORE
 )
 
 type Operator struct {
@@ -98,6 +106,8 @@ func NewTableProgressPrinter(tableNums int, finishTableNums int) *TableProgressP
 		progress: 0,
 		total:    0,
 
+		restoredChunks: make(map[string]int),
+
 		optCh:    make(chan Operator, 16),
 		finishCh: make(chan struct{}),
 	}
@@ -155,6 +165,16 @@ func (tpp *TableProgressPrinter) StartTable(name string, total int, stopUpdate b
 	}
 }
 
+// RestoreTable restores the chunks of the table finished before the run is resumed from the checkpoint,
+// it must be called before the table is started.
+func (tpp *TableProgressPrinter) RestoreTable(name string, finishedChunks int) {
+	tpp.optCh <- Operator{
+		optType: PROGRESS_OPT_RESTORE,
+		name:    name,
+		total:   finishedChunks,
+	}
+}
+
 func (tpp *TableProgressPrinter) FailTable(name string) {
 	tpp.optCh <- Operator{
 		optType: PROGRESS_OPT_FAIL,
@@ -259,13 +279,17 @@ func (tpp *TableProgressPrinter) serve() {
 					})
 					tpp.tableMap[opt.name] = e
 				}
+			case PROGRESS_OPT_RESTORE:
+				tpp.restoredChunks[opt.name] = opt.total
 			case PROGRESS_OPT_START:
+				restored := tpp.restoredChunks[opt.name]
+				delete(tpp.restoredChunks, opt.name)
 				e, ok := tpp.tableMap[opt.name]
 				if !ok {
 					e = tpp.tableList.PushBack(&TableProgress{
 						name:            opt.name,
-						progress:        0,
-						total:           opt.total,
+						progress:        restored,
+						total:           opt.total + restored,
 						state:           opt.state | TABLE_STATE_RESULT_FAIL_STRUCTURE_PASS,
 						totalStopUpdate: opt.totalStopUpdate,
 					})
@@ -273,12 +297,17 @@ func (tpp *TableProgressPrinter) serve() {
 				} else {
 					tp := e.Value.(*TableProgress)
 					tp.state ^= TABLE_STATE_REGISTER | opt.state
-					tp.progress = 0
-					tp.total = opt.total
+					tp.progress = restored
+					tp.total = opt.total + restored
 					tp.totalStopUpdate = opt.totalStopUpdate
 				}
 				if e.Value.(*TableProgress).state&TABLE_STATE_RESULT_FAIL_STRUCTURE_DONE == 0 {
-					tpp.total += opt.total
+					tpp.total += opt.total + restored
+					tpp.progress += restored
+					if restored > 0 {
+						// the restored progress isn't made by this run.
+						tpp.etaStartTime = time.Time{}
+					}
 				} else {
 					delete(tpp.tableMap, opt.name)
 				}
@@ -389,7 +418,22 @@ func (tpp *TableProgressPrinter) flush(stateIsChanged bool) {
 	coe := float32(tpp.progressTableNums*tpp.progress)/float32(tpp.tableNums*(tpp.total+1)) + float32(tpp.finishTableNums)/float32(tpp.tableNums)
 	numLeft := int(60 * coe)
 	percent := int(100 * coe)
-	fmt.Fprintf(tpp.output, "Progress [%s>%s] %d%% %d/%d\n", strings.Repeat("=", numLeft), strings.Repeat("-", 60-numLeft), percent, tpp.progress, tpp.total)
+	fmt.Fprintf(tpp.output, "Progress [%s>%s] %d%% %d/%d%s\n", strings.Repeat("=", numLeft), strings.Repeat("-", 60-numLeft), percent, tpp.progress, tpp.total, tpp.eta(coe))
+}
+
+// eta returns the estimated time to finish by the progress made in this run, it's empty if it can't be estimated yet.
+func (tpp *TableProgressPrinter) eta(coe float32) string {
+	if tpp.etaStartTime.IsZero() {
+		tpp.etaStartTime = time.Now()
+		tpp.etaStartProgress = coe
+		return ""
+	}
+	elapsed := time.Since(tpp.etaStartTime)
+	if elapsed < time.Second || coe <= tpp.etaStartProgress || coe >= 1 {
+		return ""
+	}
+	eta := time.Duration(float64(elapsed) * float64(1-coe) / float64(coe-tpp.etaStartProgress))
+	return fmt.Sprintf(" ETA %s", eta.Round(time.Second))
 }
 
 var progress_ *TableProgressPrinter = nil
@@ -422,6 +466,13 @@ func StartTable(name string, total int, stopUpdate bool) {
 	}
 }
 
+// RestoreTable restores the chunks of the table finished before the run is resumed from the checkpoint.
+func RestoreTable(name string, finishedChunks int) {
+	if progress_ != nil {
+		progress_.RestoreTable(name, finishedChunks)
+	}
+}
+
 func FailTable(name string) {
 	if progress_ != nil {
 		progress_.FailTable(name)
@@ -95,3 +95,18 @@ func TestAllSuccess(t *testing.T) {
 		"You can view the comparison details through './output_dir/sync_diff_inspector.log'\n\n",
 	)
 }
+
+func TestRestoreTable(t *testing.T) {
+	p := NewTableProgressPrinter(2, 1)
+	p.SetOutput(new(bytes.Buffer))
+	p.RestoreTable("2", 3)
+	p.RegisterTable("2", false, false)
+	p.StartTable("2", 2, true)
+	p.Inc("2")
+	p.Close()
+	tp := p.tableMap["2"].Value.(*TableProgress)
+	require.Equal(t, 4, tp.progress)
+	require.Equal(t, 5, tp.total)
+	require.Equal(t, 4, p.progress)
+	require.Equal(t, 5, p.total)
+}
@@ -0,0 +1,181 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/utils"
+)
+
+// the stages of the validation in DM.
+const (
+	DMStageRunning  = "Running"
+	DMStageStopped  = "Stopped"
+	DMStageFinished = "Finished"
+)
+
+const (
+	// the rows are compared by their full values, which is the `full` validation mode of DM.
+	dmValidationModeFull = "full"
+	dmValidatorID        = "sync_diff_inspector"
+)
+
+// DMValidationStatusResponse is the validation status in the shape of `dmctl validation status`,
+// so that the operators of DM get a unified view of the validation by sync_diff_inspector.
+type DMValidationStatusResponse struct {
+	Result        bool                       `json:"result"`
+	Msg           string                     `json:"msg"`
+	Validators    []*DMValidationStatus      `json:"validators"`
+	TableStatuses []*DMValidationTableStatus `json:"tableStatuses"`
+}
+
+// DMValidationStatus is the status of a validator of DM.
+type DMValidationStatus struct {
+	Task        string           `json:"task"`
+	Source      string           `json:"source"`
+	Mode        string           `json:"mode"`
+	Stage       string           `json:"stage"`
+	ValidatorID string           `json:"validatorID"`
+	Result      *DMProcessResult `json:"result"`
+	// the rows are counted as `insert/update/delete: %d/%d/%d`.
+	ProcessedRowsStatus string `json:"processedRowsStatus"`
+	PendingRowsStatus   string `json:"pendingRowsStatus"`
+	// the error rows are counted as a number.
+	NewErrorRowsStatus      string `json:"newErrorRowsStatus"`
+	IgnoredErrorRowsStatus  string `json:"ignoredErrorRowsStatus"`
+	ResolvedErrorRowsStatus string `json:"resolvedErrorRowsStatus"`
+	CutoverBinlogPos        string `json:"cutoverBinlogPos"`
+	CutoverBinlogGtid       string `json:"cutoverBinlogGtid"`
+}
+
+// DMProcessResult is the errors met by a validator of DM.
+type DMProcessResult struct {
+	IsCanceled bool              `json:"isCanceled"`
+	Errors     []*DMProcessError `json:"errors"`
+}
+
+// DMProcessError is an error met by a validator of DM.
+type DMProcessError struct {
+	Message  string `json:"message"`
+	RawCause string `json:"rawCause"`
+}
+
+// DMValidationTableStatus is the validation status of a table in DM.
+type DMValidationTableStatus struct {
+	Source   string `json:"source"`
+	SrcTable string `json:"srcTable"`
+	DstTable string `json:"dstTable"`
+	Stage    string `json:"stage"`
+	Message  string `json:"message"`
+}
+
+func formatDMRowsStatus(inserts, updates, deletes int64) string {
+	return fmt.Sprintf("insert/update/delete: %d/%d/%d", inserts, updates, deletes)
+}
+
+// GetDMValidationStatus returns the current results as the validation status of the DM task.
+// The compared rows are counted as processed inserts as the full data migration of DM does, and the different rows
+// are counted as new error rows. There are no pending rows since every chunk is compared only once.
+func (r *Report) GetDMValidationStatus(task string, sources []string) *DMValidationStatusResponse {
+	r.RLock()
+	defer r.RUnlock()
+	source := strings.Join(sources, ",")
+	var processedRows, errorRows int64
+	tableStatuses := make([]*DMValidationTableStatus, 0)
+	processErrors := make([]*DMProcessError, 0)
+	schemas := make([]string, 0, len(r.TableResults))
+	for schema := range r.TableResults {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+	for _, schema := range schemas {
+		tableMap := r.TableResults[schema]
+		tables := make([]string, 0, len(tableMap))
+		for table := range tableMap {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		for _, table := range tables {
+			result := tableMap[table]
+			tableErrorRows := int64(0)
+			for _, chunkResult := range result.ChunkMap {
+				tableErrorRows += int64(chunkResult.RowsAdd + chunkResult.RowsDelete)
+			}
+			processedRows += result.ProcessedRows
+			errorRows += tableErrorRows
+
+			tableName := dbutil.TableName(schema, table)
+			status := &DMValidationTableStatus{
+				Source:   source,
+				SrcTable: tableName,
+				DstTable: tableName,
+				Stage:    DMStageRunning,
+			}
+			if r.finished {
+				status.Stage = DMStageFinished
+			}
+			switch {
+			case result.MeetError != nil:
+				status.Stage = DMStageStopped
+				status.Message = utils.RedactSecrets(result.MeetError.Error())
+				processErrors = append(processErrors, &DMProcessError{
+					Message:  fmt.Sprintf("table %s meets error", tableName),
+					RawCause: utils.RedactSecrets(result.MeetError.Error()),
+				})
+			case !result.StructEqual:
+				status.Stage = DMStageStopped
+				status.Message = "the table structure is different"
+			case result.LargeTableAction == config.LargeTableSkip:
+				status.Stage = DMStageStopped
+				status.Message = "the table is skipped because it's larger than large-table-threshold"
+			case result.ExceedThreshold:
+				status.Stage = DMStageStopped
+				status.Message = fmt.Sprintf("the table is skipped after %d rows are different", tableErrorRows)
+			case tableErrorRows > 0:
+				status.Message = fmt.Sprintf("%d rows are different", tableErrorRows)
+			}
+			tableStatuses = append(tableStatuses, status)
+		}
+	}
+
+	stage := DMStageRunning
+	if r.finished {
+		stage = DMStageFinished
+	}
+	validator := &DMValidationStatus{
+		Task:                    task,
+		Source:                  source,
+		Mode:                    dmValidationModeFull,
+		Stage:                   stage,
+		ValidatorID:             dmValidatorID,
+		ProcessedRowsStatus:     formatDMRowsStatus(processedRows, 0, 0),
+		PendingRowsStatus:       formatDMRowsStatus(0, 0, 0),
+		NewErrorRowsStatus:      fmt.Sprintf("%d", errorRows),
+		IgnoredErrorRowsStatus:  "0",
+		ResolvedErrorRowsStatus: "0",
+	}
+	if len(processErrors) > 0 {
+		validator.Result = &DMProcessResult{Errors: processErrors}
+	}
+	return &DMValidationStatusResponse{
+		Result:        true,
+		Validators:    []*DMValidationStatus{validator},
+		TableStatuses: tableStatuses,
+	}
+}
@@ -18,9 +18,11 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -62,12 +64,92 @@ type TableResult struct {
 	DataEqual   bool                    `json:"data-equal"`
 	MeetError   error                   `json:"-"`
 	ChunkMap    map[string]*ChunkResult `json:"chunk-result"` // `ChunkMap` stores the `ChunkResult` of each chunk of the table
+	// TableStats is inlined in the json of the result.
+	TableStats
+}
+
+// TableStats records how the chunks of the table are compared besides the data check result,
+// it's copied as a whole when taking the snapshot of the result for the checkpoint.
+type TableStats struct {
+	// CountMismatch is true if the row counts of some chunks are different between upstream and downstream.
+	CountMismatch bool `json:"count-mismatch"`
+	// ErrorAction is the action taken by the on-error policy after the table meets error.
+	ErrorAction string `json:"error-action,omitempty"`
+	// FixedChunks and BrokenChunks are the numbers of chunks verified after applying the fix sql.
+	FixedChunks  int `json:"fixed-chunks,omitempty"`
+	BrokenChunks int `json:"broken-chunks,omitempty"`
+	// RecoveredChunks and RetryFailedChunks are the numbers of chunks failed by transient errors,
+	// which are compared successfully or failed again by the retry at the end of the run.
+	RecoveredChunks   int `json:"recovered-chunks,omitempty"`
+	RetryFailedChunks int `json:"retry-failed-chunks,omitempty"`
+	// RecheckEqualChunks and RecheckDiffChunks are the numbers of chunks with different checksums, which are
+	// equal or still different after the re-check of `recheck-delay` and `recheck-times`.
+	RecheckEqualChunks int `json:"recheck-equal-chunks,omitempty"`
+	RecheckDiffChunks  int `json:"recheck-diff-chunks,omitempty"`
+	// SampledChunks and UnsampledChunks are the numbers of chunks compared and skipped by `sample-percent`.
+	SampledChunks   int `json:"sampled-chunks,omitempty"`
+	UnsampledChunks int `json:"unsampled-chunks,omitempty"`
+	// ExceedDiffLimitChunks is the number of chunks whose different rows exceed `max-diff-rows-per-chunk`.
+	ExceedDiffLimitChunks int `json:"exceed-diff-limit-chunks,omitempty"`
+	// ExceedThreshold is true if the rest chunks of the table are skipped because the different rows
+	// or the failed chunks exceed `max-diff-rows-per-table` or `max-failed-chunks-per-table`, or the different rows
+	// of all the tables exceed `max-diff-rows-total`.
+	ExceedThreshold bool `json:"exceed-threshold,omitempty"`
+	// LargeTableAction is the action taken because the table is larger than `large-table-threshold`.
+	LargeTableAction string `json:"large-table-action,omitempty"`
+	// Notes records how the comparison of the table is adjusted, e.g. the ignored expression indexes.
+	Notes []string `json:"notes,omitempty"`
+	// ExtraColumns are the columns only in the downstream, which aren't compared because of `ignore-extra-columns`.
+	ExtraColumns []string `json:"extra-columns,omitempty"`
+	// QueryCheck is true if the result sets of the queries are compared instead of the table.
+	QueryCheck bool `json:"query-check,omitempty"`
+	// SlowQuery is the first chunk query of the table exceeding `slow-query-threshold`.
+	SlowQuery *SlowQueryResult `json:"slow-query,omitempty"`
+	// ProcessedRows is the number of the upstream rows compared by checksum so far.
+	ProcessedRows int64 `json:"processed-rows,omitempty"`
+	// DownstreamRows is the number of the downstream rows counted so far, it's only counted by `check-count-only`.
+	DownstreamRows int64 `json:"downstream-rows,omitempty"`
+	// Duration is the total time spent to compare the chunks of the table.
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// diffRows returns the numbers of the rows to add and delete of the table.
+func (t *TableResult) diffRows() (int, int) {
+	rowAdd, rowDelete := 0, 0
+	for _, chunkResult := range t.ChunkMap {
+		rowAdd += chunkResult.RowsAdd
+		rowDelete += chunkResult.RowsDelete
+	}
+	return rowAdd, rowDelete
+}
+
+// SlowQueryResult records the plan of a slow chunk query and the suggestion to speed it up.
+type SlowQueryResult struct {
+	// Kind is `checksum` or `rows`.
+	Kind       string        `json:"kind"`
+	Cost       time.Duration `json:"cost"`
+	Plan       string        `json:"plan"`
+	Suggestion string        `json:"suggestion"`
 }
 
 // ChunkResult save the necessarily information to provide summary information
 type ChunkResult struct {
 	RowsAdd    int `json:"rows-add"`    // `RowAdd` is the number of rows needed to add
 	RowsDelete int `json:"rows-delete"` // `RowDelete` is the number of rows needed to delete
+
+	// `CountMismatch` is true if the row counts of the chunk are different,
+	// even if the checksums are equal.
+	CountMismatch   bool  `json:"count-mismatch,omitempty"`
+	UpstreamCount   int64 `json:"upstream-count,omitempty"`
+	DownstreamCount int64 `json:"downstream-count,omitempty"`
+	// `ExceedDiffLimit` is true if the row-by-row comparison of the chunk stopped
+	// because of `max-diff-rows-per-chunk`, so `RowsAdd` and `RowsDelete` are incomplete.
+	ExceedDiffLimit bool `json:"exceed-diff-limit,omitempty"`
+	// `RowHashes` are the hashes of the full rows whose counts are different, see `full-row-hash`.
+	RowHashes []string `json:"row-hashes,omitempty"`
+	// `Range` and `IndexID` are the range of the failed chunk, which is re-checked by `--check-failed-only`.
+	Range   *chunk.Range `json:"range,omitempty"`
+	IndexID int64        `json:"index-id,omitempty"`
 }
 
 // Report saves the check results.
@@ -82,8 +164,109 @@ type Report struct {
 	TotalSize    int64                              `json:"-"` // Total size of the checked tables
 	SourceConfig [][]byte                           `json:"-"`
 	TargetConfig []byte                             `json:"-"`
+	// ChecksumAlgorithm is the algorithm of the checksum of the chunks, see `checksum-algorithm`.
+	ChecksumAlgorithm string `json:"checksum-algorithm,omitempty"`
+	// ChecksumOnly is true if only the checksums of the chunks are compared, so the different rows are unknown.
+	ChecksumOnly bool `json:"checksum-only,omitempty"`
+	// SamplePercent is the percentage of the chunks compared by `sample-percent`, 0 means all the chunks are compared.
+	SamplePercent int `json:"sample-percent,omitempty"`
 
 	task *config.TaskConfig `json:"-"`
+	// finished is true after the summary is committed.
+	finished bool
+	// failFastStopped is true if the comparison is stopped at the first different chunk by `fail-fast`,
+	// so the tables without difference may not be compared completely.
+	failFastStopped bool
+
+	// how the tables are listed in the summary, see `summary-filter`, `summary-sort-by` and `summary-collapse-passed`.
+	summaryFilter         string
+	summarySortBy         string
+	summaryCollapsePassed bool
+}
+
+// namedTableResult is the result of the table named by the key of TableResults.
+type namedTableResult struct {
+	schema string
+	table  string
+	result *TableResult
+}
+
+// SetChecksumAlgorithm sets the algorithm of the checksum of the chunks, which is shown in the summary.
+func (r *Report) SetChecksumAlgorithm(algorithm string) {
+	r.ChecksumAlgorithm = algorithm
+}
+
+// SetChecksumOnly sets whether only the checksums of the chunks are compared, then the numbers of
+// the different chunks are shown in the summary instead of the different rows.
+func (r *Report) SetChecksumOnly(checksumOnly bool) {
+	r.ChecksumOnly = checksumOnly
+}
+
+// SetSamplePercent sets the percentage of the chunks compared by the sampling, then the different chunks
+// of all the chunks are estimated in the summary.
+func (r *Report) SetSamplePercent(percent int) {
+	r.SamplePercent = percent
+}
+
+// SetFailFastStopped records that the comparison is stopped at the first different chunk by `fail-fast`.
+func (r *Report) SetFailFastStopped() {
+	r.Lock()
+	defer r.Unlock()
+	r.failFastStopped = true
+}
+
+// SetSummaryOptions sets how the tables are listed in the summary.
+func (r *Report) SetSummaryOptions(filter, sortBy string, collapsePassed bool) {
+	r.summaryFilter = filter
+	r.summarySortBy = sortBy
+	r.summaryCollapsePassed = collapsePassed
+}
+
+// getResultsByName returns the results of the tables in the order of the schema names, then the table names.
+// The raw names are compared, since the quoted ones put "`tbl2`" before "`tbl`".
+func (r *Report) getResultsByName() []*namedTableResult {
+	results := make([]*namedTableResult, 0)
+	for schema, tableMap := range r.TableResults {
+		for table, result := range tableMap {
+			results = append(results, &namedTableResult{schema: schema, table: table, result: result})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].schema != results[j].schema {
+			return results[i].schema < results[j].schema
+		}
+		return results[i].table < results[j].table
+	})
+	return results
+}
+
+// getSortedResults returns the results of the tables in the order of `summary-sort-by`,
+// the ties are broken by the table names.
+func (r *Report) getSortedResults() []*namedTableResult {
+	results := r.getResultsByName()
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch r.summarySortBy {
+		case config.SummarySortByDiffRows:
+			aAdd, aDelete := a.result.diffRows()
+			bAdd, bDelete := b.result.diffRows()
+			return aAdd+aDelete > bAdd+bDelete
+		case config.SummarySortByDuration:
+			return a.result.Duration > b.result.Duration
+		}
+		return false
+	})
+	return results
+}
+
+// displayName returns the name of the table in the summary, which is followed by the duration if the tables
+// are sorted by the durations.
+func (r *Report) displayName(res *namedTableResult) string {
+	name := dbutil.TableName(res.schema, res.table)
+	if r.summarySortBy == config.SummarySortByDuration {
+		name = fmt.Sprintf("%s (%s)", name, res.result.Duration.Round(time.Millisecond))
+	}
+	return name
 }
 
 // LoadReport loads the report from the checkpoint
@@ -103,48 +286,273 @@ func (r *Report) LoadReport(reportInfo *Report) {
 
 func (r *Report) getSortedTables() []string {
 	equalTables := make([]string, 0)
+	for _, res := range r.getSortedResults() {
+		if res.result.StructEqual && res.result.DataEqual {
+			equalTables = append(equalTables, r.displayName(res))
+		}
+	}
+	return equalTables
+}
+
+func (r *Report) getCountMismatchTables() []string {
+	tables := make([]string, 0)
 	for schema, tableMap := range r.TableResults {
 		for table, result := range tableMap {
-			if result.StructEqual && result.DataEqual {
-				equalTables = append(equalTables, dbutil.TableName(schema, table))
+			if result.CountMismatch {
+				tables = append(tables, dbutil.TableName(schema, table))
 			}
 		}
 	}
-	sort.Slice(equalTables, func(i, j int) bool { return equalTables[i] < equalTables[j] })
-	return equalTables
+	sort.Strings(tables)
+	return tables
 }
 
-func (r *Report) getDiffRows() [][]string {
-	diffRows := make([][]string, 0)
+func (r *Report) getExceedDiffLimitTables() []string {
+	tables := make([]string, 0)
 	for schema, tableMap := range r.TableResults {
 		for table, result := range tableMap {
-			if result.StructEqual && result.DataEqual {
-				continue
+			if result.ExceedDiffLimitChunks > 0 {
+				tables = append(tables, dbutil.TableName(schema, table))
 			}
-			diffRow := make([]string, 0)
-			diffRow = append(diffRow, dbutil.TableName(schema, table))
-			if !result.StructEqual {
-				diffRow = append(diffRow, "false")
-			} else {
-				diffRow = append(diffRow, "true")
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+func (r *Report) getExceedThresholdTables() []string {
+	tables := make([]string, 0)
+	for schema, tableMap := range r.TableResults {
+		for table, result := range tableMap {
+			if result.ExceedThreshold {
+				tables = append(tables, dbutil.TableName(schema, table))
+			}
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// getLargeTables returns the tables handled by the action because they are larger than `large-table-threshold`.
+func (r *Report) getLargeTables(action string) []string {
+	tables := make([]string, 0)
+	for schema, tableMap := range r.TableResults {
+		for table, result := range tableMap {
+			if result.LargeTableAction == action {
+				tables = append(tables, dbutil.TableName(schema, table))
 			}
-			rowAdd, rowDelete := 0, 0
-			for _, chunkResult := range result.ChunkMap {
-				rowAdd += chunkResult.RowsAdd
-				rowDelete += chunkResult.RowsDelete
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// getTableNotes returns the notes of the tables, in the format of `table: note`. The tables are in the order of
+// the names, and the notes of a table are kept in the order they are added.
+func (r *Report) getTableNotes() []string {
+	notes := make([]string, 0)
+	for _, res := range r.getResultsByName() {
+		for _, note := range res.result.Notes {
+			notes = append(notes, fmt.Sprintf("%s: %s", dbutil.TableName(res.schema, res.table), note))
+		}
+	}
+	return notes
+}
+
+func (r *Report) getSlowQueries() []string {
+	slowQueries := make([]string, 0)
+	for schema, tableMap := range r.TableResults {
+		for table, result := range tableMap {
+			if result.SlowQuery == nil {
+				continue
 			}
-			diffRow = append(diffRow, fmt.Sprintf("+%d/-%d", rowAdd, rowDelete))
-			diffRows = append(diffRows, diffRow)
+			slowQueries = append(slowQueries, fmt.Sprintf("%s: the %s query costs %s, %s\n%s\n",
+				dbutil.TableName(schema, table), result.SlowQuery.Kind, result.SlowQuery.Cost, result.SlowQuery.Suggestion, result.SlowQuery.Plan))
+		}
+	}
+	sort.Strings(slowQueries)
+	return slowQueries
+}
+
+func (r *Report) getFixVerificationRows() [][]string {
+	rows := make([][]string, 0)
+	for _, res := range r.getResultsByName() {
+		result := res.result
+		if result.FixedChunks+result.BrokenChunks == 0 {
+			continue
 		}
+		rows = append(rows, []string{dbutil.TableName(res.schema, res.table), strconv.Itoa(result.FixedChunks), strconv.Itoa(result.BrokenChunks)})
+	}
+	return rows
+}
+
+func (r *Report) getRetryRows() [][]string {
+	rows := make([][]string, 0)
+	for _, res := range r.getResultsByName() {
+		result := res.result
+		if result.RecoveredChunks+result.RetryFailedChunks == 0 {
+			continue
+		}
+		rows = append(rows, []string{dbutil.TableName(res.schema, res.table), strconv.Itoa(result.RecoveredChunks), strconv.Itoa(result.RetryFailedChunks)})
+	}
+	return rows
+}
+
+// getRecheckRows returns the numbers of the re-checked chunks of the tables, which are equal or still different.
+func (r *Report) getRecheckRows() [][]string {
+	rows := make([][]string, 0)
+	for _, res := range r.getResultsByName() {
+		result := res.result
+		if result.RecheckEqualChunks+result.RecheckDiffChunks == 0 {
+			continue
+		}
+		rows = append(rows, []string{dbutil.TableName(res.schema, res.table), strconv.Itoa(result.RecheckEqualChunks), strconv.Itoa(result.RecheckDiffChunks)})
+	}
+	return rows
+}
+
+// sampleConfidenceZ is the z-score of the 95% confidence, which the upper bound of the rate of the different chunks is estimated with.
+const sampleConfidenceZ = 1.96
+
+// estimateDiffChunks returns the estimated number of the different chunks of all the chunks by the different ones
+// of the sampled chunks, and the upper bound of the rate of the different chunks at 95% confidence by the Wilson
+// score interval, which is still meaningful if none of the sampled chunks is different.
+func estimateDiffChunks(sampled, diff, total int) (float64, float64) {
+	if sampled <= 0 {
+		return 0, 1
+	}
+	n, z := float64(sampled), sampleConfidenceZ
+	p := float64(diff) / n
+	upper := (p + z*z/(2*n) + z*math.Sqrt(p*(1-p)/n+z*z/(4*n*n))) / (1 + z*z/n)
+	return p * float64(total), math.Min(upper, 1)
+}
+
+// getSampleRows returns the sampled chunks of the tables, the different ones of them and the estimate of all the chunks,
+// in the order of the table names like the other per-table rows, whatever `summary-sort-by` is.
+func (r *Report) getSampleRows() [][]string {
+	rows := make([][]string, 0)
+	for _, res := range r.getResultsByName() {
+		result := res.result
+		if result.SampledChunks+result.UnsampledChunks == 0 {
+			continue
+		}
+		total := result.SampledChunks + result.UnsampledChunks
+		diffChunks := len(result.ChunkMap)
+		estimate, upper := estimateDiffChunks(result.SampledChunks, diffChunks, total)
+		rows = append(rows, []string{
+			dbutil.TableName(res.schema, res.table),
+			fmt.Sprintf("%d/%d", result.SampledChunks, total),
+			strconv.Itoa(diffChunks),
+			fmt.Sprintf("%.1f", estimate),
+			fmt.Sprintf("%.2f%%", upper*100),
+		})
+	}
+	return rows
+}
+
+func (r *Report) getDiffRows() [][]string {
+	diffRows := make([][]string, 0)
+	for _, res := range r.getSortedResults() {
+		result := res.result
+		if result.StructEqual && result.DataEqual {
+			continue
+		}
+		diffRow := make([]string, 0)
+		diffRow = append(diffRow, r.displayName(res))
+		if !result.StructEqual {
+			diffRow = append(diffRow, "false")
+		} else {
+			diffRow = append(diffRow, "true")
+		}
+		rowAdd, rowDelete := result.diffRows()
+		diffRow = append(diffRow, fmt.Sprintf("+%d/-%d", rowAdd, rowDelete))
+		diffRows = append(diffRows, diffRow)
 	}
 	return diffRows
 }
 
+// getPartitionDiffRows returns the different rows of the partitions of the failed tables split by partitions,
+// which are summed from the failed chunks in the partitions.
+func (r *Report) getPartitionDiffRows() [][]string {
+	rows := make([][]string, 0)
+	for _, res := range r.getSortedResults() {
+		type partitionDiff struct {
+			rowsAdd, rowsDelete, chunks int
+		}
+		partitions := make(map[string]*partitionDiff)
+		names := make([]string, 0)
+		for _, chunkResult := range res.result.ChunkMap {
+			if chunkResult.Range == nil || chunkResult.Range.Partition == "" {
+				continue
+			}
+			name := chunkResult.Range.Partition
+			if _, ok := partitions[name]; !ok {
+				partitions[name] = &partitionDiff{}
+				names = append(names, name)
+			}
+			partitions[name].rowsAdd += chunkResult.RowsAdd
+			partitions[name].rowsDelete += chunkResult.RowsDelete
+			partitions[name].chunks++
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			diff := partitions[name]
+			rows = append(rows, []string{
+				r.displayName(res),
+				name,
+				fmt.Sprintf("+%d/-%d", diff.rowsAdd, diff.rowsDelete),
+				strconv.Itoa(diff.chunks),
+			})
+		}
+	}
+	return rows
+}
+
+// getDiffChunkRows returns the numbers of the different chunks of the failed tables.
+func (r *Report) getDiffChunkRows() [][]string {
+	rows := make([][]string, 0)
+	for _, res := range r.getSortedResults() {
+		result := res.result
+		if result.StructEqual && result.DataEqual {
+			continue
+		}
+		rows = append(rows, []string{
+			r.displayName(res),
+			strconv.FormatBool(result.StructEqual),
+			strconv.Itoa(len(result.ChunkMap)),
+		})
+	}
+	return rows
+}
+
+// getCountDeltaRows returns the row counts of the failed tables and the deltas of the downstream to the upstream.
+func (r *Report) getCountDeltaRows() [][]string {
+	rows := make([][]string, 0)
+	for _, res := range r.getSortedResults() {
+		result := res.result
+		if result.StructEqual && result.DataEqual {
+			continue
+		}
+		rows = append(rows, []string{
+			r.displayName(res),
+			strconv.FormatBool(result.StructEqual),
+			strconv.FormatInt(result.ProcessedRows, 10),
+			strconv.FormatInt(result.DownstreamRows, 10),
+			fmt.Sprintf("%+d", result.DownstreamRows-result.ProcessedRows),
+		})
+	}
+	return rows
+}
+
 // CalculateTotalSize calculate the total size of all the checked tables
 // Notice, user should run the analyze table first, when some of tables' size are zero.
 func (r *Report) CalculateTotalSize(ctx context.Context, db *sql.DB) {
 	for schema, tableMap := range r.TableResults {
-		for table := range tableMap {
+		for table, result := range tableMap {
+			if result.QueryCheck {
+				// the result set of a query has no table size
+				continue
+			}
 			size, err := utils.GetTableSize(ctx, db, schema, table)
 			if err != nil {
 				r.SetTableMeetError(schema, table, err)
@@ -163,6 +571,10 @@ func (r *Report) CommitSummary() error {
 	passNum, failedNum := int32(0), int32(0)
 	for _, tableMap := range r.TableResults {
 		for _, result := range tableMap {
+			if result.LargeTableAction == config.LargeTableSkip {
+				// the data of the skipped large tables is not compared
+				continue
+			}
 			if result.StructEqual && result.DataEqual {
 				passNum++
 			} else {
@@ -172,6 +584,9 @@ func (r *Report) CommitSummary() error {
 	}
 	r.PassNum = passNum
 	r.FailedNum = failedNum
+	r.Lock()
+	r.finished = true
+	r.Unlock()
 	summaryPath := filepath.Join(r.task.OutputDir, "summary.txt")
 	summaryFile, err := os.Create(summaryPath)
 	if err != nil {
@@ -187,24 +602,167 @@ func (r *Report) CommitSummary() error {
 	summaryFile.WriteString("Target Databases\n\n\n\n")
 	summaryFile.Write(r.TargetConfig)
 	summaryFile.WriteString("\n")
+	switch r.ChecksumAlgorithm {
+	case "":
+	case config.ChecksumNone:
+		summaryFile.WriteString("Only the row counts are compared\n\n")
+	default:
+		summaryFile.WriteString("Checksum Algorithm\n\n\n\n")
+		summaryFile.WriteString(r.ChecksumAlgorithm + "\n\n")
+		if r.ChecksumOnly {
+			summaryFile.WriteString("Only the checksums are compared, the different rows are not compared\n\n")
+		}
+	}
 
 	summaryFile.WriteString("Comparison Result\n\n\n\n")
-	summaryFile.WriteString("The table structure and data in following tables are equivalent\n\n")
 	equalTables := r.getSortedTables()
-	for _, table := range equalTables {
-		summaryFile.WriteString(table + "\n")
+	switch {
+	case r.failFastStopped:
+		// the tables without difference may not be compared completely.
+		summaryFile.WriteString("The comparison is stopped at the first different chunk because of fail-fast, the rest chunks are not compared\n")
+	case r.summaryFilter == config.SummaryFilterFailed:
+		// only the failed and errored tables are listed.
+	case r.summaryCollapsePassed:
+		summaryFile.WriteString(fmt.Sprintf("The table structure and data in %d tables are equivalent\n", len(equalTables)))
+	default:
+		summaryFile.WriteString("The table structure and data in following tables are equivalent\n\n")
+		for _, table := range equalTables {
+			summaryFile.WriteString(table + "\n")
+		}
+	}
+	skippedLargeTables := r.getLargeTables(config.LargeTableSkip)
+	if len(skippedLargeTables) > 0 {
+		summaryFile.WriteString("\nThe data-check of following tables are skipped because they are larger than the large-table-threshold\n\n")
+		for _, table := range skippedLargeTables {
+			summaryFile.WriteString(table + "\n")
+		}
+	}
+	tableNotes := r.getTableNotes()
+	if len(tableNotes) > 0 {
+		summaryFile.WriteString("\nThe comparison of following tables are adjusted\n\n")
+		for _, note := range tableNotes {
+			summaryFile.WriteString(note + "\n")
+		}
+	}
+	retryRows := r.getRetryRows()
+	if len(retryRows) > 0 {
+		summaryFile.WriteString("\nThe chunks of following tables failed by transient errors are retried at the end of the run\n\n")
+		retryString := &strings.Builder{}
+		retryTable := tablewriter.NewWriter(retryString)
+		retryTable.SetHeader([]string{"Table", "Recovered chunks", "Still failed chunks"})
+		for _, v := range retryRows {
+			retryTable.Append(v)
+		}
+		retryTable.Render()
+		summaryFile.WriteString(retryString.String())
+	}
+	recheckRows := r.getRecheckRows()
+	if len(recheckRows) > 0 {
+		summaryFile.WriteString("\nThe chunks of following tables with different checksums are compared again after the delay\n\n")
+		recheckString := &strings.Builder{}
+		recheckTable := tablewriter.NewWriter(recheckString)
+		recheckTable.SetHeader([]string{"Table", "Equal after re-check", "Still different chunks"})
+		for _, v := range recheckRows {
+			recheckTable.Append(v)
+		}
+		recheckTable.Render()
+		summaryFile.WriteString(recheckString.String())
+	}
+	sampleRows := r.getSampleRows()
+	if len(sampleRows) > 0 {
+		summaryFile.WriteString(fmt.Sprintf("\nOnly %d%% of the chunks of following tables are sampled, the different chunks of all the chunks are estimated\n\n", r.SamplePercent))
+		sampleString := &strings.Builder{}
+		sampleTable := tablewriter.NewWriter(sampleString)
+		sampleTable.SetHeader([]string{"Table", "Sampled chunks", "Different chunks", "Estimated different chunks", "Different rate upper bound (95%)"})
+		for _, v := range sampleRows {
+			sampleTable.Append(v)
+		}
+		sampleTable.Render()
+		summaryFile.WriteString(sampleString.String())
+	}
+	slowQueries := r.getSlowQueries()
+	if len(slowQueries) > 0 {
+		summaryFile.WriteString("\nThe chunk queries of following tables are slow, the plans and index suggestions are\n\n")
+		for _, slowQuery := range slowQueries {
+			summaryFile.WriteString(slowQuery + "\n")
+		}
 	}
 	if r.Result == Fail {
 		summaryFile.WriteString("\nThe following tables contains inconsistent data\n\n")
 		tableString := &strings.Builder{}
 		table := tablewriter.NewWriter(tableString)
-		table.SetHeader([]string{"Table", "Structure equality", "Data diff rows"})
-		diffRows := r.getDiffRows()
-		for _, v := range diffRows {
-			table.Append(v)
+		switch {
+		case r.ChecksumAlgorithm == config.ChecksumNone:
+			// the different rows are unknown, only the counts are compared.
+			table.SetHeader([]string{"Table", "Structure equality", "Upstream rows", "Downstream rows", "Count delta"})
+			for _, v := range r.getCountDeltaRows() {
+				table.Append(v)
+			}
+		case r.ChecksumOnly:
+			// the different rows are unknown, only the different chunks are recorded.
+			table.SetHeader([]string{"Table", "Structure equality", "Different chunks"})
+			for _, v := range r.getDiffChunkRows() {
+				table.Append(v)
+			}
+		default:
+			table.SetHeader([]string{"Table", "Structure equality", "Data diff rows"})
+			diffRows := r.getDiffRows()
+			for _, v := range diffRows {
+				table.Append(v)
+			}
 		}
 		table.Render()
 		summaryFile.WriteString(tableString.String())
+
+		partitionRows := r.getPartitionDiffRows()
+		if len(partitionRows) > 0 {
+			summaryFile.WriteString("\nThe different rows of following tables are split by partitions\n\n")
+			partitionString := &strings.Builder{}
+			partitionTable := tablewriter.NewWriter(partitionString)
+			partitionTable.SetHeader([]string{"Table", "Partition", "Data diff rows", "Different chunks"})
+			for _, v := range partitionRows {
+				partitionTable.Append(v)
+			}
+			partitionTable.Render()
+			summaryFile.WriteString(partitionString.String())
+		}
+
+		fixRows := r.getFixVerificationRows()
+		if len(fixRows) > 0 {
+			summaryFile.WriteString("\nThe fix sql of following tables has been applied and verified\n\n")
+			fixString := &strings.Builder{}
+			fixTable := tablewriter.NewWriter(fixString)
+			fixTable.SetHeader([]string{"Table", "Verified fixed chunks", "Still broken chunks"})
+			for _, v := range fixRows {
+				fixTable.Append(v)
+			}
+			fixTable.Render()
+			summaryFile.WriteString(fixString.String())
+		}
+
+		countMismatchTables := r.getCountMismatchTables()
+		if len(countMismatchTables) > 0 {
+			summaryFile.WriteString("\nThe row count of following tables are not equal\n\n")
+			for _, table := range countMismatchTables {
+				summaryFile.WriteString(table + "\n")
+			}
+		}
+
+		exceedDiffLimitTables := r.getExceedDiffLimitTables()
+		if len(exceedDiffLimitTables) > 0 {
+			summaryFile.WriteString("\nThe following tables contains chunks exceeding the diff limit, the data diff rows are incomplete\n\n")
+			for _, table := range exceedDiffLimitTables {
+				summaryFile.WriteString(table + "\n")
+			}
+		}
+
+		exceedThresholdTables := r.getExceedThresholdTables()
+		if len(exceedThresholdTables) > 0 {
+			summaryFile.WriteString("\nThe data-check of following tables are stopped because the diffs exceed the threshold\n\n")
+			for _, table := range exceedThresholdTables {
+				summaryFile.WriteString(table + "\n")
+			}
+		}
 	}
 	duration := r.Duration + time.Since(r.StartTime)
 	summaryFile.WriteString(fmt.Sprintf("Time Cost: %s\n", duration))
@@ -216,31 +774,67 @@ func (r *Report) Print(w io.Writer) error {
 	var summary strings.Builder
 	if r.Result == Pass {
 		summary.WriteString(fmt.Sprintf("A total of %d table have been compared and all are equal.\n", r.FailedNum+r.PassNum))
+		if r.SamplePercent > 0 {
+			summary.WriteString(fmt.Sprintf("Only %d%% of the chunks are sampled, the estimate of the different chunks is in the summary\n", r.SamplePercent))
+		}
+		for _, table := range r.getLargeTables(config.LargeTableSkip) {
+			summary.WriteString(fmt.Sprintf("The data-check of %s is skipped because it is larger than the large-table-threshold\n", table))
+		}
 		summary.WriteString(fmt.Sprintf("You can view the comparision details through '%s/%s'\n", r.task.OutputDir, config.LogFileName))
 	} else if r.Result == Fail {
-		for schema, tableMap := range r.TableResults {
-			for table, result := range tableMap {
-				if !result.StructEqual {
-					if result.DataSkip {
-						summary.WriteString(fmt.Sprintf("The structure of %s is not equal, and data-check is skipped\n", dbutil.TableName(schema, table)))
-					} else {
-						summary.WriteString(fmt.Sprintf("The structure of %s is not equal\n", dbutil.TableName(schema, table)))
-					}
+		for _, res := range r.getSortedResults() {
+			schema, table, result := res.schema, res.table, res.result
+			if !result.StructEqual {
+				if result.DataSkip {
+					summary.WriteString(fmt.Sprintf("The structure of %s is not equal, and data-check is skipped\n", dbutil.TableName(schema, table)))
+				} else {
+					summary.WriteString(fmt.Sprintf("The structure of %s is not equal\n", dbutil.TableName(schema, table)))
 				}
-				if !result.DataEqual {
-					summary.WriteString(fmt.Sprintf("The data of %s is not equal\n", dbutil.TableName(schema, table)))
+			}
+			if !result.DataEqual {
+				summary.WriteString(fmt.Sprintf("The data of %s is not equal\n", dbutil.TableName(schema, table)))
+			}
+			if result.CountMismatch {
+				summary.WriteString(fmt.Sprintf("The row count of %s is not equal\n", dbutil.TableName(schema, table)))
+			}
+			if result.LargeTableAction == config.LargeTableSkip {
+				summary.WriteString(fmt.Sprintf("The data-check of %s is skipped because it is larger than the large-table-threshold\n", dbutil.TableName(schema, table)))
+			}
+			if result.ExceedThreshold {
+				summary.WriteString(fmt.Sprintf("The data-check of %s is stopped because the diffs exceed the threshold\n", dbutil.TableName(schema, table)))
+			}
+			if result.ExceedDiffLimitChunks > 0 {
+				summary.WriteString(fmt.Sprintf("%d chunks of %s exceed the diff limit\n", result.ExceedDiffLimitChunks, dbutil.TableName(schema, table)))
+			}
+			if result.FixedChunks+result.BrokenChunks > 0 {
+				if result.BrokenChunks == 0 {
+					summary.WriteString(fmt.Sprintf("The fix sql of %s has been applied and verified\n", dbutil.TableName(schema, table)))
+				} else {
+					summary.WriteString(fmt.Sprintf("The data of %s is still not equal after applying the fix sql\n", dbutil.TableName(schema, table)))
 				}
 			}
 		}
 		summary.WriteString("\n")
-		summary.WriteString("The rest of tables are all equal.\n")
+		if r.failFastStopped {
+			summary.WriteString("The comparison is stopped at the first difference because of fail-fast, the rest of tables are not compared completely.\n")
+		} else {
+			summary.WriteString("The rest of tables are all equal.\n")
+		}
 		summary.WriteString(fmt.Sprintf("The patch file has been generated in \n\t'%s/'\n", r.task.FixDir))
 		summary.WriteString(fmt.Sprintf("You can view the comparision details through '%s/%s'\n", r.task.OutputDir, config.LogFileName))
 	} else {
 		summary.WriteString("Error in comparison process:\n")
-		for schema, tableMap := range r.TableResults {
-			for table, result := range tableMap {
-				summary.WriteString(fmt.Sprintf("%s error occured in %s\n", result.MeetError.Error(), dbutil.TableName(schema, table)))
+		for _, res := range r.getSortedResults() {
+			schema, table, result := res.schema, res.table, res.result
+			if result.MeetError == nil {
+				continue
+			}
+			summary.WriteString(fmt.Sprintf("%s error occured in %s\n", utils.RedactSecrets(result.MeetError.Error()), dbutil.TableName(schema, table)))
+			if result.RetryFailedChunks > 0 {
+				summary.WriteString(fmt.Sprintf("%d chunks of %s still failed after the retry at the end of the run\n", result.RetryFailedChunks, dbutil.TableName(schema, table)))
+			}
+			if result.ErrorAction == config.OnErrorSkipTable {
+				summary.WriteString(fmt.Sprintf("The rest data-check of %s is skipped\n", dbutil.TableName(schema, table)))
 			}
 		}
 		summary.WriteString(fmt.Sprintf("You can view the comparision details through '%s/%s'\n", r.task.OutputDir, config.LogFileName))
@@ -274,6 +868,10 @@ func (r *Report) Init(tableDiffs []*common.TableDiff, sourceConfig [][]byte, tar
 			DataEqual:   true,
 			MeetError:   nil,
 			ChunkMap:    make(map[string]*ChunkResult),
+			TableStats: TableStats{
+				Notes:      tableDiff.Notes,
+				QueryCheck: tableDiff.Query != "",
+			},
 		}
 	}
 }
@@ -314,6 +912,244 @@ func (r *Report) SetTableDataCheckResult(schema, table string, equal bool, rowsA
 	}
 }
 
+// SetChunkRange records the range of the failed chunk, so that the chunk can be re-checked alone.
+func (r *Report) SetChunkRange(schema, table string, chunkRange *chunk.Range, indexID int64) {
+	r.Lock()
+	defer r.Unlock()
+	result := r.TableResults[schema][table]
+	id := chunkRange.Index.ToString()
+	if _, ok := result.ChunkMap[id]; !ok {
+		result.ChunkMap[id] = &ChunkResult{}
+	}
+	result.ChunkMap[id].Range = chunkRange.Clone()
+	result.ChunkMap[id].IndexID = indexID
+}
+
+// GetFailedChunks returns whether the table failed, and the failed chunks of the table in the order of the chunk id
+// if the table can be re-checked by them, or nil if the whole table should be re-checked, e.g. its structure is
+// different, it met an error, or some of its chunks are skipped or have no saved range.
+func (r *Report) GetFailedChunks(schema, table string) (bool, []*ChunkResult) {
+	r.RLock()
+	defer r.RUnlock()
+	result, ok := r.TableResults[schema][table]
+	if !ok || result.LargeTableAction == config.LargeTableSkip {
+		return false, nil
+	}
+	// a table meeting an error may still be marked as equal, so the errors are checked first.
+	if !result.StructEqual || result.MeetError != nil || len(result.ErrorAction) > 0 ||
+		result.ExceedThreshold || result.RetryFailedChunks > 0 {
+		return true, nil
+	}
+	if result.DataEqual {
+		return false, nil
+	}
+	if len(result.ChunkMap) == 0 {
+		return true, nil
+	}
+	ids := make([]*chunk.ChunkID, 0, len(result.ChunkMap))
+	for key, chunkResult := range result.ChunkMap {
+		id := &chunk.ChunkID{}
+		if chunkResult.Range == nil || id.FromString(key) != nil {
+			return true, nil
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Compare(ids[j]) < 0
+	})
+	chunks := make([]*ChunkResult, 0, len(ids))
+	for _, id := range ids {
+		chunks = append(chunks, result.ChunkMap[id.ToString()])
+	}
+	return true, chunks
+}
+
+// SetTableCountMismatch records that the row counts of the chunk are different between upstream and downstream.
+func (r *Report) SetTableCountMismatch(schema, table string, upstreamCount, downstreamCount int64, id *chunk.ChunkID) {
+	r.Lock()
+	defer r.Unlock()
+	result := r.TableResults[schema][table]
+	result.DataEqual = false
+	result.CountMismatch = true
+	if _, ok := result.ChunkMap[id.ToString()]; !ok {
+		result.ChunkMap[id.ToString()] = &ChunkResult{}
+	}
+	chunkResult := result.ChunkMap[id.ToString()]
+	chunkResult.CountMismatch = true
+	chunkResult.UpstreamCount = upstreamCount
+	chunkResult.DownstreamCount = downstreamCount
+	if r.Result != Error {
+		r.Result = Fail
+	}
+}
+
+// SetChunkExceedDiffLimit records that the different rows of the chunk exceed `max-diff-rows-per-chunk`.
+func (r *Report) SetChunkExceedDiffLimit(schema, table string, id *chunk.ChunkID) {
+	r.Lock()
+	defer r.Unlock()
+	result := r.TableResults[schema][table]
+	result.DataEqual = false
+	result.ExceedDiffLimitChunks++
+	if _, ok := result.ChunkMap[id.ToString()]; !ok {
+		result.ChunkMap[id.ToString()] = &ChunkResult{}
+	}
+	result.ChunkMap[id.ToString()].ExceedDiffLimit = true
+	if r.Result != Error {
+		r.Result = Fail
+	}
+}
+
+// SetChunkRowHashes records the hashes of the full rows whose counts are different in the chunk.
+func (r *Report) SetChunkRowHashes(schema, table string, id *chunk.ChunkID, hashes []string) {
+	r.Lock()
+	defer r.Unlock()
+	result := r.TableResults[schema][table]
+	if _, ok := result.ChunkMap[id.ToString()]; !ok {
+		result.ChunkMap[id.ToString()] = &ChunkResult{}
+	}
+	result.ChunkMap[id.ToString()].RowHashes = hashes
+}
+
+// SetTableExceedThreshold records that the rest chunks of the table are skipped because the diffs exceed the threshold.
+func (r *Report) SetTableExceedThreshold(schema, table string) {
+	r.Lock()
+	defer r.Unlock()
+	result := r.TableResults[schema][table]
+	result.DataEqual = false
+	result.ExceedThreshold = true
+	if r.Result != Error {
+		r.Result = Fail
+	}
+}
+
+// SetTableLargeTableAction records the action taken because the table is larger than `large-table-threshold`.
+func (r *Report) SetTableLargeTableAction(schema, table string, action string) {
+	r.Lock()
+	defer r.Unlock()
+	if result, ok := r.TableResults[schema][table]; ok {
+		result.LargeTableAction = action
+	}
+}
+
+// SetTableSlowQuery records the slow chunk query of the table, only the first one is kept.
+func (r *Report) SetTableSlowQuery(schema, table string, slowQuery *SlowQueryResult) {
+	r.Lock()
+	defer r.Unlock()
+	if result, ok := r.TableResults[schema][table]; ok && result.SlowQuery == nil {
+		result.SlowQuery = slowQuery
+	}
+}
+
+// SetTableExtraColumns records the columns only in the downstream which aren't compared, and notes them.
+// It's set only once, since the structure is compared again when resuming from the checkpoint.
+func (r *Report) SetTableExtraColumns(schema, table string, columns []string) {
+	r.Lock()
+	defer r.Unlock()
+	if result, ok := r.TableResults[schema][table]; ok && len(result.ExtraColumns) == 0 {
+		result.ExtraColumns = columns
+		notes := make([]string, 0, len(result.Notes)+1)
+		result.Notes = append(append(notes, result.Notes...), fmt.Sprintf("extra columns %s of the downstream are not compared", strings.Join(columns, ",")))
+	}
+}
+
+// AddTableNote appends a note about how the comparison of the table is adjusted, the notes of the table are
+// listed in the summary in the order they are added.
+func (r *Report) AddTableNote(schema, table string, note string) {
+	r.Lock()
+	defer r.Unlock()
+	if result, ok := r.TableResults[schema][table]; ok {
+		// the notes may be shared with the snapshots, so append to a copy.
+		notes := make([]string, 0, len(result.Notes)+1)
+		result.Notes = append(append(notes, result.Notes...), note)
+	}
+}
+
+// AddTableProcessedRows adds the number of the upstream rows compared by the checksum of a chunk.
+func (r *Report) AddTableProcessedRows(schema, table string, rows int64) {
+	r.Lock()
+	defer r.Unlock()
+	if result, ok := r.TableResults[schema][table]; ok {
+		result.ProcessedRows += rows
+	}
+}
+
+// AddTableDownstreamRows adds the number of the downstream rows counted in a chunk.
+func (r *Report) AddTableDownstreamRows(schema, table string, rows int64) {
+	r.Lock()
+	defer r.Unlock()
+	if result, ok := r.TableResults[schema][table]; ok {
+		result.DownstreamRows += rows
+	}
+}
+
+// IsTableEqual returns true if the struct and the data of the table are checked and equal.
+func (r *Report) IsTableEqual(schema, table string) bool {
+	r.RLock()
+	defer r.RUnlock()
+	result, ok := r.TableResults[schema][table]
+	if !ok {
+		return false
+	}
+	return result.StructEqual && result.DataEqual && !result.DataSkip && !result.ExceedThreshold && result.MeetError == nil
+}
+
+// SetChunkFixVerified sets whether the chunk is equal after applying the fix sql.
+func (r *Report) SetChunkFixVerified(schema, table string, fixed bool) {
+	r.Lock()
+	defer r.Unlock()
+	result := r.TableResults[schema][table]
+	if fixed {
+		result.FixedChunks++
+	} else {
+		result.BrokenChunks++
+	}
+}
+
+// AddTableDuration adds the time spent to compare a chunk of the table.
+func (r *Report) AddTableDuration(schema, table string, duration time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	if result, ok := r.TableResults[schema][table]; ok {
+		result.Duration += duration
+	}
+}
+
+// SetChunkRetried records the outcome of the retry of a chunk failed by a transient error.
+func (r *Report) SetChunkRetried(schema, table string, recovered bool) {
+	r.Lock()
+	defer r.Unlock()
+	result := r.TableResults[schema][table]
+	if recovered {
+		result.RecoveredChunks++
+	} else {
+		result.RetryFailedChunks++
+	}
+}
+
+// SetChunkSampled records whether the chunk is compared or skipped by the sampling.
+func (r *Report) SetChunkSampled(schema, table string, sampled bool) {
+	r.Lock()
+	defer r.Unlock()
+	result := r.TableResults[schema][table]
+	if sampled {
+		result.SampledChunks++
+	} else {
+		result.UnsampledChunks++
+	}
+}
+
+// SetChunkRechecked records the result of the chunk compared again after the delay because its checksums were different.
+func (r *Report) SetChunkRechecked(schema, table string, equal bool) {
+	r.Lock()
+	defer r.Unlock()
+	result := r.TableResults[schema][table]
+	if equal {
+		result.RecheckEqualChunks++
+	} else {
+		result.RecheckDiffChunks++
+	}
+}
+
 // SetTableMeetError sets meet error when check the table.
 func (r *Report) SetTableMeetError(schema, table string, err error) {
 	r.Lock()
@@ -330,54 +1166,105 @@ func (r *Report) SetTableMeetError(schema, table string, err error) {
 	r.Result = Error
 }
 
+// SetTableErrorAction records the action taken by the on-error policy after the table meets error.
+func (r *Report) SetTableErrorAction(schema, table string, action string) {
+	r.Lock()
+	defer r.Unlock()
+	if result, ok := r.TableResults[schema][table]; ok {
+		result.ErrorAction = action
+	}
+}
+
 // GetSnapshot get the snapshot of the current state of the report, then we can restart the
 // sync-diff and get the correct report state.
 func (r *Report) GetSnapshot(chunkID *chunk.ChunkID, schema, table string) (*Report, error) {
 	r.RLock()
 	defer r.RUnlock()
 	targetID := utils.UniqueID(schema, table)
+	targetDeferred := isDeferred(r.TableResults[schema][table])
 	reserveMap := make(map[string]map[string]*TableResult)
 	for schema, tableMap := range r.TableResults {
 		reserveMap[schema] = make(map[string]*TableResult)
 		for table, result := range tableMap {
 			reportID := utils.UniqueID(schema, table)
-			if reportID >= targetID {
-				chunkRes := make(map[string]*ChunkResult)
-				reserveMap[schema][table] = &TableResult{
-					Schema:      result.Schema,
-					Table:       result.Table,
-					StructEqual: result.StructEqual,
-					DataEqual:   result.DataEqual,
-					MeetError:   result.MeetError,
-				}
-				for id, chunkResult := range result.ChunkMap {
-					sid := new(chunk.ChunkID)
-					err := sid.FromString(id)
-					if err != nil {
-						return nil, errors.Trace(err)
-					}
-					if sid.Compare(chunkID) <= 0 {
-						chunkRes[id] = chunkResult
-					}
+			// the tables are compared in descending order of the unique id,
+			// and the deferred large tables are compared after all the other tables.
+			deferred := isDeferred(result)
+			if (deferred == targetDeferred && reportID >= targetID) || (!deferred && targetDeferred) {
+				snapshot, err := result.snapshot(chunkID)
+				if err != nil {
+					return nil, errors.Trace(err)
 				}
-				reserveMap[schema][table].ChunkMap = chunkRes
+				reserveMap[schema][table] = snapshot
+			}
+		}
+	}
+	return r.newSnapshot(reserveMap), nil
+}
+
+// GetTablesSnapshot gets the snapshot of the tables up to their own checked chunks, which are keyed by the schema
+// and the table. The tables without the checked chunk are left out, since they are checked from the beginning
+// after resuming.
+func (r *Report) GetTablesSnapshot(chunkIDs map[string]map[string]*chunk.ChunkID) (*Report, error) {
+	r.RLock()
+	defer r.RUnlock()
+	reserveMap := make(map[string]map[string]*TableResult)
+	for schema, tableMap := range r.TableResults {
+		reserveMap[schema] = make(map[string]*TableResult)
+		for table, result := range tableMap {
+			chunkID, ok := chunkIDs[schema][table]
+			if !ok {
+				continue
+			}
+			snapshot, err := result.snapshot(chunkID)
+			if err != nil {
+				return nil, errors.Trace(err)
 			}
+			reserveMap[schema][table] = snapshot
 		}
 	}
+	return r.newSnapshot(reserveMap), nil
+}
 
-	result := r.Result
-	totalSize := r.TotalSize
-	duration := time.Since(r.StartTime)
-	task := r.task
+// snapshot returns a copy of the result with the chunks up to the chunk id.
+func (t *TableResult) snapshot(chunkID *chunk.ChunkID) (*TableResult, error) {
+	chunkRes := make(map[string]*ChunkResult)
+	for id, chunkResult := range t.ChunkMap {
+		sid := new(chunk.ChunkID)
+		err := sid.FromString(id)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if sid.Compare(chunkID) <= 0 {
+			chunkRes[id] = chunkResult
+		}
+	}
+	return &TableResult{
+		Schema:      t.Schema,
+		Table:       t.Table,
+		StructEqual: t.StructEqual,
+		DataEqual:   t.DataEqual,
+		MeetError:   t.MeetError,
+		ChunkMap:    chunkRes,
+		TableStats:  t.TableStats,
+	}, nil
+}
+
+// newSnapshot returns the snapshot of the report with the table results, it's called with the read lock.
+func (r *Report) newSnapshot(tableResults map[string]map[string]*TableResult) *Report {
 	return &Report{
 		PassNum:      0,
 		FailedNum:    0,
-		Result:       result,
-		TableResults: reserveMap,
+		Result:       r.Result,
+		TableResults: tableResults,
 		StartTime:    r.StartTime,
-		Duration:     duration,
-		TotalSize:    totalSize,
+		Duration:     time.Since(r.StartTime),
+		TotalSize:    r.TotalSize,
 
-		task: task,
-	}, nil
+		task: r.task,
+	}
+}
+
+func isDeferred(result *TableResult) bool {
+	return result != nil && result.LargeTableAction == config.LargeTableDefer
 }
@@ -17,9 +17,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -256,6 +258,278 @@ func TestPrint(t *testing.T) {
 		"You can view the comparision details through 'output_dir/sync_diff.log'\n")
 }
 
+// newTestReport returns the report of the tables `test`.`tbl`, `test`.`tbl2`... with the equal structures.
+func newTestReport(t *testing.T, taskConfig *config.TaskConfig, tableCount int) *Report {
+	report := NewReport(taskConfig)
+	createTableSQL := "create table `test`.`tbl`(`a` int, `b` varchar(10), primary key(`a`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+
+	tableDiffs := make([]*common.TableDiff, 0, tableCount)
+	for i := 0; i < tableCount; i++ {
+		table := "tbl"
+		if i > 0 {
+			table = fmt.Sprintf("tbl%d", i+1)
+		}
+		tableDiffs = append(tableDiffs, &common.TableDiff{Schema: "test", Table: table, Info: tableInfo, Collation: "[123]"})
+	}
+	report.Init(tableDiffs, [][]byte{[]byte("123")}, []byte("456"))
+	for _, tableDiff := range tableDiffs {
+		report.SetTableStructCheckResult(tableDiff.Schema, tableDiff.Table, true, false)
+	}
+	return report
+}
+
+func TestCountMismatch(t *testing.T) {
+	report := newTestReport(t, task, 1)
+
+	id := &chunk.ChunkID{0, 0, 0, 0, 1}
+	report.SetTableCountMismatch("test", "tbl", 10, 9, id)
+	report.SetTableDataCheckResult("test", "tbl", false, 1, 0, id)
+	require.Equal(t, Fail, report.Result)
+
+	result := report.TableResults["test"]["tbl"]
+	require.False(t, result.DataEqual)
+	require.True(t, result.CountMismatch)
+	chunkResult := result.ChunkMap[id.ToString()]
+	require.True(t, chunkResult.CountMismatch)
+	require.Equal(t, int64(10), chunkResult.UpstreamCount)
+	require.Equal(t, int64(9), chunkResult.DownstreamCount)
+	require.Equal(t, 1, chunkResult.RowsAdd)
+	require.Equal(t, []string{"`test`.`tbl`"}, report.getCountMismatchTables())
+
+	buf := new(bytes.Buffer)
+	report.Print(buf)
+	require.Contains(t, buf.String(), "The row count of `test`.`tbl` is not equal\n")
+}
+
+func TestCountOnly(t *testing.T) {
+	report := newTestReport(t, &config.TaskConfig{OutputDir: "./", FixDir: task.FixDir}, 2)
+	report.SetChecksumAlgorithm(config.ChecksumNone)
+
+	id := &chunk.ChunkID{0, 0, 0, 0, 1}
+	report.AddTableProcessedRows("test", "tbl", 10)
+	report.AddTableDownstreamRows("test", "tbl", 8)
+	report.SetTableCountMismatch("test", "tbl", 10, 8, id)
+	report.SetTableDataCheckResult("test", "tbl", false, 0, 0, id)
+	report.AddTableProcessedRows("test", "tbl2", 5)
+	report.AddTableDownstreamRows("test", "tbl2", 5)
+	report.SetTableDataCheckResult("test", "tbl2", true, 0, 0, id)
+	require.Equal(t, [][]string{{"`test`.`tbl`", "true", "10", "8", "-2"}}, report.getCountDeltaRows())
+
+	require.NoError(t, report.CommitSummary())
+	filename := path.Join("./", "summary.txt")
+	defer os.Remove(filename)
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "Only the row counts are compared\n\n")
+	require.Contains(t, string(data), "COUNT DELTA")
+	require.NotContains(t, string(data), "DATA DIFF ROWS")
+}
+
+func TestFailFastStopped(t *testing.T) {
+	report := newTestReport(t, &config.TaskConfig{OutputDir: "./", FixDir: task.FixDir}, 2)
+	report.SetTableDataCheckResult("test", "tbl", false, 1, 0, &chunk.ChunkID{0, 0, 0, 0, 1})
+	report.SetFailFastStopped()
+
+	require.NoError(t, report.CommitSummary())
+	filename := path.Join("./", "summary.txt")
+	defer os.Remove(filename)
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "The comparison is stopped at the first different chunk because of fail-fast")
+	require.NotContains(t, string(data), "The table structure and data in following tables are equivalent")
+
+	buf := new(bytes.Buffer)
+	report.Print(buf)
+	require.Contains(t, buf.String(), "The data of `test`.`tbl` is not equal\n")
+	require.Contains(t, buf.String(), "the rest of tables are not compared completely.\n")
+	require.NotContains(t, buf.String(), "The rest of tables are all equal.")
+}
+
+func TestChecksumOnly(t *testing.T) {
+	report := newTestReport(t, &config.TaskConfig{OutputDir: "./", FixDir: task.FixDir}, 2)
+	report.SetChecksumAlgorithm(config.ChecksumCRC32)
+	report.SetChecksumOnly(true)
+
+	report.SetTableDataCheckResult("test", "tbl", false, 0, 0, &chunk.ChunkID{0, 0, 0, 0, 3})
+	report.SetTableDataCheckResult("test", "tbl", false, 0, 0, &chunk.ChunkID{0, 0, 0, 2, 3})
+	report.SetTableDataCheckResult("test", "tbl2", true, 0, 0, &chunk.ChunkID{1, 0, 0, 0, 1})
+	require.Equal(t, Fail, report.Result)
+	require.Equal(t, [][]string{{"`test`.`tbl`", "true", "2"}}, report.getDiffChunkRows())
+
+	require.NoError(t, report.CommitSummary())
+	filename := path.Join("./", "summary.txt")
+	defer os.Remove(filename)
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "Only the checksums are compared, the different rows are not compared\n\n")
+	require.Contains(t, string(data), "DIFFERENT CHUNKS")
+	require.NotContains(t, string(data), "DATA DIFF ROWS")
+}
+
+func TestExceedDiffLimit(t *testing.T) {
+	report := newTestReport(t, task, 1)
+
+	id := &chunk.ChunkID{0, 0, 0, 0, 1}
+	report.SetChunkExceedDiffLimit("test", "tbl", id)
+	report.SetTableDataCheckResult("test", "tbl", false, 11, 0, id)
+	require.Equal(t, Fail, report.Result)
+
+	result := report.TableResults["test"]["tbl"]
+	require.False(t, result.DataEqual)
+	require.Equal(t, 1, result.ExceedDiffLimitChunks)
+	chunkResult := result.ChunkMap[id.ToString()]
+	require.True(t, chunkResult.ExceedDiffLimit)
+	require.Equal(t, 11, chunkResult.RowsAdd)
+	require.Equal(t, []string{"`test`.`tbl`"}, report.getExceedDiffLimitTables())
+
+	buf := new(bytes.Buffer)
+	report.Print(buf)
+	require.Contains(t, buf.String(), "1 chunks of `test`.`tbl` exceed the diff limit\n")
+}
+
+func TestExceedThreshold(t *testing.T) {
+	report := newTestReport(t, task, 2)
+	report.SetTableExceedThreshold("test", "tbl")
+	require.Equal(t, Fail, report.Result)
+	require.False(t, report.TableResults["test"]["tbl"].DataEqual)
+	require.True(t, report.TableResults["test"]["tbl2"].DataEqual)
+	require.Equal(t, []string{"`test`.`tbl`"}, report.getExceedThresholdTables())
+
+	buf := new(bytes.Buffer)
+	report.Print(buf)
+	require.Contains(t, buf.String(), "The data-check of `test`.`tbl` is stopped because the diffs exceed the threshold\n")
+}
+
+func TestErrorAction(t *testing.T) {
+	report := newTestReport(t, task, 2)
+	report.SetTableMeetError("test", "tbl", errors.New("123"))
+	report.SetTableErrorAction("test", "tbl", config.OnErrorSkipTable)
+	require.Equal(t, Error, report.Result)
+	require.Equal(t, config.OnErrorSkipTable, report.TableResults["test"]["tbl"].ErrorAction)
+
+	buf := new(bytes.Buffer)
+	report.Print(buf)
+	require.Equal(t, "Error in comparison process:\n"+
+		"123 error occured in `test`.`tbl`\n"+
+		"The rest data-check of `test`.`tbl` is skipped\n"+
+		"You can view the comparision details through 'output_dir/sync_diff.log'\n", buf.String())
+}
+
+func TestGetFailedChunks(t *testing.T) {
+	report := newTestReport(t, task, 4)
+
+	newRange := func(chunkIndex int, lower, upper string) *chunk.Range {
+		r := chunk.NewChunkRange()
+		r.Update("a", lower, upper, true, true)
+		r.Index = &chunk.ChunkID{TableIndex: 0, ChunkIndex: chunkIndex, ChunkCnt: 10}
+		return r
+	}
+	// the failed chunks of tbl are returned in the order of the chunk id.
+	for _, r := range []*chunk.Range{newRange(5, "50", "60"), newRange(2, "20", "30")} {
+		report.SetTableDataCheckResult("test", "tbl", false, 1, 0, r.Index)
+		report.SetChunkRange("test", "tbl", r, 1)
+	}
+	// the failed chunk of tbl3 has no range, so the whole table is re-checked.
+	report.SetTableDataCheckResult("test", "tbl3", false, 1, 0, newRange(1, "10", "20").Index)
+	// tbl4 met an error.
+	report.SetTableMeetError("test", "tbl4", errors.New("123"))
+
+	isFailed, chunks := report.GetFailedChunks("test", "tbl")
+	require.True(t, isFailed)
+	require.Len(t, chunks, 2)
+	require.Equal(t, 2, chunks[0].Range.Index.ChunkIndex)
+	require.Equal(t, "20", chunks[0].Range.Bounds[0].Lower)
+	require.Equal(t, int64(1), chunks[0].IndexID)
+	require.Equal(t, 5, chunks[1].Range.Index.ChunkIndex)
+
+	isFailed, chunks = report.GetFailedChunks("test", "tbl2")
+	require.False(t, isFailed)
+	require.Nil(t, chunks)
+	for _, table := range []string{"tbl3", "tbl4"} {
+		isFailed, chunks = report.GetFailedChunks("test", table)
+		require.True(t, isFailed)
+		require.Nil(t, chunks)
+	}
+}
+
+func TestFixVerification(t *testing.T) {
+	report := newTestReport(t, task, 2)
+	report.SetTableDataCheckResult("test", "tbl", false, 1, 0, &chunk.ChunkID{0, 0, 0, 0, 2})
+	report.SetTableDataCheckResult("test", "tbl", false, 0, 1, &chunk.ChunkID{0, 0, 0, 1, 2})
+	report.SetTableDataCheckResult("test", "tbl2", false, 1, 1, &chunk.ChunkID{1, 0, 0, 0, 1})
+
+	report.SetChunkFixVerified("test", "tbl", true)
+	report.SetChunkFixVerified("test", "tbl", true)
+	report.SetChunkFixVerified("test", "tbl2", false)
+	require.Equal(t, [][]string{{"`test`.`tbl`", "2", "0"}, {"`test`.`tbl2`", "0", "1"}}, report.getFixVerificationRows())
+
+	buf := new(bytes.Buffer)
+	report.Print(buf)
+	require.Contains(t, buf.String(), "The fix sql of `test`.`tbl` has been applied and verified\n")
+	require.Contains(t, buf.String(), "The data of `test`.`tbl2` is still not equal after applying the fix sql\n")
+}
+
+func TestRetryChunks(t *testing.T) {
+	report := newTestReport(t, task, 2)
+	report.SetTableDataCheckResult("test", "tbl", true, 0, 0, &chunk.ChunkID{0, 0, 0, 0, 1})
+	report.SetChunkRetried("test", "tbl", true)
+	report.SetChunkRetried("test", "tbl2", true)
+	report.SetChunkRetried("test", "tbl2", false)
+	report.SetTableMeetError("test", "tbl2", errors.New("invalid connection"))
+	require.Equal(t, [][]string{{"`test`.`tbl`", "1", "0"}, {"`test`.`tbl2`", "1", "1"}}, report.getRetryRows())
+
+	buf := new(bytes.Buffer)
+	report.Print(buf)
+	require.Contains(t, buf.String(), "1 chunks of `test`.`tbl2` still failed after the retry at the end of the run\n")
+	require.NotContains(t, buf.String(), "`test`.`tbl` still failed")
+}
+
+func TestRecheck(t *testing.T) {
+	report := newTestReport(t, &config.TaskConfig{OutputDir: "./", FixDir: task.FixDir}, 2)
+	report.SetChunkRechecked("test", "tbl", true)
+	report.SetChunkRechecked("test", "tbl", true)
+	report.SetChunkRechecked("test", "tbl2", false)
+	report.SetTableDataCheckResult("test", "tbl2", false, 1, 0, &chunk.ChunkID{1, 0, 0, 0, 1})
+	require.Equal(t, [][]string{{"`test`.`tbl`", "2", "0"}, {"`test`.`tbl2`", "0", "1"}}, report.getRecheckRows())
+
+	require.NoError(t, report.CommitSummary())
+	filename := path.Join("./", "summary.txt")
+	defer os.Remove(filename)
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "EQUAL AFTER RE-CHECK")
+}
+
+func TestSample(t *testing.T) {
+	report := newTestReport(t, &config.TaskConfig{OutputDir: "./", FixDir: task.FixDir}, 2)
+	report.SetSamplePercent(10)
+	for i := 0; i < 100; i++ {
+		report.SetChunkSampled("test", "tbl", i%10 == 0)
+		report.SetChunkSampled("test", "tbl2", i%10 == 0)
+	}
+	report.SetTableDataCheckResult("test", "tbl2", false, 1, 0, &chunk.ChunkID{1, 0, 0, 0, 1})
+	require.Equal(t, [][]string{
+		{"`test`.`tbl`", "10/100", "0", "0.0", "27.75%"},
+		{"`test`.`tbl2`", "10/100", "1", "10.0", "40.42%"},
+	}, report.getSampleRows())
+	// the rows are not reordered by the diff rows.
+	report.SetSummaryOptions(config.SummaryFilterAll, config.SummarySortByDiffRows, false)
+	require.Equal(t, "`test`.`tbl`", report.getSampleRows()[0][0])
+
+	estimate, upper := estimateDiffChunks(0, 0, 100)
+	require.Equal(t, float64(0), estimate)
+	require.Equal(t, float64(1), upper)
+
+	require.NoError(t, report.CommitSummary())
+	filename := path.Join("./", "summary.txt")
+	defer os.Remove(filename)
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "Only 10% of the chunks of following tables are sampled")
+}
+
 func TestGetSnapshot(t *testing.T) {
 	report := NewReport(task)
 	createTableSQL1 := "create table `test`.`tbl`(`a` int, `b` varchar(10), `c` float, `d` datetime, primary key(`a`, `b`))"
@@ -372,6 +646,145 @@ func TestGetSnapshot(t *testing.T) {
 	}
 }
 
+func TestLargeTables(t *testing.T) {
+	report := NewReport(task)
+	createTableSQL := "create table `test`.`tbl`(`a` int, `b` varchar(10), primary key(`a`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+
+	tableDiffs := []*common.TableDiff{
+		{
+			Schema: "xtest",
+			Table:  "tbl",
+			Info:   tableInfo,
+		},
+		{
+			Schema: "test",
+			Table:  "tbl",
+			Info:   tableInfo,
+		},
+		{
+			Schema:     "ztest",
+			Table:      "tbl",
+			Info:       tableInfo,
+			LargeTable: true,
+		},
+		{
+			Schema:     "atest",
+			Table:      "tbl",
+			Info:       tableInfo,
+			LargeTable: true,
+		},
+	}
+	report.Init(tableDiffs, [][]byte{[]byte("123")}, []byte("456"))
+	report.SetTableLargeTableAction("ztest", "tbl", config.LargeTableDefer)
+	report.SetTableLargeTableAction("atest", "tbl", config.LargeTableSkip)
+	for _, tableDiff := range tableDiffs {
+		report.SetTableStructCheckResult(tableDiff.Schema, tableDiff.Table, true, false)
+	}
+	require.Equal(t, []string{"`ztest`.`tbl`"}, report.getLargeTables(config.LargeTableDefer))
+	require.Equal(t, []string{"`atest`.`tbl`"}, report.getLargeTables(config.LargeTableSkip))
+
+	// the deferred table is compared after all the other tables
+	snap, err := report.GetSnapshot(&chunk.ChunkID{1, 0, 0, 0, 1}, "test", "tbl")
+	require.NoError(t, err)
+	require.Contains(t, snap.TableResults["xtest"], "tbl")
+	require.Contains(t, snap.TableResults["test"], "tbl")
+	require.NotContains(t, snap.TableResults["ztest"], "tbl")
+	snap, err = report.GetSnapshot(&chunk.ChunkID{2, 0, 0, 0, 1}, "ztest", "tbl")
+	require.NoError(t, err)
+	require.Contains(t, snap.TableResults["xtest"], "tbl")
+	require.Contains(t, snap.TableResults["test"], "tbl")
+	require.Contains(t, snap.TableResults["ztest"], "tbl")
+
+	buf := new(bytes.Buffer)
+	report.Print(buf)
+	require.Contains(t, buf.String(), "The data-check of `atest`.`tbl` is skipped because it is larger than the large-table-threshold\n")
+}
+
+func TestGetTablesSnapshot(t *testing.T) {
+	report := NewReport(task)
+	createTableSQL := "create table `test`.`tbl`(`a` int, `b` varchar(10), primary key(`a`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+
+	tableDiffs := []*common.TableDiff{
+		{Schema: "test", Table: "tbl1", Info: tableInfo},
+		{Schema: "test", Table: "tbl2", Info: tableInfo},
+		{Schema: "test", Table: "tbl3", Info: tableInfo},
+	}
+	report.Init(tableDiffs, [][]byte{[]byte("123")}, []byte("456"))
+	report.SetTableDataCheckResult("test", "tbl1", false, 1, 1, &chunk.ChunkID{0, 0, 0, 3, 10})
+	report.SetTableDataCheckResult("test", "tbl2", false, 1, 1, &chunk.ChunkID{1, 0, 0, 1, 10})
+	report.SetTableDataCheckResult("test", "tbl2", false, 1, 1, &chunk.ChunkID{1, 0, 0, 5, 10})
+	report.SetChunkFixVerified("test", "tbl2", true)
+
+	// each table is kept up to its own chunk, the tables without the chunk are left out.
+	snap, err := report.GetTablesSnapshot(map[string]map[string]*chunk.ChunkID{
+		"test": {
+			"tbl1": {0, 0, 0, 1, 10},
+			"tbl2": {1, 0, 0, 3, 10},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, snap.TableResults["test"], 2)
+	require.Len(t, snap.TableResults["test"]["tbl1"].ChunkMap, 0)
+	require.Len(t, snap.TableResults["test"]["tbl2"].ChunkMap, 1)
+	require.Contains(t, snap.TableResults["test"]["tbl2"].ChunkMap, "1:0-0:1:10")
+	// the stats of the table are kept as a whole
+	require.Equal(t, 1, snap.TableResults["test"]["tbl2"].FixedChunks)
+	require.NotContains(t, snap.TableResults["test"], "tbl3")
+}
+
+func TestTableNotes(t *testing.T) {
+	report := NewReport(task)
+	createTableSQL := "create table `test`.`tbl`(`a` int, `b` varchar(10), unique key uk(`b`(4)))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+
+	tableDiffs := []*common.TableDiff{
+		{
+			Schema: "test",
+			Table:  "tbl",
+			Info:   tableInfo,
+			Notes:  []string{"prefix index uk is split by the full column values"},
+		},
+		{
+			Schema: "atest",
+			Table:  "tbl",
+			Info:   tableInfo,
+		},
+	}
+	report.Init(tableDiffs, [][]byte{[]byte("123")}, []byte("456"))
+	require.Equal(t, []string{"`test`.`tbl`: prefix index uk is split by the full column values"}, report.getTableNotes())
+
+	snap, err := report.GetSnapshot(&chunk.ChunkID{0, 0, 0, 0, 1}, "test", "tbl")
+	require.NoError(t, err)
+	require.Equal(t, tableDiffs[0].Notes, snap.TableResults["test"]["tbl"].Notes)
+
+	report.AddTableNote("test", "tbl", "checksum timed out 3 times, the rest chunks are compared row by row")
+	require.Equal(t, []string{
+		"`test`.`tbl`: prefix index uk is split by the full column values",
+		"`test`.`tbl`: checksum timed out 3 times, the rest chunks are compared row by row",
+	}, report.getTableNotes())
+	// the tables are listed by the names, and the notes of a table in the order they are added.
+	report.AddTableNote("atest", "tbl", "checksum timed out 3 times, the rest chunks are compared row by row")
+	require.Equal(t, []string{
+		"`atest`.`tbl`: checksum timed out 3 times, the rest chunks are compared row by row",
+		"`test`.`tbl`: prefix index uk is split by the full column values",
+		"`test`.`tbl`: checksum timed out 3 times, the rest chunks are compared row by row",
+	}, report.getTableNotes())
+	// the snapshot is not affected
+	require.Equal(t, tableDiffs[0].Notes, snap.TableResults["test"]["tbl"].Notes)
+
+	require.True(t, report.IsTableEqual("test", "tbl"))
+	report.SetTableDataCheckResult("test", "tbl", false, 1, 0, &chunk.ChunkID{0, 0, 0, 0, 1})
+	require.False(t, report.IsTableEqual("test", "tbl"))
+	report.SetTableStructCheckResult("atest", "tbl", true, true)
+	require.False(t, report.IsTableEqual("atest", "tbl"))
+	require.False(t, report.IsTableEqual("xtest", "tbl"))
+}
+
 func TestCommitSummary(t *testing.T) {
 	outputDir := "./"
 	report := NewReport(&config.TaskConfig{OutputDir: outputDir, FixDir: task.FixDir})
@@ -481,4 +894,118 @@ func TestCommitSummary(t *testing.T) {
 	file.Close()
 	err = os.Remove(filename)
 	require.NoError(t, err)
+
+	// the algorithm of the checksum follows the databases.
+	report.SetChecksumAlgorithm(config.ChecksumSHA1)
+	require.NoError(t, report.CommitSummary())
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "user = \"root\"\n\n"+
+		"Checksum Algorithm\n\n\n\n"+
+		"sha1\n\n"+
+		"Comparison Result\n\n\n\n")
+	require.NoError(t, os.Remove(filename))
+}
+
+func TestSummaryOptions(t *testing.T) {
+	report := NewReport(&config.TaskConfig{OutputDir: "./", FixDir: task.FixDir})
+	createTableSQL := "create table `test`.`tbl`(`a` int, `b` varchar(10), primary key(`a`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	tableDiffs := []*common.TableDiff{
+		{Schema: "test", Table: "tbl1", Info: tableInfo, Collation: "[123]"},
+		{Schema: "test", Table: "tbl2", Info: tableInfo, Collation: "[123]"},
+		{Schema: "test", Table: "tbl3", Info: tableInfo, Collation: "[123]"},
+		{Schema: "test", Table: "tbl4", Info: tableInfo, Collation: "[123]"},
+	}
+	report.Init(tableDiffs, [][]byte{[]byte("")}, []byte(""))
+	for _, tableDiff := range tableDiffs {
+		report.SetTableStructCheckResult(tableDiff.Schema, tableDiff.Table, true, false)
+	}
+	report.SetTableDataCheckResult("test", "tbl1", false, 1, 0, &chunk.ChunkID{0, 0, 0, 0, 1})
+	report.SetTableDataCheckResult("test", "tbl2", false, 10, 5, &chunk.ChunkID{1, 0, 0, 0, 1})
+	report.AddTableDuration("test", "tbl3", 2*time.Second)
+	report.AddTableDuration("test", "tbl4", time.Second)
+	report.AddTableDuration("test", "tbl4", 2*time.Second)
+
+	// the tables are sorted by the names by default.
+	require.Equal(t, []string{"`test`.`tbl3`", "`test`.`tbl4`"}, report.getSortedTables())
+	diffRows := report.getDiffRows()
+	require.Equal(t, 2, len(diffRows))
+	require.Equal(t, "`test`.`tbl1`", diffRows[0][0])
+	require.Equal(t, "`test`.`tbl2`", diffRows[1][0])
+
+	report.SetSummaryOptions(config.SummaryFilterAll, config.SummarySortByDiffRows, false)
+	diffRows = report.getDiffRows()
+	require.Equal(t, []string{"`test`.`tbl2`", "true", "+10/-5"}, diffRows[0])
+	require.Equal(t, []string{"`test`.`tbl1`", "true", "+1/-0"}, diffRows[1])
+
+	report.SetSummaryOptions(config.SummaryFilterAll, config.SummarySortByDuration, false)
+	require.Equal(t, []string{"`test`.`tbl4` (3s)", "`test`.`tbl3` (2s)"}, report.getSortedTables())
+
+	filename := path.Join("./", "summary.txt")
+	defer os.Remove(filename)
+	report.SetSummaryOptions(config.SummaryFilterAll, config.SummarySortByName, true)
+	require.NoError(t, report.CommitSummary())
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "The table structure and data in 2 tables are equivalent\n")
+	require.NotContains(t, string(data), "`test`.`tbl3`")
+
+	report.SetSummaryOptions(config.SummaryFilterFailed, config.SummarySortByName, false)
+	require.NoError(t, report.CommitSummary())
+	data, err = os.ReadFile(filename)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "are equivalent")
+	require.NotContains(t, string(data), "`test`.`tbl3`")
+	require.Contains(t, string(data), "`test`.`tbl1`")
+}
+
+func TestDMValidationStatus(t *testing.T) {
+	report := NewReport(task)
+	createTableSQL := "create table `test`.`tbl`(`a` int, `b` varchar(10), primary key(`a`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+
+	tableDiffs := []*common.TableDiff{
+		{Schema: "test", Table: "tbl", Info: tableInfo},
+		{Schema: "test", Table: "tbl2", Info: tableInfo},
+		{Schema: "atest", Table: "tbl", Info: tableInfo},
+	}
+	report.Init(tableDiffs, [][]byte{[]byte("123")}, []byte("456"))
+	report.AddTableProcessedRows("test", "tbl", 100)
+	report.AddTableProcessedRows("test", "tbl", 50)
+	report.AddTableProcessedRows("atest", "tbl", 10)
+	report.SetTableDataCheckResult("test", "tbl", false, 2, 1, &chunk.ChunkID{0, 0, 0, 0, 1})
+	report.SetTableMeetError("test", "tbl2", errors.New("123"))
+
+	status := report.GetDMValidationStatus("task", []string{"mysql-01", "mysql-02"})
+	require.True(t, status.Result)
+	require.Len(t, status.Validators, 1)
+	validator := status.Validators[0]
+	require.Equal(t, "task", validator.Task)
+	require.Equal(t, "mysql-01,mysql-02", validator.Source)
+	require.Equal(t, DMStageRunning, validator.Stage)
+	require.Equal(t, "insert/update/delete: 160/0/0", validator.ProcessedRowsStatus)
+	require.Equal(t, "insert/update/delete: 0/0/0", validator.PendingRowsStatus)
+	require.Equal(t, "3", validator.NewErrorRowsStatus)
+	require.Len(t, validator.Result.Errors, 1)
+	require.Equal(t, "123", validator.Result.Errors[0].RawCause)
+
+	require.Equal(t, []*DMValidationTableStatus{
+		{Source: "mysql-01,mysql-02", SrcTable: "`atest`.`tbl`", DstTable: "`atest`.`tbl`", Stage: DMStageRunning},
+		{Source: "mysql-01,mysql-02", SrcTable: "`test`.`tbl`", DstTable: "`test`.`tbl`", Stage: DMStageRunning, Message: "3 rows are different"},
+		{Source: "mysql-01,mysql-02", SrcTable: "`test`.`tbl2`", DstTable: "`test`.`tbl2`", Stage: DMStageStopped, Message: "123"},
+	}, status.TableStatuses)
+
+	// the processed rows are kept in the checkpoint
+	snap, err := report.GetSnapshot(&chunk.ChunkID{0, 0, 0, 0, 1}, "atest", "tbl")
+	require.NoError(t, err)
+	require.Equal(t, int64(150), snap.TableResults["test"]["tbl"].ProcessedRows)
+
+	report.finished = true
+	status = report.GetDMValidationStatus("task", []string{"mysql-01"})
+	require.Equal(t, DMStageFinished, status.Validators[0].Stage)
+	require.Equal(t, DMStageFinished, status.TableStatuses[0].Stage)
+	require.Equal(t, DMStageStopped, status.TableStatuses[2].Stage)
 }
@@ -0,0 +1,187 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/source"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/source/common"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/splitter"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/utils"
+	"go.uber.org/zap"
+)
+
+// rowHashReader reads the hashes of the full rows and their counts in the order of the hashes,
+// the counts of the same hash read from the different shards are summed.
+type rowHashReader struct {
+	iter source.RowDataIterator
+	next map[string]*dbutil.ColumnData
+}
+
+// Next returns the next hash and its count, the hash is empty if there are no more rows.
+func (r *rowHashReader) Next() (string, int64, error) {
+	if r.next == nil {
+		row, err := r.iter.Next()
+		if err != nil || row == nil {
+			return "", 0, errors.Trace(err)
+		}
+		r.next = row
+	}
+	hash := string(r.next[utils.RowHashColumn].Data)
+	var count int64
+	for r.next != nil && string(r.next[utils.RowHashColumn].Data) == hash {
+		n, err := strconv.ParseInt(string(r.next[utils.RowCountColumn].Data), 10, 64)
+		if err != nil {
+			return "", 0, errors.Trace(err)
+		}
+		count += n
+		if r.next, err = r.iter.Next(); err != nil {
+			return "", 0, errors.Trace(err)
+		}
+	}
+	return hash, count, nil
+}
+
+// compareRowHash compares the hashes read from upstream and downstream, the empty hash
+// means there are no more rows, so it's greater than any hash.
+func compareRowHash(upstreamHash, downstreamHash string) int {
+	switch {
+	case upstreamHash == downstreamHash:
+		return 0
+	case downstreamHash == "" || (upstreamHash != "" && upstreamHash < downstreamHash):
+		return -1
+	default:
+		return 1
+	}
+}
+
+// compareRowHashes compares the hashes of the full rows and their counts of the table without primary key
+// or unique key, so the duplicate rows are compared as a multiset. The rows of the different hashes are fetched
+// to generate the fix sql, which inserts or deletes the row as many times as the counts differ.
+func (df *Diff) compareRowHashes(ctx context.Context, rangeInfo *splitter.RangeInfo, dml *ChunkDML) (bool, error) {
+	upstreamRowsIterator, err := df.upstream.GetRowsIterator(ctx, rangeInfo)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer upstreamRowsIterator.Close()
+	beginTime := time.Now()
+	downstreamRowsIterator, err := df.downstream.GetRowsIterator(ctx, rangeInfo)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer downstreamRowsIterator.Close()
+	df.checkSlowQuery(ctx, rangeInfo, slowRowsQuery, time.Since(beginTime))
+
+	tableDiff := df.workSource.GetTables()[rangeInfo.GetTableIndex()]
+	upstreamHashes := &rowHashReader{iter: upstreamRowsIterator}
+	downstreamHashes := &rowHashReader{iter: downstreamRowsIterator}
+	upstreamHash, upstreamCount, err := upstreamHashes.Next()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	downstreamHash, downstreamCount, err := downstreamHashes.Next()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	equal := true
+	for (upstreamHash != "" || downstreamHash != "") && !df.exceedDiffLimit(dml) {
+		var (
+			hash                   string
+			upstreamN, downstreamN int64
+		)
+		cmp := compareRowHash(upstreamHash, downstreamHash)
+		if cmp <= 0 {
+			hash, upstreamN = upstreamHash, upstreamCount
+			if upstreamHash, upstreamCount, err = upstreamHashes.Next(); err != nil {
+				return false, errors.Trace(err)
+			}
+		}
+		if cmp >= 0 {
+			hash, downstreamN = downstreamHash, downstreamCount
+			if downstreamHash, downstreamCount, err = downstreamHashes.Next(); err != nil {
+				return false, errors.Trace(err)
+			}
+		}
+		if upstreamN == downstreamN {
+			continue
+		}
+		equal = false
+		log.Debug("the count of the row hash is different", zap.String("table", dbutil.TableName(tableDiff.Schema, tableDiff.Table)),
+			zap.String("row hash", hash), zap.Int64("upstream count", upstreamN), zap.Int64("downstream count", downstreamN))
+		dml.rowHashes = append(dml.rowHashes, hash)
+		if err := df.generateRowHashFixSQL(ctx, rangeInfo, tableDiff, dml, hash, upstreamN-downstreamN); err != nil {
+			return false, errors.Trace(err)
+		}
+	}
+	if df.exceedDiffLimit(dml) {
+		// the fix sqls of the chunk are incomplete, so drop them instead of fixing the chunk partially.
+		dml.exceedDiffLimit = true
+		dml.sqls = nil
+		dml.events = nil
+	}
+	return equal, nil
+}
+
+// generateRowHashFixSQL fetches the row of the hash, and generates the sqls inserting it `diff` times
+// if `diff` is positive, or deleting it `-diff` times if `diff` is negative.
+func (df *Diff) generateRowHashFixSQL(ctx context.Context, rangeInfo *splitter.RangeInfo, tableDiff *common.TableDiff, dml *ChunkDML, hash string, diff int64) error {
+	t, s, times := source.Insert, df.upstream, diff
+	if diff < 0 {
+		t, s, times = source.Delete, df.downstream, -diff
+	}
+	rowRange := rangeInfo.Copy()
+	rowRange.ChunkRange.Where = utils.RowHashExpression(tableDiff.Info) + " = ?"
+	rowRange.ChunkRange.Args = []interface{}{hash}
+	rowRange.FullColumns = true
+	iter, err := s.GetRowsIterator(ctx, rowRange)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer iter.Close()
+	row, err := iter.Next()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if row == nil {
+		return errors.Errorf("the row of hash %s is not found when fetching its values, it may be changed during the comparison", hash)
+	}
+
+	var upstreamData, downstreamData map[string]*dbutil.ColumnData
+	if t == source.Insert {
+		upstreamData = row
+	} else {
+		downstreamData = row
+	}
+	sql := df.downstream.GenerateFixSQL(t, upstreamData, downstreamData, rangeInfo.GetTableIndex())
+	for i := int64(0); i < times && !df.exceedDiffLimit(dml); i++ {
+		if df.diffEvents != nil {
+			if err := df.encodeDiffEvent(tableDiff, dml, t, upstreamData, downstreamData); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		dml.sqls = append(dml.sqls, sql)
+		if t == source.Insert {
+			dml.rowAdd++
+		} else {
+			dml.rowDelete++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/checkpoints"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/progress"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/splitter"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/utils"
+)
+
+// sampling returns whether only a part of the chunks are compared, the failed chunks of the last run
+// are always compared.
+func (df *Diff) sampling() bool {
+	return df.sample > 0 && df.sample < 100 && df.failedChunks == nil
+}
+
+// sampleChunk returns whether the chunk is chosen to be compared, and records it in the report.
+// The chunk is chosen by the hash of the seed, the table and the chunk id, so the same chunks are chosen
+// by the runs with the same seed, and the chunks after the checkpoint are chosen again after resuming.
+func (df *Diff) sampleChunk(rangeInfo *splitter.RangeInfo) bool {
+	if !df.sampling() {
+		return true
+	}
+	tableDiff := df.downstream.GetTables()[rangeInfo.GetTableIndex()]
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%s/%s", df.sampleSeed, utils.UniqueID(tableDiff.Schema, tableDiff.Table), rangeInfo.ChunkRange.Index.ToString())
+	sampled := h.Sum64()%100 < uint64(df.sample)
+	df.report.SetChunkSampled(tableDiff.Schema, tableDiff.Table, sampled)
+	return sampled
+}
+
+// skipUnsampledChunk passes the chunk not chosen by the sampling to the checkpoint without comparing it.
+func (df *Diff) skipUnsampledChunk(rangeInfo *splitter.RangeInfo) {
+	dml := &ChunkDML{
+		node: rangeInfo.ToNode(),
+	}
+	dml.node.State = checkpoints.IgnoreState
+	df.sqlCh <- dml
+	progress.Inc(rangeInfo.ProgressID)
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/checkpoints"
+	flag "github.com/spf13/pflag"
+)
+
+// runShowCheckpoint handles `sync_diff_inspector show-checkpoint <output-dir or checkpoint file>`, which prints
+// the finished tables, the failed chunks and where the comparison is resumed, and returns the exit code.
+func runShowCheckpoint(args []string) int {
+	fs := flag.NewFlagSet("show-checkpoint", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sync_diff_inspector show-checkpoint <output-dir or checkpoint file>")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if errors.Cause(err) == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	fileName := fs.Arg(0)
+	if info, err := os.Stat(fileName); err == nil && info.IsDir() {
+		fileName = filepath.Join(fileName, "checkpoint", checkpointFile)
+	}
+	state, err := checkpoints.ReadSavedState(context.Background(), checkpoints.NewFileStorage(fileName))
+	if err != nil {
+		fmt.Printf("Fail to read the checkpoint %s.\n%s\n", fileName, err.Error())
+		return 1
+	}
+	fmt.Printf("Checkpoint: %s\n", fileName)
+	if err := state.Print(os.Stdout); err != nil {
+		fmt.Printf("Fail to print the checkpoint.\n%s\n", err.Error())
+		return 1
+	}
+	return 0
+}
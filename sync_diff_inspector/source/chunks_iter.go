@@ -20,6 +20,7 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/chunk"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/progress"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/source/common"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/splitter"
@@ -36,71 +37,46 @@ type ChunksIterator struct {
 	chunksCh       chan *splitter.RangeInfo
 	errCh          chan error
 	limit          int
+	// tableThreadCount is the number of tables produce chunks concurrently.
+	tableThreadCount int
 
 	cancel context.CancelFunc
 }
 
-func NewChunksIterator(ctx context.Context, analyzer TableAnalyzer, tableDiffs []*common.TableDiff, startRange *splitter.RangeInfo) (*ChunksIterator, error) {
+// NewChunksIterator returns the iterator of the chunks of the tables, the chunks of each table start after its
+// range in startRanges, which is keyed by the table index.
+func NewChunksIterator(ctx context.Context, analyzer TableAnalyzer, tableDiffs []*common.TableDiff, startRanges map[int]*splitter.RangeInfo, tableThreadCount int) (*ChunksIterator, error) {
 	ctxx, cancel := context.WithCancel(ctx)
+	if tableThreadCount <= 0 {
+		tableThreadCount = config.DefaultTableThreadCount
+	}
 	iter := &ChunksIterator{
-		tableAnalyzer: analyzer,
-		TableDiffs:    tableDiffs,
-		chunksCh:      make(chan *splitter.RangeInfo, 64),
-		errCh:         make(chan error, len(tableDiffs)),
-		cancel:        cancel,
+		tableAnalyzer:    analyzer,
+		TableDiffs:       tableDiffs,
+		chunksCh:         make(chan *splitter.RangeInfo, 64),
+		errCh:            make(chan error, len(tableDiffs)),
+		tableThreadCount: tableThreadCount,
+		cancel:           cancel,
 	}
-	go iter.produceChunks(ctxx, startRange)
+	go iter.produceChunks(ctxx, startRanges)
 	return iter, nil
 }
 
-func (t *ChunksIterator) produceChunks(ctx context.Context, startRange *splitter.RangeInfo) {
+func (t *ChunksIterator) produceChunks(ctx context.Context, startRanges map[int]*splitter.RangeInfo) {
 	defer close(t.chunksCh)
-	pool := utils.NewWorkerPool(3, "chunks producer")
-	t.nextTableIndex = 0
+	// the chunks of `tableThreadCount` tables are sent to the same channel,
+	// so they are interleaved and small tables are not blocked by a huge one.
+	pool := utils.NewWorkerPool(uint(t.tableThreadCount), "chunks producer")
 
-	// If chunkRange
-	if startRange != nil {
-		curIndex := startRange.GetTableIndex()
-		curTable := t.TableDiffs[curIndex]
-		t.nextTableIndex = curIndex + 1
-		// if this chunk is empty, data-check for this table should be skipped
-		if startRange.ChunkRange.Type != chunk.Empty {
-			pool.Apply(func() {
-				chunkIter, err := t.tableAnalyzer.AnalyzeSplitter(ctx, curTable, startRange)
-				if err != nil {
-					t.errCh <- errors.Trace(err)
-					return
-				}
-				defer chunkIter.Close()
-				for {
-					c, err := chunkIter.Next()
-					if err != nil {
-						t.errCh <- errors.Trace(err)
-						return
-					}
-					if c == nil {
-						break
-					}
-					c.Index.TableIndex = curIndex
-					select {
-					case <-ctx.Done():
-						log.Info("Stop do produce chunks by context done")
-						return
-					case t.chunksCh <- &splitter.RangeInfo{
-						ChunkRange: c,
-						IndexID:    getCurTableIndexID(chunkIter),
-						ProgressID: dbutil.TableName(curTable.Schema, curTable.Table),
-					}:
-					}
-				}
-			})
-		}
-	}
-
-	for ; t.nextTableIndex < len(t.TableDiffs); t.nextTableIndex++ {
+	for t.nextTableIndex = 0; t.nextTableIndex < len(t.TableDiffs); t.nextTableIndex++ {
 		curTableIndex := t.nextTableIndex
+		startRange := startRanges[curTableIndex]
+		if startRange != nil && isTableFinished(startRange) {
+			// all the chunks of the table have been checked before resuming.
+			continue
+		}
 		// skip data-check, but still need to send a empty chunk to make checkpoint continuous
-		if t.TableDiffs[curTableIndex].IgnoreDataCheck {
+		if startRange == nil && t.TableDiffs[curTableIndex].IgnoreDataCheck {
 			pool.Apply(func() {
 				table := t.TableDiffs[curTableIndex]
 				progressID := dbutil.TableName(table.Schema, table.Table)
@@ -127,7 +103,7 @@ func (t *ChunksIterator) produceChunks(ctx context.Context, startRange *splitter
 
 		pool.Apply(func() {
 			table := t.TableDiffs[curTableIndex]
-			chunkIter, err := t.tableAnalyzer.AnalyzeSplitter(ctx, table, nil)
+			chunkIter, err := t.tableAnalyzer.AnalyzeSplitter(ctx, table, startRange)
 			if err != nil {
 				t.errCh <- errors.Trace(err)
 				return
@@ -159,6 +135,11 @@ func (t *ChunksIterator) produceChunks(ctx context.Context, startRange *splitter
 	pool.WaitFinished()
 }
 
+// isTableFinished returns true if the range is the last chunk of the table, or the data-check of the table is skipped.
+func isTableFinished(r *splitter.RangeInfo) bool {
+	return r.ChunkRange.Type == chunk.Empty || r.ChunkRange.IsLastChunkForTable()
+}
+
 func (t *ChunksIterator) Next(ctx context.Context) (*splitter.RangeInfo, error) {
 	select {
 	case <-ctx.Done():
@@ -183,8 +164,11 @@ func (t *ChunksIterator) getCurTableIndex() int {
 
 // TODO: getCurTableIndexID only used for binary search, should be optimized later.
 func getCurTableIndexID(tableIter splitter.ChunkIterator) int64 {
-	if bt, ok := tableIter.(*splitter.BucketIterator); ok {
-		return bt.GetIndexID()
+	switch iter := tableIter.(type) {
+	case *splitter.BucketIterator:
+		return iter.GetIndexID()
+	case *failedChunkIterator:
+		return iter.indexID
 	}
 	return 0
 }
@@ -0,0 +1,85 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// RowBuffer keeps the rows in a compact buffer instead of a map[string]*dbutil.ColumnData per row.
+// The values of all the rows are appended to one byte slice and located by the offsets,
+// and the column names are shared by the rows, so the memory of very wide tables is reduced several-fold.
+type RowBuffer struct {
+	columns []string
+	// the value of the j-th column of the i-th row is data[offsets[k]:offsets[k+1]], k = i*len(columns)+j.
+	data    []byte
+	offsets []int
+	// nulls is the bitmap of the NULL values, indexed by k too.
+	nulls []uint64
+}
+
+// NewRowBuffer returns a RowBuffer of the columns.
+func NewRowBuffer(columns []string) *RowBuffer {
+	return &RowBuffer{
+		columns: columns,
+		offsets: []int{0},
+	}
+}
+
+// Append copies the values of the row into the buffer, the columns not in the row are NULL.
+func (b *RowBuffer) Append(row map[string]*dbutil.ColumnData) {
+	for _, column := range b.columns {
+		k := len(b.offsets) - 1
+		if k/64 >= len(b.nulls) {
+			b.nulls = append(b.nulls, 0)
+		}
+		data, ok := row[column]
+		if !ok || data.IsNull {
+			b.nulls[k/64] |= 1 << uint(k%64)
+		} else {
+			b.data = append(b.data, data.Data...)
+		}
+		b.offsets = append(b.offsets, len(b.data))
+	}
+}
+
+// Len returns the number of rows in the buffer.
+func (b *RowBuffer) Len() int {
+	if len(b.columns) == 0 {
+		return 0
+	}
+	return (len(b.offsets) - 1) / len(b.columns)
+}
+
+// Row decodes the i-th row. The values share the memory of the buffer, so they must not be modified.
+func (b *RowBuffer) Row(i int) map[string]*dbutil.ColumnData {
+	row := make(map[string]*dbutil.ColumnData, len(b.columns))
+	values := make([]dbutil.ColumnData, len(b.columns))
+	for j, column := range b.columns {
+		k := i*len(b.columns) + j
+		if b.nulls[k/64]&(1<<uint(k%64)) != 0 {
+			values[j].IsNull = true
+		} else {
+			start, end := b.offsets[k], b.offsets[k+1]
+			values[j].Data = b.data[start:end:end]
+		}
+		row[column] = &values[j]
+	}
+	return row
+}
+
+// Size returns the approximate memory in bytes used by the buffer.
+func (b *RowBuffer) Size() int {
+	return cap(b.data) + 8*cap(b.offsets) + 8*cap(b.nulls)
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowBuffer(t *testing.T) {
+	buffer := NewRowBuffer([]string{"a", "b", "c"})
+	require.Equal(t, 0, buffer.Len())
+
+	rows := []map[string]*dbutil.ColumnData{
+		{
+			"a": {Data: []byte("1")},
+			"b": {Data: []byte("hello")},
+			"c": {IsNull: true},
+		},
+		{
+			"a": {Data: []byte("2")},
+			"b": {Data: []byte("")},
+			"c": {Data: []byte("world")},
+		},
+		{
+			// the missing column is NULL
+			"a": {Data: []byte("3")},
+			"b": {Data: []byte("!")},
+		},
+	}
+	for _, row := range rows {
+		buffer.Append(row)
+	}
+	require.Equal(t, 3, buffer.Len())
+
+	for i, row := range rows {
+		decoded := buffer.Row(i)
+		require.Len(t, decoded, 3)
+		for _, column := range []string{"a", "b", "c"} {
+			expected, ok := row[column]
+			if !ok || expected.IsNull {
+				require.True(t, decoded[column].IsNull)
+				continue
+			}
+			require.False(t, decoded[column].IsNull)
+			require.Equal(t, string(expected.Data), string(decoded[column].Data))
+		}
+	}
+
+	// more than 64 values to use several words of the null bitmap
+	columns := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		columns = append(columns, fmt.Sprintf("c%d", i))
+	}
+	buffer = NewRowBuffer(columns)
+	for i := 0; i < 3; i++ {
+		buffer.Append(generateWideRow(columns, i))
+	}
+	for i := 0; i < 3; i++ {
+		row := buffer.Row(i)
+		for j, column := range columns {
+			if (i+j)%7 == 0 {
+				require.True(t, row[column].IsNull)
+			} else {
+				require.Equal(t, strconv.Itoa(i*j), string(row[column].Data))
+			}
+		}
+	}
+}
+
+func generateWideRow(columns []string, i int) map[string]*dbutil.ColumnData {
+	row := make(map[string]*dbutil.ColumnData, len(columns))
+	for j, column := range columns {
+		if (i+j)%7 == 0 {
+			row[column] = &dbutil.ColumnData{IsNull: true}
+			continue
+		}
+		row[column] = &dbutil.ColumnData{Data: []byte(strconv.Itoa(i * j))}
+	}
+	return row
+}
+
+const (
+	benchWideColumns = 300
+	benchWideRows    = 1000
+)
+
+func benchWideColumnNames() []string {
+	columns := make([]string, 0, benchWideColumns)
+	for i := 0; i < benchWideColumns; i++ {
+		columns = append(columns, fmt.Sprintf("column_%d", i))
+	}
+	return columns
+}
+
+// heapInUse returns the bytes of the live objects after a GC.
+func heapInUse() int64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapAlloc)
+}
+
+// BenchmarkRowMaps keeps the rows of a very wide table as maps, which is how the rows are scanned.
+func BenchmarkRowMaps(b *testing.B) {
+	columns := benchWideColumnNames()
+	b.ReportAllocs()
+	var retained int64
+	for n := 0; n < b.N; n++ {
+		before := heapInUse()
+		rows := make([]map[string]*dbutil.ColumnData, 0, benchWideRows)
+		for i := 0; i < benchWideRows; i++ {
+			rows = append(rows, generateWideRow(columns, i))
+		}
+		retained += heapInUse() - before
+		runtime.KeepAlive(rows)
+	}
+	b.ReportMetric(float64(retained)/float64(b.N*benchWideRows), "bytes/row")
+}
+
+// BenchmarkRowBuffer keeps the same rows in a RowBuffer.
+func BenchmarkRowBuffer(b *testing.B) {
+	columns := benchWideColumnNames()
+	b.ReportAllocs()
+	var retained int64
+	for n := 0; n < b.N; n++ {
+		before := heapInUse()
+		buffer := NewRowBuffer(columns)
+		for i := 0; i < benchWideRows; i++ {
+			buffer.Append(generateWideRow(columns, i))
+		}
+		retained += heapInUse() - before
+		runtime.KeepAlive(buffer)
+	}
+	b.ReportMetric(float64(retained)/float64(b.N*benchWideRows), "bytes/row")
+}
@@ -39,11 +39,11 @@ func (r RowDatas) Less(i, j int) bool {
 	for _, col := range r.OrderKeyCols {
 		col1, ok := r.Rows[i].Data[col.Name.O]
 		if !ok {
-			log.Fatal("data don't have column", zap.String("column", col.Name.O), zap.Reflect("data", r.Rows[i].Data))
+			log.Fatal("data don't have column", zap.String("column", col.Name.O), utils.RedactAnyData("data", r.Rows[i].Data))
 		}
 		col2, ok := r.Rows[j].Data[col.Name.O]
 		if !ok {
-			log.Fatal("data don't have column", zap.String("column", col.Name.O), zap.Reflect("data", r.Rows[j].Data))
+			log.Fatal("data don't have column", zap.String("column", col.Name.O), utils.RedactAnyData("data", r.Rows[j].Data))
 		}
 
 		switch {
@@ -67,11 +67,11 @@ func (r RowDatas) Less(i, j int) bool {
 
 		num1, err1 := strconv.ParseFloat(strData1, 64)
 		if err1 != nil {
-			log.Fatal("convert string to float failed", zap.String("column", col.Name.O), zap.String("data", strData1), zap.Error(err1))
+			log.Fatal("convert string to float failed", zap.String("column", col.Name.O), utils.RedactAnyData("data", strData1), zap.Error(err1))
 		}
 		num2, err2 := strconv.ParseFloat(strData2, 64)
 		if err2 != nil {
-			log.Fatal("convert string to float failed", zap.String("column", col.Name.O), zap.String("data", strData2), zap.Error(err2))
+			log.Fatal("convert string to float failed", zap.String("column", col.Name.O), utils.RedactAnyData("data", strData2), zap.Error(err2))
 		}
 
 		if num1 == num2 {
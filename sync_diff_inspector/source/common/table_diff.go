@@ -15,7 +15,10 @@ package common
 
 import (
 	"database/sql"
+	"fmt"
 
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/utils"
 	"github.com/pingcap/tidb/parser/model"
 )
 
@@ -33,6 +36,13 @@ type TableShardSource struct {
 type TableSource struct {
 	OriginSchema string
 	OriginTable  string
+	// Query is selected from instead of the table if it's not empty, which is used for the query checks
+	// and the tables with the renamed columns.
+	Query string
+	// ColumnMap maps the target columns to the renamed columns of the table, the Query renames them back.
+	ColumnMap map[string]string
+	// Expressions maps the target columns to the expressions selected instead of them by the Query.
+	Expressions map[string]string
 }
 
 // TableDiff saves config for diff table
@@ -50,6 +60,13 @@ type TableDiff struct {
 	// columns be ignored
 	IgnoreColumns []string `json:"-"`
 
+	// only these columns and the unique key are compared if it's not empty
+	Columns []string `json:"-"`
+
+	// PartialColumns is true if some columns are ignored or not in `Columns`, then the different rows
+	// are fixed by UPDATE instead of REPLACE, so that the values of these columns are kept.
+	PartialColumns bool `json:"-"`
+
 	// field should be the primary key, unique key or field with index
 	Fields string `json:"fields"`
 
@@ -65,4 +82,91 @@ type TableDiff struct {
 	Collation string `json:"collation"`
 
 	ChunkSize int64 `json:"chunk-size"`
+
+	// CheckThreadCount is the max number of the chunks of the table compared concurrently, 0 means no limit.
+	CheckThreadCount int `json:"-"`
+
+	// ErrorPolicy decides what to do when the table meets error.
+	ErrorPolicy *config.ErrorPolicy `json:"-"`
+
+	// LargeTable is true if the estimated size of the table exceeds `large-table-threshold`.
+	LargeTable bool `json:"-"`
+	// EstimatedSize is the estimated size in bytes of the table in the target, it's only estimated
+	// for `large-table-threshold` and the orders by the sizes of `table-order`.
+	EstimatedSize int64 `json:"-"`
+
+	// LargeColumns are the TEXT/BLOB columns compared by their MD5 hashes first,
+	// the full values are only fetched for the different rows.
+	LargeColumns []string `json:"-"`
+
+	// ChangeHintColumn records the last modified time of the rows, only the rows changed
+	// since the last successful run are compared in the incremental mode.
+	ChangeHintColumn string `json:"-"`
+
+	// Tolerance is the max differences of the numeric values regarded as equal when comparing the rows,
+	// nil means the FLOAT/DOUBLE values differing by `DefaultFloatTolerance` are equal.
+	Tolerance *utils.Tolerance `json:"-"`
+
+	// ColumnMap maps the target columns to the columns renamed in the source, see `column-map`.
+	ColumnMap map[string]string `json:"-"`
+
+	// SourceExpressions and TargetExpressions map the columns to the expressions selected instead of them
+	// from the source and the target, see `source-expressions` and `target-expressions`.
+	SourceExpressions map[string]string `json:"-"`
+	TargetExpressions map[string]string `json:"-"`
+
+	// SensitiveColumns are compared by their SHA2 hashes, and redacted in the fix sql, see `sensitive-columns`.
+	SensitiveColumns []string `json:"-"`
+
+	// FullRowHash is true if the table has no primary key or unique key, and the rows are compared by
+	// the hashes of the full rows and their counts, see `full-row-hash`.
+	FullRowHash bool `json:"-"`
+
+	// Partitions are the partitions of the table compared one by one, the chunks are split in each partition,
+	// see `split-by-partition` and `partitions`. It's empty if the table isn't split by partitions.
+	Partitions []*Partition `json:"-"`
+
+	// ChecksumAlgorithm is the algorithm of the checksum of the chunks, see `checksum-algorithm`.
+	ChecksumAlgorithm string `json:"-"`
+
+	// Notes records how the comparison of the table is adjusted, which are shown in the summary.
+	Notes []string `json:"-"`
+
+	// Query and SourceQuery are the queries of the target and the source for the query checks,
+	// their result sets are compared instead of the table.
+	Query       string `json:"query,omitempty"`
+	SourceQuery string `json:"source-query,omitempty"`
+}
+
+// Partition is a partition of the table and the condition selecting its rows.
+type Partition struct {
+	Name  string
+	Where string
+}
+
+// GetRange returns the range of the rows compared in the partition, it's the range of the table
+// if the partition is empty.
+func (t *TableDiff) GetRange(partition string) string {
+	for _, p := range t.Partitions {
+		if p.Name == partition {
+			return fmt.Sprintf("(%s) AND (%s)", t.Range, p.Where)
+		}
+	}
+	return t.Range
+}
+
+// GetExpressions returns the expressions of the columns selected from the target or the source.
+func (t *TableDiff) GetExpressions(isTarget bool) map[string]string {
+	if isTarget {
+		return t.TargetExpressions
+	}
+	return t.SourceExpressions
+}
+
+// GetQuery returns the query of the target or the source, it's empty if the table isn't a query check.
+func (t *TableDiff) GetQuery(isTarget bool) string {
+	if isTarget {
+		return t.Query
+	}
+	return t.SourceQuery
 }
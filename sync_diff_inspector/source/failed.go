@@ -0,0 +1,87 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/checkpoints"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/chunk"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/progress"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/source/common"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/splitter"
+)
+
+// FailedChunksAnalyzer only splits the chunks failed in the last run for `--check-failed-only`.
+// The tables failed as a whole are split by the analyzer of the source.
+type FailedChunksAnalyzer struct {
+	analyzer TableAnalyzer
+	failed   *checkpoints.FailedChunks
+}
+
+// NewFailedChunksAnalyzer returns the analyzer re-checking the failed chunks.
+func NewFailedChunksAnalyzer(analyzer TableAnalyzer, failed *checkpoints.FailedChunks) *FailedChunksAnalyzer {
+	return &FailedChunksAnalyzer{analyzer: analyzer, failed: failed}
+}
+
+// AnalyzeSplitter implements TableAnalyzer.AnalyzeSplitter. The failed chunks of a table are numbered again
+// in their order as the chunks of a single bucket, so the checkpoint of them is continuous.
+func (a *FailedChunksAnalyzer) AnalyzeSplitter(ctx context.Context, table *common.TableDiff, startRange *splitter.RangeInfo) (splitter.ChunkIterator, error) {
+	failedTable := a.failed.GetTable(table.Schema, table.Table)
+	if failedTable == nil || failedTable.WholeTable || len(failedTable.Chunks) == 0 {
+		return a.analyzer.AnalyzeSplitter(ctx, table, startRange)
+	}
+	chunkCnt := len(failedTable.Chunks)
+	beginIndex := 0
+	if startRange != nil {
+		beginIndex = startRange.ChunkRange.Index.ChunkIndex + 1
+	}
+	chunks := make([]*chunk.Range, 0, chunkCnt)
+	for i := beginIndex; i < chunkCnt; i++ {
+		failedRange := failedTable.Chunks[i].Range
+		// the conditions are built again, since the collation and the range of the table may be changed.
+		chunkRange := chunk.NewChunkRange()
+		for _, bound := range failedRange.Bounds {
+			chunkRange.Update(bound.Column, bound.Lower, bound.Upper, bound.HasLower, bound.HasUpper)
+		}
+		chunk.InitChunk(chunkRange, failedRange.Type, 0, 0, table.Collation, table.GetRange(failedRange.Partition))
+		chunkRange.Partition = failedRange.Partition
+		chunkRange.Index.ChunkIndex = i
+		chunkRange.Index.ChunkCnt = chunkCnt
+		chunkRange.IsFirst = i == 0
+		chunkRange.IsLast = i == chunkCnt-1
+		chunks = append(chunks, chunkRange)
+	}
+	progress.StartTable(dbutil.TableName(table.Schema, table.Table), len(chunks), true)
+	return &failedChunkIterator{chunks: chunks, indexID: failedTable.Chunks[0].IndexID}, nil
+}
+
+type failedChunkIterator struct {
+	chunks    []*chunk.Range
+	nextChunk int
+	// indexID is the index splitting the chunks, which is used by the binary search.
+	indexID int64
+}
+
+func (s *failedChunkIterator) Next() (*chunk.Range, error) {
+	if s.nextChunk >= len(s.chunks) {
+		return nil, nil
+	}
+	c := s.chunks[s.nextChunk]
+	s.nextChunk++
+	return c, nil
+}
+
+func (s *failedChunkIterator) Close() {}
@@ -0,0 +1,331 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/chunk"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/progress"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/source/common"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/splitter"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/utils"
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/model"
+	"go.uber.org/zap"
+)
+
+const (
+	mockSchema   = "mock"
+	mockIDColumn = "id"
+	// mockTableSQL is the structure of the synthetic tables.
+	mockTableSQL = "CREATE TABLE `%s`.`%s` (`id` BIGINT NOT NULL, `name` VARCHAR(64), `age` INT, `score` DECIMAL(10,2), `created` DATETIME, PRIMARY KEY (`id`))"
+	// mockChunkSize keeps the chunks small enough, so the binary search which needs a database is never used.
+	mockChunkSize = splitter.SplitThreshold
+)
+
+// NewMockSources returns the sources generating the synthetic tables on both sides,
+// so that the whole diff pipeline can be exercised without databases.
+func NewMockSources(cfg *config.Config) (downstream Source, upstream Source, err error) {
+	targetMock := cfg.Task.TargetInstance.Mock
+	p := parser.New()
+	tableDiffs := make([]*common.TableDiff, 0, targetMock.Tables)
+	for i := 0; i < targetMock.Tables; i++ {
+		table := fmt.Sprintf("t%d", i)
+		if !cfg.Task.TargetCheckTables.MatchTable(mockSchema, table) {
+			continue
+		}
+		if cfg.Task.IsRecheck() && !cfg.Task.TargetRecheckTables.MatchTable(mockSchema, table) {
+			continue
+		}
+		tableInfo, err := dbutil.GetTableInfoBySQL(fmt.Sprintf(mockTableSQL, mockSchema, table), p)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		tableDiffs = append(tableDiffs, &common.TableDiff{
+			Schema:      mockSchema,
+			Table:       table,
+			Info:        tableInfo,
+			Range:       "TRUE",
+			ChunkSize:   mockChunkSize,
+			ErrorPolicy: &config.ErrorPolicy{Action: config.OnErrorSkipTable},
+
+			ChecksumAlgorithm: cfg.GetChecksumAlgorithm(),
+		})
+	}
+	if len(tableDiffs) == 0 {
+		return nil, nil, errors.Errorf("no table need to be compared")
+	}
+	// the same order as the real sources, see `NewSources`.
+	sort.Slice(tableDiffs, func(i, j int) bool {
+		ti := utils.UniqueID(tableDiffs[i].Schema, tableDiffs[i].Table)
+		tj := utils.UniqueID(tableDiffs[j].Schema, tableDiffs[j].Table)
+		return strings.Compare(ti, tj) > 0
+	})
+	log.Info("compare the synthetic tables of the mock sources", zap.Int("tables", len(tableDiffs)))
+
+	upstream = &MockSource{
+		tableDiffs:       tableDiffs,
+		mock:             cfg.Task.SourceInstances[0].Mock,
+		tableThreadCount: cfg.GetTableThreadCount(),
+	}
+	downstream = &MockSource{
+		tableDiffs:       tableDiffs,
+		mock:             targetMock,
+		tableThreadCount: cfg.GetTableThreadCount(),
+	}
+	return downstream, upstream, nil
+}
+
+// MockTableAnalyzer splits the synthetic tables by the id.
+type MockTableAnalyzer struct {
+	mock *config.MockConfig
+}
+
+func (a *MockTableAnalyzer) AnalyzeSplitter(ctx context.Context, table *common.TableDiff, startRange *splitter.RangeInfo) (splitter.ChunkIterator, error) {
+	chunkCnt := int((a.mock.Rows + mockChunkSize - 1) / mockChunkSize)
+	beginIndex := 0
+	if startRange != nil {
+		beginIndex = startRange.ChunkRange.Index.ChunkIndex + 1
+	}
+	chunks := make([]*chunk.Range, 0, chunkCnt)
+	for i := beginIndex; i < chunkCnt; i++ {
+		chunkRange := chunk.NewChunkRange()
+		// the i-th chunk is (i*mockChunkSize, (i+1)*mockChunkSize], and the first and the last chunk are unbounded.
+		chunkRange.Update(mockIDColumn, strconv.FormatInt(int64(i)*mockChunkSize, 10), strconv.FormatInt(int64(i+1)*mockChunkSize, 10), i > 0, i < chunkCnt-1)
+		chunks = append(chunks, chunkRange)
+	}
+	chunk.InitChunks(chunks, chunk.Random, 0, 0, beginIndex, table.Collation, table.Range, chunkCnt)
+	progress.StartTable(dbutil.TableName(table.Schema, table.Table), len(chunks), true)
+	return &mockChunkIterator{chunks: chunks}, nil
+}
+
+type mockChunkIterator struct {
+	chunks    []*chunk.Range
+	nextChunk int
+}
+
+func (s *mockChunkIterator) Next() (*chunk.Range, error) {
+	if s.nextChunk >= len(s.chunks) {
+		return nil, nil
+	}
+	c := s.chunks[s.nextChunk]
+	s.nextChunk++
+	return c, nil
+}
+
+func (s *mockChunkIterator) Close() {}
+
+// MockRowsIterator returns the synthetic rows in the order of id.
+type MockRowsIterator struct {
+	rows    *common.RowBuffer
+	nextRow int
+}
+
+func (s *MockRowsIterator) Next() (map[string]*dbutil.ColumnData, error) {
+	if s.nextRow >= s.rows.Len() {
+		return nil, nil
+	}
+	row := s.rows.Row(s.nextRow)
+	s.nextRow++
+	return row, nil
+}
+
+func (s *MockRowsIterator) Close() {}
+
+// MockSource generates deterministic synthetic rows by the seed, and misses or changes some of them by the corruption rate.
+type MockSource struct {
+	tableDiffs []*common.TableDiff
+	mock       *config.MockConfig
+	// tableThreadCount is the number of tables produce chunks concurrently
+	tableThreadCount int
+}
+
+func (s *MockSource) GetTableAnalyzer() TableAnalyzer {
+	return &MockTableAnalyzer{s.mock}
+}
+
+func (s *MockSource) GetRangeIterator(ctx context.Context, startRanges map[int]*splitter.RangeInfo, analyzer TableAnalyzer) (RangeIterator, error) {
+	return NewChunksIterator(ctx, analyzer, s.tableDiffs, startRanges, s.tableThreadCount)
+}
+
+func (s *MockSource) GetCountAndCrc32(ctx context.Context, tableRange *splitter.RangeInfo) *ChecksumInfo {
+	beginTime := time.Now()
+	table := s.tableDiffs[tableRange.GetTableIndex()]
+	var count, checksum int64
+	rows := s.getRows(table, tableRange.GetChunk())
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Row(i)
+		values := make([]string, 0, len(table.Info.Columns))
+		for _, col := range table.Info.Columns {
+			values = append(values, string(row[col.Name.O].Data))
+		}
+		count++
+		checksum ^= mockRowChecksum(table.ChecksumAlgorithm, strings.Join(values, ","))
+	}
+	return &ChecksumInfo{
+		Algorithm: table.ChecksumAlgorithm,
+		Checksum:  checksum,
+		Count:     count,
+		Cost:      time.Since(beginTime),
+	}
+}
+
+// mockRowChecksum returns the checksum of a row as the checksum query of the algorithm does.
+func mockRowChecksum(algorithm, row string) int64 {
+	switch algorithm {
+	case config.ChecksumNone:
+		return 0
+	case config.ChecksumSHA1:
+		// the first 60 bits, i.e. the first 15 hex digits of the SHA1.
+		sum := sha1.Sum([]byte(row))
+		return int64(binary.BigEndian.Uint64(sum[:8]) >> 4)
+	}
+	return int64(crc32.ChecksumIEEE([]byte(row)))
+}
+
+func (s *MockSource) GetRowsIterator(ctx context.Context, tableRange *splitter.RangeInfo) (RowDataIterator, error) {
+	table := s.tableDiffs[tableRange.GetTableIndex()]
+	return &MockRowsIterator{rows: s.getRows(table, tableRange.GetChunk())}, nil
+}
+
+func (s *MockSource) GenerateFixSQL(t DMLType, upstreamData, downstreamData map[string]*dbutil.ColumnData, tableIndex int) string {
+	switch t {
+	case Insert:
+		return utils.GenerateReplaceDML(upstreamData, s.tableDiffs[tableIndex].Info, s.tableDiffs[tableIndex].Schema)
+	case Delete:
+		return utils.GenerateDeleteDML(downstreamData, s.tableDiffs[tableIndex].Info, s.tableDiffs[tableIndex].Schema)
+	case Replace:
+		if s.tableDiffs[tableIndex].PartialColumns {
+			return utils.GenerateUpdateDMLWithAnnotation(upstreamData, downstreamData, s.tableDiffs[tableIndex].Info, s.tableDiffs[tableIndex].Schema)
+		}
+		return utils.GenerateReplaceDMLWithAnnotation(upstreamData, downstreamData, s.tableDiffs[tableIndex].Info, s.tableDiffs[tableIndex].Schema)
+	default:
+		log.Fatal("Don't support this type", zap.Any("dml type", t))
+	}
+	return ""
+}
+
+func (s *MockSource) GetTables() []*common.TableDiff {
+	return s.tableDiffs
+}
+
+func (s *MockSource) GetSourceStructInfo(ctx context.Context, tableIndex int) ([]*model.TableInfo, error) {
+	return []*model.TableInfo{s.tableDiffs[tableIndex].Info}, nil
+}
+
+// GetDB returns nil because the mock source has no database.
+func (s *MockSource) GetDB() *sql.DB {
+	return nil
+}
+
+func (s *MockSource) GetSnapshot() string {
+	return ""
+}
+
+func (s *MockSource) Close() {}
+
+// getRows returns the rows in the range of the chunk, which is bounded by the id only.
+func (s *MockSource) getRows(table *common.TableDiff, chunkRange *chunk.Range) *common.RowBuffer {
+	lower, upper := int64(0), s.mock.Rows
+	for _, bound := range chunkRange.Bounds {
+		if bound.Column != mockIDColumn {
+			continue
+		}
+		if bound.HasLower {
+			lower, _ = strconv.ParseInt(bound.Lower, 10, 64)
+		}
+		if bound.HasUpper {
+			upper, _ = strconv.ParseInt(bound.Upper, 10, 64)
+		}
+	}
+	if upper > s.mock.Rows {
+		upper = s.mock.Rows
+	}
+	columns := make([]string, 0, len(table.Info.Columns))
+	for _, col := range table.Info.Columns {
+		columns = append(columns, col.Name.O)
+	}
+	rows := common.NewRowBuffer(columns)
+	for id := lower + 1; id <= upper; id++ {
+		if row := s.generateRow(table, id); row != nil {
+			rows.Append(row)
+		}
+	}
+	return rows
+}
+
+// generateRow returns the row of the id, or nil if it's missing because of the corruption.
+func (s *MockSource) generateRow(table *common.TableDiff, id int64) map[string]*dbutil.ColumnData {
+	// the corruption only depends on the seed of this side,
+	// so the same rows are corrupted every time and the comparison is deterministic.
+	corruption := mockHash(s.mock.Seed, "corruption", table.Table, id)
+	corrupted := float64(corruption)/float64(math.MaxUint64) < s.mock.CorruptionRate
+	if corrupted && corruption%3 == 0 {
+		return nil
+	}
+
+	h := mockHash(s.mock.Seed, "row", table.Table, id)
+	values := map[string]string{
+		"id":      strconv.FormatInt(id, 10),
+		"name":    fmt.Sprintf("name-%d", h%100000),
+		"age":     strconv.FormatUint(h%100, 10),
+		"score":   fmt.Sprintf("%d.%02d", h%100000, h%100),
+		"created": time.Unix(1600000000+int64(h%100000000), 0).UTC().Format("2006-01-02 15:04:05"),
+	}
+	if corrupted {
+		if corruption%3 == 1 {
+			values["name"] = fmt.Sprintf("corrupted-%d", h%100000)
+		} else {
+			values["age"] = strconv.FormatUint(h%100+100, 10)
+		}
+	}
+
+	row := make(map[string]*dbutil.ColumnData, len(table.Info.Columns))
+	for _, col := range table.Info.Columns {
+		row[col.Name.O] = &dbutil.ColumnData{
+			Data: []byte(values[col.Name.O]),
+		}
+	}
+	return row
+}
+
+func mockHash(seed int64, kind, table string, id int64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(fmt.Sprintf("%d/%s/%s/%d", seed, kind, table, id)))
+	// the high bits of FNV are poorly spread for the similar keys, so mix them by the finalizer of
+	// MurmurHash3 before comparing the hash with the corruption rate.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
 	"github.com/pingcap/tidb-tools/pkg/filter"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/chaos"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/source/common"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/splitter"
@@ -47,7 +48,23 @@ func (a *MySQLTableAnalyzer) AnalyzeSplitter(ctx context.Context, table *common.
 	originTable := *table
 	originTable.Schema = matchedSources[0].OriginSchema
 	originTable.Table = matchedSources[0].OriginTable
+	originTable.Query = matchedSources[0].Query
 	progressID := dbutil.TableName(table.Schema, table.Table)
+	if originTable.Query != "" {
+		// the random values can't be selected from the result set of a query efficiently, so it's split by the key columns.
+		limitIter, err := splitter.NewLimitIteratorWithCheckpoint(ctx, progressID, &originTable, matchedSources[0].DBConn, startRange)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return limitIter, nil
+	}
+	if len(table.Partitions) > 0 {
+		partitionIter, err := splitter.NewPartitionIteratorWithCheckpoint(ctx, progressID, &originTable, matchedSources[0].DBConn, startRange)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return partitionIter, nil
+	}
 	// use random splitter if we cannot use bucket splitter, then we can simply choose target table to generate chunks.
 	randIter, err := splitter.NewRandomIteratorWithCheckpoint(ctx, progressID, &originTable, matchedSources[0].DBConn, startRange)
 	if err != nil {
@@ -58,6 +75,8 @@ func (a *MySQLTableAnalyzer) AnalyzeSplitter(ctx context.Context, table *common.
 
 type MySQLSources struct {
 	tableDiffs []*common.TableDiff
+	// tableThreadCount is the number of tables produce chunks concurrently
+	tableThreadCount int
 
 	sourceTablesMap map[string][]*common.TableShardSource
 }
@@ -79,8 +98,8 @@ func (s *MySQLSources) GetTableAnalyzer() TableAnalyzer {
 	}
 }
 
-func (s *MySQLSources) GetRangeIterator(ctx context.Context, r *splitter.RangeInfo, analyzer TableAnalyzer) (RangeIterator, error) {
-	return NewChunksIterator(ctx, analyzer, s.tableDiffs, r)
+func (s *MySQLSources) GetRangeIterator(ctx context.Context, startRanges map[int]*splitter.RangeInfo, analyzer TableAnalyzer) (RangeIterator, error) {
+	return NewChunksIterator(ctx, analyzer, s.tableDiffs, startRanges, s.tableThreadCount)
 }
 
 func (s *MySQLSources) Close() {
@@ -101,7 +120,15 @@ func (s *MySQLSources) GetCountAndCrc32(ctx context.Context, tableRange *splitte
 
 	for _, ms := range matchSources {
 		go func(ms *common.TableShardSource) {
-			count, checksum, err := utils.GetCountAndCRC32Checksum(ctx, ms.DBConn, ms.OriginSchema, ms.OriginTable, table.Info, chunk.Where, chunk.Args)
+			var (
+				count, checksum int64
+				err             error
+			)
+			if ms.Query != "" {
+				count, checksum, err = utils.GetQueryCountAndChecksum(ctx, ms.DBConn, ms.Query, ms.OriginTable, table.Info, table.ChecksumAlgorithm, chunk.Where, chunk.Args)
+			} else {
+				count, checksum, err = utils.GetCountAndChecksum(ctx, ms.DBConn, ms.OriginSchema, ms.OriginTable, table.Info, table.ChecksumAlgorithm, chunk.Where, chunk.Args)
+			}
 			infoCh <- &ChecksumInfo{
 				Checksum: checksum,
 				Count:    count,
@@ -129,10 +156,11 @@ func (s *MySQLSources) GetCountAndCrc32(ctx context.Context, tableRange *splitte
 
 	cost := time.Since(beginTime)
 	return &ChecksumInfo{
-		Checksum: totalChecksum,
-		Count:    totalCount,
-		Err:      err,
-		Cost:     cost,
+		Algorithm: table.ChecksumAlgorithm,
+		Checksum:  totalChecksum,
+		Count:     totalCount,
+		Err:       err,
+		Cost:      cost,
 	}
 }
 
@@ -147,6 +175,9 @@ func (s *MySQLSources) GenerateFixSQL(t DMLType, upstreamData, downstreamData ma
 	case Delete:
 		return utils.GenerateDeleteDML(downstreamData, s.tableDiffs[tableIndex].Info, s.tableDiffs[tableIndex].Schema)
 	case Replace:
+		if s.tableDiffs[tableIndex].PartialColumns {
+			return utils.GenerateUpdateDMLWithAnnotation(upstreamData, downstreamData, s.tableDiffs[tableIndex].Info, s.tableDiffs[tableIndex].Schema)
+		}
 		return utils.GenerateReplaceDMLWithAnnotation(upstreamData, downstreamData, s.tableDiffs[tableIndex].Info, s.tableDiffs[tableIndex].Schema)
 	default:
 		log.Fatal("Don't support this type", zap.Any("dml type", t))
@@ -162,10 +193,23 @@ func (s *MySQLSources) GetRowsIterator(ctx context.Context, tableRange *splitter
 	table := s.tableDiffs[tableRange.GetTableIndex()]
 	matchSources := getMatchedSourcesForTable(s.sourceTablesMap, table)
 
+	if err := chaos.Inject(chaos.SourceQueryError); err != nil {
+		return nil, errors.Trace(err)
+	}
 	var rowsQuery string
 	var orderKeyCols []*model.ColumnInfo
+	hashColumns := getHashColumns(table, tableRange)
 	for i, ms := range matchSources {
-		rowsQuery, orderKeyCols = utils.GetTableRowsQueryFormat(ms.OriginSchema, ms.OriginTable, table.Info, table.Collation)
+		switch {
+		case isRowHashes(table, tableRange) && ms.Query != "":
+			rowsQuery, orderKeyCols = utils.GetRowHashesQueryFormat(utils.QueryTableName(ms.Query, ms.OriginTable), table.Info)
+		case isRowHashes(table, tableRange):
+			rowsQuery, orderKeyCols = utils.GetRowHashesQueryFormat(dbutil.TableName(ms.OriginSchema, ms.OriginTable), table.Info)
+		case ms.Query != "":
+			rowsQuery, orderKeyCols = utils.GetQueryRowsQueryFormat(ms.Query, ms.OriginTable, table.Info, table.Collation, hashColumns)
+		default:
+			rowsQuery, orderKeyCols = utils.GetTableRowsQueryFormat(ms.OriginSchema, ms.OriginTable, table.Info, table.Collation, hashColumns)
+		}
 		query := fmt.Sprintf(rowsQuery, chunk.Where)
 		rows, err := ms.DBConn.QueryContext(ctx, query, chunk.Args...)
 		if err != nil {
@@ -225,11 +269,25 @@ func (s *MySQLSources) GetSourceStructInfo(ctx context.Context, tableIndex int)
 	sourceTableInfos := make([]*model.TableInfo, len(tableSources))
 	for i, tableSource := range tableSources {
 		sourceSchema, sourceTable := tableSource.OriginSchema, tableSource.OriginTable
-		sourceTableInfo, err := dbutil.GetTableInfo(ctx, tableSource.DBConn, sourceSchema, sourceTable)
+		var (
+			sourceTableInfo *model.TableInfo
+			err             error
+		)
+		switch {
+		case len(tableSource.ColumnMap) > 0 || len(tableSource.Expressions) > 0:
+			sourceTableInfo, err = dbutil.GetTableInfo(ctx, tableSource.DBConn, sourceSchema, sourceTable)
+			if err == nil {
+				sourceTableInfo = utils.RenameColumns(sourceTableInfo, tableSource.ColumnMap)
+			}
+		case tableSource.Query != "":
+			sourceTableInfo, err = getQueryTableInfo(ctx, tableSource.DBConn, tableDiff, tableSource.Query)
+		default:
+			sourceTableInfo, err = dbutil.GetTableInfo(ctx, tableSource.DBConn, sourceSchema, sourceTable)
+		}
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
-		sourceTableInfo, _ = utils.ResetColumns(sourceTableInfo, tableDiff.IgnoreColumns)
+		sourceTableInfo, _ = utils.ResetColumns(sourceTableInfo, utils.ProjectColumns(sourceTableInfo, tableDiff.IgnoreColumns, tableDiff.Columns))
 		sourceTableInfos[i] = sourceTableInfo
 	}
 	return sourceTableInfos, nil
@@ -280,12 +338,17 @@ func (ms *MultiSourceRowsIterator) Close() {
 	}
 }
 
-func NewMySQLSources(ctx context.Context, tableDiffs []*common.TableDiff, ds []*config.DataSource, threadCount int) (Source, error) {
+// NewMySQLSources builds the source of the MySQL instances, isTarget is true if it's the target instance.
+func NewMySQLSources(ctx context.Context, tableDiffs []*common.TableDiff, ds []*config.DataSource, threadCount int, tableThreadCount int, isTarget bool) (Source, error) {
 	sourceTablesMap := make(map[string][]*common.TableShardSource)
 	// we should get the real table name
 	// and real table row query from sourceDB.
 	uniqueMap := make(map[string]struct{})
 	for _, tableDiff := range tableDiffs {
+		if tableDiff.Query != "" {
+			// the query checks don't select from the tables.
+			continue
+		}
 		uniqueMap[utils.UniqueID(tableDiff.Schema, tableDiff.Table)] = struct{}{}
 	}
 
@@ -331,6 +394,22 @@ func NewMySQLSources(ctx context.Context, tableDiffs []*common.TableDiff, ds []*
 				})
 			}
 		}
+		// the query runs on every instance, and their result sets are merged like the shards.
+		for _, tableDiff := range tableDiffs {
+			if tableDiff.Query == "" {
+				continue
+			}
+			uniqueId := utils.UniqueID(tableDiff.Schema, tableDiff.Table)
+			maxSourceRouteTableCount[uniqueId]++
+			sourceTablesMap[uniqueId] = append(sourceTablesMap[uniqueId], &common.TableShardSource{
+				TableSource: common.TableSource{
+					OriginSchema: tableDiff.Schema,
+					OriginTable:  tableDiff.Table,
+					Query:        tableDiff.GetQuery(isTarget),
+				},
+				DBConn: sourceDB.Conn,
+			})
+		}
 		maxConn := 0
 		for _, c := range maxSourceRouteTableCount {
 			if c > maxConn {
@@ -352,9 +431,27 @@ func NewMySQLSources(ctx context.Context, tableDiffs []*common.TableDiff, ds []*
 		}
 	}
 
+	for _, tableDiff := range tableDiffs {
+		var columnMap map[string]string
+		if !isTarget {
+			columnMap = tableDiff.ColumnMap
+		}
+		expressions := tableDiff.GetExpressions(isTarget)
+		if len(columnMap) == 0 && len(expressions) == 0 {
+			continue
+		}
+		// the renamed columns and the expressions of every shard are selected with the aliases of the target columns.
+		for _, ms := range sourceTablesMap[utils.UniqueID(tableDiff.Schema, tableDiff.Table)] {
+			ms.ColumnMap = columnMap
+			ms.Expressions = expressions
+			ms.Query = utils.GetColumnMapQuery(dbutil.TableName(ms.OriginSchema, ms.OriginTable), tableDiff.Info, columnMap, expressions)
+		}
+	}
+
 	mss := &MySQLSources{
-		tableDiffs:      tableDiffs,
-		sourceTablesMap: sourceTablesMap,
+		tableDiffs:       tableDiffs,
+		tableThreadCount: tableThreadCount,
+		sourceTablesMap:  sourceTablesMap,
 	}
 	return mss, nil
 }
@@ -16,6 +16,7 @@ package source
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"sort"
 	"strings"
 	"time"
@@ -31,6 +32,7 @@ import (
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/splitter"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/utils"
 	"github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/parser/mysql"
 	"go.uber.org/zap"
 )
 
@@ -42,13 +44,13 @@ const (
 	Replace
 )
 
-const UnifiedTimeZone string = "+0:00"
-
 type ChecksumInfo struct {
-	Checksum int64
-	Count    int64
-	Err      error
-	Cost     time.Duration
+	// Algorithm is the algorithm of the checksum, the checksums of different algorithms are never equal.
+	Algorithm string
+	Checksum  int64
+	Count     int64
+	Err       error
+	Cost      time.Duration
 }
 
 // RowDataIterator represents the row data in source.
@@ -71,13 +73,14 @@ type Source interface {
 	// the implement of this function is different in mysql/tidb.
 	GetTableAnalyzer() TableAnalyzer
 
-	// GetRangeIterator generates the range iterator with the checkpoint(*splitter.RangeInfo) and analyzer.
+	// GetRangeIterator generates the range iterator with the checkpoints of the tables(*splitter.RangeInfo keyed
+	// by the table index) and analyzer.
 	// this is the mainly iterator across the whole sync diff.
 	// One source has one range iterator to produce the range to channel.
 	// there are many workers consume the range from the channel to compare.
-	GetRangeIterator(context.Context, *splitter.RangeInfo, TableAnalyzer) (RangeIterator, error)
+	GetRangeIterator(context.Context, map[int]*splitter.RangeInfo, TableAnalyzer) (RangeIterator, error)
 
-	// GetCountAndCrc32 gets the crc32 result and the count from given range.
+	// GetCountAndCrc32 gets the checksum by the algorithm of the table and the count from given range.
 	GetCountAndCrc32(context.Context, *splitter.RangeInfo) *ChecksumInfo
 
 	// GetRowsIterator gets the row data iterator from given range.
@@ -105,6 +108,10 @@ type Source interface {
 }
 
 func NewSources(ctx context.Context, cfg *config.Config) (downstream Source, upstream Source, err error) {
+	if cfg.Task.TargetInstance.IsMock() {
+		// the mock sources have no database to connect.
+		return NewMockSources(cfg)
+	}
 	// init db connection for upstream / downstream.
 	err = initDBConn(ctx, cfg)
 	if err != nil {
@@ -116,19 +123,157 @@ func NewSources(ctx context.Context, cfg *config.Config) (downstream Source, ups
 	}
 
 	tableDiffs := make([]*common.TableDiff, 0, len(tablesToBeCheck))
+	startTime := time.Now()
 	for _, tableConfig := range tablesToBeCheck {
-		newInfo, needUnifiedTimeZone := utils.ResetColumns(tableConfig.TargetTableInfo, tableConfig.IgnoreColumns)
+		notes := checkSpecialIndexes(tableConfig)
+		for _, column := range tableConfig.Columns {
+			if dbutil.FindColumnByName(tableConfig.TargetTableInfo.Columns, column) == nil {
+				return nil, nil, errors.Errorf("column %s in `columns` not found in table %s", column, dbutil.TableName(tableConfig.Schema, tableConfig.Table))
+			}
+		}
+		ignoredColumns := make([]string, 0, len(tableConfig.IgnoreColumns))
+		for _, column := range tableConfig.IgnoreColumns {
+			if column == "" {
+				continue
+			}
+			if dbutil.FindColumnByName(tableConfig.TargetTableInfo.Columns, column) == nil {
+				return nil, nil, errors.Errorf("column %s in `ignore-columns` not found in table %s", column, dbutil.TableName(tableConfig.Schema, tableConfig.Table))
+			}
+			ignoredColumns = append(ignoredColumns, column)
+		}
+		if err := checkTimeColumn(tableConfig); err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		if tableConfig.ChangeHintColumn != "" && dbutil.FindColumnByName(tableConfig.TargetTableInfo.Columns, tableConfig.ChangeHintColumn) == nil {
+			return nil, nil, errors.Errorf("column %s in `change-hint-column` not found in table %s", tableConfig.ChangeHintColumn, dbutil.TableName(tableConfig.Schema, tableConfig.Table))
+		}
+		for column := range tableConfig.ColumnTolerances {
+			col := dbutil.FindColumnByName(tableConfig.TargetTableInfo.Columns, column)
+			if col == nil {
+				return nil, nil, errors.Errorf("column %s in `column-tolerances` not found in table %s", column, dbutil.TableName(tableConfig.Schema, tableConfig.Table))
+			}
+			if utils.NeedQuotes(col.FieldType.Tp) {
+				return nil, nil, errors.Errorf("column %s in `column-tolerances` of table %s is not numeric", column, dbutil.TableName(tableConfig.Schema, tableConfig.Table))
+			}
+		}
+		columnMap, err := checkColumnMap(tableConfig, "column-map", tableConfig.ColumnMap)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		if len(columnMap) > 0 {
+			notes = append(notes, fmt.Sprintf("columns are renamed from the source: %s", columnMapString(columnMap)))
+		}
+		sourceExpressions, err := checkColumnMap(tableConfig, "source-expressions", tableConfig.SourceExpressions)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		targetExpressions, err := checkColumnMap(tableConfig, "target-expressions", tableConfig.TargetExpressions)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		if len(sourceExpressions) > 0 || len(targetExpressions) > 0 {
+			notes = append(notes, fmt.Sprintf("columns are compared by the expressions: %s", expressionsString(sourceExpressions, targetExpressions)))
+		}
+		sensitiveColumns, err := checkSensitiveColumns(tableConfig)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		if len(sensitiveColumns) > 0 {
+			// the hashes are computed from the values selected on each side, which may be renamed or transformed.
+			sourceExpressions = hashSensitiveColumns(sensitiveColumns, sourceExpressions, columnMap)
+			targetExpressions = hashSensitiveColumns(sensitiveColumns, targetExpressions, nil)
+			notes = append(notes, fmt.Sprintf("columns %s are compared by their SHA2 hashes and redacted in the fix sql", strings.Join(sensitiveColumns, ",")))
+		}
+		transformed := len(columnMap) > 0 || len(sourceExpressions) > 0 || len(targetExpressions) > 0
+		partitions, err := checkPartitions(tableConfig, cfg.SplitByPartition, transformed)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		switch {
+		case len(tableConfig.Partitions) > 0:
+			notes = append(notes, fmt.Sprintf("only partitions %s are compared", strings.Join(tableConfig.Partitions, ",")))
+		case len(partitions) > 0:
+			notes = append(notes, fmt.Sprintf("compared partition by partition in %d partitions", len(partitions)))
+		}
+		tolerance := utils.NewTolerance(tableConfig.FloatTolerance, tableConfig.ColumnTolerances, cfg.SemanticJSON)
+		if tolerance != nil {
+			notes = append(notes, tolerance.String())
+		}
+		if importedTable, ok := cfg.Task.ImportedTables[dbutil.TableName(tableConfig.Schema, tableConfig.Table)]; ok {
+			notes = append(notes, fmt.Sprintf("imported by TiDB Lightning in %d data engines", importedTable.DataEngines))
+		}
+		if len(tableConfig.Columns) > 0 {
+			notes = append(notes, fmt.Sprintf("only columns %s and the unique key are compared", strings.Join(tableConfig.Columns, ",")))
+		}
+		if len(ignoredColumns) > 0 {
+			notes = append(notes, fmt.Sprintf("columns %s are ignored", strings.Join(ignoredColumns, ",")))
+		}
+		columnCount := len(tableConfig.TargetTableInfo.Columns)
+		ignoreColumns := utils.ProjectColumns(tableConfig.TargetTableInfo, tableConfig.IgnoreColumns, tableConfig.Columns)
+		newInfo, needUnifiedTimeZone := utils.ResetColumns(tableConfig.TargetTableInfo, ignoreColumns)
+		onError := tableConfig.OnError
+		if onError == "" {
+			onError = cfg.OnError
+		}
+		errorPolicy, err := config.ParseErrorPolicy(onError)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		tableRange := tableConfig.Range
+		if tableConfig.IgnoreWhere != "" {
+			tableRange = excludeRows(tableRange, tableConfig.IgnoreWhere)
+			notes = append(notes, fmt.Sprintf("rows matching `%s` are ignored", tableConfig.IgnoreWhere))
+		}
+		if tableConfig.TimeColumn != "" {
+			// the window is validated by CheckConfig, and its start is fixed for all the chunks of this run.
+			window, _ := config.ParseCheckWindow(tableConfig.CheckWindow)
+			since := startTime.Add(-window)
+			tableRange = utils.TimeWindowRange(tableRange, tableConfig.TimeColumn, since)
+			notes = append(notes, fmt.Sprintf("only the rows whose %s is not less than '%s' are compared", tableConfig.TimeColumn, since.Format(time.RFC3339)))
+		}
+		var query, sourceQuery string
+		if tableConfig.QueryCheck != nil {
+			query, sourceQuery = tableConfig.QueryCheck.TargetQuery, tableConfig.QueryCheck.SourceQuery
+		}
+		fullRowHash := cfg.FullRowHash && !utils.HasUniqueKey(newInfo)
+		if fullRowHash {
+			notes = append(notes, "no primary key or unique key, the rows are compared by the hashes of the full rows")
+		}
+		var largeColumns []string
+		if cfg.LazyLargeColumns {
+			largeColumns = utils.GetLargeColumns(newInfo)
+			if len(largeColumns) > 0 {
+				notes = append(notes, fmt.Sprintf("columns %s are compared by their MD5 hashes first", strings.Join(largeColumns, ",")))
+			}
+		}
 		tableDiffs = append(tableDiffs, &common.TableDiff{
 			Schema: tableConfig.Schema,
 			Table:  tableConfig.Table,
 			Info:   newInfo,
 			// TODO: field `IgnoreColumns` can be deleted.
 			IgnoreColumns:       tableConfig.IgnoreColumns,
+			Columns:             tableConfig.Columns,
+			PartialColumns:      len(newInfo.Columns) < columnCount,
 			Fields:              strings.Join(tableConfig.Fields, ","),
-			Range:               tableConfig.Range,
+			Range:               tableRange,
 			NeedUnifiedTimeZone: needUnifiedTimeZone,
 			Collation:           tableConfig.Collation,
 			ChunkSize:           tableConfig.ChunkSize,
+			CheckThreadCount:    tableConfig.CheckThreadCount,
+			ErrorPolicy:         errorPolicy,
+			LargeColumns:        largeColumns,
+			ChangeHintColumn:    tableConfig.ChangeHintColumn,
+			Tolerance:           tolerance,
+			ColumnMap:           columnMap,
+			SourceExpressions:   sourceExpressions,
+			TargetExpressions:   targetExpressions,
+			SensitiveColumns:    sensitiveColumns,
+			FullRowHash:         fullRowHash,
+			Partitions:          partitions,
+			ChecksumAlgorithm:   cfg.GetChecksumAlgorithm(),
+			Notes:               notes,
+			Query:               query,
+			SourceQuery:         sourceQuery,
 		})
 
 		// When the router set case-sensitive false,
@@ -149,25 +294,202 @@ func NewSources(ctx context.Context, cfg *config.Config) (downstream Source, ups
 		return nil, nil, errors.Errorf("no table need to be compared")
 	}
 
+	instances := append([]*config.DataSource{cfg.Task.TargetInstance}, cfg.Task.SourceInstances...)
+	for _, tableDiff := range tableDiffs {
+		if err := checkCollation(ctx, tableDiff, instances); err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+	}
+
+	tableOrder := cfg.GetTableOrder()
+	if cfg.LargeTableThreshold > 0 || tableOrder == config.TableOrderLargestFirst || tableOrder == config.TableOrderSmallestFirst {
+		estimateTableSizes(ctx, cfg.Task.TargetInstance.Conn, tableDiffs)
+	}
+	if cfg.LargeTableThreshold > 0 {
+		markLargeTables(tableDiffs, cfg.LargeTableThreshold)
+	}
+	priorityTables, err := cfg.GetPriorityTables()
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
 	// Sort TableDiff is important!
 	// because we compare table one by one.
-	sort.Slice(tableDiffs, func(i, j int) bool {
-		ti := utils.UniqueID(tableDiffs[i].Schema, tableDiffs[i].Table)
-		tj := utils.UniqueID(tableDiffs[j].Schema, tableDiffs[j].Table)
-		return strings.Compare(ti, tj) > 0
-	})
-	upstream, err = buildSourceFromCfg(ctx, tableDiffs, cfg.CheckThreadCount, cfg.Task.SourceInstances...)
+	sortTables(tableDiffs, tableOrder, priorityTables, cfg.GetLargeTableAction() == config.LargeTableDefer)
+	upstream, err = buildSourceFromCfg(ctx, tableDiffs, cfg.CheckThreadCount, cfg.GetTableThreadCount(), false, cfg.Task.SourceInstances...)
 	if err != nil {
 		return nil, nil, errors.Annotate(err, "from upstream")
 	}
-	downstream, err = buildSourceFromCfg(ctx, tableDiffs, cfg.CheckThreadCount, cfg.Task.TargetInstance)
+	downstream, err = buildSourceFromCfg(ctx, tableDiffs, cfg.CheckThreadCount, cfg.GetTableThreadCount(), true, cfg.Task.TargetInstance)
 	if err != nil {
 		return nil, nil, errors.Annotate(err, "from downstream")
 	}
 	return downstream, upstream, nil
 }
 
-func buildSourceFromCfg(ctx context.Context, tableDiffs []*common.TableDiff, checkThreadCount int, dbs ...*config.DataSource) (Source, error) {
+// excludeRows returns the range without the rows matching `ignoreWhere`.
+// The rows whose `ignoreWhere` is NULL are kept, because they don't match it.
+func excludeRows(tableRange, ignoreWhere string) string {
+	return fmt.Sprintf("(%s) AND ((%s) IS NOT TRUE)", tableRange, ignoreWhere)
+}
+
+// getHashColumns returns the columns selected as their hashes when reading the rows of the range.
+func getHashColumns(table *common.TableDiff, tableRange *splitter.RangeInfo) []string {
+	if tableRange.FullColumns {
+		return nil
+	}
+	return table.LargeColumns
+}
+
+// isRowHashes returns true if the hashes of the full rows and their counts are read instead of the rows,
+// which is the case of the tables compared by `full-row-hash` unless the full rows of a hash are fetched.
+func isRowHashes(table *common.TableDiff, tableRange *splitter.RangeInfo) bool {
+	return table.FullRowHash && !tableRange.FullColumns
+}
+
+// checkSpecialIndexes removes the expression indexes of the table, and returns the notes of
+// the expression indexes and the prefix indexes, which are not used to split chunks by buckets.
+func checkSpecialIndexes(tableConfig *config.TableConfig) []string {
+	notes := make([]string, 0)
+	tableName := dbutil.TableName(tableConfig.Schema, tableConfig.Table)
+	removed := utils.RemoveExpressionIndexes(tableConfig.TargetTableInfo)
+	if len(removed) > 0 {
+		log.Warn("ignore the expression indexes of table", zap.String("table", tableName), zap.Strings("indexes", removed))
+		notes = append(notes, fmt.Sprintf("expression indexes %s are ignored", strings.Join(removed, ",")))
+	}
+	for _, index := range tableConfig.TargetTableInfo.Indices {
+		if (index.Primary || index.Unique) && utils.IsPrefixIndex(index) {
+			log.Warn("prefix index is not used to split chunks by buckets, fall back to the full column values",
+				zap.String("table", tableName), zap.String("index", index.Name.O))
+			notes = append(notes, fmt.Sprintf("prefix index %s is split by the full column values", index.Name.O))
+		}
+	}
+	return notes
+}
+
+// checkCollation checks the collation of the table exists in all the instances,
+// and matches the charset of the index columns, which are compared with the collation.
+func checkCollation(ctx context.Context, tableDiff *common.TableDiff, instances []*config.DataSource) error {
+	if tableDiff.Collation == "" {
+		return nil
+	}
+	tableName := dbutil.TableName(tableDiff.Schema, tableDiff.Table)
+	charset := ""
+	for _, instance := range instances {
+		cs, err := utils.GetCharsetByCollation(ctx, instance.Conn, tableDiff.Collation)
+		if err != nil {
+			return errors.Annotatef(err, "get the charset of collation %s for table %s", tableDiff.Collation, tableName)
+		}
+		if cs == "" {
+			return errors.Errorf("the collation %s of table %s doesn't exist in %s", tableDiff.Collation, tableName, dbutil.HostPort(instance.Host, instance.Port))
+		}
+		charset = cs
+	}
+
+	for _, index := range tableDiff.Info.Indices {
+		for _, indexColumn := range index.Columns {
+			column := tableDiff.Info.Columns[indexColumn.Offset]
+			if column.FieldType.Charset == "" || column.FieldType.Charset == "binary" {
+				continue
+			}
+			if column.FieldType.Charset != charset {
+				return errors.Errorf("the collation %s of table %s doesn't match the charset %s of column %s", tableDiff.Collation, tableName, column.FieldType.Charset, column.Name.O)
+			}
+		}
+	}
+	return nil
+}
+
+// estimateTableSizes estimates the sizes of the tables in the target, the sizes of the result sets of the queries
+// and the tables failed to estimate are left 0.
+func estimateTableSizes(ctx context.Context, db *sql.DB, tableDiffs []*common.TableDiff) {
+	for _, tableDiff := range tableDiffs {
+		if tableDiff.Query != "" {
+			// the size of the result set of a query is unknown.
+			continue
+		}
+		size, err := utils.GetTableSize(ctx, db, tableDiff.Schema, tableDiff.Table)
+		if err != nil {
+			log.Warn("fail to estimate the table size, treat it as an empty table",
+				zap.String("table", dbutil.TableName(tableDiff.Schema, tableDiff.Table)),
+				zap.Error(err))
+			continue
+		}
+		tableDiff.EstimatedSize = size
+	}
+}
+
+// markLargeTables marks the tables whose estimated size in the target exceeds the threshold.
+func markLargeTables(tableDiffs []*common.TableDiff, threshold int64) {
+	for _, tableDiff := range tableDiffs {
+		if tableDiff.EstimatedSize > threshold {
+			log.Info("found large table",
+				zap.String("table", dbutil.TableName(tableDiff.Schema, tableDiff.Table)),
+				zap.Int64("size", tableDiff.EstimatedSize))
+			tableDiff.LargeTable = true
+		}
+	}
+}
+
+// sortTables sorts the tables in the order they are compared by `table-order`, the tables of the same
+// order are sorted by the descending order of their names. The deferred large tables are compared
+// after all the other tables.
+func sortTables(tableDiffs []*common.TableDiff, order string, priorityTables []tableFilter.Filter, deferLargeTables bool) {
+	priority := func(tableDiff *common.TableDiff) int {
+		for i, f := range priorityTables {
+			if f.MatchTable(tableDiff.Schema, tableDiff.Table) {
+				return i
+			}
+		}
+		return len(priorityTables)
+	}
+	sort.Slice(tableDiffs, func(i, j int) bool {
+		// the deferred large tables are compared after all the other tables.
+		if deferLargeTables && tableDiffs[i].LargeTable != tableDiffs[j].LargeTable {
+			return !tableDiffs[i].LargeTable
+		}
+		switch {
+		case order == config.TableOrderLargestFirst && tableDiffs[i].EstimatedSize != tableDiffs[j].EstimatedSize:
+			return tableDiffs[i].EstimatedSize > tableDiffs[j].EstimatedSize
+		case order == config.TableOrderSmallestFirst && tableDiffs[i].EstimatedSize != tableDiffs[j].EstimatedSize:
+			return tableDiffs[i].EstimatedSize < tableDiffs[j].EstimatedSize
+		case order == config.TableOrderPriority:
+			if pi, pj := priority(tableDiffs[i]), priority(tableDiffs[j]); pi != pj {
+				return pi < pj
+			}
+		}
+		ti := utils.UniqueID(tableDiffs[i].Schema, tableDiffs[i].Table)
+		tj := utils.UniqueID(tableDiffs[j].Schema, tableDiffs[j].Table)
+		return strings.Compare(ti, tj) > 0
+	})
+}
+
+// RestoreTableOrder reorders the tables in place by their names in order, which are the names of the tables saved
+// in the checkpoint, so that the chunks of the checkpoint keyed by the table indexes match the tables even if the
+// estimated sizes of the tables are changed. It returns false if the names aren't the names of the tables.
+func RestoreTableOrder(tableDiffs []*common.TableDiff, names []string) bool {
+	if len(names) != len(tableDiffs) {
+		return false
+	}
+	tableMap := make(map[string]*common.TableDiff, len(tableDiffs))
+	for _, tableDiff := range tableDiffs {
+		tableMap[dbutil.TableName(tableDiff.Schema, tableDiff.Table)] = tableDiff
+	}
+	ordered := make([]*common.TableDiff, 0, len(names))
+	for _, name := range names {
+		tableDiff, ok := tableMap[name]
+		if !ok {
+			return false
+		}
+		ordered = append(ordered, tableDiff)
+		delete(tableMap, name)
+	}
+	copy(tableDiffs, ordered)
+	return true
+}
+
+// buildSourceFromCfg builds the source of the instances, isTarget is true if they are the target instance.
+func buildSourceFromCfg(ctx context.Context, tableDiffs []*common.TableDiff, checkThreadCount int, tableThreadCount int, isTarget bool, dbs ...*config.DataSource) (Source, error) {
 	if len(dbs) < 1 {
 		return nil, errors.Errorf("no db config detected")
 	}
@@ -178,27 +500,241 @@ func buildSourceFromCfg(ctx context.Context, tableDiffs []*common.TableDiff, che
 
 	if ok {
 		if len(dbs) == 1 {
-			return NewTiDBSource(ctx, tableDiffs, dbs[0], checkThreadCount)
+			return NewTiDBSource(ctx, tableDiffs, dbs[0], checkThreadCount, tableThreadCount, isTarget)
 		} else {
 			log.Fatal("Don't support check table in multiple tidb instance, please specify one tidb instance.")
 		}
 	}
-	return NewMySQLSources(ctx, tableDiffs, dbs, checkThreadCount)
+	return NewMySQLSources(ctx, tableDiffs, dbs, checkThreadCount, tableThreadCount, isTarget)
+}
+
+// checkColumnMap checks the target columns of the map of the option exist, and returns the map keyed by
+// the names of the target columns in the table info.
+func checkColumnMap(tableConfig *config.TableConfig, option string, m map[string]string) (map[string]string, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	if tableConfig.QueryCheck != nil {
+		return nil, errors.Errorf("`%s` is not supported by the query check %s", option, dbutil.TableName(tableConfig.Schema, tableConfig.Table))
+	}
+	columnMap := make(map[string]string, len(m))
+	for column, value := range m {
+		col := dbutil.FindColumnByName(tableConfig.TargetTableInfo.Columns, column)
+		if col == nil {
+			return nil, errors.Errorf("column %s in `%s` not found in table %s", column, option, dbutil.TableName(tableConfig.Schema, tableConfig.Table))
+		}
+		columnMap[col.Name.O] = value
+	}
+	return columnMap, nil
+}
+
+// columnMapString returns the column map in the format of `source->target` sorted by the target columns.
+func columnMapString(columnMap map[string]string) string {
+	columns := make([]string, 0, len(columnMap))
+	for column := range columnMap {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for i, column := range columns {
+		columns[i] = fmt.Sprintf("%s->%s", columnMap[column], column)
+	}
+	return strings.Join(columns, ",")
+}
+
+// checkTimeColumn checks the time column of `check-window` is a DATE, DATETIME or TIMESTAMP column of the table.
+func checkTimeColumn(tableConfig *config.TableConfig) error {
+	if tableConfig.TimeColumn == "" {
+		return nil
+	}
+	tableName := dbutil.TableName(tableConfig.Schema, tableConfig.Table)
+	col := dbutil.FindColumnByName(tableConfig.TargetTableInfo.Columns, tableConfig.TimeColumn)
+	if col == nil {
+		return errors.Errorf("column %s in `time-column` not found in table %s", tableConfig.TimeColumn, tableName)
+	}
+	switch col.FieldType.Tp {
+	case mysql.TypeDate, mysql.TypeDatetime, mysql.TypeTimestamp:
+		return nil
+	default:
+		return errors.Errorf("column %s in `time-column` of table %s is not a DATE, DATETIME or TIMESTAMP column", tableConfig.TimeColumn, tableName)
+	}
+}
+
+// checkPartitions returns the partitions of the table compared one by one, which are the partitions in `partitions`,
+// or all the partitions if `split-by-partition` is set. The rows of the partitions can't be selected from the query
+// of a query check or the table with the renamed or transformed columns, so such tables aren't split by partitions.
+func checkPartitions(tableConfig *config.TableConfig, splitByPartition, transformed bool) ([]*common.Partition, error) {
+	if len(tableConfig.Partitions) == 0 && (!splitByPartition || tableConfig.TargetTableInfo.GetPartitionInfo() == nil) {
+		return nil, nil
+	}
+	tableName := dbutil.TableName(tableConfig.Schema, tableConfig.Table)
+	if tableConfig.QueryCheck != nil || transformed {
+		if len(tableConfig.Partitions) > 0 {
+			return nil, errors.Errorf("`partitions` of table %s can't be set with the query check, column-map or the expressions", tableName)
+		}
+		log.Warn("the table with the transformed columns is not split by partitions", zap.String("table", tableName))
+		return nil, nil
+	}
+	names, conditions, err := utils.PartitionConditions(tableConfig.TargetTableInfo)
+	if err != nil {
+		if len(tableConfig.Partitions) > 0 {
+			return nil, errors.Annotatef(err, "`partitions` of table %s", tableName)
+		}
+		log.Warn("the table is not split by partitions", zap.String("table", tableName), zap.Error(err))
+		return nil, nil
+	}
+	partitions := make([]*common.Partition, 0, len(names))
+	for i, name := range names {
+		if len(tableConfig.Partitions) > 0 && !containsFold(tableConfig.Partitions, name) {
+			continue
+		}
+		partitions = append(partitions, &common.Partition{Name: name, Where: conditions[i]})
+	}
+	for _, name := range tableConfig.Partitions {
+		if !containsFold(names, name) {
+			return nil, errors.Errorf("partition %s in `partitions` not found in table %s", name, tableName)
+		}
+	}
+	return partitions, nil
+}
+
+// containsFold returns true if the names contain the name case-insensitively.
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSensitiveColumns checks the sensitive columns can be compared by their hashes, and returns their names
+// in the table info. The unique keys can't be sensitive since the rows are split and identified by them,
+// and the numeric values compared by the tolerance can't be hashed.
+func checkSensitiveColumns(tableConfig *config.TableConfig) ([]string, error) {
+	if len(tableConfig.SensitiveColumns) == 0 {
+		return nil, nil
+	}
+	tableName := dbutil.TableName(tableConfig.Schema, tableConfig.Table)
+	if tableConfig.QueryCheck != nil {
+		return nil, errors.Errorf("`sensitive-columns` is not supported by the query check %s", tableName)
+	}
+	columns := make([]string, 0, len(tableConfig.SensitiveColumns))
+	for _, column := range tableConfig.SensitiveColumns {
+		col := dbutil.FindColumnByName(tableConfig.TargetTableInfo.Columns, column)
+		if col == nil {
+			return nil, errors.Errorf("column %s in `sensitive-columns` not found in table %s", column, tableName)
+		}
+		for _, index := range tableConfig.TargetTableInfo.Indices {
+			if !index.Primary && !index.Unique {
+				continue
+			}
+			for _, indexCol := range index.Columns {
+				if indexCol.Name.L == col.Name.L {
+					return nil, errors.Errorf("column %s in `sensitive-columns` is in the unique key %s of table %s", column, index.Name.O, tableName)
+				}
+			}
+		}
+		if _, ok := utils.NewTolerance(tableConfig.FloatTolerance, tableConfig.ColumnTolerances, false).Of(col); ok {
+			return nil, errors.Errorf("column %s in `sensitive-columns` of table %s is compared by the tolerance", column, tableName)
+		}
+		columns = append(columns, col.Name.O)
+	}
+	return columns, nil
+}
+
+// hashSensitiveColumns returns the expressions selecting the SHA2 hashes of the sensitive columns, which
+// wrap the expressions or the renamed columns of the sensitive columns if they have.
+func hashSensitiveColumns(sensitiveColumns []string, expressions, columnMap map[string]string) map[string]string {
+	hashExpressions := make(map[string]string, len(expressions)+len(sensitiveColumns))
+	for column, expression := range expressions {
+		hashExpressions[column] = expression
+	}
+	for _, column := range sensitiveColumns {
+		expression, ok := expressions[column]
+		if !ok {
+			expression = dbutil.ColumnName(column)
+			if sourceColumn, ok := columnMap[column]; ok {
+				expression = dbutil.ColumnName(sourceColumn)
+			}
+		}
+		hashExpressions[column] = utils.SensitiveColumnExpression(expression)
+	}
+	return hashExpressions
+}
+
+// expressionsString returns the expressions of the source and the target in the format of `column: source vs target`
+// sorted by the columns, the column itself is used if it has no expression on one side.
+func expressionsString(sourceExpressions, targetExpressions map[string]string) string {
+	columns := make([]string, 0, len(sourceExpressions)+len(targetExpressions))
+	for column := range sourceExpressions {
+		columns = append(columns, column)
+	}
+	for column := range targetExpressions {
+		if _, ok := sourceExpressions[column]; !ok {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+	for i, column := range columns {
+		sourceExpression, targetExpression := column, column
+		if expression, ok := sourceExpressions[column]; ok {
+			sourceExpression = expression
+		}
+		if expression, ok := targetExpressions[column]; ok {
+			targetExpression = expression
+		}
+		columns[i] = fmt.Sprintf("%s: %s vs %s", column, sourceExpression, targetExpression)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// getQueryTableInfo returns the table info of the result set of the query, whose key columns are the same as the target.
+func getQueryTableInfo(ctx context.Context, db *sql.DB, tableDiff *common.TableDiff, query string) (*model.TableInfo, error) {
+	keyColumns := make([]string, 0)
+	for _, index := range tableDiff.Info.Indices {
+		if index.Primary {
+			for _, col := range index.Columns {
+				keyColumns = append(keyColumns, col.Name.O)
+			}
+		}
+	}
+	tableInfo, err := utils.GetQueryTableInfo(ctx, db, tableDiff.Schema, tableDiff.Table, query, keyColumns)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return tableInfo, nil
 }
 
 func initDBConn(ctx context.Context, cfg *config.Config) error {
 	// Unified time zone
-	vars := map[string]string{
-		"time_zone": UnifiedTimeZone,
+	vars := utils.UnifiedTimeZoneVars()
+	// we had `cfg.GetTableThreadCount()` producers and `cfg.CheckThreadCount` consumer to use db connections.
+	// so the connection count need to be cfg.CheckThreadCount + cfg.GetTableThreadCount().
+	if cfg.SyncPoint != nil {
+		if err := setSyncPointSnapshots(ctx, cfg, vars); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	// the connection with an expired snapshot fails with a confusing error, so check it first.
+	if err := checkSnapshot(ctx, "target", cfg.Task.TargetInstance, vars); err != nil {
+		return errors.Trace(err)
+	}
+	for _, source := range cfg.Task.SourceInstances {
+		if err := checkSnapshot(ctx, "source", source, vars); err != nil {
+			return errors.Trace(err)
+		}
 	}
-	// we had 3 producers and `cfg.CheckThreadCount` consumer to use db connections.
-	// so the connection count need to be cfg.CheckThreadCount + 3.
-	targetConn, err := common.CreateDB(ctx, cfg.Task.TargetInstance.ToDBConfig(), vars, cfg.CheckThreadCount+3)
+	targetConn, err := common.CreateDB(ctx, cfg.Task.TargetInstance.ToDBConfig(), vars, cfg.CheckThreadCount+cfg.GetTableThreadCount())
 	if err != nil {
 		return errors.Trace(err)
 	}
 
 	cfg.Task.TargetInstance.Conn = targetConn
+	initTimeZone(ctx, "target", cfg.Task.TargetInstance)
+	targetCharset, err := utils.GetSessionCharset(ctx, targetConn)
+	if err != nil {
+		return errors.Trace(err)
+	}
 
 	for _, source := range cfg.Task.SourceInstances {
 		// connect source db with target db time_zone
@@ -207,10 +743,182 @@ func initDBConn(ctx context.Context, cfg *config.Config) error {
 			return errors.Trace(err)
 		}
 		source.Conn = conn
+		initTimeZone(ctx, "source", source)
+		if err := unifySessionCharset(ctx, source, targetCharset, vars, cfg.CheckThreadCount+1); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return checkPrivileges(ctx, cfg)
+}
+
+// unifySessionCharset reconnects the source with the charset settings of the target if they are different,
+// otherwise the same rows are read as different values and the checksums never match.
+func unifySessionCharset(ctx context.Context, source *config.DataSource, targetCharset *utils.SessionCharsetInfo, vars map[string]string, connCount int) error {
+	sourceCharset, err := utils.GetSessionCharset(ctx, source.Conn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if sourceCharset.Equal(targetCharset) {
+		return nil
+	}
+	log.Warn("the session charset of source is different from target, use the settings of target",
+		zap.String("host", source.Host), zap.Int("port", source.Port),
+		zap.String("source character_set_results", sourceCharset.Results),
+		zap.String("source collation_connection", sourceCharset.CollationConnection),
+		zap.String("target character_set_results", targetCharset.Results),
+		zap.String("target collation_connection", targetCharset.CollationConnection))
+
+	charsetVars := targetCharset.Vars()
+	for k, v := range vars {
+		charsetVars[k] = v
+	}
+	source.Conn.Close()
+	conn, err := common.CreateDB(ctx, source.ToDBConfig(), charsetVars, connCount)
+	if err != nil {
+		return errors.Annotatef(err, "fail to use the session charset of target for source %s", dbutil.HostPort(source.Host, source.Port))
+	}
+	source.Conn = conn
+
+	sourceCharset, err = utils.GetSessionCharset(ctx, conn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !sourceCharset.Equal(targetCharset) {
+		return errors.Errorf("the session charset of source %s (character_set_results: %s, collation_connection: %s) can't be the same as target (character_set_results: %s, collation_connection: %s)",
+			dbutil.HostPort(source.Host, source.Port), sourceCharset.Results, sourceCharset.CollationConnection, targetCharset.Results, targetCharset.CollationConnection)
 	}
 	return nil
 }
 
+// checkPrivileges checks the users of the instances have the needed privileges, so it fails early.
+func checkPrivileges(ctx context.Context, cfg *config.Config) error {
+	targetPrivs := []mysql.PrivilegeType{mysql.SelectPriv}
+	if cfg.ApplyFixSQL {
+		// the fix sql is made up of REPLACE and DELETE
+		targetPrivs = append(targetPrivs, mysql.InsertPriv, mysql.DeletePriv)
+	}
+	// only the read access is needed if the fix sql is not applied.
+	if err := checkInstancePrivileges(ctx, "target", cfg.Task.TargetInstance, targetPrivs, !cfg.ApplyFixSQL); err != nil {
+		return errors.Trace(err)
+	}
+	for _, source := range cfg.Task.SourceInstances {
+		if err := checkInstancePrivileges(ctx, "source", source, []mysql.PrivilegeType{mysql.SelectPriv}, false); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func checkInstancePrivileges(ctx context.Context, instance string, ds *config.DataSource, privs []mysql.PrivilegeType, readOnly bool) error {
+	granted, err := utils.GetPrivileges(ctx, ds.Conn)
+	if err != nil {
+		// some cloud services forbid `SHOW GRANTS`, the comparison still fails later if the privileges are lacked.
+		log.Warn("fail to check the privileges of instance, skip it",
+			zap.String("instance", instance), zap.String("host", ds.Host), zap.Int("port", ds.Port), zap.Error(err))
+		return nil
+	}
+	if lacked := granted.Lack(privs, false); len(lacked) > 0 {
+		return errors.Errorf("the user '%s' of %s %s lacks the privileges %s, please grant them to the user, e.g. `GRANT %s ON *.* TO '%s'`",
+			ds.User, instance, dbutil.HostPort(ds.Host, ds.Port), strings.Join(lacked, ","), strings.Join(lacked, ","), ds.User)
+	}
+	if readOnly && granted.IsSuperUser() {
+		log.Warn("the user of instance is a superuser while only the read access is needed, a read-only user is recommended",
+			zap.String("instance", instance), zap.String("host", ds.Host), zap.Int("port", ds.Port), zap.String("user", ds.User))
+	}
+	return nil
+}
+
+// setSyncPointSnapshots sets the snapshots of the source and the target to the latest consistent pair
+// recorded by the changefeed of TiCDC, so users needn't work out the matching snapshots.
+func setSyncPointSnapshots(ctx context.Context, cfg *config.Config, vars map[string]string) error {
+	target := cfg.Task.TargetInstance
+	db, err := dbutil.OpenDB(*target.ToDBConfig(), vars)
+	if err != nil {
+		return errors.Annotatef(err, "connect to target %s", dbutil.HostPort(target.Host, target.Port))
+	}
+	defer dbutil.CloseDB(db)
+	primaryTS, secondaryTS, err := utils.GetLatestSyncPoint(ctx, db, cfg.SyncPoint.ClusterID, cfg.SyncPoint.Changefeed)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("use the snapshots of the latest syncpoint",
+		zap.String("changefeed", cfg.SyncPoint.Changefeed),
+		zap.String("source snapshot", primaryTS),
+		zap.String("target snapshot", secondaryTS))
+	cfg.Task.SourceInstances[0].Snapshot = primaryTS
+	target.Snapshot = secondaryTS
+	return nil
+}
+
+// checkSnapshot checks the snapshot of the TiDB instance is not older than the GC safe point,
+// and resolves how the snapshot is read by the capability of the instance.
+func checkSnapshot(ctx context.Context, instance string, ds *config.DataSource, vars map[string]string) error {
+	if len(ds.Snapshot) == 0 {
+		return nil
+	}
+	if ds.GetSnapshotMode() == config.SnapshotModeNone {
+		log.Warn("ignore the snapshot, the latest data is read", zap.String("instance", instance), zap.String("snapshot", ds.Snapshot))
+		return nil
+	}
+	dbCfg := ds.ToDBConfig()
+	// connect without the snapshot, which may be expired
+	dbCfg.Snapshot = ""
+	db, err := dbutil.OpenDB(*dbCfg, vars)
+	if err != nil {
+		return errors.Annotatef(err, "connect to %s %s", instance, dbutil.HostPort(ds.Host, ds.Port))
+	}
+	defer dbutil.CloseDB(db)
+	if ok, _ := dbutil.IsTiDB(ctx, db); !ok {
+		return nil
+	}
+	// the GC safe point is read from the TiDB, so it's the one of the keyspace in a multi-tenant cluster.
+	if err := utils.CheckSnapshotNotGCed(ctx, db, ds.Snapshot); err != nil {
+		return errors.Annotatef(err, "check snapshot of %s %s", instance, dbutil.HostPort(ds.Host, ds.Port))
+	}
+	mode, err := resolveSnapshotMode(ctx, db, ds)
+	if err != nil {
+		return errors.Annotatef(err, "check snapshot of %s %s", instance, dbutil.HostPort(ds.Host, ds.Port))
+	}
+	log.Info("read the snapshot", zap.String("instance", instance), zap.String("snapshot", ds.Snapshot), zap.String("snapshot-mode", mode))
+	ds.ResolvedSnapshotMode = mode
+	return nil
+}
+
+// resolveSnapshotMode returns the mode to read the snapshot of TiDB, `tidb_snapshot` is preferred in `auto` mode
+// because it also applies to the statistics and the structures, and `AS OF TIMESTAMP` is used if it's restricted.
+func resolveSnapshotMode(ctx context.Context, db *sql.DB, ds *config.DataSource) (string, error) {
+	mode := ds.GetSnapshotMode()
+	if mode == config.SnapshotModeAuto || mode == config.SnapshotModeTiDBSnapshot {
+		err := utils.CheckTiDBSnapshotAllowed(ctx, db, ds.Snapshot)
+		if err == nil {
+			return config.SnapshotModeTiDBSnapshot, nil
+		}
+		if mode == config.SnapshotModeTiDBSnapshot {
+			return "", errors.Annotate(err, "tidb_snapshot is not allowed, try snapshot-mode as-of-timestamp")
+		}
+		log.Warn("tidb_snapshot is not allowed, try AS OF TIMESTAMP", zap.Error(err))
+	}
+	if err := utils.CheckAsOfTimestampAllowed(ctx, db, ds.Snapshot); err != nil {
+		return "", errors.Annotate(err, "AS OF TIMESTAMP is not allowed")
+	}
+	return config.SnapshotModeAsOfTimestamp, nil
+}
+
+// initTimeZone records the session time zone of the connections of the data source, which decides the values of
+// the timestamp columns, and logs the time zones to help diagnose the differences of timestamp columns.
+func initTimeZone(ctx context.Context, instance string, ds *config.DataSource) {
+	tz, err := utils.GetTimeZone(ctx, ds.Conn)
+	if err != nil {
+		log.Warn("fail to get time zone", zap.String("instance", instance), zap.Error(err))
+		return
+	}
+	log.Info("time zone of instance", zap.String("instance", instance), zap.String("session", tz.Session), zap.String("system", tz.System))
+	ds.SessionTimeZone = tz.Session
+	if ds.Location, err = tz.Location(); err != nil {
+		log.Warn("fail to parse time zone", zap.String("instance", instance), zap.Error(err))
+	}
+}
+
 func initTables(ctx context.Context, cfg *config.Config) (cfgTables []*config.TableConfig, err error) {
 	downStreamConn := cfg.Task.TargetInstance.Conn
 	TargetTablesList := make([]*common.TableSource, 0)
@@ -241,6 +949,12 @@ func initTables(ctx context.Context, cfg *config.Config) (cfgTables []*config.Ta
 	cfgTables = make([]*config.TableConfig, 0, len(TargetTablesList))
 	for _, tables := range TargetTablesList {
 		if cfg.Task.TargetCheckTables.MatchTable(tables.OriginSchema, tables.OriginTable) {
+			if cfg.Task.IsRecheck() && !cfg.Task.TargetRecheckTables.MatchTable(tables.OriginSchema, tables.OriginTable) {
+				continue
+			}
+			if !cfg.Task.IsImported(tables.OriginSchema, tables.OriginTable) {
+				continue
+			}
 			log.Debug("match target table", zap.String("table", dbutil.TableName(tables.OriginSchema, tables.OriginTable)))
 			tableInfo, err := dbutil.GetTableInfo(ctx, downStreamConn, tables.OriginSchema, tables.OriginTable)
 			if err != nil {
@@ -276,13 +990,52 @@ func initTables(ctx context.Context, cfg *config.Config) (cfgTables []*config.Ta
 					cfgTable.Range = table.Range
 				}
 				cfgTable.IgnoreColumns = table.IgnoreColumns
+				cfgTable.Columns = table.Columns
 				cfgTable.Fields = table.Fields
 				cfgTable.Collation = table.Collation
 				cfgTable.ChunkSize = table.ChunkSize
+				cfgTable.CheckThreadCount = table.CheckThreadCount
+				cfgTable.OnError = table.OnError
+				cfgTable.IgnoreWhere = table.IgnoreWhere
+				cfgTable.ChangeHintColumn = table.ChangeHintColumn
+				cfgTable.TimeColumn = table.TimeColumn
+				cfgTable.CheckWindow = table.CheckWindow
+				cfgTable.FloatTolerance = table.FloatTolerance
+				cfgTable.ColumnTolerances = table.ColumnTolerances
+				cfgTable.ColumnMap = table.ColumnMap
+				cfgTable.SourceExpressions = table.SourceExpressions
+				cfgTable.TargetExpressions = table.TargetExpressions
+				cfgTable.SensitiveColumns = table.SensitiveColumns
+				cfgTable.Partitions = table.Partitions
 				cfgTable.HasMatched = true
 			}
 		}
 	}
+
+	// The result sets of the query checks are compared like the tables.
+	for _, queryCheck := range cfg.Task.TargetQueryChecks {
+		if cfg.Task.IsRecheck() && !cfg.Task.TargetRecheckTables.MatchTable(queryCheck.Schema, queryCheck.Table) {
+			continue
+		}
+		for _, cfgTable := range cfgTables {
+			if cfgTable.Schema == queryCheck.Schema && cfgTable.Table == queryCheck.Table {
+				return nil, errors.Errorf("the target-table of query check %s.%s is also a checked table", queryCheck.Schema, queryCheck.Table)
+			}
+		}
+		tableInfo, err := utils.GetQueryTableInfo(ctx, downStreamConn, queryCheck.Schema, queryCheck.Table, queryCheck.TargetQuery, queryCheck.KeyColumns)
+		if err != nil {
+			return nil, errors.Annotatef(err, "get the result set information of query check %s.%s from target source", queryCheck.Schema, queryCheck.Table)
+		}
+		cfgTables = append(cfgTables, &config.TableConfig{
+			Schema:          queryCheck.Schema,
+			Table:           queryCheck.Table,
+			TargetTableInfo: tableInfo,
+			Range:           "TRUE",
+			ChunkSize:       queryCheck.ChunkSize,
+			OnError:         queryCheck.OnError,
+			QueryCheck:      queryCheck,
+		})
+	}
 	return cfgTables, nil
 }
 
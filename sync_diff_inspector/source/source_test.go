@@ -159,7 +159,7 @@ func TestTiDBSource(t *testing.T) {
 
 	tableDiffs := prepareTiDBTables(t, tableCases)
 
-	tidb, err := NewTiDBSource(ctx, tableDiffs, &config.DataSource{Conn: conn}, 1)
+	tidb, err := NewTiDBSource(ctx, tableDiffs, &config.DataSource{Conn: conn}, 1, config.DefaultTableThreadCount, false)
 	require.NoError(t, err)
 
 	for n, tableCase := range tableCases {
@@ -173,7 +173,7 @@ func TestTiDBSource(t *testing.T) {
 	}
 
 	// Test ChunkIterator
-	iter, err := tidb.GetRangeIterator(ctx, tableCases[0].rangeInfo, &MockAnalyzer{})
+	iter, err := tidb.GetRangeIterator(ctx, map[int]*splitter.RangeInfo{0: tableCases[0].rangeInfo}, &MockAnalyzer{})
 	require.NoError(t, err)
 	resRecords := [][]bool{
 		{false, false, false, false, false},
@@ -305,7 +305,7 @@ func TestMysqlShardSources(t *testing.T) {
 		cs[i] = &config.DataSource{Conn: conn}
 	}
 
-	shard, err := NewMySQLSources(ctx, tableDiffs, cs, 4)
+	shard, err := NewMySQLSources(ctx, tableDiffs, cs, 4, config.DefaultTableThreadCount, false)
 	require.NoError(t, err)
 
 	for i := 0; i < len(dbs); i++ {
@@ -429,7 +429,7 @@ func TestMysqlRouter(t *testing.T) {
 	mock.ExpectQuery("SHOW FULL TABLES IN.*").WillReturnRows(tablesRows)
 	tablesRows = sqlmock.NewRows([]string{"Tables_in_test", "Table_type"}).AddRow("test_t", "BASE TABLE")
 	mock.ExpectQuery("SHOW FULL TABLES IN.*").WillReturnRows(tablesRows)
-	mysql, err := NewMySQLSources(ctx, tableDiffs, []*config.DataSource{ds}, 4)
+	mysql, err := NewMySQLSources(ctx, tableDiffs, []*config.DataSource{ds}, 4, config.DefaultTableThreadCount, false)
 	require.NoError(t, err)
 
 	// random splitter
@@ -440,7 +440,7 @@ func TestMysqlRouter(t *testing.T) {
 	require.NoError(t, err)
 	rangeIter.Close()
 
-	rangeIter, err = mysql.GetRangeIterator(ctx, tableCases[0].rangeInfo, mysql.GetTableAnalyzer())
+	rangeIter, err = mysql.GetRangeIterator(ctx, map[int]*splitter.RangeInfo{0: tableCases[0].rangeInfo}, mysql.GetTableAnalyzer())
 	require.NoError(t, err)
 	rangeIter.Close()
 
@@ -534,7 +534,7 @@ func TestTiDBRouter(t *testing.T) {
 	mock.ExpectQuery("SHOW FULL TABLES IN.*").WillReturnRows(tablesRows)
 	tablesRows = sqlmock.NewRows([]string{"Tables_in_test", "Table_type"}).AddRow("test2", "BASE TABLE")
 	mock.ExpectQuery("SHOW FULL TABLES IN.*").WillReturnRows(tablesRows)
-	tidb, err := NewTiDBSource(ctx, tableDiffs, ds, 1)
+	tidb, err := NewTiDBSource(ctx, tableDiffs, ds, 1, config.DefaultTableThreadCount, false)
 	require.NoError(t, err)
 	infoRows := sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("test_t", "CREATE TABLE `source_test`.`test1` (`a` int, `b` varchar(24), `c` float, primary key(`a`, `b`))")
 	mock.ExpectQuery("SHOW CREATE TABLE.*").WillReturnRows(infoRows)
@@ -672,6 +672,47 @@ func TestSource(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestCheckCollation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	upConn, upMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer upConn.Close()
+	downConn, downMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer downConn.Close()
+	instances := []*config.DataSource{{Host: "127.0.0.1", Port: 4000, Conn: downConn}, {Host: "127.0.0.1", Port: 3306, Conn: upConn}}
+
+	createTableSQL := "create table `test`.`test`(`a` int, `b` varchar(10) character set latin1, `c` varchar(10) character set utf8mb4, primary key(`a`, `b`), key(`c`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	tableDiff := &common.TableDiff{Schema: "test", Table: "test", Info: tableInfo}
+	require.NoError(t, checkCollation(ctx, tableDiff, instances))
+
+	// the collation doesn't exist in upstream
+	tableDiff.Collation = "latin1_bin"
+	downMock.ExpectQuery("COLLATIONS").WithArgs("latin1_bin").WillReturnRows(sqlmock.NewRows([]string{"CHARACTER_SET_NAME"}).AddRow("latin1"))
+	upMock.ExpectQuery("COLLATIONS").WithArgs("latin1_bin").WillReturnRows(sqlmock.NewRows([]string{"CHARACTER_SET_NAME"}))
+	err = checkCollation(ctx, tableDiff, instances)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "doesn't exist in 127.0.0.1:3306")
+
+	// the collation doesn't match the charset of column `c`
+	downMock.ExpectQuery("COLLATIONS").WithArgs("latin1_bin").WillReturnRows(sqlmock.NewRows([]string{"CHARACTER_SET_NAME"}).AddRow("latin1"))
+	upMock.ExpectQuery("COLLATIONS").WithArgs("latin1_bin").WillReturnRows(sqlmock.NewRows([]string{"CHARACTER_SET_NAME"}).AddRow("latin1"))
+	err = checkCollation(ctx, tableDiff, instances)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "doesn't match the charset utf8mb4 of column c")
+
+	createTableSQL = "create table `test`.`test`(`a` int, `b` varchar(10) character set latin1, primary key(`a`, `b`))"
+	tableDiff.Info, err = dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	downMock.ExpectQuery("COLLATIONS").WithArgs("latin1_bin").WillReturnRows(sqlmock.NewRows([]string{"CHARACTER_SET_NAME"}).AddRow("latin1"))
+	upMock.ExpectQuery("COLLATIONS").WithArgs("latin1_bin").WillReturnRows(sqlmock.NewRows([]string{"CHARACTER_SET_NAME"}).AddRow("latin1"))
+	require.NoError(t, checkCollation(ctx, tableDiff, instances))
+}
+
 func TestInitTables(t *testing.T) {
 	ctx := context.Background()
 	cfg := config.NewConfig()
@@ -724,3 +765,118 @@ func TestInitTables(t *testing.T) {
 	require.Contains(t, err.Error(), "different config matched to same target table")
 	require.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestExcludeRows(t *testing.T) {
+	require.Equal(t, "(TRUE) AND ((deleted_at IS NOT NULL) IS NOT TRUE)", excludeRows("TRUE", "deleted_at IS NOT NULL"))
+	require.Equal(t, "(age > 10) AND ((status = 'deleted' OR status = 'archived') IS NOT TRUE)", excludeRows("age > 10", "status = 'deleted' OR status = 'archived'"))
+}
+
+func TestMockSource(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.Task.TargetInstance = &config.DataSource{
+		SourceType: config.SourceTypeMock,
+		Mock:       &config.MockConfig{Tables: 3, Rows: 2500, Seed: 1, CorruptionRate: 0.01},
+	}
+	cfg.Task.SourceInstances = []*config.DataSource{{
+		SourceType: config.SourceTypeMock,
+		Mock:       &config.MockConfig{Tables: 3, Rows: 2500, Seed: 1},
+	}}
+	var err error
+	cfg.Task.TargetCheckTables, err = filter.Parse([]string{"mock.t0", "mock.t2"})
+	require.NoError(t, err)
+
+	downstream, upstream, err := NewSources(ctx, cfg)
+	require.NoError(t, err)
+	tableDiffs := downstream.GetTables()
+	require.Len(t, tableDiffs, 2)
+	require.Equal(t, "t2", tableDiffs[0].Table)
+	require.Equal(t, "t0", tableDiffs[1].Table)
+	require.Nil(t, downstream.GetDB())
+
+	iter, err := upstream.GetRangeIterator(ctx, nil, upstream.GetTableAnalyzer())
+	require.NoError(t, err)
+	defer iter.Close()
+	chunks, unequalChunks := 0, 0
+	var upstreamCount, downstreamCount int64
+	for {
+		rangeInfo, err := iter.Next(ctx)
+		require.NoError(t, err)
+		if rangeInfo == nil {
+			break
+		}
+		chunks++
+		upstreamInfo := upstream.GetCountAndCrc32(ctx, rangeInfo)
+		downstreamInfo := downstream.GetCountAndCrc32(ctx, rangeInfo)
+		upstreamCount += upstreamInfo.Count
+		downstreamCount += downstreamInfo.Count
+		require.NoError(t, upstreamInfo.Err)
+		require.NoError(t, downstreamInfo.Err)
+		// the mock sources are deterministic.
+		require.Equal(t, upstreamInfo.Checksum, upstream.GetCountAndCrc32(ctx, rangeInfo).Checksum)
+		if upstreamInfo.Checksum != downstreamInfo.Checksum {
+			unequalChunks++
+		}
+
+		rows, err := upstream.GetRowsIterator(ctx, rangeInfo)
+		require.NoError(t, err)
+		rowCount := int64(0)
+		for {
+			row, err := rows.Next()
+			require.NoError(t, err)
+			if row == nil {
+				break
+			}
+			rowCount++
+		}
+		require.Equal(t, upstreamInfo.Count, rowCount)
+	}
+	// 2500 rows are split into 3 chunks of each table.
+	require.Equal(t, 6, chunks)
+	require.Equal(t, int64(5000), upstreamCount)
+	require.Less(t, downstreamCount, upstreamCount)
+	require.Greater(t, unequalChunks, 0)
+}
+
+func TestSortTables(t *testing.T) {
+	newTables := func() []*common.TableDiff {
+		return []*common.TableDiff{
+			{Schema: "a", Table: "t1", EstimatedSize: 30},
+			{Schema: "b", Table: "t2", EstimatedSize: 10, LargeTable: true},
+			{Schema: "c", Table: "t3", EstimatedSize: 20},
+			{Schema: "d", Table: "t4", EstimatedSize: 20},
+		}
+	}
+	names := func(tableDiffs []*common.TableDiff) []string {
+		res := make([]string, 0, len(tableDiffs))
+		for _, tableDiff := range tableDiffs {
+			res = append(res, tableDiff.Table)
+		}
+		return res
+	}
+
+	tableDiffs := newTables()
+	sortTables(tableDiffs, config.TableOrderName, nil, false)
+	require.Equal(t, []string{"t4", "t3", "t2", "t1"}, names(tableDiffs))
+	sortTables(tableDiffs, config.TableOrderName, nil, true)
+	require.Equal(t, []string{"t4", "t3", "t1", "t2"}, names(tableDiffs))
+
+	// the tables of the same size are sorted by the names.
+	sortTables(tableDiffs, config.TableOrderLargestFirst, nil, false)
+	require.Equal(t, []string{"t1", "t4", "t3", "t2"}, names(tableDiffs))
+	sortTables(tableDiffs, config.TableOrderSmallestFirst, nil, false)
+	require.Equal(t, []string{"t2", "t4", "t3", "t1"}, names(tableDiffs))
+
+	cfg := &config.Config{PriorityTables: []string{"c.*", "a.t1"}}
+	priorityTables, err := cfg.GetPriorityTables()
+	require.NoError(t, err)
+	sortTables(tableDiffs, config.TableOrderPriority, priorityTables, false)
+	require.Equal(t, []string{"t3", "t1", "t4", "t2"}, names(tableDiffs))
+
+	// the order saved in the checkpoint is restored only if it has the same tables.
+	require.True(t, RestoreTableOrder(tableDiffs, []string{"`b`.`t2`", "`a`.`t1`", "`d`.`t4`", "`c`.`t3`"}))
+	require.Equal(t, []string{"t2", "t1", "t4", "t3"}, names(tableDiffs))
+	require.False(t, RestoreTableOrder(tableDiffs, []string{"`b`.`t2`", "`a`.`t1`", "`d`.`t4`", "`e`.`t5`"}))
+	require.False(t, RestoreTableOrder(tableDiffs, []string{"`b`.`t2`"}))
+	require.Equal(t, []string{"t2", "t1", "t4", "t3"}, names(tableDiffs))
+}
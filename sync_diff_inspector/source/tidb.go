@@ -23,6 +23,7 @@ import (
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
 	"github.com/pingcap/tidb-tools/pkg/filter"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/chaos"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/source/common"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/splitter"
@@ -43,7 +44,24 @@ func (a *TiDBTableAnalyzer) AnalyzeSplitter(ctx context.Context, table *common.T
 	originTable := *table
 	originTable.Schema = matchedSource.OriginSchema
 	originTable.Table = matchedSource.OriginTable
+	originTable.Query = matchedSource.Query
 	progressID := dbutil.TableName(table.Schema, table.Table)
+	if originTable.Query != "" {
+		// the result set of a query has no statistics, so it's split by the key columns directly.
+		limitIter, err := splitter.NewLimitIteratorWithCheckpoint(ctx, progressID, &originTable, a.dbConn, startRange)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return limitIter, nil
+	}
+	if len(table.Partitions) > 0 {
+		// the chunks are split in each partition, so the statistics of the whole table aren't used.
+		partitionIter, err := splitter.NewPartitionIteratorWithCheckpoint(ctx, progressID, &originTable, a.dbConn, startRange)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return partitionIter, nil
+	}
 	// if we decide to use bucket to split chunks
 	// we always use bucksIter even we load from checkpoint is not bucketNode
 	// TODO check whether we can use bucket for this table to split chunks.
@@ -83,8 +101,12 @@ type TiDBSource struct {
 	tableDiffs     []*common.TableDiff
 	sourceTableMap map[string]*common.TableSource
 	snapshot       string
+	// staleReadSnapshot is the snapshot read by `AS OF TIMESTAMP`, it's empty if `tidb_snapshot` is used.
+	staleReadSnapshot string
 	// checkThreadCount is the pool size of produce chunks
 	checkThreadCount int
+	// tableThreadCount is the number of tables produce chunks concurrently
+	tableThreadCount int
 	dbConn           *sql.DB
 }
 
@@ -97,19 +119,19 @@ func (s *TiDBSource) GetTableAnalyzer() TableAnalyzer {
 }
 
 func getMatchSource(sourceTableMap map[string]*common.TableSource, table *common.TableDiff) *common.TableSource {
-	if len(sourceTableMap) == 0 {
-		// no sourceTableMap, return the origin table name
-		return &common.TableSource{
-			OriginSchema: table.Schema,
-			OriginTable:  table.Table,
-		}
-	}
 	uniqueID := utils.UniqueID(table.Schema, table.Table)
-	return sourceTableMap[uniqueID]
+	if source, ok := sourceTableMap[uniqueID]; ok {
+		return source
+	}
+	// not in sourceTableMap, return the origin table name
+	return &common.TableSource{
+		OriginSchema: table.Schema,
+		OriginTable:  table.Table,
+	}
 }
 
-func (s *TiDBSource) GetRangeIterator(ctx context.Context, r *splitter.RangeInfo, analyzer TableAnalyzer) (RangeIterator, error) {
-	return NewChunksIterator(ctx, analyzer, s.tableDiffs, r)
+func (s *TiDBSource) GetRangeIterator(ctx context.Context, startRanges map[int]*splitter.RangeInfo, analyzer TableAnalyzer) (RangeIterator, error) {
+	return NewChunksIterator(ctx, analyzer, s.tableDiffs, startRanges, s.tableThreadCount)
 }
 
 func (s *TiDBSource) Close() {
@@ -121,14 +143,23 @@ func (s *TiDBSource) GetCountAndCrc32(ctx context.Context, tableRange *splitter.
 	chunk := tableRange.GetChunk()
 
 	matchSource := getMatchSource(s.sourceTableMap, table)
-	count, checksum, err := utils.GetCountAndCRC32Checksum(ctx, s.dbConn, matchSource.OriginSchema, matchSource.OriginTable, table.Info, chunk.Where, chunk.Args)
+	var (
+		count, checksum int64
+		err             error
+	)
+	if matchSource.Query != "" {
+		count, checksum, err = utils.GetQueryCountAndChecksum(ctx, s.dbConn, matchSource.Query, matchSource.OriginTable, table.Info, table.ChecksumAlgorithm, chunk.Where, chunk.Args)
+	} else {
+		count, checksum, err = utils.GetStaleCountAndChecksum(ctx, s.dbConn, matchSource.OriginSchema, matchSource.OriginTable, s.staleReadSnapshot, table.Info, table.ChecksumAlgorithm, chunk.Where, chunk.Args)
+	}
 
 	cost := time.Since(beginTime)
 	return &ChecksumInfo{
-		Checksum: checksum,
-		Count:    count,
-		Err:      err,
-		Cost:     cost,
+		Algorithm: table.ChecksumAlgorithm,
+		Checksum:  checksum,
+		Count:     count,
+		Err:       err,
+		Cost:      cost,
 	}
 }
 
@@ -141,11 +172,22 @@ func (s *TiDBSource) GetSourceStructInfo(ctx context.Context, tableIndex int) ([
 	tableInfos := make([]*model.TableInfo, 1)
 	tableDiff := s.GetTables()[tableIndex]
 	source := getMatchSource(s.sourceTableMap, tableDiff)
-	tableInfos[0], err = dbutil.GetTableInfo(ctx, s.GetDB(), source.OriginSchema, source.OriginTable)
+	switch {
+	case len(source.ColumnMap) > 0 || len(source.Expressions) > 0:
+		// the structure of the table is compared, instead of the result set of the query renaming the columns.
+		tableInfos[0], err = dbutil.GetTableInfo(ctx, s.GetDB(), source.OriginSchema, source.OriginTable)
+		if err == nil {
+			tableInfos[0] = utils.RenameColumns(tableInfos[0], source.ColumnMap)
+		}
+	case source.Query != "":
+		tableInfos[0], err = getQueryTableInfo(ctx, s.GetDB(), tableDiff, source.Query)
+	default:
+		tableInfos[0], err = dbutil.GetTableInfo(ctx, s.GetDB(), source.OriginSchema, source.OriginTable)
+	}
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	tableInfos[0], _ = utils.ResetColumns(tableInfos[0], tableDiff.IgnoreColumns)
+	tableInfos[0], _ = utils.ResetColumns(tableInfos[0], utils.ProjectColumns(tableInfos[0], tableDiff.IgnoreColumns, tableDiff.Columns))
 	return tableInfos, nil
 }
 
@@ -157,6 +199,9 @@ func (s *TiDBSource) GenerateFixSQL(t DMLType, upstreamData, downstreamData map[
 		return utils.GenerateDeleteDML(downstreamData, s.tableDiffs[tableIndex].Info, s.tableDiffs[tableIndex].Schema)
 	}
 	if t == Replace {
+		if s.tableDiffs[tableIndex].PartialColumns {
+			return utils.GenerateUpdateDMLWithAnnotation(upstreamData, downstreamData, s.tableDiffs[tableIndex].Info, s.tableDiffs[tableIndex].Schema)
+		}
 		return utils.GenerateReplaceDMLWithAnnotation(upstreamData, downstreamData, s.tableDiffs[tableIndex].Info, s.tableDiffs[tableIndex].Schema)
 	}
 	log.Fatal("Don't support this type", zap.Any("dml type", t))
@@ -168,10 +213,24 @@ func (s *TiDBSource) GetRowsIterator(ctx context.Context, tableRange *splitter.R
 
 	table := s.tableDiffs[tableRange.GetTableIndex()]
 	matchedSource := getMatchSource(s.sourceTableMap, table)
-	rowsQuery, _ := utils.GetTableRowsQueryFormat(matchedSource.OriginSchema, matchedSource.OriginTable, table.Info, table.Collation)
+	var rowsQuery string
+	hashColumns := getHashColumns(table, tableRange)
+	switch {
+	case isRowHashes(table, tableRange) && matchedSource.Query != "":
+		rowsQuery, _ = utils.GetRowHashesQueryFormat(utils.QueryTableName(matchedSource.Query, matchedSource.OriginTable), table.Info)
+	case isRowHashes(table, tableRange):
+		rowsQuery, _ = utils.GetRowHashesQueryFormat(utils.StaleTableName(matchedSource.OriginSchema, matchedSource.OriginTable, s.staleReadSnapshot), table.Info)
+	case matchedSource.Query != "":
+		rowsQuery, _ = utils.GetQueryRowsQueryFormat(matchedSource.Query, matchedSource.OriginTable, table.Info, table.Collation, hashColumns)
+	default:
+		rowsQuery, _ = utils.GetStaleTableRowsQueryFormat(matchedSource.OriginSchema, matchedSource.OriginTable, s.staleReadSnapshot, table.Info, table.Collation, hashColumns)
+	}
 	query := fmt.Sprintf(rowsQuery, chunk.Where)
 
-	log.Debug("select data", zap.String("sql", query), zap.Reflect("args", chunk.Args))
+	log.Debug("select data", zap.String("sql", query), utils.RedactData(table.Schema, table.Table, "args", chunk.Args))
+	if err := chaos.Inject(chaos.SourceQueryError); err != nil {
+		return nil, errors.Trace(err)
+	}
 	rows, err := s.dbConn.QueryContext(ctx, query, chunk.Args...)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -189,7 +248,7 @@ func (s *TiDBSource) GetSnapshot() string {
 	return s.snapshot
 }
 
-func getSourceTableMap(ctx context.Context, tableDiffs []*common.TableDiff, ds *config.DataSource) (map[string]*common.TableSource, error) {
+func getSourceTableMap(ctx context.Context, tableDiffs []*common.TableDiff, ds *config.DataSource, isTarget bool) (map[string]*common.TableSource, error) {
 	sourceTableMap := make(map[string]*common.TableSource)
 	if ds.Router != nil {
 		log.Info("find router for tidb source")
@@ -197,6 +256,10 @@ func getSourceTableMap(ctx context.Context, tableDiffs []*common.TableDiff, ds *
 		// and real table row query from source.
 		uniqueMap := make(map[string]struct{})
 		for _, tableDiff := range tableDiffs {
+			if tableDiff.Query != "" {
+				// the query checks don't select from the tables.
+				continue
+			}
 			uniqueMap[utils.UniqueID(tableDiff.Schema, tableDiff.Table)] = struct{}{}
 		}
 
@@ -240,25 +303,71 @@ func getSourceTableMap(ctx context.Context, tableDiffs []*common.TableDiff, ds *
 
 		// check tablesMap
 		for _, tableDiff := range tableDiffs {
+			if tableDiff.Query != "" {
+				continue
+			}
 			if _, ok := sourceTableMap[utils.UniqueID(tableDiff.Schema, tableDiff.Table)]; !ok {
 				return nil, errors.Errorf("the source has no table to be compared. target-table is `%s`.`%s`", tableDiff.Schema, tableDiff.Table)
 			}
 		}
 	}
+	for _, tableDiff := range tableDiffs {
+		if tableDiff.Query == "" {
+			continue
+		}
+		sourceTableMap[utils.UniqueID(tableDiff.Schema, tableDiff.Table)] = &common.TableSource{
+			OriginSchema: tableDiff.Schema,
+			OriginTable:  tableDiff.Table,
+			Query:        tableDiff.GetQuery(isTarget),
+		}
+	}
 	return sourceTableMap, nil
 }
 
-func NewTiDBSource(ctx context.Context, tableDiffs []*common.TableDiff, ds *config.DataSource, checkThreadCount int) (Source, error) {
-	sourceTableMap, err := getSourceTableMap(ctx, tableDiffs, ds)
+// NewTiDBSource builds the source of a TiDB instance, isTarget is true if it's the target instance.
+func NewTiDBSource(ctx context.Context, tableDiffs []*common.TableDiff, ds *config.DataSource, checkThreadCount int, tableThreadCount int, isTarget bool) (Source, error) {
+	sourceTableMap, err := getSourceTableMap(ctx, tableDiffs, ds, isTarget)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	staleReadSnapshot := ds.GetStaleReadSnapshot()
+	if staleReadSnapshot != "" {
+		for _, tableDiff := range tableDiffs {
+			if tableDiff.Query != "" {
+				log.Warn("the query check reads the latest data because the snapshot is read by AS OF TIMESTAMP",
+					zap.String("table", dbutil.TableName(tableDiff.Schema, tableDiff.Table)))
+			}
+		}
+	}
+	for _, tableDiff := range tableDiffs {
+		var columnMap map[string]string
+		if !isTarget {
+			columnMap = tableDiff.ColumnMap
+		}
+		expressions := tableDiff.GetExpressions(isTarget)
+		if len(columnMap) == 0 && len(expressions) == 0 {
+			continue
+		}
+		// the renamed columns and the expressions are selected with the aliases of the target columns,
+		// so the rest are the same as the target.
+		source := getMatchSource(sourceTableMap, tableDiff)
+		source.ColumnMap = columnMap
+		source.Expressions = expressions
+		source.Query = utils.GetColumnMapQuery(utils.StaleTableName(source.OriginSchema, source.OriginTable, staleReadSnapshot), tableDiff.Info, columnMap, expressions)
+		sourceTableMap[utils.UniqueID(tableDiff.Schema, tableDiff.Table)] = source
+	}
+	snapshot := ds.Snapshot
+	if ds.GetSnapshotMode() == config.SnapshotModeNone {
+		snapshot = ""
+	}
 	ts := &TiDBSource{
-		tableDiffs:       tableDiffs,
-		sourceTableMap:   sourceTableMap,
-		snapshot:         ds.Snapshot,
-		dbConn:           ds.Conn,
-		checkThreadCount: checkThreadCount,
+		tableDiffs:        tableDiffs,
+		sourceTableMap:    sourceTableMap,
+		snapshot:          snapshot,
+		staleReadSnapshot: staleReadSnapshot,
+		dbConn:            ds.Conn,
+		checkThreadCount:  checkThreadCount,
+		tableThreadCount:  tableThreadCount,
 	}
 	return ts, nil
 }
@@ -141,11 +141,17 @@ func (s *BucketIterator) init(startRange *RangeInfo) error {
 		if startRange != nil && startRange.IndexID != index.ID {
 			continue
 		}
+		if utils.IsPrefixIndex(index) {
+			// the bounds of the buckets are the truncated prefix values,
+			// which can't be used as the bounds of chunks.
+			log.Debug("skip prefix index for buckets", zap.String("index", index.Name.O))
+			continue
+		}
 		bucket, ok := buckets[index.Name.O]
 		if !ok {
 			return errors.NotFoundf("index %s in buckets info", index.Name.O)
 		}
-		log.Debug("buckets for index", zap.String("index", index.Name.O), zap.Reflect("buckets", buckets))
+		log.Debug("buckets for index", zap.String("index", index.Name.O), utils.RedactData(s.table.Schema, s.table.Table, "buckets", buckets))
 
 		indexColumns := utils.GetColumnsFromIndex(index, s.table.Info)
 
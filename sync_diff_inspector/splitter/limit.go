@@ -114,7 +114,12 @@ func NewLimitIteratorWithCheckpoint(ctx context.Context, progressID string, tabl
 
 	chunkSize := table.ChunkSize
 	if chunkSize <= 0 {
-		cnt, err := dbutil.GetRowCount(ctx, dbConn, table.Schema, table.Table, "", nil)
+		var cnt int64
+		if table.Query != "" {
+			cnt, err = utils.GetQueryRowCount(ctx, dbConn, table.Query, table.Table)
+		} else {
+			cnt, err = dbutil.GetRowCount(ctx, dbConn, table.Schema, table.Table, "", nil)
+		}
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
@@ -252,6 +257,10 @@ func generateLimitQueryTemplate(indexColumns []*model.ColumnInfo, table *common.
 		fields = append(fields, dbutil.ColumnName(columnInfo.Name.O))
 	}
 	columns := strings.Join(fields, ", ")
+	tableName := dbutil.TableName(table.Schema, table.Table)
+	if table.Query != "" {
+		tableName = utils.QueryTableName(table.Query, table.Table)
+	}
 
-	return fmt.Sprintf("SELECT %s FROM %s WHERE %%s ORDER BY %s LIMIT %d,1", columns, dbutil.TableName(table.Schema, table.Table), columns, chunkSize)
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %%s ORDER BY %s LIMIT %d,1", columns, tableName, columns, chunkSize)
 }
@@ -0,0 +1,152 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package splitter
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/chunk"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/progress"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/source/common"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/utils"
+	"github.com/pingcap/tidb/parser/model"
+	"go.uber.org/zap"
+)
+
+// PartitionIterator splits the chunks of the table partition by partition. The chunks of a partition are split
+// by random in the range of the partition, and their bucket index is the index of the partition, so a chunk never
+// crosses the boundaries of the partitions, and the chunks of the next partition are split after the last one.
+type PartitionIterator struct {
+	ctx        context.Context
+	progressID string
+	table      *common.TableDiff
+	fields     []*model.ColumnInfo
+	dbConn     *sql.DB
+
+	nextPartition int
+	chunks        []*chunk.Range
+	nextChunk     int
+}
+
+// NewPartitionIteratorWithCheckpoint returns the iterator of the chunks of the partitions after startRange.
+func NewPartitionIteratorWithCheckpoint(ctx context.Context, progressID string, table *common.TableDiff, dbConn *sql.DB, startRange *RangeInfo) (*PartitionIterator, error) {
+	var splitFieldArr []string
+	if len(table.Fields) != 0 {
+		splitFieldArr = strings.Split(table.Fields, ",")
+	}
+	for i := range splitFieldArr {
+		splitFieldArr[i] = strings.TrimSpace(splitFieldArr[i])
+	}
+	fields, err := GetSplitFields(table.Info, splitFieldArr)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	iter := &PartitionIterator{
+		ctx:        ctx,
+		progressID: progressID,
+		table:      table,
+		fields:     fields,
+		dbConn:     dbConn,
+	}
+	progress.StartTable(progressID, 0, false)
+	if startRange == nil {
+		return iter, nil
+	}
+	c := startRange.GetChunk()
+	switch {
+	case c.IsLastChunkForTable():
+		iter.nextPartition = len(table.Partitions)
+	case c.IsLastChunkForBucket():
+		iter.nextPartition = c.Index.BucketIndexLeft + 1
+	default:
+		// the rest chunks of the partition in progress are split after the checkpoint chunk.
+		iter.nextPartition = c.Index.BucketIndexLeft
+		if err := iter.splitPartition(c); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return iter, nil
+}
+
+// Next implements ChunkIterator.Next, the chunks of the next partition are split if the chunks
+// of the current one are all returned.
+func (s *PartitionIterator) Next() (*chunk.Range, error) {
+	for s.nextChunk >= len(s.chunks) {
+		if s.nextPartition >= len(s.table.Partitions) {
+			progress.UpdateTotal(s.progressID, 0, true)
+			return nil, nil
+		}
+		if err := s.splitPartition(nil); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	c := s.chunks[s.nextChunk]
+	s.nextChunk++
+	return c, nil
+}
+
+// splitPartition splits the chunks of the next partition, only the range after startChunk is split
+// if it's not nil.
+func (s *PartitionIterator) splitPartition(startChunk *chunk.Range) error {
+	partitionIndex := s.nextPartition
+	partition := s.table.Partitions[partitionIndex]
+	limits := s.table.GetRange(partition.Name)
+	chunkRange := chunk.NewChunkRange()
+	beginIndex, chunkCnt := 0, 0
+	if startChunk != nil {
+		for _, bound := range startChunk.Bounds {
+			chunkRange.Update(bound.Column, bound.Upper, "", true, false)
+		}
+		beginIndex = startChunk.Index.ChunkIndex + 1
+		chunkCnt = startChunk.Index.ChunkCnt - beginIndex
+	} else {
+		cnt, err := dbutil.GetRowCount(s.ctx, s.dbConn, s.table.Schema, s.table.Table, limits, nil)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		chunkSize := s.table.ChunkSize
+		if chunkSize <= 0 {
+			chunkSize = utils.CalculateChunkSize(cnt)
+		}
+		chunkCnt = int((cnt + chunkSize - 1) / chunkSize)
+		log.Info("split partition by random", zap.String("table", dbutil.TableName(s.table.Schema, s.table.Table)),
+			zap.String("partition", partition.Name), zap.Int64("row count", cnt), zap.Int("split chunk num", chunkCnt))
+	}
+
+	chunks, err := splitRangeByRandom(s.dbConn, chunkRange, chunkCnt, s.table.Schema, s.table.Table, s.fields, limits, s.table.Collation)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// the random values may be less than expected, so the count of the chunks is decided after splitting.
+	chunk.InitChunks(chunks, chunk.Random, partitionIndex, partitionIndex, beginIndex, s.table.Collation, limits, beginIndex+len(chunks))
+	for i, c := range chunks {
+		c.Partition = partition.Name
+		c.IsFirst = partitionIndex == 0 && c.Index.ChunkIndex == 0
+		c.IsLast = partitionIndex == len(s.table.Partitions)-1 && i == len(chunks)-1
+	}
+	s.chunks, s.nextChunk = chunks, 0
+	s.nextPartition++
+	progress.UpdateTotal(s.progressID, len(chunks), false)
+	return nil
+}
+
+func (s *PartitionIterator) Close() {
+
+}
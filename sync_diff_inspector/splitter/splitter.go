@@ -39,6 +39,9 @@ type RangeInfo struct {
 	IndexID int64 `json:"index-id"`
 
 	ProgressID string `json:"progress-id"`
+
+	// FullColumns is true if the large columns of the rows are fetched in full values instead of their hashes.
+	FullColumns bool `json:"-"`
 }
 
 // GetTableIndex return the index of table diffs.
@@ -59,9 +62,10 @@ func (r *RangeInfo) GetChunk() *chunk.Range {
 
 func (r *RangeInfo) Copy() *RangeInfo {
 	return &RangeInfo{
-		ChunkRange: r.ChunkRange.Clone(),
-		IndexID:    r.IndexID,
-		ProgressID: r.ProgressID,
+		ChunkRange:  r.ChunkRange.Clone(),
+		IndexID:     r.IndexID,
+		ProgressID:  r.ProgressID,
+		FullColumns: r.FullColumns,
 	}
 }
 
@@ -802,6 +802,24 @@ func TestLimitSpliter(t *testing.T) {
 	}
 }
 
+func TestLimitQueryTemplate(t *testing.T) {
+	createTableSQL := "create table `test`.`test`(`a` int, `b` varchar(10), `c` float, primary key(`a`, `b`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	indexColumns := utils.GetColumnsFromIndex(tableInfo.Indices[0], tableInfo)
+
+	tableDiff := &common.TableDiff{
+		Schema: "test",
+		Table:  "test",
+		Info:   tableInfo,
+	}
+	require.Equal(t, "SELECT `a`, `b` FROM `test`.`test` WHERE %s ORDER BY `a`, `b` LIMIT 1000,1", generateLimitQueryTemplate(indexColumns, tableDiff, 1000))
+
+	// the query check selects from the result set of the query
+	tableDiff.Query = "SELECT a, b, SUM(c) AS c FROM test.t GROUP BY a, b"
+	require.Equal(t, "SELECT `a`, `b` FROM (SELECT a, b, SUM(c) AS c FROM test.t GROUP BY a, b) AS `test` WHERE %s ORDER BY `a`, `b` LIMIT 1000,1", generateLimitQueryTemplate(indexColumns, tableDiff, 1000))
+}
+
 func createFakeResultForLimitSplit(mock sqlmock.Sqlmock, aValues []string, bValues []string, needEnd bool) {
 	for i, a := range aValues {
 		limitRows := sqlmock.NewRows([]string{"a", "b"})
@@ -0,0 +1,69 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"go.uber.org/zap"
+)
+
+// startStatusServer serves the progress of the comparison at `/status` in the shape of `dmctl validation status`,
+// and returns the function to stop the server. It's served by HTTPS if `status-security` is set.
+func (df *Diff) startStatusServer(cfg *config.Config) (func(), error) {
+	tlsCfg, err := cfg.GetStatusTLSConfig()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	listener, err := net.Listen("tcp", cfg.StatusAddr)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot listen on the status address %s", cfg.StatusAddr)
+	}
+	if tlsCfg != nil {
+		listener = tls.NewListener(listener, tlsCfg)
+	}
+	task, sources := cfg.DMTask, cfg.Task.Source
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
+		data, err := json.Marshal(df.report.GetDMValidationStatus(task, sources))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Warn("the status server exits", zap.Error(err))
+		}
+	}()
+	log.Info("the status server is started", zap.String("address", listener.Addr().String()))
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Warn("fail to stop the status server", zap.Error(err))
+		}
+	}, nil
+}
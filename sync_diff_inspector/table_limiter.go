@@ -0,0 +1,99 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/splitter"
+	"go.uber.org/zap"
+)
+
+// maxPendingChunks is the max number of the pending chunks of a table, the chunks of the other tables
+// wait once it's exceeded, so that the chunks of a table aren't all kept in memory.
+const maxPendingChunks = splitter.DefaultChannelBuffer
+
+// tableLimiter limits the number of the chunks of a table compared concurrently by its `check-thread-count`.
+// The chunks exceeding the limit are pending instead of waiting for the workers, so that the workers are
+// left to the other tables, and they are compared by the workers of the table after the running chunks.
+type tableLimiter struct {
+	limit   int
+	running int
+	pending []*splitter.RangeInfo
+}
+
+// initTableLimiters creates the limiters of the tables whose `check-thread-count` is less than the global one.
+func (df *Diff) initTableLimiters() {
+	df.limiterCond = sync.NewCond(&df.limiterMu)
+	df.tableLimiters = make(map[int]*tableLimiter)
+	for tableIndex, tableDiff := range df.downstream.GetTables() {
+		if tableDiff.CheckThreadCount <= 0 || tableDiff.CheckThreadCount >= df.checkThreadCount {
+			continue
+		}
+		log.Info("limit the chunks of the table compared concurrently",
+			zap.String("table", dbutil.TableName(tableDiff.Schema, tableDiff.Table)),
+			zap.Int("check thread count", tableDiff.CheckThreadCount))
+		df.tableLimiters[tableIndex] = &tableLimiter{limit: tableDiff.CheckThreadCount}
+	}
+}
+
+// acquireTable returns true if the chunk can be compared now, otherwise the chunk is pending.
+func (df *Diff) acquireTable(rangeInfo *splitter.RangeInfo) bool {
+	limiter, ok := df.tableLimiters[rangeInfo.GetTableIndex()]
+	if !ok {
+		return true
+	}
+	df.limiterMu.Lock()
+	defer df.limiterMu.Unlock()
+	for len(limiter.pending) >= maxPendingChunks {
+		df.limiterCond.Wait()
+	}
+	if limiter.running < limiter.limit {
+		limiter.running++
+		return true
+	}
+	limiter.pending = append(limiter.pending, rangeInfo)
+	return false
+}
+
+// releaseTable returns the next pending chunk of the table after the chunk is compared,
+// or nil if there is no pending chunk.
+func (df *Diff) releaseTable(rangeInfo *splitter.RangeInfo) *splitter.RangeInfo {
+	limiter, ok := df.tableLimiters[rangeInfo.GetTableIndex()]
+	if !ok {
+		return nil
+	}
+	df.limiterMu.Lock()
+	defer df.limiterMu.Unlock()
+	defer df.limiterCond.Broadcast()
+	if len(limiter.pending) == 0 {
+		limiter.running--
+		return nil
+	}
+	next := limiter.pending[0]
+	limiter.pending = limiter.pending[1:]
+	return next
+}
+
+// consumeTableChunks compares the chunk, then the pending chunks of the same table by the same worker,
+// so the number of the workers occupied by the table doesn't exceed its limit.
+func (df *Diff) consumeTableChunks(ctx context.Context, rangeInfo *splitter.RangeInfo) {
+	for rangeInfo != nil {
+		df.consumeChunk(ctx, rangeInfo, false)
+		rangeInfo = df.releaseTable(rangeInfo)
+	}
+}
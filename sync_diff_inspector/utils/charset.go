@@ -0,0 +1,70 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// SessionCharsetInfo is the charset settings of a session, which change the values
+// read from the database, so they must be the same on both sides to compare the checksums.
+type SessionCharsetInfo struct {
+	// Results is the `@@session.character_set_results`, empty if it's NULL.
+	Results string
+	// CollationConnection is the `@@session.collation_connection`.
+	CollationConnection string
+}
+
+// Equal returns true if the charset settings are the same.
+func (s *SessionCharsetInfo) Equal(other *SessionCharsetInfo) bool {
+	return strings.EqualFold(s.Results, other.Results) && strings.EqualFold(s.CollationConnection, other.CollationConnection)
+}
+
+// Vars returns the session variables to use the same charset settings for a connection.
+// `character_set_results` is skipped if it's NULL, because it can't be set by the quoted value.
+func (s *SessionCharsetInfo) Vars() map[string]string {
+	vars := map[string]string{
+		"collation_connection": s.CollationConnection,
+	}
+	if s.Results != "" {
+		vars["character_set_results"] = s.Results
+	}
+	return vars
+}
+
+// GetSessionCharset returns the charset settings of the session.
+func GetSessionCharset(ctx context.Context, db *sql.DB) (*SessionCharsetInfo, error) {
+	/*
+		example:
+		mysql> SELECT @@session.character_set_results, @@session.collation_connection;
+		+---------------------------------+--------------------------------+
+		| @@session.character_set_results | @@session.collation_connection |
+		+---------------------------------+--------------------------------+
+		| utf8mb4                         | utf8mb4_general_ci             |
+		+---------------------------------+--------------------------------+
+	*/
+	var results, collation sql.NullString
+	err := db.QueryRowContext(ctx, "SELECT @@session.character_set_results, @@session.collation_connection").Scan(&results, &collation)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &SessionCharsetInfo{
+		Results:             results.String,
+		CollationConnection: collation.String,
+	}, nil
+}
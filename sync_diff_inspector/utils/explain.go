@@ -0,0 +1,119 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// ExplainPlan is the result of `EXPLAIN` a query.
+type ExplainPlan struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// ExplainQuery returns the plan of the query by `EXPLAIN`.
+func ExplainQuery(ctx context.Context, db *sql.DB, query string, args []interface{}) (*ExplainPlan, error) {
+	rows, err := db.QueryContext(ctx, "EXPLAIN "+strings.TrimSuffix(strings.TrimSpace(query), ";"), args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	plan := &ExplainPlan{
+		Columns: columns,
+		Rows:    make([][]string, 0),
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.Trace(err)
+		}
+		row := make([]string, len(columns))
+		for i, value := range values {
+			row[i] = value.String
+		}
+		plan.Rows = append(plan.Rows, row)
+	}
+	return plan, errors.Trace(rows.Err())
+}
+
+// IsFullScan returns true if the plan scans the whole table. In TiDB, the id of the operator is `TableFullScan_5`,
+// or `TableScan_5` with `range:[-inf,+inf]` in the older versions. In MySQL, the access type is `ALL`.
+func (p *ExplainPlan) IsFullScan() bool {
+	for _, row := range p.Rows {
+		isTableScan := false
+		for i, column := range p.Columns {
+			value := row[i]
+			switch strings.ToLower(column) {
+			case "id":
+				if strings.Contains(value, "TableFullScan") {
+					return true
+				}
+				isTableScan = strings.Contains(value, "TableScan")
+			case "type":
+				if strings.EqualFold(value, "ALL") {
+					return true
+				}
+			case "operator info", "access object":
+				if isTableScan && strings.Contains(value, "range:[-inf,+inf]") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// String returns the plan in lines, the columns are separated by `|`.
+func (p *ExplainPlan) String() string {
+	var b strings.Builder
+	b.WriteString(strings.Join(p.Columns, " | "))
+	for _, row := range p.Rows {
+		b.WriteString("\n")
+		b.WriteString(strings.Join(row, " | "))
+	}
+	return b.String()
+}
+
+// SuggestIndex returns the suggestion for the slow query of a chunk according to its plan,
+// columns are the columns in the range condition of the chunk.
+func SuggestIndex(plan *ExplainPlan, schema, table string, columns []string) string {
+	if !plan.IsFullScan() {
+		return "the query uses an index, consider decreasing the chunk-size of the table"
+	}
+	if len(columns) == 0 {
+		return "the query scans the whole table because it is not split into chunks, consider adding an index to split it"
+	}
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, dbutil.ColumnName(column))
+	}
+	return fmt.Sprintf("the query scans the whole table, consider adding an index on %s(%s) in the target",
+		dbutil.TableName(schema, table), strings.Join(names, ", "))
+}
@@ -37,8 +37,36 @@ const (
 	defaultEtcdDialTimeOut    = 3 * time.Second
 
 	defaultGCSafePointTTL = 5 * 60
+	// removeGCSafePointTimeout is the timeout to remove the service safepoint when exits.
+	removeGCSafePointTimeout = 10 * time.Second
+
+	// gcSafePointTimeFormat is the format of `tikv_gc_safe_point` in `mysql.tidb`,
+	// the fractional seconds are also accepted when parsing.
+	gcSafePointTimeFormat = "20060102-15:04:05 -0700"
 )
 
+// GCSafePointConfig configures the service safepoint which keeps GC stopped during diff progress.
+type GCSafePointConfig struct {
+	// TTL is the ttl of the service safepoint in seconds, 0 means 300.
+	TTL int64
+	// UpdateInterval is the interval to update the service safepoint, 0 means half of the TTL.
+	UpdateInterval time.Duration
+	// ServiceID is the id of the service safepoint, empty means `Sync_diff_<timestamp>`.
+	ServiceID string
+}
+
+func (c *GCSafePointConfig) adjust() {
+	if c.TTL <= 0 {
+		c.TTL = defaultGCSafePointTTL
+	}
+	if c.UpdateInterval <= 0 {
+		c.UpdateInterval = time.Duration(c.TTL/2) * time.Second
+	}
+	if c.ServiceID == "" {
+		c.ServiceID = fmt.Sprintf("Sync_diff_%d", time.Now().UnixNano())
+	}
+}
+
 var (
 	tidbVersionRegex       = regexp.MustCompile(`-[v]?\d+\.\d+\.\d+([0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?`)
 	autoGCSafePointVersion = semver.New("4.0.0")
@@ -105,19 +133,29 @@ func sameStringArray(a, b []string) bool {
 }
 
 // GetPDClientForGC is an initialization step.
-func GetPDClientForGC(ctx context.Context, db *sql.DB) (pd.Client, error) {
+// The pd addresses are fetched from TiDB if pdAddrs is empty.
+func GetPDClientForGC(ctx context.Context, db *sql.DB, pdAddrs []string, security pd.SecurityOption) (pd.Client, error) {
 	if ok, _ := dbutil.IsTiDB(ctx, db); ok {
+		if len(pdAddrs) > 0 {
+			// the specified pd addresses may be proxies, which are different from the ones registered
+			// in the cluster, so don't check whether they belong to the TiDB.
+			pdClient, err := pd.NewClientWithContext(ctx, pdAddrs, security)
+			if err != nil {
+				return nil, errors.Annotatef(err, "[automatically GC] create pd client to control GC failed, pd address %v", pdAddrs)
+			}
+			return pdClient, nil
+		}
 		pdAddrs, err := GetPDAddrs(ctx, db)
 		if err != nil {
 			return nil, err
 		}
 		if len(pdAddrs) > 0 {
 			if same, err := checkSameCluster(ctx, db, pdAddrs); err != nil {
-				log.Info("[automatically GC] check whether fetched pd addr and TiDB belong to one cluster failed", zap.Strings("pd address", pdAddrs), zap.Error(err))
+				log.Warn("[automatically GC] check whether fetched pd addr and TiDB belong to one cluster failed", zap.Strings("pd address", pdAddrs), zap.Error(err))
 			} else if same {
-				pdClient, err := pd.NewClientWithContext(ctx, pdAddrs, pd.SecurityOption{})
+				pdClient, err := pd.NewClientWithContext(ctx, pdAddrs, security)
 				if err != nil {
-					log.Info("[automatically GC] create pd client to control GC failed", zap.Strings("pd address", pdAddrs), zap.Error(err))
+					log.Warn("[automatically GC] create pd client to control GC failed", zap.Strings("pd address", pdAddrs), zap.Error(err))
 					return nil, err
 				}
 				return pdClient, nil
@@ -171,47 +209,73 @@ func GetSpecifiedColumnValueAndClose(rows *sql.Rows, columnName string) ([]strin
 }
 
 // StartGCSavepointUpdateService keeps GC safePoint stop moving forward.
-func StartGCSavepointUpdateService(ctx context.Context, pdCli pd.Client, db *sql.DB, snapshot string) error {
+// The returned function stops the service and removes the service safepoint,
+// it's nil if the tidb doesn't support the service safepoint.
+func StartGCSavepointUpdateService(ctx context.Context, pdCli pd.Client, db *sql.DB, snapshot string, gcCfg GCSafePointConfig) (func(), error) {
 	versionStr, err := selectVersion(db)
 	if err != nil {
-		log.Info("detect version of tidb failed")
-		return nil
+		return nil, errors.Annotate(err, "detect version of tidb failed")
 	}
 	versionStr = tidbVersionRegex.FindString(versionStr)[1:]
 	versionStr = strings.TrimPrefix(versionStr, "v")
 	tidbVersion, err := semver.NewVersion(versionStr)
 	if err != nil {
-		log.Info("parse version of tidb failed")
-		return nil
+		return nil, errors.Annotate(err, "parse version of tidb failed")
+	}
+	if tidbVersion.Compare(*autoGCSafePointVersion) <= 0 {
+		log.Warn("tidb doesn't support auto gc safepoint, user should guarantee the GC stopped during diff progress", zap.Stringer("version", tidbVersion))
+		return nil, nil
 	}
+	log.Info("tidb support auto gc safepoint", zap.Stringer("version", tidbVersion))
 	// get latest snapshot
 	snapshotTS, err := parseSnapshotToTSO(db, snapshot)
-	if tidbVersion.Compare(*autoGCSafePointVersion) > 0 {
-		log.Info("tidb support auto gc safepoint", zap.Stringer("version", tidbVersion))
-		if err != nil {
-			return err
-		}
-		go updateServiceSafePoint(ctx, pdCli, snapshotTS)
-	} else {
-		log.Info("tidb doesn't support auto gc safepoint", zap.Stringer("version", tidbVersion))
+	if err != nil {
+		return nil, errors.Trace(err)
 	}
-	return nil
+
+	gcCfg.adjust()
+	updateCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		updateServiceSafePoint(updateCtx, pdCli, snapshotTS, gcCfg)
+	}()
+	return func() {
+		cancel()
+		<-done
+		removeServiceSafePoint(pdCli, gcCfg.ServiceID)
+	}, nil
 }
 
-func updateServiceSafePoint(ctx context.Context, pdClient pd.Client, snapshotTS uint64) {
-	updateInterval := time.Duration(defaultGCSafePointTTL/2) * time.Second
-	tick := time.NewTicker(updateInterval)
-	DiffServiceSafePointID := fmt.Sprintf("Sync_diff_%d", time.Now().UnixNano())
-	log.Info("generate dumpling gc safePoint id", zap.String("id", DiffServiceSafePointID))
+func removeServiceSafePoint(pdClient pd.Client, serviceID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), removeGCSafePointTimeout)
+	defer cancel()
+	// the service safepoint is removed if the ttl is not greater than 0
+	_, err := pdClient.UpdateServiceGCSafePoint(ctx, serviceID, 0, 0)
+	if err != nil {
+		log.Warn("failed to remove the service safepoint, it will be removed after the ttl expires", zap.String("id", serviceID), zap.Error(err))
+		return
+	}
+	log.Info("remove the service safepoint", zap.String("id", serviceID))
+}
+
+func updateServiceSafePoint(ctx context.Context, pdClient pd.Client, snapshotTS uint64, gcCfg GCSafePointConfig) {
+	tick := time.NewTicker(gcCfg.UpdateInterval)
+	defer tick.Stop()
+	log.Info("generate sync_diff gc safePoint id", zap.String("id", gcCfg.ServiceID), zap.Int64("ttl", gcCfg.TTL))
 	for {
 		log.Debug("update PD safePoint limit with ttl",
 			zap.Uint64("safePoint", snapshotTS),
-			zap.Duration("updateInterval", updateInterval))
+			zap.Duration("updateInterval", gcCfg.UpdateInterval))
 		for retryCnt := 0; retryCnt <= 10; retryCnt++ {
-			_, err := pdClient.UpdateServiceGCSafePoint(ctx, DiffServiceSafePointID, defaultGCSafePointTTL, snapshotTS)
+			_, err := pdClient.UpdateServiceGCSafePoint(ctx, gcCfg.ServiceID, gcCfg.TTL, snapshotTS)
 			if err == nil {
 				break
 			}
+			if retryCnt == 10 {
+				log.Warn("update PD safePoint failed, the snapshot may be GC-ed during diff progress", zap.String("id", gcCfg.ServiceID), zap.Error(err))
+				break
+			}
 			log.Debug("update PD safePoint failed", zap.Error(err), zap.Int("retryTime", retryCnt))
 			select {
 			case <-ctx.Done():
@@ -245,6 +309,39 @@ func parseSnapshotToTSO(pool *sql.DB, snapshot string) (uint64, error) {
 	return uint64(tso.Int64*1000) << 18, nil
 }
 
+// GetGCSafePoint returns the GC safe point of the TiDB as TSO.
+func GetGCSafePoint(ctx context.Context, db *sql.DB) (uint64, error) {
+	query := "SELECT VARIABLE_VALUE FROM mysql.tidb WHERE VARIABLE_NAME = 'tikv_gc_safe_point';"
+	var safePointStr string
+	if err := db.QueryRowContext(ctx, query).Scan(&safePointStr); err != nil {
+		return 0, errors.Annotatef(err, "sql: %s", query)
+	}
+	safePoint, err := time.Parse(gcSafePointTimeFormat, safePointStr)
+	if err != nil {
+		return 0, errors.Annotatef(err, "parse GC safe point %s", safePointStr)
+	}
+	return uint64(safePoint.UnixNano()/int64(time.Millisecond)) << 18, nil
+}
+
+// CheckSnapshotNotGCed returns error if the snapshot is older than the GC safe point of the TiDB,
+// the error suggests the earliest usable snapshot.
+func CheckSnapshotNotGCed(ctx context.Context, db *sql.DB, snapshot string) error {
+	snapshotTS, err := parseSnapshotToTSO(db, snapshot)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	safePoint, err := GetGCSafePoint(ctx, db)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if snapshotTS < safePoint {
+		safePointTime := time.Unix(0, int64(safePoint>>18)*int64(time.Millisecond)).UTC()
+		return errors.Errorf("snapshot %s is older than the GC safe point, the earliest usable snapshot is %d (%s UTC), please use a newer snapshot or enlarge tidb_gc_life_time",
+			snapshot, safePoint, safePointTime.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
 func GetSnapshot(ctx context.Context, db *sql.DB) ([]string, error) {
 	query := "SHOW MASTER STATUS;"
 	rows, err := db.QueryContext(ctx, query)
@@ -0,0 +1,105 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/mysql"
+)
+
+// Privileges is the privileges granted to the current user.
+type Privileges struct {
+	// global is the privileges granted on `*.*`.
+	global map[mysql.PrivilegeType]struct{}
+	// partial is the privileges granted on some databases or tables.
+	partial map[mysql.PrivilegeType]struct{}
+}
+
+// GetPrivileges returns the privileges granted to the current user by `SHOW GRANTS`.
+func GetPrivileges(ctx context.Context, db *sql.DB) (*Privileges, error) {
+	grants, err := dbutil.ShowGrants(ctx, db, "", "")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return parsePrivileges(grants)
+}
+
+func parsePrivileges(grants []string) (*Privileges, error) {
+	privs := &Privileges{
+		global:  make(map[mysql.PrivilegeType]struct{}),
+		partial: make(map[mysql.PrivilegeType]struct{}),
+	}
+	p := parser.New()
+	for _, grant := range grants {
+		node, err := p.ParseOneStmt(grant, "", "")
+		if err != nil {
+			return nil, errors.Annotatef(err, "parse grant %s", grant)
+		}
+		grantStmt, ok := node.(*ast.GrantStmt)
+		if !ok {
+			// the grants of roles and proxies are not expanded
+			continue
+		}
+		for _, privElem := range grantStmt.Privs {
+			if len(privElem.Cols) > 0 {
+				// the privileges on some columns are not enough to compare the tables
+				continue
+			}
+			if grantStmt.Level.Level == ast.GrantLevelGlobal {
+				privs.global[privElem.Priv] = struct{}{}
+			} else {
+				privs.partial[privElem.Priv] = struct{}{}
+			}
+		}
+	}
+	return privs, nil
+}
+
+// Has returns true if the privilege is granted, needGlobal is true if it must be granted on `*.*`.
+func (p *Privileges) Has(priv mysql.PrivilegeType, needGlobal bool) bool {
+	for _, granted := range []mysql.PrivilegeType{priv, mysql.AllPriv} {
+		if _, ok := p.global[granted]; ok {
+			return true
+		}
+		if _, ok := p.partial[granted]; ok && !needGlobal {
+			return true
+		}
+	}
+	return false
+}
+
+// Lack returns the privileges not granted in `privs`.
+func (p *Privileges) Lack(privs []mysql.PrivilegeType, needGlobal bool) []string {
+	lacked := make([]string, 0)
+	for _, priv := range privs {
+		if !p.Has(priv, needGlobal) {
+			lacked = append(lacked, strings.ToUpper(mysql.Priv2Str[priv]))
+		}
+	}
+	return lacked
+}
+
+// IsSuperUser returns true if all the privileges or SUPER are granted on `*.*`.
+func (p *Privileges) IsSuperUser() bool {
+	_, all := p.global[mysql.AllPriv]
+	_, super := p.global[mysql.SuperPriv]
+	return all || super
+}
@@ -0,0 +1,213 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// RedactedValue replaces the secrets and the data values of the sensitive tables.
+	RedactedValue = "******"
+	// the secrets shorter than it are not scrubbed from the logs, otherwise every occurrence of
+	// a common short word is replaced.
+	minSecretLength = 4
+)
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+
+	sensitiveMu     sync.RWMutex
+	sensitiveTables filter.Filter
+	// sensitiveColumns are the lower case names of the sensitive columns by the unique id of the tables.
+	sensitiveColumns map[string]map[string]struct{}
+)
+
+// AddSecrets registers the secrets, e.g. the passwords of the instances, which are scrubbed from the logs
+// written by the core of NewRedactCore.
+func AddSecrets(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, value := range values {
+		if len(value) < minSecretLength {
+			continue
+		}
+		exists := false
+		for _, secret := range secrets {
+			if secret == value {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			secrets = append(secrets, value)
+		}
+	}
+}
+
+// RedactSecrets replaces the registered secrets in the string.
+func RedactSecrets(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, RedactedValue)
+	}
+	return s
+}
+
+func containsSecret(s string) bool {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		if strings.Contains(s, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSecrets() bool {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return len(secrets) > 0
+}
+
+// redactCore scrubs the registered secrets from the messages and the fields before writing them.
+type redactCore struct {
+	zapcore.Core
+}
+
+// NewRedactCore wraps the core of the logger, so that the passwords and the DSNs containing them never appear in the logs.
+func NewRedactCore(core zapcore.Core) zapcore.Core {
+	return &redactCore{Core: core}
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c *redactCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = RedactSecrets(entry.Message)
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	if !hasSecrets() {
+		return fields
+	}
+	redacted := make([]zapcore.Field, 0, len(fields))
+	for _, field := range fields {
+		var value string
+		switch field.Type {
+		case zapcore.StringType:
+			value = field.String
+		case zapcore.ErrorType:
+			if err, ok := field.Interface.(error); ok {
+				value = err.Error()
+			}
+		case zapcore.StringerType:
+			if stringer, ok := field.Interface.(fmt.Stringer); ok {
+				value = stringer.String()
+			}
+		case zapcore.ReflectType:
+			if data, err := json.Marshal(field.Interface); err == nil {
+				value = string(data)
+			}
+		}
+		if value != "" && containsSecret(value) {
+			field = zap.String(field.Key, RedactSecrets(value))
+		}
+		redacted = append(redacted, field)
+	}
+	return redacted
+}
+
+// SetSensitiveTables sets the tables whose data values, e.g. the chunk bounds and the rows, are redacted in the logs.
+func SetSensitiveTables(tables filter.Filter) {
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+	sensitiveTables = tables
+}
+
+// IsSensitiveTable returns true if the data values of the table should be redacted.
+func IsSensitiveTable(schema, table string) bool {
+	sensitiveMu.RLock()
+	defer sensitiveMu.RUnlock()
+	return sensitiveTables != nil && sensitiveTables.MatchTable(schema, table)
+}
+
+// HasSensitiveTables returns true if the data values of some tables should be redacted.
+func HasSensitiveTables() bool {
+	sensitiveMu.RLock()
+	defer sensitiveMu.RUnlock()
+	return sensitiveTables != nil
+}
+
+// SetSensitiveColumns sets the columns of the table which are compared by their SHA2 hashes,
+// their values are redacted in the fix sql.
+func SetSensitiveColumns(schema, table string, columns []string) {
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+	if len(columns) == 0 {
+		delete(sensitiveColumns, UniqueID(schema, table))
+		return
+	}
+	if sensitiveColumns == nil {
+		sensitiveColumns = make(map[string]map[string]struct{})
+	}
+	columnSet := make(map[string]struct{}, len(columns))
+	for _, column := range columns {
+		columnSet[strings.ToLower(column)] = struct{}{}
+	}
+	sensitiveColumns[UniqueID(schema, table)] = columnSet
+}
+
+// IsSensitiveColumn returns true if the column of the table is compared by its SHA2 hashes.
+func IsSensitiveColumn(schema, table, column string) bool {
+	sensitiveMu.RLock()
+	defer sensitiveMu.RUnlock()
+	_, ok := sensitiveColumns[UniqueID(schema, table)][strings.ToLower(column)]
+	return ok
+}
+
+// RedactData returns the log field of the data values of the table, which is redacted if the table is sensitive.
+func RedactData(schema, table, key string, value interface{}) zap.Field {
+	if IsSensitiveTable(schema, table) {
+		return zap.String(key, RedactedValue)
+	}
+	return zap.Reflect(key, value)
+}
+
+// RedactAnyData returns the log field of the data values of an unknown table, which is redacted if any table is sensitive.
+func RedactAnyData(key string, value interface{}) zap.Field {
+	if HasSensitiveTables() {
+		return zap.String(key, RedactedValue)
+	}
+	return zap.Reflect(key, value)
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb/parser/model"
+)
+
+// AsOfTimestampClause returns the `AS OF TIMESTAMP` clause to read the snapshot,
+// the snapshot is a tso or a time in the format '2006-01-02 15:04:05'.
+func AsOfTimestampClause(snapshot string) string {
+	if _, err := strconv.ParseUint(snapshot, 10, 64); err == nil {
+		return fmt.Sprintf("AS OF TIMESTAMP TIDB_PARSE_TSO(%s)", snapshot)
+	}
+	return fmt.Sprintf("AS OF TIMESTAMP '%s'", strings.Replace(snapshot, "'", "''", -1))
+}
+
+// StaleTableName returns the table name reading the snapshot by `AS OF TIMESTAMP`,
+// it's the same as dbutil.TableName if the snapshot is empty.
+func StaleTableName(schema, table, snapshot string) string {
+	if snapshot == "" {
+		return dbutil.TableName(schema, table)
+	}
+	return fmt.Sprintf("%s %s", dbutil.TableName(schema, table), AsOfTimestampClause(snapshot))
+}
+
+// GetStaleCountAndChecksum returns the checksum by the algorithm of the table reading the snapshot by `AS OF TIMESTAMP`.
+func GetStaleCountAndChecksum(ctx context.Context, db *sql.DB, schemaName, tableName, snapshot string, tbInfo *model.TableInfo, algorithm, limitRange string, args []interface{}) (int64, int64, error) {
+	return getCountAndChecksum(ctx, db, StaleTableName(schemaName, tableName, snapshot), tbInfo, algorithm, limitRange, args)
+}
+
+// GetStaleTableRowsQueryFormat returns a rowsQuerySQL template reading the snapshot by `AS OF TIMESTAMP`,
+// e.g. SELECT ... FROM `schema`.`table` AS OF TIMESTAMP '2016-10-08 16:45:26' WHERE %s ORDER BY `a`.
+func GetStaleTableRowsQueryFormat(schema, table, snapshot string, tableInfo *model.TableInfo, collation string, hashColumns []string) (string, []*model.ColumnInfo) {
+	return getRowsQueryFormat(StaleTableName(schema, table, snapshot), tableInfo, collation, hashColumns)
+}
+
+// CheckTiDBSnapshotAllowed returns error if the session variable `tidb_snapshot` can't be set to the snapshot.
+func CheckTiDBSnapshotAllowed(ctx context.Context, db *sql.DB, snapshot string) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SET @@session.tidb_snapshot = ?", snapshot); err != nil {
+		return errors.Trace(err)
+	}
+	// the connection returns to the pool, so reset it.
+	_, err = conn.ExecContext(ctx, "SET @@session.tidb_snapshot = ''")
+	return errors.Trace(err)
+}
+
+// CheckAsOfTimestampAllowed returns error if the snapshot can't be read by `AS OF TIMESTAMP`.
+func CheckAsOfTimestampAllowed(ctx context.Context, db *sql.DB, snapshot string) error {
+	query := fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", StaleTableName("mysql", "tidb", snapshot))
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return errors.Trace(rows.Err())
+}
+
+// GetLatestSyncPoint returns the latest consistent pair of the upstream and downstream tso recorded by
+// the changefeed of TiCDC in the syncpoint table of the downstream. clusterID is ignored if it's empty.
+func GetLatestSyncPoint(ctx context.Context, db *sql.DB, clusterID, changefeed string) (primaryTS string, secondaryTS string, err error) {
+	query := "SELECT primary_ts, secondary_ts FROM `tidb_cdc`.`syncpoint_v1` WHERE changefeed = ?"
+	args := []interface{}{changefeed}
+	if clusterID != "" {
+		query += " AND ticdc_cluster_id = ?"
+		args = append(args, clusterID)
+	}
+	query += " ORDER BY CAST(primary_ts AS UNSIGNED) DESC LIMIT 1"
+	err = db.QueryRowContext(ctx, query, args...).Scan(&primaryTS, &secondaryTS)
+	if err == sql.ErrNoRows {
+		return "", "", errors.Errorf("no syncpoint of changefeed %s is found, please check syncpoint is enabled for the changefeed", changefeed)
+	}
+	if err != nil {
+		return "", "", errors.Annotatef(err, "get the syncpoint of changefeed %s", changefeed)
+	}
+	return primaryTS, secondaryTS, nil
+}
+
+// GetSnapshotTime returns the time of the snapshot in the time zone of the session,
+// it's the current time of the database if the snapshot is empty.
+func GetSnapshotTime(ctx context.Context, db *sql.DB, snapshot string) (string, error) {
+	if snapshot == "" {
+		var now string
+		err := db.QueryRowContext(ctx, "SELECT NOW()").Scan(&now)
+		return now, errors.Trace(err)
+	}
+	if _, err := strconv.ParseUint(snapshot, 10, 64); err != nil {
+		// the snapshot is already a time.
+		return snapshot, nil
+	}
+	var snapshotTime string
+	err := db.QueryRowContext(ctx, "SELECT TIDB_PARSE_TSO(?)", snapshot).Scan(&snapshotTime)
+	return snapshotTime, errors.Trace(err)
+}
+
+// TimeWindowRange returns the range only containing the rows whose time column is not less than `since`.
+// The bound is converted by FROM_UNIXTIME on the server, so it's in the time zone of the session, as the time column is.
+func TimeWindowRange(tableRange, timeColumn string, since time.Time) string {
+	return fmt.Sprintf("(%s) AND (%s >= FROM_UNIXTIME(%d))", tableRange, dbutil.ColumnName(timeColumn), since.Unix())
+}
+
+// ChangedSinceRange returns the range only containing the rows whose change hint column is not less than
+// `since`. The rows whose change hint is NULL are kept, because it's unknown whether they changed.
+func ChangedSinceRange(tableRange, hintColumn, since string) string {
+	column := dbutil.ColumnName(hintColumn)
+	return fmt.Sprintf("(%s) AND (%s >= '%s' OR %s IS NULL)", tableRange, column, strings.Replace(since, "'", "''", -1), column)
+}
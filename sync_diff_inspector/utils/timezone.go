@@ -0,0 +1,166 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/parser/mysql"
+)
+
+// UnifiedTimeZone is the time zone used by all the connections of sync-diff,
+// so that the values of timestamp columns read from upstream and downstream are comparable.
+const UnifiedTimeZone string = "+0:00"
+
+// timestampLayout is the layout of the timestamp values, the fractional seconds are accepted when parsing.
+const timestampLayout = "2006-01-02 15:04:05"
+
+// zeroTimestamp is the prefix of the zero timestamp value, which is the same in all the time zones.
+const zeroTimestamp = "0000-00-00"
+
+// TimeZoneInfo is the time zone settings of a database.
+type TimeZoneInfo struct {
+	// Session is the `@@session.time_zone`, may be `SYSTEM`.
+	Session string
+	// System is the `@@global.system_time_zone`.
+	System string
+}
+
+// Location returns the location the session time zone represents.
+func (t *TimeZoneInfo) Location() (*time.Location, error) {
+	if strings.EqualFold(t.Session, "SYSTEM") {
+		return ParseTimeZone(t.System)
+	}
+	return ParseTimeZone(t.Session)
+}
+
+// GetTimeZone returns the session and system time zones of the connection.
+func GetTimeZone(ctx context.Context, db *sql.DB) (*TimeZoneInfo, error) {
+	/*
+		example:
+		mysql> SELECT @@session.time_zone, @@global.system_time_zone;
+		+---------------------+---------------------------+
+		| @@session.time_zone | @@global.system_time_zone |
+		+---------------------+---------------------------+
+		| +0:00               | CST                       |
+		+---------------------+---------------------------+
+	*/
+	var session, system sql.NullString
+	err := db.QueryRowContext(ctx, "SELECT @@session.time_zone, @@global.system_time_zone").Scan(&session, &system)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &TimeZoneInfo{
+		Session: session.String,
+		System:  system.String,
+	}, nil
+}
+
+// UnifiedTimeZoneVars returns the session variables to set the unified time zone for a connection.
+func UnifiedTimeZoneVars() map[string]string {
+	return map[string]string{
+		"time_zone": UnifiedTimeZone,
+	}
+}
+
+// SetTimeZoneSQL returns the statement to set the session time zone, it is written to the head of fix-SQL files.
+func SetTimeZoneSQL(timeZone string) string {
+	return fmt.Sprintf("set @@session.time_zone = \"%s\";", timeZone)
+}
+
+// NeedUnifiedTimeZone returns true if the table has timestamp columns,
+// whose values depend on the session time zone.
+func NeedUnifiedTimeZone(tableInfo *model.TableInfo) bool {
+	for _, col := range tableInfo.Columns {
+		if col.FieldType.Tp == mysql.TypeTimestamp {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTimeZone parses the time zone in the format of MySQL,
+// e.g. `+08:00`, `-3:30`, `UTC` or `Asia/Shanghai`.
+func ParseTimeZone(timeZone string) (*time.Location, error) {
+	if timeZone == "" || strings.EqualFold(timeZone, "UTC") {
+		return time.UTC, nil
+	}
+	if timeZone[0] == '+' || timeZone[0] == '-' {
+		var hour, minute int
+		if _, err := fmt.Sscanf(timeZone[1:], "%d:%d", &hour, &minute); err != nil {
+			return nil, errors.Annotatef(err, "invalid time zone %s", timeZone)
+		}
+		offset := hour*3600 + minute*60
+		if offset == 0 {
+			return time.UTC, nil
+		}
+		if timeZone[0] == '-' {
+			offset = -offset
+		}
+		// the name is normalized, so that `+8:00` and `+08:00` are the same location.
+		return time.FixedZone(fmt.Sprintf("%c%02d:%02d", timeZone[0], hour, minute), offset), nil
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid time zone %s", timeZone)
+	}
+	return loc, nil
+}
+
+// ConvertTimeZone converts the timestamp value in `from` time zone into `to` time zone,
+// the number of the fractional digits is kept.
+func ConvertTimeZone(value string, from, to *time.Location) (string, error) {
+	t, err := time.ParseInLocation(timestampLayout, value, from)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	layout := timestampLayout
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		layout += "." + strings.Repeat("0", len(value)-i-1)
+	}
+	return t.In(to).Format(layout), nil
+}
+
+// SameLocation returns true if the locations are the same time zone.
+func SameLocation(loc1, loc2 *time.Location) bool {
+	return loc1.String() == loc2.String()
+}
+
+// ConvertRowTimeZone returns a copy of the row whose timestamp values in `from` time zone are converted into
+// `to` time zone, the NULL and zero values are kept.
+func ConvertRowTimeZone(data map[string]*dbutil.ColumnData, tableInfo *model.TableInfo, from, to *time.Location) (map[string]*dbutil.ColumnData, error) {
+	converted := make(map[string]*dbutil.ColumnData, len(data))
+	for name, value := range data {
+		converted[name] = value
+	}
+	for _, col := range tableInfo.Columns {
+		value, ok := data[col.Name.O]
+		if !ok || value.IsNull || col.FieldType.Tp != mysql.TypeTimestamp || strings.HasPrefix(string(value.Data), zeroTimestamp) {
+			continue
+		}
+		str, err := ConvertTimeZone(string(value.Data), from, to)
+		if err != nil {
+			return nil, errors.Annotatef(err, "convert the time zone of column %s", col.Name.O)
+		}
+		converted[col.Name.O] = &dbutil.ColumnData{Data: []byte(str)}
+	}
+	return converted, nil
+}
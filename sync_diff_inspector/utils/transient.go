@@ -0,0 +1,69 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"database/sql/driver"
+	stderrors "errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb/errno"
+)
+
+// the error numbers of the mysql client when the connection is lost.
+const (
+	crServerGone = 2006
+	crServerLost = 2013
+)
+
+// IsTransientError returns true if the error is caused by a timeout or a broken connection,
+// or is retryable by dbutil.IsRetryableError, so the same query may succeed later.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if dbutil.IsRetryableError(err) {
+		return true
+	}
+	err = errors.Cause(err)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+		switch mysqlErr.Number {
+		case errno.ErrLockWaitTimeout,
+			errno.ErrMaxExecTimeExceeded,
+			errno.ErrServerShutdown,
+			errno.ErrTiKVServerTimeout,
+			errno.ErrRegionUnavailable,
+			crServerGone,
+			crServerLost:
+			return true
+		}
+		return false
+	}
+	if err == driver.ErrBadConn || err == mysql.ErrInvalidConn || err == io.EOF || err == io.ErrUnexpectedEOF ||
+		err == context.DeadlineExceeded {
+		return true
+	}
+	var netErr net.Error
+	if stderrors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return stderrors.Is(err, syscall.ECONNRESET) || stderrors.Is(err, syscall.ECONNREFUSED) ||
+		stderrors.Is(err, syscall.ECONNABORTED) || stderrors.Is(err, syscall.EPIPE)
+}
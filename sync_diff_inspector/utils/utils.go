@@ -16,8 +16,11 @@ package utils
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"math"
+	"net/url"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -27,21 +30,47 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/chaos"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/chunk"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
+	"github.com/pingcap/tidb/parser"
 	"github.com/pingcap/tidb/parser/model"
 	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/pingcap/tidb/parser/types"
 	"go.uber.org/zap"
 )
 
+const (
+	// RowHashColumn is the column of the hashes of the full rows selected by GetRowHashesQueryFormat.
+	RowHashColumn = "_row_hash"
+	// RowCountColumn is the column of the counts of the rows of the same hash selected by GetRowHashesQueryFormat.
+	RowCountColumn = "_row_count"
+)
+
 // WorkerPool contains a pool of workers.
-// The number of workers in the channel represents how many goruntines
+// The number of idle workers represents how many goruntines
 // can be created to execute the task.
-// After the task is done, worker will be sent back to the channel.
+// After the task is done, worker will be sent back to the pool.
+// The number of workers can be changed at runtime by `Resize`.
 type WorkerPool struct {
-	limit   uint
-	workers chan *Worker
-	name    string
-	wg      sync.WaitGroup
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	limit uint
+	// idle workers
+	workers []*Worker
+	// the number of workers running tasks.
+	busy uint
+	// the number of callers waiting for an idle worker.
+	waiting uint
+	// the number of workers created and not retired.
+	total uint
+	// the ID of the next created worker, the IDs of the retired workers are not reused
+	// since they may still be running tasks.
+	nextID uint64
+
+	name string
+	wg   sync.WaitGroup
 }
 
 // Worker identified by ID.
@@ -51,17 +80,14 @@ type Worker struct {
 
 type taskFunc func()
 
-// NewWorkerPool returns a WorkerPool with `limit` workers in the channel.
+// NewWorkerPool returns a WorkerPool with `limit` workers.
 func NewWorkerPool(limit uint, name string) *WorkerPool {
-	workers := make(chan *Worker, limit)
-	for i := uint(0); i < limit; i++ {
-		workers <- &Worker{ID: uint64(i + 1)}
-	}
-	return &WorkerPool{
-		limit:   limit,
-		workers: workers,
-		name:    name,
+	pool := &WorkerPool{
+		name: name,
 	}
+	pool.cond = sync.NewCond(&pool.mu)
+	pool.resize(limit)
+	return pool
 }
 
 // Apply wait for an idle worker to run `taskFunc`.
@@ -76,28 +102,90 @@ func (pool *WorkerPool) Apply(fn taskFunc) {
 	}()
 }
 
-// apply waits for an idle worker from the channel and return it
+// apply waits for an idle worker and return it
 func (pool *WorkerPool) apply() *Worker {
-	var worker *Worker
-	select {
-	case worker = <-pool.workers:
-	default:
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if len(pool.workers) == 0 {
 		log.Debug("wait for workers", zap.String("pool", pool.name))
-		worker = <-pool.workers
+		pool.waiting++
+		for len(pool.workers) == 0 {
+			pool.cond.Wait()
+		}
+		pool.waiting--
 	}
+	worker := pool.workers[len(pool.workers)-1]
+	pool.workers = pool.workers[:len(pool.workers)-1]
+	pool.busy++
 	return worker
 }
 
-// recycle sends an idle worker back to the channel
+// recycle sends an idle worker back to the pool,
+// or retires it if the pool has been shrunk.
 func (pool *WorkerPool) recycle(worker *Worker) {
 	if worker == nil {
 		panic("invalid restore worker")
 	}
-	pool.workers <- worker
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.busy--
+	if pool.total > pool.limit {
+		pool.total--
+		return
+	}
+	pool.workers = append(pool.workers, worker)
+	pool.cond.Signal()
+}
+
+// Resize changes the number of workers to `limit`.
+// When shrinking, the busy workers are retired after their tasks are done.
+func (pool *WorkerPool) Resize(limit uint) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	log.Info("resize worker pool", zap.String("pool", pool.name), zap.Uint("from", pool.limit), zap.Uint("to", limit))
+	pool.resize(limit)
+}
+
+func (pool *WorkerPool) resize(limit uint) {
+	pool.limit = limit
+	for pool.total < limit {
+		pool.total++
+		pool.nextID++
+		pool.workers = append(pool.workers, &Worker{ID: pool.nextID})
+	}
+	// retire the idle workers first.
+	for pool.total > limit && len(pool.workers) > 0 {
+		pool.workers = pool.workers[:len(pool.workers)-1]
+		pool.total--
+	}
+	pool.cond.Broadcast()
+}
+
+// Limit returns the number of workers the pool is expected to have.
+func (pool *WorkerPool) Limit() uint {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.limit
+}
+
+// BusyWorkers returns the number of workers running tasks.
+func (pool *WorkerPool) BusyWorkers() uint {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.busy
+}
+
+// QueueLen returns the number of callers waiting for an idle worker.
+func (pool *WorkerPool) QueueLen() uint {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.waiting
 }
 
 // HasWorker checks if the pool has unallocated workers.
 func (pool *WorkerPool) HasWorker() bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
 	return len(pool.workers) > 0
 }
 
@@ -116,14 +204,30 @@ func GetColumnsFromIndex(index *model.IndexInfo, tableInfo *model.TableInfo) []*
 	return indexColumns
 }
 
-// GetTableRowsQueryFormat returns a rowsQuerySQL template for the specific table.
+// GetTableRowsQueryFormat returns a rowsQuerySQL template for the specific table,
+// the hashColumns are selected as their MD5 hashes instead of the values.
 //  e.g. SELECT /*!40001 SQL_NO_CACHE */ `a`, `b` FROM `schema`.`table` WHERE %s ORDER BY `a`.
-func GetTableRowsQueryFormat(schema, table string, tableInfo *model.TableInfo, collation string) (string, []*model.ColumnInfo) {
+func GetTableRowsQueryFormat(schema, table string, tableInfo *model.TableInfo, collation string, hashColumns []string) (string, []*model.ColumnInfo) {
+	return getRowsQueryFormat(dbutil.TableName(schema, table), tableInfo, collation, hashColumns)
+}
+
+// GetQueryRowsQueryFormat returns a rowsQuerySQL template for the result set of the query.
+//  e.g. SELECT /*!40001 SQL_NO_CACHE */ `a`, `b` FROM (SELECT ...) AS `table` WHERE %s ORDER BY `a`.
+func GetQueryRowsQueryFormat(query, table string, tableInfo *model.TableInfo, collation string, hashColumns []string) (string, []*model.ColumnInfo) {
+	return getRowsQueryFormat(QueryTableName(query, table), tableInfo, collation, hashColumns)
+}
+
+func getRowsQueryFormat(tableName string, tableInfo *model.TableInfo, collation string, hashColumns []string) (string, []*model.ColumnInfo) {
 	orderKeys, orderKeyCols := dbutil.SelectUniqueOrderKey(tableInfo)
+	hashColumnMap := SliceToMap(hashColumns)
 
 	columnNames := make([]string, 0, len(tableInfo.Columns))
 	for _, col := range tableInfo.Columns {
-		columnNames = append(columnNames, dbutil.ColumnName(col.Name.O))
+		name := dbutil.ColumnName(col.Name.O)
+		if _, ok := hashColumnMap[col.Name.O]; ok {
+			name = fmt.Sprintf("MD5(%s) AS %s", name, name)
+		}
+		columnNames = append(columnNames, name)
 	}
 	columns := strings.Join(columnNames, ", ")
 	if collation != "" {
@@ -135,11 +239,36 @@ func GetTableRowsQueryFormat(schema, table string, tableInfo *model.TableInfo, c
 	}
 
 	query := fmt.Sprintf("SELECT /*!40001 SQL_NO_CACHE */ %s FROM %s WHERE %%s ORDER BY %s%s",
-		columns, dbutil.TableName(schema, table), strings.Join(orderKeys, ","), collation)
+		columns, tableName, strings.Join(orderKeys, ","), collation)
 
 	return query, orderKeyCols
 }
 
+// GetLargeColumns returns the TEXT/BLOB columns which are not in the unique order key of the table,
+// they can be compared by their hashes first. It returns nil if the table has no primary key or unique key,
+// because the rows can't be located to fetch the full values.
+func GetLargeColumns(tableInfo *model.TableInfo) []string {
+	_, orderKeyCols := dbutil.SelectUniqueOrderKey(tableInfo)
+	if len(orderKeyCols) == len(tableInfo.Columns) {
+		return nil
+	}
+	keys := make(map[string]struct{}, len(orderKeyCols))
+	for _, col := range orderKeyCols {
+		keys[col.Name.O] = struct{}{}
+	}
+	var columns []string
+	for _, col := range tableInfo.Columns {
+		if _, ok := keys[col.Name.O]; ok {
+			continue
+		}
+		switch col.FieldType.Tp {
+		case mysql.TypeTinyBlob, mysql.TypeMediumBlob, mysql.TypeLongBlob, mysql.TypeBlob:
+			columns = append(columns, col.Name.O)
+		}
+	}
+	return columns
+}
+
 // GenerateReplaceDML returns the insert SQL for the specific row values.
 func GenerateReplaceDML(data map[string]*dbutil.ColumnData, table *model.TableInfo, schema string) string {
 	colNames := make([]string, 0, len(table.Columns))
@@ -150,16 +279,7 @@ func GenerateReplaceDML(data map[string]*dbutil.ColumnData, table *model.TableIn
 		}
 
 		colNames = append(colNames, dbutil.ColumnName(col.Name.O))
-		if data[col.Name.O].IsNull {
-			values = append(values, "NULL")
-			continue
-		}
-
-		if NeedQuotes(col.FieldType.Tp) {
-			values = append(values, fmt.Sprintf("'%s'", strings.Replace(string(data[col.Name.O].Data), "'", "\\'", -1)))
-		} else {
-			values = append(values, string(data[col.Name.O].Data))
-		}
+		values = append(values, columnValue(schema, table, col, data[col.Name.O]))
 	}
 
 	return fmt.Sprintf("REPLACE INTO %s(%s) VALUES (%s);", dbutil.TableName(schema, table.Name.O), strings.Join(colNames, ","), strings.Join(values, ","))
@@ -168,8 +288,23 @@ func GenerateReplaceDML(data map[string]*dbutil.ColumnData, table *model.TableIn
 // GerateReplaceDMLWithAnnotation returns the replace SQL for the specific 2 rows.
 // And add Annotations to show the different columns.
 func GenerateReplaceDMLWithAnnotation(source, target map[string]*dbutil.ColumnData, table *model.TableInfo, schema string) string {
+	annotation, sqlColNames, sqlValues, _ := diffColumns(source, target, table, schema)
+	return fmt.Sprintf("/*\n%s*/\nREPLACE INTO %s(%s) VALUES (%s);", annotation, dbutil.TableName(schema, table.Name.O), strings.Join(sqlColNames, ","), strings.Join(sqlValues, ","))
+}
+
+// GenerateUpdateDMLWithAnnotation returns the update SQL setting the different columns of the target row to
+// the source values, so that the columns not compared are kept. And add Annotations to show the different columns.
+func GenerateUpdateDMLWithAnnotation(source, target map[string]*dbutil.ColumnData, table *model.TableInfo, schema string) string {
+	annotation, _, _, assignments := diffColumns(source, target, table, schema)
+	return fmt.Sprintf("/*\n%s*/\nUPDATE %s SET %s WHERE %s LIMIT 1;", annotation, dbutil.TableName(schema, table.Name.O), strings.Join(assignments, ", "), rowCondition(target, table, schema))
+}
+
+// diffColumns returns the annotation showing the different columns of the 2 rows, the names and the source
+// values of the columns, and the assignments of the different columns to the source values.
+func diffColumns(source, target map[string]*dbutil.ColumnData, table *model.TableInfo, schema string) (string, []string, []string, []string) {
 	sqlColNames := make([]string, 0, len(table.Columns))
 	sqlValues := make([]string, 0, len(table.Columns))
+	assignments := make([]string, 0, len(table.Columns))
 	colNames := append(make([]string, 0, len(table.Columns)+1), "diff columns")
 	values1 := append(make([]string, 0, len(table.Columns)+1), "source data")
 	values2 := append(make([]string, 0, len(table.Columns)+1), "target data")
@@ -181,19 +316,9 @@ func GenerateReplaceDMLWithAnnotation(source, target map[string]*dbutil.ColumnDa
 		}
 
 		var data1, data2 *dbutil.ColumnData
-		var value1 string
 		data1 = source[col.Name.O]
 		data2 = target[col.Name.O]
-
-		if data1.IsNull {
-			value1 = "NULL"
-		} else {
-			if NeedQuotes(col.FieldType.Tp) {
-				value1 = fmt.Sprintf("'%s'", strings.Replace(string(data1.Data), "'", "\\'", -1))
-			} else {
-				value1 = string(data1.Data)
-			}
-		}
+		value1 := columnValue(schema, table, col, data1)
 		colName := dbutil.ColumnName(col.Name.O)
 		sqlColNames = append(sqlColNames, colName)
 		sqlValues = append(sqlValues, value1)
@@ -205,17 +330,8 @@ func GenerateReplaceDMLWithAnnotation(source, target map[string]*dbutil.ColumnDa
 
 		colNames = append(colNames, colName)
 		values1 = append(values1, value1)
-
-		if data2.IsNull {
-			values2 = append(values2, "NULL")
-		} else {
-			if NeedQuotes(col.FieldType.Tp) {
-				values2 = append(values2, fmt.Sprintf("'%s'", strings.Replace(string(data2.Data), "'", "\\'", -1)))
-			} else {
-				values2 = append(values2, string(data2.Data))
-			}
-		}
-
+		assignments = append(assignments, fmt.Sprintf("%s = %s", colName, value1))
+		values2 = append(values2, columnValue(schema, table, col, data2))
 	}
 
 	diffTable.SetRowLine(true)
@@ -229,11 +345,32 @@ func GenerateReplaceDMLWithAnnotation(source, target map[string]*dbutil.ColumnDa
 	diffTable.SetBorder(false)
 	diffTable.Render()
 
-	return fmt.Sprintf("/*\n%s*/\nREPLACE INTO %s(%s) VALUES (%s);", tableString.String(), dbutil.TableName(schema, table.Name.O), strings.Join(sqlColNames, ","), strings.Join(sqlValues, ","))
+	return tableString.String(), sqlColNames, sqlValues, assignments
 }
 
 // GerateReplaceDMLWithAnnotation returns the delete SQL for the specific row.
 func GenerateDeleteDML(data map[string]*dbutil.ColumnData, table *model.TableInfo, schema string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s LIMIT 1;", dbutil.TableName(schema, table.Name.O), rowCondition(data, table, schema))
+}
+
+// columnValue returns the value of the column in the sql, the values of the sensitive columns are redacted,
+// because only their hashes are read.
+func columnValue(schema string, table *model.TableInfo, col *model.ColumnInfo, data *dbutil.ColumnData) string {
+	switch {
+	case data.IsNull:
+		return "NULL"
+	case IsSensitiveColumn(schema, table.Name.O, col.Name.O):
+		return fmt.Sprintf("'%s'", RedactedValue)
+	case NeedQuotes(col.FieldType.Tp):
+		return fmt.Sprintf("'%s'", strings.Replace(string(data.Data), "'", "\\'", -1))
+	default:
+		return string(data.Data)
+	}
+}
+
+// rowCondition returns the condition matching the values of all the columns of the row,
+// the sensitive columns are matched by their hashes.
+func rowCondition(data map[string]*dbutil.ColumnData, table *model.TableInfo, schema string) string {
 	kvs := make([]string, 0, len(table.Columns))
 	for _, col := range table.Columns {
 		if col.IsGenerated() {
@@ -245,14 +382,34 @@ func GenerateDeleteDML(data map[string]*dbutil.ColumnData, table *model.TableInf
 			continue
 		}
 
+		if IsSensitiveColumn(schema, table.Name.O, col.Name.O) {
+			kvs = append(kvs, fmt.Sprintf("%s = '%s'", SensitiveColumnExpression(dbutil.ColumnName(col.Name.O)), string(data[col.Name.O].Data)))
+			continue
+		}
+
 		if NeedQuotes(col.FieldType.Tp) {
 			kvs = append(kvs, fmt.Sprintf("%s = '%s'", dbutil.ColumnName(col.Name.O), strings.Replace(string(data[col.Name.O].Data), "'", "\\'", -1)))
 		} else {
 			kvs = append(kvs, fmt.Sprintf("%s = %s", dbutil.ColumnName(col.Name.O), string(data[col.Name.O].Data)))
 		}
 	}
-	return fmt.Sprintf("DELETE FROM %s WHERE %s LIMIT 1;", dbutil.TableName(schema, table.Name.O), strings.Join(kvs, " AND "))
+	return strings.Join(kvs, " AND ")
+}
 
+// GenerateRangeDeleteDML returns the delete SQL for all the rows in the range,
+// `where` is the condition of the range with `?` as the placeholders of args.
+func GenerateRangeDeleteDML(schema, table, where string, args []interface{}) string {
+	var condition strings.Builder
+	argIndex := 0
+	for _, c := range where {
+		if c == '?' && argIndex < len(args) {
+			condition.WriteString(fmt.Sprintf("'%s'", strings.Replace(fmt.Sprintf("%v", args[argIndex]), "'", "\\'", -1)))
+			argIndex++
+			continue
+		}
+		condition.WriteRune(c)
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s;", dbutil.TableName(schema, table), condition.String())
 }
 
 // isCompatible checks whether 2 column types are compatible.
@@ -417,13 +574,87 @@ func NeedQuotes(tp byte) bool {
 	return !(dbutil.IsNumberType(tp) || dbutil.IsFloatType(tp))
 }
 
-// CompareData compare two row datas.
+// Tolerance is the max differences of the numeric values regarded as equal when comparing the rows,
+// so that the values only differing by rounding after heterogeneous migrations are equal.
+type Tolerance struct {
+	// Float applies to the FLOAT and DOUBLE columns without a column tolerance.
+	Float float64
+	// Columns are the tolerances of the numeric columns by their lower case names.
+	Columns map[string]float64
+	// SemanticJSON compares the JSON values semantically, so the different key orders and whitespaces are ignored.
+	SemanticJSON bool
+}
+
+// NewTolerance returns the tolerance of the table, it's nil if neither the float tolerance
+// nor the column tolerances are set, and the JSON values aren't compared semantically.
+func NewTolerance(float float64, columns map[string]float64, semanticJSON bool) *Tolerance {
+	if float <= 0 && len(columns) == 0 && !semanticJSON {
+		return nil
+	}
+	t := &Tolerance{Float: float, Columns: make(map[string]float64, len(columns)), SemanticJSON: semanticJSON}
+	if float <= 0 {
+		t.Float = config.DefaultFloatTolerance
+	}
+	for column, tolerance := range columns {
+		t.Columns[strings.ToLower(column)] = tolerance
+	}
+	return t
+}
+
+// Of returns the tolerance of the column, ok is false if the values of the column are compared exactly.
+// The tolerance is nil-safe, the FLOAT/DOUBLE values are compared by `DefaultFloatTolerance` then.
+func (t *Tolerance) Of(column *model.ColumnInfo) (tolerance float64, ok bool) {
+	if t != nil {
+		if tolerance, ok = t.Columns[column.Name.L]; ok {
+			return tolerance, true
+		}
+	}
+	if column.FieldType.Tp != mysql.TypeFloat && column.FieldType.Tp != mysql.TypeDouble {
+		return 0, false
+	}
+	if t == nil {
+		return config.DefaultFloatTolerance, true
+	}
+	return t.Float, true
+}
+
+// String returns the tolerance as a note of the table.
+func (t *Tolerance) String() string {
+	columns := make([]string, 0, len(t.Columns))
+	for column, tolerance := range t.Columns {
+		columns = append(columns, fmt.Sprintf("%s by %g", column, tolerance))
+	}
+	sort.Strings(columns)
+	note := fmt.Sprintf("FLOAT/DOUBLE values differing by %g are equal", t.Float)
+	if len(columns) > 0 {
+		note += ", the values of " + strings.Join(columns, ", ")
+	}
+	if t.SemanticJSON {
+		note += ", the JSON values are compared semantically"
+	}
+	return note
+}
+
+// equalJSON returns true if the JSON values are the same after parsed, it's false if any of them can't be parsed.
+func equalJSON(data1, data2 []byte) bool {
+	var value1, value2 interface{}
+	if err := json.Unmarshal(data1, &value1); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(data2, &value2); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(value1, value2)
+}
+
+// CompareData compare two row datas, the numeric and JSON values are compared by the tolerance, nil means
+// the FLOAT/DOUBLE values differing by `DefaultFloatTolerance` are equal.
 // equal = true: map1 = map2
 // equal = false:
 // 		1. cmp = 0: map1 and map2 have the same orderkeycolumns, but other columns are in difference.
 //		2. cmp = -1: map1 < map2 (by comparing the orderkeycolumns)
 // 		3. cmp = 1: map1 > map2
-func CompareData(map1, map2 map[string]*dbutil.ColumnData, orderKeyCols, columns []*model.ColumnInfo) (equal bool, cmp int32, err error) {
+func CompareData(map1, map2 map[string]*dbutil.ColumnData, orderKeyCols, columns []*model.ColumnInfo, tolerance *Tolerance) (equal bool, cmp int32, err error) {
 	var (
 		data1, data2 *dbutil.ColumnData
 		str1, str2   string
@@ -456,7 +687,7 @@ func CompareData(map1, map2 map[string]*dbutil.ColumnData, orderKeyCols, columns
 		}
 		str1 = string(data1.Data)
 		str2 = string(data2.Data)
-		if column.FieldType.Tp == mysql.TypeFloat || column.FieldType.Tp == mysql.TypeDouble {
+		if epsilon, ok := tolerance.Of(column); ok {
 			if data1.IsNull == data2.IsNull && data1.IsNull {
 				continue
 			}
@@ -467,13 +698,18 @@ func CompareData(map1, map2 map[string]*dbutil.ColumnData, orderKeyCols, columns
 				err = errors.Errorf("convert %s, %s to float failed, err1: %v, err2: %v", str1, str2, err1, err2)
 				return
 			}
-			if math.Abs(num1-num2) <= 1e-6 {
+			if math.Abs(num1-num2) <= epsilon {
 				continue
 			}
 		} else {
 			if (str1 == str2) && (data1.IsNull == data2.IsNull) {
 				continue
 			}
+			if tolerance != nil && tolerance.SemanticJSON && column.FieldType.Tp == mysql.TypeJSON &&
+				!data1.IsNull && !data2.IsNull && equalJSON(data1.Data, data2.Data) {
+				log.Debug("the JSON values are equal semantically", zap.String("column", column.Name.O), zap.String("value1", str1), zap.String("value2", str2))
+				continue
+			}
 		}
 
 		equal = false
@@ -582,6 +818,7 @@ func SliceToMap(slice []string) map[string]interface{} {
 }
 
 // GetApproximateMidBySize return the `count`th row in rows that meet the `limitRange`.
+// It returns nil if the row contains NULL values.
 func GetApproximateMidBySize(ctx context.Context, db *sql.DB, schema, table string, indexColumns []*model.ColumnInfo, limitRange string, args []interface{}, count int64) (map[string]string, error) {
 	/*
 		example
@@ -593,6 +830,46 @@ func GetApproximateMidBySize(ctx context.Context, db *sql.DB, schema, table stri
 		+------+---------+-----------------+
 		1 row in set (0.09 sec)
 	*/
+	return getIndexValuesByOffset(ctx, db, schema, table, indexColumns, limitRange, args, count/2)
+}
+
+// GetApproximateSplitPointsBySize returns `splitCount-1` rows in rows that meet the `limitRange`,
+// which split the `count` rows into `splitCount` parts with about the same size.
+// The adjacent duplicate rows are removed, so less rows may be returned.
+func GetApproximateSplitPointsBySize(ctx context.Context, db *sql.DB, schema, table string, indexColumns []*model.ColumnInfo, limitRange string, args []interface{}, count int64, splitCount int) ([]map[string]string, error) {
+	points := make([]map[string]string, 0, splitCount-1)
+	for i := 1; i < splitCount; i++ {
+		columnValues, err := getIndexValuesByOffset(ctx, db, schema, table, indexColumns, limitRange, args, count*int64(i)/int64(splitCount))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if columnValues == nil {
+			// NULL values can't be the bound of a range, skip this point
+			continue
+		}
+		if len(points) > 0 && isSameIndexValues(points[len(points)-1], columnValues) {
+			continue
+		}
+		points = append(points, columnValues)
+	}
+	return points, nil
+}
+
+func isSameIndexValues(values1, values2 map[string]string) bool {
+	if len(values1) != len(values2) {
+		return false
+	}
+	for column, value := range values1 {
+		if v, ok := values2[column]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// getIndexValuesByOffset returns the values of `indexColumns` of the `offset`th row in rows that meet the `limitRange`.
+// It returns nil if any of the values is NULL.
+func getIndexValuesByOffset(ctx context.Context, db *sql.DB, schema, table string, indexColumns []*model.ColumnInfo, limitRange string, args []interface{}, offset int64) (map[string]string, error) {
 	columnNames := make([]string, 0, len(indexColumns))
 	for _, col := range indexColumns {
 		columnNames = append(columnNames, dbutil.ColumnName(col.Name.O))
@@ -602,8 +879,8 @@ func GetApproximateMidBySize(ctx context.Context, db *sql.DB, schema, table stri
 		dbutil.TableName(schema, table),
 		limitRange,
 		strings.Join(columnNames, ", "),
-		count/2)
-	log.Debug("get mid by size", zap.String("sql", query), zap.Reflect("args", args))
+		offset)
+	log.Debug("get index values by offset", zap.String("sql", query), RedactAnyData("args", args))
 	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -611,7 +888,7 @@ func GetApproximateMidBySize(ctx context.Context, db *sql.DB, schema, table stri
 	defer rows.Close()
 	columns := make([]interface{}, len(indexColumns))
 	for i := range columns {
-		columns[i] = new(string)
+		columns[i] = new(sql.NullString)
 	}
 	if !rows.Next() {
 		if err := rows.Err(); err != nil {
@@ -625,7 +902,12 @@ func GetApproximateMidBySize(ctx context.Context, db *sql.DB, schema, table stri
 	}
 	columnValues := make(map[string]string)
 	for i, column := range columns {
-		columnValues[indexColumns[i].Name.O] = *column.(*string)
+		value := column.(*sql.NullString)
+		if !value.Valid {
+			log.Debug("the row contains NULL value", zap.String("column", indexColumns[i].Name.O))
+			return nil, nil
+		}
+		columnValues[indexColumns[i].Name.O] = value.String
 	}
 	return columnValues, nil
 }
@@ -641,8 +923,31 @@ func GetTableSize(ctx context.Context, db *sql.DB, schemaName, tableName string)
 	return dataSize.Int64, nil
 }
 
-// GetCountAndCRC32Checksum returns checksum code and count of some data by given condition
-func GetCountAndCRC32Checksum(ctx context.Context, db *sql.DB, schemaName, tableName string, tbInfo *model.TableInfo, limitRange string, args []interface{}) (int64, int64, error) {
+// GetCharsetByCollation returns the charset of the collation, returns an empty string if the collation doesn't exist.
+func GetCharsetByCollation(ctx context.Context, db *sql.DB, collation string) (string, error) {
+	query := "SELECT CHARACTER_SET_NAME FROM `information_schema`.`COLLATIONS` WHERE COLLATION_NAME = ?;"
+	var charset sql.NullString
+	err := db.QueryRowContext(ctx, query, collation).Scan(&charset)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return charset.String, nil
+}
+
+// GetCountAndChecksum returns checksum code by the algorithm and count of some data by given condition
+func GetCountAndChecksum(ctx context.Context, db *sql.DB, schemaName, tableName string, tbInfo *model.TableInfo, algorithm, limitRange string, args []interface{}) (int64, int64, error) {
+	return getCountAndChecksum(ctx, db, dbutil.TableName(schemaName, tableName), tbInfo, algorithm, limitRange, args)
+}
+
+// GetQueryCountAndChecksum returns checksum code by the algorithm and count of the result set of the query by given condition
+func GetQueryCountAndChecksum(ctx context.Context, db *sql.DB, query, tableName string, tbInfo *model.TableInfo, algorithm, limitRange string, args []interface{}) (int64, int64, error) {
+	return getCountAndChecksum(ctx, db, QueryTableName(query, tableName), tbInfo, algorithm, limitRange, args)
+}
+
+func getCountAndChecksum(ctx context.Context, db *sql.DB, tableName string, tbInfo *model.TableInfo, algorithm, limitRange string, args []interface{}) (int64, int64, error) {
 	/*
 		calculate CRC32 checksum and count example:
 		mysql> select count(*) as CNT, BIT_XOR(CAST(CRC32(CONCAT_WS(',', id, name, age, CONCAT(ISNULL(id), ISNULL(name), ISNULL(age))))AS UNSIGNED)) as CHECKSUM from test.test where id > 0;
@@ -653,6 +958,48 @@ func GetCountAndCRC32Checksum(ctx context.Context, db *sql.DB, schemaName, table
 		+--------+------------+
 		1 row in set (0.46 sec)
 	*/
+	query := CountAndChecksumQuery(tableName, tbInfo, algorithm, limitRange)
+	log.Debug("count and checksum", zap.String("sql", query), RedactAnyData("args", args))
+	if err := chaos.Inject(chaos.SourceQueryError); err != nil {
+		return -1, -1, errors.Trace(err)
+	}
+
+	var count sql.NullInt64
+	var checksum sql.NullInt64
+	err := db.QueryRowContext(ctx, query, args...).Scan(&count, &checksum)
+	if err != nil {
+		log.Warn("execute checksum query fail", zap.String("query", query), RedactAnyData("args", args), zap.Error(err))
+		return -1, -1, errors.Trace(err)
+	}
+	if !count.Valid || !checksum.Valid {
+		// if don't have any data, the checksum will be `NULL`
+		log.Warn("get empty count or checksum", zap.String("sql", query), RedactAnyData("args", args))
+		return 0, 0, nil
+	}
+
+	return count.Int64, checksum.Int64, nil
+}
+
+// CountAndChecksumQuery returns the query to calculate the checksum by the algorithm and count of the table by given condition,
+// tableName is the quoted name of the table or the result set of a query.
+func CountAndChecksumQuery(tableName string, tbInfo *model.TableInfo, algorithm, limitRange string) string {
+	row := rowExpression(tbInfo)
+	var rowChecksum string
+	switch algorithm {
+	case config.ChecksumNone:
+		return fmt.Sprintf("SELECT COUNT(*) as CNT, 0 as CHECKSUM FROM %s WHERE %s;", tableName, limitRange)
+	case config.ChecksumSHA1:
+		// the first 15 hex digits, so that the result of BIT_XOR fits in a signed 64-bit integer.
+		rowChecksum = fmt.Sprintf("CAST(CONV(LEFT(SHA1(%s), 15), 16, 10) AS UNSIGNED)", row)
+	default:
+		rowChecksum = fmt.Sprintf("CAST(CRC32(%s)AS UNSIGNED)", row)
+	}
+	return fmt.Sprintf("SELECT COUNT(*) as CNT, BIT_XOR(%s) as CHECKSUM FROM %s WHERE %s;", rowChecksum, tableName, limitRange)
+}
+
+// rowExpression returns the expression concatenating the values of all the columns of the row,
+// the NULL values are distinguished from the empty values by ISNULL.
+func rowExpression(tbInfo *model.TableInfo) string {
 	columnNames := make([]string, 0, len(tbInfo.Columns))
 	columnIsNull := make([]string, 0, len(tbInfo.Columns))
 	for _, col := range tbInfo.Columns {
@@ -667,25 +1014,24 @@ func GetCountAndCRC32Checksum(ctx context.Context, db *sql.DB, schemaName, table
 		columnNames = append(columnNames, name)
 		columnIsNull = append(columnIsNull, fmt.Sprintf("ISNULL(%s)", name))
 	}
+	return fmt.Sprintf("CONCAT_WS(',', %s, CONCAT(%s))", strings.Join(columnNames, ", "), strings.Join(columnIsNull, ", "))
+}
 
-	query := fmt.Sprintf("SELECT COUNT(*) as CNT, BIT_XOR(CAST(CRC32(CONCAT_WS(',', %s, CONCAT(%s)))AS UNSIGNED)) as CHECKSUM FROM %s WHERE %s;",
-		strings.Join(columnNames, ", "), strings.Join(columnIsNull, ", "), dbutil.TableName(schemaName, tableName), limitRange)
-	log.Debug("count and checksum", zap.String("sql", query), zap.Reflect("args", args))
-
-	var count sql.NullInt64
-	var checksum sql.NullInt64
-	err := db.QueryRowContext(ctx, query, args...).Scan(&count, &checksum)
-	if err != nil {
-		log.Warn("execute checksum query fail", zap.String("query", query), zap.Reflect("args", args), zap.Error(err))
-		return -1, -1, errors.Trace(err)
-	}
-	if !count.Valid || !checksum.Valid {
-		// if don't have any data, the checksum will be `NULL`
-		log.Warn("get empty count or checksum", zap.String("sql", query), zap.Reflect("args", args))
-		return 0, 0, nil
-	}
+// RowHashExpression returns the expression of the MD5 hash of all the columns of the row.
+func RowHashExpression(tbInfo *model.TableInfo) string {
+	return fmt.Sprintf("MD5(%s)", rowExpression(tbInfo))
+}
 
-	return count.Int64, checksum.Int64, nil
+// GetRowHashesQueryFormat returns a query template selecting the distinct hashes of the full rows and their counts
+// ordered by the hashes, which compares the rows of the tables without primary key or unique key as a multiset.
+// The returned column is the hash column, which orders the rows.
+//  e.g. SELECT MD5(...) AS `_row_hash`, COUNT(*) AS `_row_count` FROM `schema`.`t` WHERE %s GROUP BY `_row_hash` ORDER BY `_row_hash`
+func GetRowHashesQueryFormat(tableName string, tbInfo *model.TableInfo) (string, []*model.ColumnInfo) {
+	hashColumn := &model.ColumnInfo{Name: model.NewCIStr(RowHashColumn), FieldType: *types.NewFieldType(mysql.TypeVarchar)}
+	query := fmt.Sprintf("SELECT /*!40001 SQL_NO_CACHE */ %s AS %s, COUNT(*) AS %s FROM %s WHERE %%s GROUP BY %s ORDER BY %s",
+		RowHashExpression(tbInfo), dbutil.ColumnName(RowHashColumn), dbutil.ColumnName(RowCountColumn), tableName,
+		dbutil.ColumnName(RowHashColumn), dbutil.ColumnName(RowHashColumn))
+	return query, []*model.ColumnInfo{hashColumn}
 }
 
 // ResetColumns removes index from `tableInfo.Indices`, whose columns appear in `columns`.
@@ -696,7 +1042,6 @@ func GetCountAndCRC32Checksum(ctx context.Context, db *sql.DB, schemaName, table
 func ResetColumns(tableInfo *model.TableInfo, columns []string) (*model.TableInfo, bool) {
 	// Although columns is empty, need to initialize indices' offset mapping to column.
 
-	hasTimeStampType := false
 	// Remove all index from `tableInfo.Indices`, whose columns are involved of any column in `columns`.
 	removeColMap := SliceToMap(columns)
 	for i := 0; i < len(tableInfo.Indices); i++ {
@@ -725,7 +1070,6 @@ func ResetColumns(tableInfo *model.TableInfo, columns []string) (*model.TableInf
 	for i, col := range tableInfo.Columns {
 		col.Offset = i
 		colMap[col.Name.O] = i
-		hasTimeStampType = hasTimeStampType || (col.FieldType.Tp == mysql.TypeTimestamp)
 	}
 
 	// Initialize the offset of the column of each index to new `tableInfo.Columns`.
@@ -740,7 +1084,282 @@ func ResetColumns(tableInfo *model.TableInfo, columns []string) (*model.TableInf
 		}
 	}
 
-	return tableInfo, hasTimeStampType
+	return tableInfo, NeedUnifiedTimeZone(tableInfo)
+}
+
+// ProjectColumns returns the columns to be ignored, which are `ignoreColumns` and the columns not in `columns`.
+// The columns of the unique key are always kept to identify the rows. It returns `ignoreColumns` if `columns` is empty.
+func ProjectColumns(tableInfo *model.TableInfo, ignoreColumns []string, columns []string) []string {
+	if len(columns) == 0 {
+		return ignoreColumns
+	}
+	// the column names are case-insensitive
+	keepColMap := make(map[string]struct{}, len(columns))
+	for _, column := range columns {
+		keepColMap[strings.ToLower(column)] = struct{}{}
+	}
+	keys, _ := dbutil.SelectUniqueOrderKey(tableInfo)
+	for _, key := range keys {
+		keepColMap[strings.ToLower(key)] = struct{}{}
+	}
+	ignoreColMap := SliceToMap(ignoreColumns)
+	projected := make([]string, 0, len(tableInfo.Columns))
+	projected = append(projected, ignoreColumns...)
+	for _, col := range tableInfo.Columns {
+		if _, ok := ignoreColMap[col.Name.O]; ok {
+			continue
+		}
+		if _, ok := keepColMap[col.Name.L]; !ok {
+			projected = append(projected, col.Name.O)
+		}
+	}
+	return projected
+}
+
+// ExtraColumns returns the columns of `tableInfo` missing in any of `otherTableInfos`, the column names are case-insensitive.
+func ExtraColumns(tableInfo *model.TableInfo, otherTableInfos []*model.TableInfo) []string {
+	extraColumns := make([]string, 0)
+	for _, col := range tableInfo.Columns {
+		for _, otherTableInfo := range otherTableInfos {
+			if dbutil.FindColumnByName(otherTableInfo.Columns, col.Name.O) == nil {
+				extraColumns = append(extraColumns, col.Name.O)
+				break
+			}
+		}
+	}
+	return extraColumns
+}
+
+// PartitionConditions returns the names of the partitions of the range or hash partitioned table, and the conditions
+// selecting the rows of each partition, which are used in both upstream and downstream, so the upstream table doesn't
+// need the same partitions. The rows whose partition expressions are NULL are in the first partition.
+//  e.g. `a` < 10 OR `a` IS NULL, `a` >= 10 AND `a` < 20, `a` >= 20
+//  e.g. IFNULL(ABS(MOD(`a`, 4)), 0) = 0
+func PartitionConditions(tableInfo *model.TableInfo) ([]string, []string, error) {
+	pi := tableInfo.GetPartitionInfo()
+	if pi == nil {
+		return nil, nil, errors.Errorf("table %s is not partitioned", tableInfo.Name.O)
+	}
+	expr := pi.Expr
+	if len(pi.Columns) > 1 {
+		return nil, nil, errors.Errorf("partitions of multiple columns of table %s are not supported", tableInfo.Name.O)
+	}
+	if len(pi.Columns) == 1 {
+		expr = dbutil.ColumnName(pi.Columns[0].O)
+	}
+
+	names := make([]string, 0, len(pi.Definitions))
+	conditions := make([]string, 0, len(pi.Definitions))
+	for i, def := range pi.Definitions {
+		names = append(names, def.Name.O)
+		switch pi.Type {
+		case model.PartitionTypeRange:
+			kvs := make([]string, 0, 2)
+			if i > 0 {
+				kvs = append(kvs, fmt.Sprintf("%s >= %s", expr, pi.Definitions[i-1].LessThan[0]))
+			}
+			if len(def.LessThan) > 0 && !strings.EqualFold(def.LessThan[0], "MAXVALUE") {
+				kvs = append(kvs, fmt.Sprintf("%s < %s", expr, def.LessThan[0]))
+			}
+			switch {
+			case i == 0 && len(kvs) == 0:
+				conditions = append(conditions, "TRUE")
+			case i == 0:
+				conditions = append(conditions, fmt.Sprintf("%s OR %s IS NULL", kvs[0], expr))
+			default:
+				conditions = append(conditions, strings.Join(kvs, " AND "))
+			}
+		case model.PartitionTypeHash:
+			conditions = append(conditions, fmt.Sprintf("IFNULL(ABS(MOD(%s, %d)), 0) = %d", expr, len(pi.Definitions), i))
+		default:
+			return nil, nil, errors.Errorf("%s partitions of table %s are not supported", pi.Type.String(), tableInfo.Name.O)
+		}
+	}
+	return names, conditions, nil
+}
+
+// RemoveExpressionIndexes removes the expression indexes and their hidden columns from `tableInfo`,
+// because the hidden columns can't be selected and don't exist in the other side.
+// It returns the names of the removed indexes.
+func RemoveExpressionIndexes(tableInfo *model.TableInfo) []string {
+	removed := make([]string, 0)
+	for i := 0; i < len(tableInfo.Indices); i++ {
+		index := tableInfo.Indices[i]
+		for _, col := range index.Columns {
+			if tableInfo.Columns[col.Offset].Hidden {
+				removed = append(removed, index.Name.O)
+				tableInfo.Indices = append(tableInfo.Indices[:i], tableInfo.Indices[i+1:]...)
+				i--
+				break
+			}
+		}
+	}
+	for j := 0; j < len(tableInfo.Columns); j++ {
+		if tableInfo.Columns[j].Hidden {
+			tableInfo.Columns = append(tableInfo.Columns[:j], tableInfo.Columns[j+1:]...)
+			j--
+		}
+	}
+	// the offsets are recalculated in `ResetColumns`
+	return removed
+}
+
+// HasUniqueKey returns true if the table has a primary key or a unique key identifying the rows.
+func HasUniqueKey(tableInfo *model.TableInfo) bool {
+	for _, index := range tableInfo.Indices {
+		if index.Primary || index.Unique {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrefixIndex returns true if some columns of the index are prefix columns, e.g. `KEY(a(10))`.
+func IsPrefixIndex(index *model.IndexInfo) bool {
+	for _, col := range index.Columns {
+		if col.Length != types.UnspecifiedLength {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryTableName returns the derived table of the query, which is selected from like a table.
+//  e.g. (SELECT `a`, COUNT(*) AS `cnt` FROM `schema`.`t` GROUP BY `a`) AS `table`
+func QueryTableName(query, table string) string {
+	return fmt.Sprintf("(%s) AS %s", strings.TrimSuffix(strings.TrimSpace(query), ";"), dbutil.ColumnName(table))
+}
+
+// GetColumnMapQuery returns the query selecting the columns of the table info from the table, the columns renamed
+// in the table are selected with the aliases of the target columns, and the expressions are selected instead of
+// their columns. `columnMap` and `expressions` map the target columns to the renamed columns and the expressions.
+//  e.g. SELECT `uid` AS `user_id`, LOWER(`name`) AS `name` FROM `schema`.`t`
+func GetColumnMapQuery(tableName string, tableInfo *model.TableInfo, columnMap, expressions map[string]string) string {
+	columns := make([]string, 0, len(tableInfo.Columns))
+	for _, col := range tableInfo.Columns {
+		if expression, ok := expressions[col.Name.O]; ok {
+			columns = append(columns, fmt.Sprintf("%s AS %s", expression, dbutil.ColumnName(col.Name.O)))
+			continue
+		}
+		if sourceColumn, ok := columnMap[col.Name.O]; ok {
+			columns = append(columns, fmt.Sprintf("%s AS %s", dbutil.ColumnName(sourceColumn), dbutil.ColumnName(col.Name.O)))
+			continue
+		}
+		columns = append(columns, dbutil.ColumnName(col.Name.O))
+	}
+	return fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), tableName)
+}
+
+// SensitiveColumnExpression returns the expression of the SHA2 hash of the sensitive column,
+// which is selected instead of the column, so the values never leave the databases.
+func SensitiveColumnExpression(column string) string {
+	return fmt.Sprintf("SHA2(%s, 256)", column)
+}
+
+// RenameColumns renames the columns of the table info and its indices to the target columns,
+// `columnMap` maps the target columns to the columns of the table info.
+func RenameColumns(tableInfo *model.TableInfo, columnMap map[string]string) *model.TableInfo {
+	targetColumns := make(map[string]model.CIStr, len(columnMap))
+	for column, sourceColumn := range columnMap {
+		targetColumns[strings.ToLower(sourceColumn)] = model.NewCIStr(column)
+	}
+	for _, col := range tableInfo.Columns {
+		if name, ok := targetColumns[col.Name.L]; ok {
+			col.Name = name
+		}
+	}
+	for _, index := range tableInfo.Indices {
+		for _, col := range index.Columns {
+			if name, ok := targetColumns[col.Name.L]; ok {
+				col.Name = name
+			}
+		}
+	}
+	return tableInfo
+}
+
+// GetQueryRowCount returns the row count of the result set of the query.
+func GetQueryRowCount(ctx context.Context, db *sql.DB, query, table string) (int64, error) {
+	countQuery := fmt.Sprintf("SELECT COUNT(*) AS CNT FROM %s;", QueryTableName(query, table))
+	var count sql.NullInt64
+	err := db.QueryRowContext(ctx, countQuery).Scan(&count)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return count.Int64, nil
+}
+
+// GetQueryTableInfo returns the table information of the result set of the query, so it can be compared like a table.
+// The columns are built from the column types of the result set, and `keyColumns` are used as the primary key.
+func GetQueryTableInfo(ctx context.Context, db *sql.DB, schema, table, query string, keyColumns []string) (*model.TableInfo, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT 0;", QueryTableName(query, table)))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	columnDefs := make([]string, 0, len(columnTypes))
+	for _, columnType := range columnTypes {
+		columnDefs = append(columnDefs, fmt.Sprintf("%s %s", dbutil.ColumnName(columnType.Name()), queryColumnType(columnType)))
+	}
+	createTableSQL := fmt.Sprintf("CREATE TABLE %s (%s)", dbutil.TableName(schema, table), strings.Join(columnDefs, ", "))
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	if err != nil {
+		return nil, errors.Annotatef(err, "build table info for query of %s", dbutil.TableName(schema, table))
+	}
+
+	// the key is added directly, because the string columns can't be the key without the prefix length.
+	keyIndex := &model.IndexInfo{
+		Name:    model.NewCIStr("PRIMARY"),
+		Primary: true,
+		Unique:  true,
+		State:   model.StatePublic,
+	}
+	for _, name := range keyColumns {
+		col := dbutil.FindColumnByName(tableInfo.Columns, name)
+		if col == nil {
+			return nil, errors.NotFoundf("key column %s in the result set of query of %s", name, dbutil.TableName(schema, table))
+		}
+		keyIndex.Columns = append(keyIndex.Columns, &model.IndexColumn{
+			Name:   col.Name,
+			Offset: col.Offset,
+			Length: types.UnspecifiedLength,
+		})
+	}
+	tableInfo.Indices = append(tableInfo.Indices, keyIndex)
+	return tableInfo, nil
+}
+
+// queryColumnType returns the column type in the CREATE TABLE statement for the column of a result set.
+// The lengths of the string columns are unknown, so they are built as TEXT or BLOB.
+func queryColumnType(columnType *sql.ColumnType) string {
+	typeName := columnType.DatabaseTypeName()
+	unsigned := strings.HasPrefix(typeName, "UNSIGNED ")
+	typeName = strings.TrimPrefix(typeName, "UNSIGNED ")
+	switch typeName {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "FLOAT", "DOUBLE", "YEAR", "DATE", "JSON":
+	case "DECIMAL":
+		if precision, scale, ok := columnType.DecimalSize(); ok {
+			typeName = fmt.Sprintf("DECIMAL(%d,%d)", precision, scale)
+		}
+	case "DATETIME", "TIMESTAMP", "TIME":
+		if fsp, _, ok := columnType.DecimalSize(); ok && fsp > 0 {
+			typeName = fmt.Sprintf("%s(%d)", typeName, fsp)
+		}
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		typeName = "LONGBLOB"
+	default:
+		// CHAR, VARCHAR, TEXT, ENUM, SET and the unknown types are compared as strings.
+		typeName = "LONGTEXT"
+	}
+	if unsigned {
+		typeName += " UNSIGNED"
+	}
+	return typeName
 }
 
 // UniqueID returns `schema:table`
@@ -818,11 +1437,17 @@ func GetSQLFileName(index *chunk.ChunkID) string {
 // GetChunkIDFromSQLFileName convert the filename to chunk's `Index`.
 func GetChunkIDFromSQLFileName(fileIDStr string) (int, int, int, int, error) {
 	ids := strings.Split(fileIDStr, ":")
+	if len(ids) != 3 {
+		return 0, 0, 0, 0, errors.Errorf("invalid chunk id %s in sql file name", fileIDStr)
+	}
 	tableIndex, err := strconv.Atoi(ids[0])
 	if err != nil {
 		return 0, 0, 0, 0, errors.Trace(err)
 	}
 	bucketIndex := strings.Split(ids[1], "-")
+	if len(bucketIndex) != 2 {
+		return 0, 0, 0, 0, errors.Errorf("invalid bucket index %s in sql file name", ids[1])
+	}
 	bucketIndexLeft, err := strconv.Atoi(bucketIndex[0])
 	if err != nil {
 		return 0, 0, 0, 0, errors.Trace(err)
@@ -837,3 +1462,33 @@ func GetChunkIDFromSQLFileName(fileIDStr string) (int, int, int, int, error) {
 	}
 	return tableIndex, bucketIndexLeft, bucketIndexRight, chunkIndex, nil
 }
+
+// GetFixSQLFileName returns the name of the fix-SQL file for the chunk of the table.
+// e.g. `schema:table:1:2-3:4.sql`.
+// The schema and table names are escaped so that they never contain ':' or '/'.
+func GetFixSQLFileName(schema, table string, index *chunk.ChunkID) string {
+	return fmt.Sprintf("%s:%s:%s.sql", url.QueryEscape(schema), url.QueryEscape(table), GetSQLFileName(index))
+}
+
+// GetChunkIDFromFixSQLFileName parses the chunk's `Index` from the name of a fix-SQL file.
+// The chunk id is always the last three fields of the name, so files generated
+// before the schema and table names were escaped can be parsed as well.
+func GetChunkIDFromFixSQLFileName(name string) (*chunk.ChunkID, error) {
+	if !strings.HasSuffix(name, ".sql") {
+		return nil, errors.Errorf("%s is not a sql file", name)
+	}
+	fields := strings.Split(strings.TrimSuffix(name, ".sql"), ":")
+	if len(fields) < 5 {
+		return nil, errors.Errorf("invalid fix sql file name %s", name)
+	}
+	tableIndex, bucketIndexLeft, bucketIndexRight, chunkIndex, err := GetChunkIDFromSQLFileName(strings.Join(fields[len(fields)-3:], ":"))
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid fix sql file name %s", name)
+	}
+	return &chunk.ChunkID{
+		TableIndex:       tableIndex,
+		BucketIndexLeft:  bucketIndexLeft,
+		BucketIndexRight: bucketIndexRight,
+		ChunkIndex:       chunkIndex,
+	}, nil
+}
@@ -17,15 +17,26 @@ import (
 	"context"
 	"database/sql/driver"
 	"fmt"
+	"net"
+	"os"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
 	"github.com/pingcap/tidb-tools/sync_diff_inspector/chunk"
+	"github.com/pingcap/tidb-tools/sync_diff_inspector/config"
 	"github.com/pingcap/tidb/parser"
 	"github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/pingcap/tidb/parser/types"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 type tableCaseType struct {
@@ -58,6 +69,56 @@ func TestWorkerPool(t *testing.T) {
 	pool.WaitFinished()
 }
 
+func TestWorkerPoolResize(t *testing.T) {
+	pool := NewWorkerPool(1, "test")
+	blockCh := make(chan struct{})
+	pool.Apply(func() {
+		<-blockCh
+	})
+	require.Equal(t, pool.BusyWorkers(), uint(1))
+	require.False(t, pool.HasWorker())
+
+	// wait for an idle worker
+	appliedCh := make(chan struct{})
+	go func() {
+		pool.Apply(func() {
+			<-blockCh
+		})
+		close(appliedCh)
+	}()
+	require.Eventually(t, func() bool { return pool.QueueLen() == 1 }, time.Second, 10*time.Millisecond)
+
+	// grow
+	pool.Resize(2)
+	<-appliedCh
+	require.Equal(t, pool.QueueLen(), uint(0))
+	require.Equal(t, pool.BusyWorkers(), uint(2))
+	require.Equal(t, pool.Limit(), uint(2))
+
+	// shrink, the busy workers are retired after their tasks are done.
+	pool.Resize(1)
+	require.False(t, pool.HasWorker())
+	close(blockCh)
+	pool.WaitFinished()
+	require.Equal(t, pool.BusyWorkers(), uint(0))
+	require.True(t, pool.HasWorker())
+	require.Equal(t, len(pool.workers), 1)
+
+	// the ID of a busy worker is not reused after shrinking and growing.
+	pool = NewWorkerPool(2, "test")
+	blockCh = make(chan struct{})
+	pool.Apply(func() {
+		<-blockCh
+	})
+	pool.Resize(1)
+	require.False(t, pool.HasWorker())
+	pool.Resize(2)
+	require.Equal(t, len(pool.workers), 1)
+	require.Equal(t, pool.workers[0].ID, uint64(3))
+	close(blockCh)
+	pool.WaitFinished()
+}
+
 func TestStringsToInterface(t *testing.T) {
 	res := []interface{}{"1", "2", "3"}
 	require.Equal(t, res[0], "1")
@@ -83,7 +144,7 @@ func TestBasicTableUtilOperation(t *testing.T) {
 	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
 	require.NoError(t, err)
 
-	query, orderKeyCols := GetTableRowsQueryFormat("test", "test", tableInfo, "123")
+	query, orderKeyCols := GetTableRowsQueryFormat("test", "test", tableInfo, "123", nil)
 	require.Equal(t, query, "SELECT /*!40001 SQL_NO_CACHE */ `a`, `b`, `c`, `d` FROM `test`.`test` WHERE %s ORDER BY `a`,`b` COLLATE \"123\"")
 	expectName := []string{"a", "b"}
 	for i, col := range orderKeyCols {
@@ -147,67 +208,77 @@ func TestBasicTableUtilOperation(t *testing.T) {
 			"╍╍╍╍╍╍╍╍╍╍╍╍╍╍╍╋╍╍╍╍╍╋╍╍╍╍╍╍╍\n"+
 			"*/\n"+
 			"REPLACE INTO `schema`.`test`(`a`,`b`,`c`,`d`) VALUES (1,'a',1.22,'sdf');")
+	require.Equal(t, GenerateUpdateDMLWithAnnotation(data1, data2, tableInfo, "schema"),
+		"/*\n"+
+			"  DIFF COLUMNS ╏ `B` ╏ `C`   \n"+
+			"╍╍╍╍╍╍╍╍╍╍╍╍╍╍╍╋╍╍╍╍╍╋╍╍╍╍╍╍╍\n"+
+			"  source data  ╏ 'a' ╏ 1.22  \n"+
+			"╍╍╍╍╍╍╍╍╍╍╍╍╍╍╍╋╍╍╍╍╍╋╍╍╍╍╍╍╍\n"+
+			"  target data  ╏ 'b' ╏ 2.22  \n"+
+			"╍╍╍╍╍╍╍╍╍╍╍╍╍╍╍╋╍╍╍╍╍╋╍╍╍╍╍╍╍\n"+
+			"*/\n"+
+			"UPDATE `schema`.`test` SET `b` = 'a', `c` = 1.22 WHERE `a` = 1 AND `b` = 'b' AND `c` = 2.22 AND `d` = 'sdf' LIMIT 1;")
 	require.Equal(t, GenerateDeleteDML(data1, tableInfo, "schema"), "DELETE FROM `schema`.`test` WHERE `a` = 1 AND `b` = 'a' AND `c` = 1.22 AND `d` = 'sdf' LIMIT 1;")
 
 	// same
-	equal, cmp, err := CompareData(data1, data1, orderKeyCols, columns)
+	equal, cmp, err := CompareData(data1, data1, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(0))
 	require.True(t, equal)
 
 	// orderkey same but other column different
-	equal, cmp, err = CompareData(data1, data3, orderKeyCols, columns)
+	equal, cmp, err = CompareData(data1, data3, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(-1))
 	require.False(t, equal)
 
-	equal, cmp, err = CompareData(data3, data1, orderKeyCols, columns)
+	equal, cmp, err = CompareData(data3, data1, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(1))
 	require.False(t, equal)
 
 	// orderKey different
-	equal, cmp, err = CompareData(data1, data2, orderKeyCols, columns)
+	equal, cmp, err = CompareData(data1, data2, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(-1))
 	require.False(t, equal)
 
-	equal, cmp, err = CompareData(data2, data1, orderKeyCols, columns)
+	equal, cmp, err = CompareData(data2, data1, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(1))
 	require.False(t, equal)
 
-	equal, cmp, err = CompareData(data4, data1, orderKeyCols, columns)
+	equal, cmp, err = CompareData(data4, data1, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(0))
 	require.False(t, equal)
 
-	equal, cmp, err = CompareData(data1, data4, orderKeyCols, columns)
+	equal, cmp, err = CompareData(data1, data4, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(0))
 	require.False(t, equal)
 
-	equal, cmp, err = CompareData(data5, data4, orderKeyCols, columns)
+	equal, cmp, err = CompareData(data5, data4, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(1))
 	require.False(t, equal)
 
-	equal, cmp, err = CompareData(data4, data5, orderKeyCols, columns)
+	equal, cmp, err = CompareData(data4, data5, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(-1))
 	require.False(t, equal)
 
-	equal, cmp, err = CompareData(data4, data6, orderKeyCols, columns)
+	equal, cmp, err = CompareData(data4, data6, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(1))
 	require.False(t, equal)
 
-	equal, cmp, err = CompareData(data6, data4, orderKeyCols, columns)
+	equal, cmp, err = CompareData(data6, data4, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(-1))
 	require.False(t, equal)
 
-	equal, cmp, err = CompareData(data6, data7, orderKeyCols, columns)
+	equal, cmp, err = CompareData(data6, data7, orderKeyCols, columns, nil)
 	require.NoError(t, err)
 	require.Equal(t, cmp, int32(0))
 	require.True(t, equal)
@@ -229,7 +300,87 @@ func TestBasicTableUtilOperation(t *testing.T) {
 	require.Equal(t, tableInfo.Indices[0].Columns[1].Offset, 1)
 }
 
-func TestGetCountAndCRC32Checksum(t *testing.T) {
+func TestTolerance(t *testing.T) {
+	createTableSQL := "create table `test`.`test`(`a` int, `b` double, `c` decimal(10,3), `d` varchar(10), primary key(`a`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	columns := tableInfo.Columns
+	orderKeyCols := columns[:1]
+	row := func(b, c string) map[string]*dbutil.ColumnData {
+		return map[string]*dbutil.ColumnData{
+			"a": {Data: []byte("1")},
+			"b": {Data: []byte(b)},
+			"c": {Data: []byte(c)},
+			"d": {Data: []byte("x")},
+		}
+	}
+
+	require.Nil(t, NewTolerance(0, nil, false))
+	tolerance := NewTolerance(0.01, map[string]float64{"C": 0.005}, false)
+	require.Equal(t, "FLOAT/DOUBLE values differing by 0.01 are equal, the values of c by 0.005", tolerance.String())
+	epsilon, ok := tolerance.Of(columns[1])
+	require.True(t, ok)
+	require.Equal(t, 0.01, epsilon)
+	epsilon, ok = tolerance.Of(columns[2])
+	require.True(t, ok)
+	require.Equal(t, 0.005, epsilon)
+	_, ok = tolerance.Of(columns[3])
+	require.False(t, ok)
+	epsilon, ok = (*Tolerance)(nil).Of(columns[1])
+	require.True(t, ok)
+	require.Equal(t, config.DefaultFloatTolerance, epsilon)
+
+	// the default tolerance only applies to the FLOAT/DOUBLE columns.
+	equal, _, err := CompareData(row("1.0000001", "1.000"), row("1.0000002", "1.000"), orderKeyCols, columns, nil)
+	require.NoError(t, err)
+	require.True(t, equal)
+	equal, _, err = CompareData(row("1.001", "1.000"), row("1.002", "1.000"), orderKeyCols, columns, nil)
+	require.NoError(t, err)
+	require.False(t, equal)
+	equal, _, err = CompareData(row("1.000", "1.001"), row("1.000", "1.002"), orderKeyCols, columns, nil)
+	require.NoError(t, err)
+	require.False(t, equal)
+
+	equal, _, err = CompareData(row("1.001", "1.001"), row("1.002", "1.002"), orderKeyCols, columns, tolerance)
+	require.NoError(t, err)
+	require.True(t, equal)
+	equal, cmp, err := CompareData(row("1.001", "1.001"), row("1.002", "1.010"), orderKeyCols, columns, tolerance)
+	require.NoError(t, err)
+	require.False(t, equal)
+	require.Equal(t, int32(0), cmp)
+}
+
+func TestSemanticJSON(t *testing.T) {
+	createTableSQL := "create table `test`.`test`(`a` int, `j` json, primary key(`a`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	columns := tableInfo.Columns
+	row := func(j string) map[string]*dbutil.ColumnData {
+		return map[string]*dbutil.ColumnData{
+			"a": {Data: []byte("1")},
+			"j": {Data: []byte(j), IsNull: j == ""},
+		}
+	}
+
+	tolerance := NewTolerance(0, nil, true)
+	require.NotNil(t, tolerance)
+	require.Equal(t, "FLOAT/DOUBLE values differing by 1e-06 are equal, the JSON values are compared semantically", tolerance.String())
+
+	equal, _, err := CompareData(row(`{"a": 1, "b": [1, 2]}`), row(`{"b":[1,2],"a":1}`), columns[:1], columns, nil)
+	require.NoError(t, err)
+	require.False(t, equal)
+	equal, _, err = CompareData(row(`{"a": 1, "b": [1, 2]}`), row(`{"b":[1,2],"a":1}`), columns[:1], columns, tolerance)
+	require.NoError(t, err)
+	require.True(t, equal)
+	equal, _, err = CompareData(row(`{"a": 1, "b": [1, 2]}`), row(`{"a": 1, "b": [2, 1]}`), columns[:1], columns, tolerance)
+	require.NoError(t, err)
+	require.False(t, equal)
+	equal, _, err = CompareData(row(`{"a": 1}`), row(""), columns[:1], columns, tolerance)
+	require.NoError(t, err)
+	require.False(t, equal)
+}
+
+func TestGetCountAndChecksum(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 
@@ -243,10 +394,60 @@ func TestGetCountAndCRC32Checksum(t *testing.T) {
 
 	mock.ExpectQuery("SELECT COUNT.*FROM `test_schema`\\.`test_table` WHERE \\[23 45\\].*").WithArgs("123", "234").WillReturnRows(sqlmock.NewRows([]string{"CNT", "CHECKSUM"}).AddRow(123, 456))
 
-	count, checksum, err := GetCountAndCRC32Checksum(ctx, conn, "test_schema", "test_table", tableInfo, "[23 45]", []interface{}{"123", "234"})
+	count, checksum, err := GetCountAndChecksum(ctx, conn, "test_schema", "test_table", tableInfo, config.ChecksumCRC32, "[23 45]", []interface{}{"123", "234"})
 	require.NoError(t, err)
 	require.Equal(t, count, int64(123))
 	require.Equal(t, checksum, int64(456))
+
+	query := CountAndChecksumQuery("`test`.`t`", &model.TableInfo{Columns: []*model.ColumnInfo{{Name: model.NewCIStr("a")}}}, config.ChecksumCRC32, "(`a` > ?)")
+	require.Equal(t, "SELECT COUNT(*) as CNT, BIT_XOR(CAST(CRC32(CONCAT_WS(',', `a`, CONCAT(ISNULL(`a`))))AS UNSIGNED)) as CHECKSUM FROM `test`.`t` WHERE (`a` > ?);", query)
+	query = CountAndChecksumQuery("`test`.`t`", &model.TableInfo{Columns: []*model.ColumnInfo{{Name: model.NewCIStr("a")}}}, config.ChecksumSHA1, "(`a` > ?)")
+	require.Equal(t, "SELECT COUNT(*) as CNT, BIT_XOR(CAST(CONV(LEFT(SHA1(CONCAT_WS(',', `a`, CONCAT(ISNULL(`a`)))), 15), 16, 10) AS UNSIGNED)) as CHECKSUM FROM `test`.`t` WHERE (`a` > ?);", query)
+	query = CountAndChecksumQuery("`test`.`t`", &model.TableInfo{Columns: []*model.ColumnInfo{{Name: model.NewCIStr("a")}}}, config.ChecksumNone, "(`a` > ?)")
+	require.Equal(t, "SELECT COUNT(*) as CNT, 0 as CHECKSUM FROM `test`.`t` WHERE (`a` > ?);", query)
+}
+
+func TestQueryCheck(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	query := "SELECT a, COUNT(*) AS cnt, SUM(b) AS total FROM test.t GROUP BY a;"
+	require.Equal(t, "(SELECT a, COUNT(*) AS cnt, SUM(b) AS total FROM test.t GROUP BY a) AS `stats`", QueryTableName(query, "stats"))
+
+	columns := mock.NewRowsWithColumnDefinition(
+		sqlmock.NewColumn("a").OfType("VARCHAR", ""),
+		sqlmock.NewColumn("cnt").OfType("BIGINT", int64(0)),
+		sqlmock.NewColumn("total").OfType("DECIMAL", "").WithPrecisionAndScale(32, 2),
+	)
+	mock.ExpectQuery("SELECT \\* FROM \\(SELECT a, COUNT.*GROUP BY a\\) AS `stats` LIMIT 0").WillReturnRows(columns)
+	tableInfo, err := GetQueryTableInfo(ctx, conn, "test", "stats", query, []string{"a"})
+	require.NoError(t, err)
+	require.Len(t, tableInfo.Columns, 3)
+	require.Equal(t, mysql.TypeLongBlob, tableInfo.Columns[0].Tp)
+	require.Equal(t, mysql.TypeLonglong, tableInfo.Columns[1].Tp)
+	require.Equal(t, mysql.TypeNewDecimal, tableInfo.Columns[2].Tp)
+	require.Equal(t, 2, tableInfo.Columns[2].Decimal)
+	require.Len(t, tableInfo.Indices, 1)
+	require.True(t, tableInfo.Indices[0].Primary)
+	require.Equal(t, "a", tableInfo.Indices[0].Columns[0].Name.O)
+
+	rowsQuery, orderKeyCols := GetQueryRowsQueryFormat(query, "stats", tableInfo, "", nil)
+	require.Equal(t, "SELECT /*!40001 SQL_NO_CACHE */ `a`, `cnt`, `total` FROM (SELECT a, COUNT(*) AS cnt, SUM(b) AS total FROM test.t GROUP BY a) AS `stats` WHERE %s ORDER BY `a`", rowsQuery)
+	require.Equal(t, "a", orderKeyCols[0].Name.O)
+
+	mock.ExpectQuery("SELECT COUNT.*FROM \\(SELECT a, COUNT.*GROUP BY a\\) AS `stats` WHERE \\[23 45\\].*").WithArgs("123").WillReturnRows(sqlmock.NewRows([]string{"CNT", "CHECKSUM"}).AddRow(123, 456))
+	count, checksum, err := GetQueryCountAndChecksum(ctx, conn, query, "stats", tableInfo, config.ChecksumCRC32, "[23 45]", []interface{}{"123"})
+	require.NoError(t, err)
+	require.Equal(t, int64(123), count)
+	require.Equal(t, int64(456), checksum)
+
+	mock.ExpectQuery("SELECT \\* FROM \\(SELECT a, COUNT.*GROUP BY a\\) AS `stats` LIMIT 0").WillReturnRows(mock.NewRowsWithColumnDefinition(sqlmock.NewColumn("a").OfType("VARCHAR", "")))
+	_, err = GetQueryTableInfo(ctx, conn, "test", "stats", query, []string{"b"})
+	require.Contains(t, err.Error(), "key column b in the result set of query of `test`.`stats` not found")
 }
 
 func TestGetApproximateMid(t *testing.T) {
@@ -270,6 +471,29 @@ func TestGetApproximateMid(t *testing.T) {
 	require.Equal(t, data["b"], "10")
 }
 
+func TestGetApproximateSplitPoints(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	createTableSQL := "create table `test`.`test`(`a` int, `b` varchar(10), primary key(`a`, `b`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT `a`, `b` FROM `test`\\.`test_utils` WHERE 2222.* LIMIT 1 OFFSET 10$").WithArgs("aaaa").WillReturnRows(sqlmock.NewRows([]string{"a", "b"}).AddRow("5", "10"))
+	mock.ExpectQuery("SELECT `a`, `b` FROM `test`\\.`test_utils` WHERE 2222.* LIMIT 1 OFFSET 20$").WithArgs("aaaa").WillReturnRows(sqlmock.NewRows([]string{"a", "b"}).AddRow("5", "10"))
+	mock.ExpectQuery("SELECT `a`, `b` FROM `test`\\.`test_utils` WHERE 2222.* LIMIT 1 OFFSET 30$").WithArgs("aaaa").WillReturnRows(sqlmock.NewRows([]string{"a", "b"}).AddRow("8", "20"))
+
+	points, err := GetApproximateSplitPointsBySize(ctx, conn, "test", "test_utils", tableInfo.Columns, "2222", []interface{}{"aaaa"}, 40, 4)
+	require.NoError(t, err)
+	// the duplicate point is removed
+	require.Equal(t, []map[string]string{{"a": "5", "b": "10"}, {"a": "8", "b": "20"}}, points)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGenerateSQLs(t *testing.T) {
 	createTableSQL := "CREATE TABLE `diff_test`.`atest` (`id` int(24), `name` varchar(24), `birthday` datetime, `update_time` time, `money` decimal(20,2), `id_gen` int(11) GENERATED ALWAYS AS ((`id` + 1)) VIRTUAL, primary key(`id`, `name`))"
 	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
@@ -317,6 +541,37 @@ func TestGenerateSQLs(t *testing.T) {
 	deleteSQL = GenerateDeleteDML(rowsData, tableInfo, "diff_test")
 	require.Equal(t, replaceSQL, "REPLACE INTO `diff_test`.`atest`(`id`,`name`,`birthday`,`update_time`,`money`) VALUES (NULL,'a\\'a','2018-01-01 00:00:00','10:10:10',11.1111);")
 	require.Equal(t, deleteSQL, "DELETE FROM `diff_test`.`atest` WHERE `id` is NULL AND `name` = 'a\\'a' AND `birthday` = '2018-01-01 00:00:00' AND `update_time` = '10:10:10' AND `money` = 11.1111 LIMIT 1;")
+
+	// test the range delete
+	deleteSQL = GenerateRangeDeleteDML("diff_test", "atest", "((`id` > ?) AND (`id` <= ?)) AND (`name` != ?)", []interface{}{"1", "100", "a'a"})
+	require.Equal(t, deleteSQL, "DELETE FROM `diff_test`.`atest` WHERE ((`id` > '1') AND (`id` <= '100')) AND (`name` != 'a\\'a');")
+}
+
+func TestSensitiveColumnsSQL(t *testing.T) {
+	createTableSQL := "CREATE TABLE `diff_test`.`stest` (`id` int, `ssn` varchar(24), `name` varchar(24), primary key(`id`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	SetSensitiveColumns("diff_test", "stest", []string{"SSN"})
+	defer SetSensitiveColumns("diff_test", "stest", nil)
+	require.True(t, IsSensitiveColumn("diff_test", "stest", "ssn"))
+	require.False(t, IsSensitiveColumn("diff_test", "stest", "name"))
+
+	hash := "8d969eef6ecad3c29a3a629280e686cf0c3f5d5a86aff3ca12020c923adc6c92"
+	source := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1")},
+		"ssn":  {Data: []byte(hash)},
+		"name": {Data: []byte("xxx")},
+	}
+	target := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1")},
+		"ssn":  {Data: []byte("a665a45920422f9d417e4867efdc4fb8a04a1f3fff1fa07e998e86f7f7a27ae3")},
+		"name": {Data: []byte("xxx")},
+	}
+	require.Equal(t, "REPLACE INTO `diff_test`.`stest`(`id`,`ssn`,`name`) VALUES (1,'******','xxx');", GenerateReplaceDML(source, tableInfo, "diff_test"))
+	require.Equal(t, "DELETE FROM `diff_test`.`stest` WHERE `id` = 1 AND SHA2(`ssn`, 256) = '"+hash+"' AND `name` = 'xxx' LIMIT 1;", GenerateDeleteDML(source, tableInfo, "diff_test"))
+	updateSQL := GenerateUpdateDMLWithAnnotation(source, target, tableInfo, "diff_test")
+	require.NotContains(t, updateSQL, hash)
+	require.Contains(t, updateSQL, "SET `ssn` = '******' WHERE `id` = 1 AND SHA2(`ssn`, 256) = 'a665a45920422f9d417e4867efdc4fb8a04a1f3fff1fa07e998e86f7f7a27ae3'")
 }
 
 func TestResetColumns(t *testing.T) {
@@ -344,6 +599,114 @@ func TestResetColumns(t *testing.T) {
 	require.Equal(t, len(tbInfo.Indices), 1)
 }
 
+func TestProjectColumns(t *testing.T) {
+	createTableSQL := "CREATE TABLE `test`.`atest` (`id` int, `a` int, `b` varchar(20), `c` int, `d` int, primary key(`id`), key idx(`c`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"d"}, ProjectColumns(tableInfo, []string{"d"}, nil))
+	ignoreColumns := ProjectColumns(tableInfo, []string{"d"}, []string{"A", "b"})
+	require.Equal(t, []string{"d", "c"}, ignoreColumns)
+
+	tableInfo, _ = ResetColumns(tableInfo, ignoreColumns)
+	require.Len(t, tableInfo.Columns, 3)
+	require.Equal(t, "id", tableInfo.Columns[0].Name.O)
+	require.Equal(t, "a", tableInfo.Columns[1].Name.O)
+	require.Equal(t, "b", tableInfo.Columns[2].Name.O)
+	// the primary key is kept, and the index of the ignored column is removed
+	require.Len(t, tableInfo.Indices, 1)
+	require.True(t, tableInfo.Indices[0].Primary)
+}
+
+func TestColumnMap(t *testing.T) {
+	columnMap := map[string]string{"user_id": "uid"}
+	targetTableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`user_id` int, `name` varchar(20), primary key(`user_id`))", parser.New())
+	require.NoError(t, err)
+	require.Equal(t, "SELECT `uid` AS `user_id`, `name` FROM `test`.`atest`", GetColumnMapQuery(dbutil.TableName("test", "atest"), targetTableInfo, columnMap, nil))
+	expressions := map[string]string{"name": "LOWER(`name`)"}
+	require.Equal(t, "SELECT `user_id`, LOWER(`name`) AS `name` FROM `test`.`atest`", GetColumnMapQuery(dbutil.TableName("test", "atest"), targetTableInfo, nil, expressions))
+	require.Equal(t, "SELECT `uid` AS `user_id`, LOWER(`name`) AS `name` FROM `test`.`atest`", GetColumnMapQuery(dbutil.TableName("test", "atest"), targetTableInfo, columnMap, expressions))
+
+	sourceTableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`UID` int, `name` varchar(20), primary key(`UID`))", parser.New())
+	require.NoError(t, err)
+	sourceTableInfo = RenameColumns(sourceTableInfo, columnMap)
+	require.Equal(t, "user_id", sourceTableInfo.Columns[0].Name.O)
+	require.Equal(t, "name", sourceTableInfo.Columns[1].Name.O)
+	require.Equal(t, "user_id", sourceTableInfo.Indices[0].Columns[0].Name.O)
+}
+
+func TestExtraColumns(t *testing.T) {
+	upstreamTableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(20), `age` int, primary key(`id`))", parser.New())
+	require.NoError(t, err)
+	downstreamTableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`ID` int, `name` varchar(20), `deleted` tinyint, `updated_by` varchar(20), primary key(`ID`))", parser.New())
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"deleted", "updated_by"}, ExtraColumns(downstreamTableInfo, []*model.TableInfo{upstreamTableInfo}))
+	require.Equal(t, []string{"age"}, ExtraColumns(upstreamTableInfo, []*model.TableInfo{downstreamTableInfo}))
+	require.Empty(t, ExtraColumns(upstreamTableInfo, []*model.TableInfo{upstreamTableInfo}))
+}
+
+func TestRowHashes(t *testing.T) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`a` int, `b` varchar(20), key idx(`a`))", parser.New())
+	require.NoError(t, err)
+	require.False(t, HasUniqueKey(tableInfo))
+
+	query, orderKeyCols := GetRowHashesQueryFormat("`test`.`atest`", tableInfo)
+	require.Equal(t, "SELECT /*!40001 SQL_NO_CACHE */ MD5(CONCAT_WS(',', `a`, `b`, CONCAT(ISNULL(`a`), ISNULL(`b`)))) AS `_row_hash`, "+
+		"COUNT(*) AS `_row_count` FROM `test`.`atest` WHERE %s GROUP BY `_row_hash` ORDER BY `_row_hash`", query)
+	require.Len(t, orderKeyCols, 1)
+	require.Equal(t, RowHashColumn, orderKeyCols[0].Name.O)
+	require.True(t, NeedQuotes(orderKeyCols[0].FieldType.Tp))
+
+	tableInfo, err = dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`a` int, `b` varchar(20), unique key uk(`b`))", parser.New())
+	require.NoError(t, err)
+	require.True(t, HasUniqueKey(tableInfo))
+	tableInfo, err = dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`a` int primary key, `b` varchar(20))", parser.New())
+	require.NoError(t, err)
+	require.True(t, HasUniqueKey(tableInfo))
+}
+
+func TestPartitionConditions(t *testing.T) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`a` int, `b` varchar(20)) "+
+		"PARTITION BY RANGE (`a`) (PARTITION p0 VALUES LESS THAN (10), PARTITION p1 VALUES LESS THAN (20), PARTITION p2 VALUES LESS THAN MAXVALUE)", parser.New())
+	require.NoError(t, err)
+	names, conditions, err := PartitionConditions(tableInfo)
+	require.NoError(t, err)
+	require.Equal(t, []string{"p0", "p1", "p2"}, names)
+	require.Equal(t, []string{"`a` < 10 OR `a` IS NULL", "`a` >= 10 AND `a` < 20", "`a` >= 20"}, conditions)
+
+	tableInfo, err = dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`a` int, `b` varchar(20)) PARTITION BY HASH (`a`) PARTITIONS 2", parser.New())
+	require.NoError(t, err)
+	names, conditions, err = PartitionConditions(tableInfo)
+	require.NoError(t, err)
+	require.Equal(t, []string{"p0", "p1"}, names)
+	require.Equal(t, []string{"IFNULL(ABS(MOD(`a`, 2)), 0) = 0", "IFNULL(ABS(MOD(`a`, 2)), 0) = 1"}, conditions)
+
+	tableInfo, err = dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`a` int, `b` varchar(20))", parser.New())
+	require.NoError(t, err)
+	_, _, err = PartitionConditions(tableInfo)
+	require.Error(t, err)
+}
+
+func TestRemoveExpressionIndexes(t *testing.T) {
+	createTableSQL := "CREATE TABLE `test`.`atest` (`a` int, `b` varchar(20), `c` int, unique key uk(`b`(4)), key idx(`c`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	// mock an expression index, whose column is a hidden virtual column
+	hiddenCol := &model.ColumnInfo{Name: model.NewCIStr("_V$_expr_idx_0"), Offset: len(tableInfo.Columns), Hidden: true}
+	tableInfo.Columns = append(tableInfo.Columns, hiddenCol)
+	tableInfo.Indices = append(tableInfo.Indices, &model.IndexInfo{
+		Name:    model.NewCIStr("expr_idx"),
+		Columns: []*model.IndexColumn{{Name: hiddenCol.Name, Offset: hiddenCol.Offset, Length: types.UnspecifiedLength}},
+	})
+
+	require.Equal(t, []string{"expr_idx"}, RemoveExpressionIndexes(tableInfo))
+	require.Len(t, tableInfo.Columns, 3)
+	require.Len(t, tableInfo.Indices, 2)
+	require.True(t, IsPrefixIndex(tableInfo.Indices[0]))
+	require.False(t, IsPrefixIndex(tableInfo.Indices[1]))
+}
+
 func TestGetTableSize(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -365,6 +728,46 @@ func TestGetTableSize(t *testing.T) {
 	require.Equal(t, size, int64(8000))
 }
 
+func TestGetCharsetByCollation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+	mock.ExpectQuery("COLLATIONS").WithArgs("utf8mb4_bin").WillReturnRows(sqlmock.NewRows([]string{"CHARACTER_SET_NAME"}).AddRow("utf8mb4"))
+	charset, err := GetCharsetByCollation(ctx, conn, "utf8mb4_bin")
+	require.NoError(t, err)
+	require.Equal(t, "utf8mb4", charset)
+
+	mock.ExpectQuery("COLLATIONS").WithArgs("no_exist").WillReturnRows(sqlmock.NewRows([]string{"CHARACTER_SET_NAME"}))
+	charset, err = GetCharsetByCollation(ctx, conn, "no_exist")
+	require.NoError(t, err)
+	require.Equal(t, "", charset)
+}
+
+func TestCheckSnapshotNotGCed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	safePointTime, err := time.Parse(gcSafePointTimeFormat, "20211025-10:00:00 +0000")
+	require.NoError(t, err)
+	safePoint := uint64(safePointTime.UnixNano()/int64(time.Millisecond)) << 18
+
+	mock.ExpectQuery("tikv_gc_safe_point").WillReturnRows(sqlmock.NewRows([]string{"VARIABLE_VALUE"}).AddRow("20211025-10:00:00.123 +0000"))
+	require.NoError(t, CheckSnapshotNotGCed(ctx, conn, fmt.Sprintf("%d", safePoint+(1<<18)*1000)))
+
+	mock.ExpectQuery("tikv_gc_safe_point").WillReturnRows(sqlmock.NewRows([]string{"VARIABLE_VALUE"}).AddRow("20211025-10:00:00 +0000"))
+	err = CheckSnapshotNotGCed(ctx, conn, fmt.Sprintf("%d", safePoint-1))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), fmt.Sprintf("the earliest usable snapshot is %d (2021-10-25 10:00:00 UTC)", safePoint))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetBetterIndex(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -485,6 +888,31 @@ func TestGetChunkIDFromSQLFileName(t *testing.T) {
 	require.Equal(t, chunkIndex, 14)
 }
 
+func TestFixSQLFileName(t *testing.T) {
+	index := &chunk.ChunkID{
+		TableIndex:       1,
+		BucketIndexLeft:  2,
+		BucketIndexRight: 3,
+		ChunkIndex:       4,
+		ChunkCnt:         10,
+	}
+	name := GetFixSQLFileName("a:b", "c/d", index)
+	require.Equal(t, name, "a%3Ab:c%2Fd:1:2-3:4.sql")
+	id, err := GetChunkIDFromFixSQLFileName(name)
+	require.NoError(t, err)
+	require.Equal(t, id.Compare(index), 0)
+
+	// file generated before the names are escaped
+	id, err = GetChunkIDFromFixSQLFileName("a:b:c:1:2-3:4.sql")
+	require.NoError(t, err)
+	require.Equal(t, id.Compare(index), 0)
+
+	_, err = GetChunkIDFromFixSQLFileName("patch.sql")
+	require.Error(t, err)
+	_, err = GetChunkIDFromFixSQLFileName("a:b:1:2:4.sql")
+	require.Error(t, err)
+}
+
 func TestCompareStruct(t *testing.T) {
 	createTableSQL := "create table `test`.`test`(`a` int, `b` varchar(10), `c` float, `d` datetime, primary key(`a`, `b`), index(`c`))"
 	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
@@ -569,3 +997,320 @@ func TestCompareStruct(t *testing.T) {
 	require.Equal(t, tableInfo.Indices[0].Name.O, "c")
 
 }
+
+func TestTimeWindowRange(t *testing.T) {
+	since := time.Date(2016, 10, 8, 16, 45, 26, 0, time.UTC)
+	require.Equal(t, "(a > 1) AND (`created_at` >= FROM_UNIXTIME(1475945126))", TimeWindowRange("a > 1", "created_at", since))
+
+	// the bound is the same instant whatever the time zone of sync-diff or the session is,
+	// the server converts it to the session time zone.
+	east8, err := ParseTimeZone("+08:00")
+	require.NoError(t, err)
+	require.Equal(t, TimeWindowRange("a > 1", "created_at", since), TimeWindowRange("a > 1", "created_at", since.In(east8)))
+}
+
+func TestTimeZone(t *testing.T) {
+	loc, err := ParseTimeZone(UnifiedTimeZone)
+	require.NoError(t, err)
+	_, offset := time.Now().In(loc).Zone()
+	require.Equal(t, offset, 0)
+	unified := loc
+
+	loc, err = ParseTimeZone("-3:30")
+	require.NoError(t, err)
+	_, offset = time.Now().In(loc).Zone()
+	require.Equal(t, offset, -(3*3600 + 30*60))
+
+	_, err = ParseTimeZone("+a:b")
+	require.Error(t, err)
+
+	east8, err := ParseTimeZone("+08:00")
+	require.NoError(t, err)
+	value, err := ConvertTimeZone("2021-01-01 07:00:00", east8, time.UTC)
+	require.NoError(t, err)
+	require.Equal(t, value, "2020-12-31 23:00:00")
+	// the fractional digits are kept
+	value, err = ConvertTimeZone("2021-01-01 07:00:00.100000", east8, time.UTC)
+	require.NoError(t, err)
+	require.Equal(t, value, "2020-12-31 23:00:00.100000")
+
+	loc, err = ParseTimeZone("+8:00")
+	require.NoError(t, err)
+	require.True(t, SameLocation(loc, east8))
+	require.False(t, SameLocation(loc, time.UTC))
+
+	tz := &TimeZoneInfo{Session: "SYSTEM", System: "UTC"}
+	loc, err = tz.Location()
+	require.NoError(t, err)
+	require.Equal(t, loc, time.UTC)
+	require.True(t, SameLocation(loc, unified))
+
+	require.Equal(t, SetTimeZoneSQL(UnifiedTimeZone), "set @@session.time_zone = \"+0:00\";")
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("create table `test`.`test`(`a` int, `b` timestamp)", parser.New())
+	require.NoError(t, err)
+	require.True(t, NeedUnifiedTimeZone(tableInfo))
+
+	// only the timestamp values are converted, the NULL and zero values are kept.
+	row := map[string]*dbutil.ColumnData{
+		"a": {Data: []byte("2021-01-01 07:00:00")},
+		"b": {Data: []byte("2021-01-01 07:00:00")},
+	}
+	converted, err := ConvertRowTimeZone(row, tableInfo, east8, time.UTC)
+	require.NoError(t, err)
+	require.Equal(t, "2021-01-01 07:00:00", string(converted["a"].Data))
+	require.Equal(t, "2020-12-31 23:00:00", string(converted["b"].Data))
+	require.Equal(t, "2021-01-01 07:00:00", string(row["b"].Data))
+	for _, data := range []*dbutil.ColumnData{{IsNull: true}, {Data: []byte("0000-00-00 00:00:00")}} {
+		converted, err = ConvertRowTimeZone(map[string]*dbutil.ColumnData{"a": row["a"], "b": data}, tableInfo, east8, time.UTC)
+		require.NoError(t, err)
+		require.Equal(t, data, converted["b"])
+	}
+
+	tableInfo, needUnifiedTimeZone := ResetColumns(tableInfo, []string{"b"})
+	require.False(t, needUnifiedTimeZone)
+	require.False(t, NeedUnifiedTimeZone(tableInfo))
+}
+
+func TestPrivileges(t *testing.T) {
+	privs, err := parsePrivileges([]string{
+		"GRANT USAGE ON *.* TO 'diff'@'%'",
+		"GRANT SELECT ON `test`.* TO 'diff'@'%'",
+		"GRANT INSERT (`a`) ON `test`.`t` TO 'diff'@'%'",
+	})
+	require.NoError(t, err)
+	require.True(t, privs.Has(mysql.SelectPriv, false))
+	require.False(t, privs.Has(mysql.SelectPriv, true))
+	// the privileges on some columns are ignored
+	require.False(t, privs.Has(mysql.InsertPriv, false))
+	require.Equal(t, []string{"INSERT", "DELETE"}, privs.Lack([]mysql.PrivilegeType{mysql.SelectPriv, mysql.InsertPriv, mysql.DeletePriv}, false))
+	require.False(t, privs.IsSuperUser())
+
+	privs, err = parsePrivileges([]string{"GRANT ALL PRIVILEGES ON *.* TO 'root'@'%' WITH GRANT OPTION"})
+	require.NoError(t, err)
+	require.True(t, privs.Has(mysql.ReplicationSlavePriv, true))
+	require.Empty(t, privs.Lack([]mysql.PrivilegeType{mysql.SelectPriv, mysql.InsertPriv, mysql.DeletePriv}, false))
+	require.True(t, privs.IsSuperUser())
+
+	_, err = parsePrivileges([]string{"GRANT ABC"})
+	require.Error(t, err)
+}
+
+func TestSessionCharset(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	mock.ExpectQuery("SELECT @@session.character_set_results, @@session.collation_connection").WillReturnRows(sqlmock.NewRows([]string{"results", "collation"}).AddRow(nil, "utf8mb4_bin"))
+	charset, err := GetSessionCharset(context.Background(), conn)
+	require.NoError(t, err)
+	require.Equal(t, "", charset.Results)
+	require.Equal(t, "utf8mb4_bin", charset.CollationConnection)
+	require.Equal(t, map[string]string{"collation_connection": "utf8mb4_bin"}, charset.Vars())
+
+	other := &SessionCharsetInfo{Results: "UTF8MB4", CollationConnection: "utf8mb4_bin"}
+	require.False(t, charset.Equal(other))
+	require.Equal(t, map[string]string{"collation_connection": "utf8mb4_bin", "character_set_results": "UTF8MB4"}, other.Vars())
+	charset.Results = "utf8mb4"
+	require.True(t, charset.Equal(other))
+}
+
+func TestExplainQuery(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// TiDB
+	mock.ExpectQuery("EXPLAIN SELECT COUNT.*FROM `test`\\.`t` WHERE \\(`a` > \\?\\)$").WithArgs("1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "estRows", "task", "access object", "operator info"}).
+			AddRow("StreamAgg_16", "1.00", "root", "", "funcs:count(1)->Column#3").
+			AddRow("└─TableReader_17", "1.00", "root", "", "data:StreamAgg_8").
+			AddRow("  └─TableFullScan_15", "10000.00", "cop[tikv]", "table:t", "keep order:false, stats:pseudo"))
+	query := CountAndChecksumQuery("`test`.`t`", &model.TableInfo{Columns: []*model.ColumnInfo{{Name: model.NewCIStr("a")}}}, config.ChecksumCRC32, "(`a` > ?)")
+	plan, err := ExplainQuery(context.Background(), conn, query, []interface{}{"1"})
+	require.NoError(t, err)
+	require.Len(t, plan.Rows, 3)
+	require.True(t, plan.IsFullScan())
+	require.Equal(t, "the query scans the whole table, consider adding an index on `test`.`t`(`a`, `b`) in the target", SuggestIndex(plan, "test", "t", []string{"a", "b"}))
+	require.Contains(t, SuggestIndex(plan, "test", "t", nil), "not split into chunks")
+
+	// MySQL
+	mock.ExpectQuery("EXPLAIN SELECT").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "select_type", "table", "type", "key"}).
+			AddRow("1", "SIMPLE", "t", "range", "PRIMARY"))
+	plan, err = ExplainQuery(context.Background(), conn, "SELECT * FROM `test`.`t` WHERE `a` > 1", nil)
+	require.NoError(t, err)
+	require.False(t, plan.IsFullScan())
+	require.Equal(t, "id | select_type | table | type | key\n1 | SIMPLE | t | range | PRIMARY", plan.String())
+	require.Contains(t, SuggestIndex(plan, "test", "t", []string{"a"}), "decreasing the chunk-size")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDiskSpace(t *testing.T) {
+	free, err := GetDiskFreeSpace(t.TempDir())
+	require.NoError(t, err)
+	require.Greater(t, free, uint64(0))
+	_, err = GetDiskFreeSpace("/no/such/dir")
+	require.Error(t, err)
+
+	require.True(t, IsNoSpaceError(errors.Trace(&os.PathError{Op: "write", Path: "a.sql", Err: syscall.ENOSPC})))
+	require.True(t, IsNoSpaceError(syscall.ENOSPC))
+	require.False(t, IsNoSpaceError(&os.PathError{Op: "write", Path: "a.sql", Err: syscall.EACCES}))
+	require.False(t, IsNoSpaceError(nil))
+}
+
+func TestLargeColumns(t *testing.T) {
+	createTableSQL := "create table `test`.`test`(`a` int, `b` text, `c` blob, `d` varchar(10), primary key(`a`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	largeColumns := GetLargeColumns(tableInfo)
+	require.Equal(t, []string{"b", "c"}, largeColumns)
+
+	query, orderKeyCols := GetTableRowsQueryFormat("test", "test", tableInfo, "", largeColumns)
+	require.Equal(t, "SELECT /*!40001 SQL_NO_CACHE */ `a`, MD5(`b`) AS `b`, MD5(`c`) AS `c`, `d` FROM `test`.`test` WHERE %s ORDER BY `a`", query)
+	require.Equal(t, "a", orderKeyCols[0].Name.O)
+
+	// the rows can't be located without primary key or unique key
+	createTableSQL = "create table `test`.`test`(`a` int, `b` text)"
+	tableInfo, err = dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	require.Nil(t, GetLargeColumns(tableInfo))
+
+	// the large column in the unique key is compared by the values
+	createTableSQL = "create table `test`.`test`(`a` int, `b` text, `c` text, unique key uk(`b`(10)))"
+	tableInfo, err = dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, GetLargeColumns(tableInfo))
+}
+
+func TestStaleRead(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	require.Equal(t, "`test`.`test`", StaleTableName("test", "test", ""))
+	require.Equal(t, "`test`.`test` AS OF TIMESTAMP TIDB_PARSE_TSO(386902609362944000)", StaleTableName("test", "test", "386902609362944000"))
+	require.Equal(t, "`test`.`test` AS OF TIMESTAMP '2016-10-08 16:45:26'", StaleTableName("test", "test", "2016-10-08 16:45:26"))
+	require.Equal(t, "AS OF TIMESTAMP 'a''b'", AsOfTimestampClause("a'b"))
+
+	createTableSQL := "create table `test`.`test`(`a` int, `b` varchar(10), primary key(`a`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL, parser.New())
+	require.NoError(t, err)
+	query, _ := GetStaleTableRowsQueryFormat("test", "test", "2016-10-08 16:45:26", tableInfo, "", nil)
+	require.Equal(t, "SELECT /*!40001 SQL_NO_CACHE */ `a`, `b` FROM `test`.`test` AS OF TIMESTAMP '2016-10-08 16:45:26' WHERE %s ORDER BY `a`", query)
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	mock.ExpectQuery("SELECT COUNT.*FROM `test`\\.`test` AS OF TIMESTAMP TIDB_PARSE_TSO\\(123\\) WHERE \\[23 45\\].*").WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"CNT", "CHECKSUM"}).AddRow(12, 34))
+	count, checksum, err := GetStaleCountAndChecksum(ctx, conn, "test", "test", "123", tableInfo, config.ChecksumCRC32, "[23 45]", []interface{}{"1"})
+	require.NoError(t, err)
+	require.Equal(t, int64(12), count)
+	require.Equal(t, int64(34), checksum)
+
+	mock.ExpectExec("SET @@session.tidb_snapshot = \\?").WithArgs("123").WillReturnError(errors.New("tidb_snapshot is restricted"))
+	require.Contains(t, CheckTiDBSnapshotAllowed(ctx, conn, "123").Error(), "tidb_snapshot is restricted")
+	mock.ExpectExec("SET @@session.tidb_snapshot = \\?").WithArgs("123").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET @@session.tidb_snapshot = ''").WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, CheckTiDBSnapshotAllowed(ctx, conn, "123"))
+
+	mock.ExpectQuery("SELECT 1 FROM `mysql`\\.`tidb` AS OF TIMESTAMP TIDB_PARSE_TSO\\(123\\) LIMIT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	require.NoError(t, CheckAsOfTimestampAllowed(ctx, conn, "123"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLatestSyncPoint(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	mock.ExpectQuery("SELECT primary_ts, secondary_ts FROM `tidb_cdc`\\.`syncpoint_v1` WHERE changefeed = \\? ORDER BY .* LIMIT 1").
+		WithArgs("cf").WillReturnRows(sqlmock.NewRows([]string{"primary_ts", "secondary_ts"}).AddRow("434203468585484289", "434203468772392961"))
+	primaryTS, secondaryTS, err := GetLatestSyncPoint(ctx, conn, "", "cf")
+	require.NoError(t, err)
+	require.Equal(t, "434203468585484289", primaryTS)
+	require.Equal(t, "434203468772392961", secondaryTS)
+
+	mock.ExpectQuery("SELECT primary_ts, secondary_ts FROM `tidb_cdc`\\.`syncpoint_v1` WHERE changefeed = \\? AND ticdc_cluster_id = \\? ORDER BY .* LIMIT 1").
+		WithArgs("cf", "default").WillReturnRows(sqlmock.NewRows([]string{"primary_ts", "secondary_ts"}))
+	_, _, err = GetLatestSyncPoint(ctx, conn, "default", "cf")
+	require.Contains(t, err.Error(), "no syncpoint of changefeed cf is found")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetSnapshotTime(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	mock.ExpectQuery("SELECT NOW\\(\\)").WillReturnRows(sqlmock.NewRows([]string{"NOW()"}).AddRow("2022-01-02 03:04:05"))
+	snapshotTime, err := GetSnapshotTime(ctx, conn, "")
+	require.NoError(t, err)
+	require.Equal(t, "2022-01-02 03:04:05", snapshotTime)
+
+	mock.ExpectQuery("SELECT TIDB_PARSE_TSO\\(\\?\\)").WithArgs("386902609362944000").WillReturnRows(sqlmock.NewRows([]string{"TIDB_PARSE_TSO"}).AddRow("2016-10-08 16:45:26.000"))
+	snapshotTime, err = GetSnapshotTime(ctx, conn, "386902609362944000")
+	require.NoError(t, err)
+	require.Equal(t, "2016-10-08 16:45:26.000", snapshotTime)
+
+	snapshotTime, err = GetSnapshotTime(ctx, conn, "2016-10-08 16:45:26")
+	require.NoError(t, err)
+	require.Equal(t, "2016-10-08 16:45:26", snapshotTime)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Equal(t, "(a > 1) AND (`updated_at` >= '2016-10-08 16:45:26' OR `updated_at` IS NULL)", ChangedSinceRange("a > 1", "updated_at", "2016-10-08 16:45:26"))
+}
+
+func TestRedact(t *testing.T) {
+	AddSecrets("p@ssw0rd", "abc", "")
+	require.Equal(t, "root:******@tcp(127.0.0.1:4000)/", RedactSecrets("root:p@ssw0rd@tcp(127.0.0.1:4000)/"))
+	// the short secrets are not scrubbed
+	require.Equal(t, "abc", RedactSecrets("abc"))
+
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zap.New(NewRedactCore(core)).With(zap.String("dsn", "root:p@ssw0rd@tcp(127.0.0.1:4000)/"))
+	logger.Info("connect with p@ssw0rd",
+		zap.Error(errors.New("access denied for p@ssw0rd")),
+		zap.Reflect("config", map[string]string{"password": "p@ssw0rd"}),
+		zap.Int("port", 4000))
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	require.Equal(t, "connect with ******", entries[0].Message)
+	fields := entries[0].ContextMap()
+	require.Equal(t, "root:******@tcp(127.0.0.1:4000)/", fields["dsn"])
+	require.Equal(t, "access denied for ******", fields["error"])
+	require.Equal(t, `{"password":"******"}`, fields["config"])
+	require.Equal(t, int64(4000), fields["port"])
+
+	require.False(t, HasSensitiveTables())
+	require.Equal(t, zap.Reflect("args", []interface{}{1}), RedactAnyData("args", []interface{}{1}))
+	tables, err := filter.Parse([]string{"finance.*"})
+	require.NoError(t, err)
+	SetSensitiveTables(tables)
+	defer SetSensitiveTables(nil)
+	require.True(t, IsSensitiveTable("finance", "t"))
+	require.False(t, IsSensitiveTable("test", "t"))
+	require.Equal(t, zap.String("args", RedactedValue), RedactData("finance", "t", "args", []interface{}{1}))
+	require.Equal(t, zap.Reflect("args", []interface{}{1}), RedactData("test", "t", "args", []interface{}{1}))
+	require.Equal(t, zap.String("args", RedactedValue), RedactAnyData("args", []interface{}{1}))
+}
+
+func TestIsTransientError(t *testing.T) {
+	require.False(t, IsTransientError(nil))
+	require.False(t, IsTransientError(errors.New("chaos: injected source-query-error")))
+	require.False(t, IsTransientError(context.Canceled))
+	require.False(t, IsTransientError(&gomysql.MySQLError{Number: 1146, Message: "Table 'test.t' doesn't exist"}))
+
+	require.True(t, IsTransientError(errors.Trace(driver.ErrBadConn)))
+	require.True(t, IsTransientError(gomysql.ErrInvalidConn))
+	require.True(t, IsTransientError(errors.Annotate(context.DeadlineExceeded, "checksum")))
+	require.True(t, IsTransientError(&gomysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}))
+	require.True(t, IsTransientError(&gomysql.MySQLError{Number: 9005, Message: "Region is unavailable"}))
+	require.True(t, IsTransientError(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}))
+}